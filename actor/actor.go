@@ -0,0 +1,55 @@
+// Package actor carries the principal performing an operation in a context, so that changes can be audited.
+package actor
+
+import (
+	"context"
+
+	"github.com/davidyannick/repository-pattern/domain"
+)
+
+// Unknown is the actor of a context carrying none.
+var Unknown = domain.Actor{Kind: domain.ActorUnknown}
+
+type contextKey struct{}
+
+// User returns the actor for the end user or operator with the given ID.
+func User(id string) domain.Actor {
+	return domain.Actor{Kind: domain.ActorUser, ID: id}
+}
+
+// Service returns the actor for the service or job with the given name.
+func Service(name string) domain.Actor {
+	return domain.Actor{Kind: domain.ActorService, ID: name}
+}
+
+// With returns a copy of ctx carrying the given actor.
+func With(ctx context.Context, a domain.Actor) context.Context {
+	return context.WithValue(ctx, contextKey{}, a)
+}
+
+// FromContext returns the actor of ctx, if any.
+func FromContext(ctx context.Context) (domain.Actor, bool) {
+	a, ok := ctx.Value(contextKey{}).(domain.Actor)
+	return a, ok && a.Kind != ""
+}
+
+// Of returns the actor of ctx, or Unknown.
+func Of(ctx context.Context) domain.Actor {
+	if a, ok := FromContext(ctx); ok {
+		return a
+	}
+	return Unknown
+}
+
+type scopeKey struct{}
+
+// WithScope returns a copy of ctx restricting its actor to the given permissions, as API keys do.
+func WithScope(ctx context.Context, permissions []domain.Permission) context.Context {
+	return context.WithValue(ctx, scopeKey{}, permissions)
+}
+
+// Scope returns the permissions the actor of ctx is restricted to, if it is restricted.
+func Scope(ctx context.Context) ([]domain.Permission, bool) {
+	permissions, ok := ctx.Value(scopeKey{}).([]domain.Permission)
+	return permissions, ok
+}
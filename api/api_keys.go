@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/google/uuid"
+)
+
+type apiKeyRequest struct {
+	Name           string              `json:"name"`
+	UserID         *uuid.UUID          `json:"user_id"`
+	ServiceAccount string              `json:"service_account"`
+	Permissions    []domain.Permission `json:"permissions"`
+	ExpiresAt      *time.Time          `json:"expires_at"`
+}
+
+// apiKeyResponse is a created API key along with the key itself, only ever returned at creation.
+type apiKeyResponse struct {
+	*domain.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeyHandler serves the API key endpoints. Like UserHandler, it leaves permission checks to the service.
+type APIKeyHandler struct {
+	users *service.UserService
+}
+
+// NewAPIKeyHandler creates an APIKeyHandler over users.
+func NewAPIKeyHandler(users *service.UserService) *APIKeyHandler {
+	return &APIKeyHandler{users: users}
+}
+
+// Register mounts GET and POST /api-keys and DELETE /api-keys/{id} on the given mux.
+func (h *APIKeyHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api-keys", h.List)
+	mux.HandleFunc("POST /api-keys", h.Create)
+	mux.HandleFunc("DELETE /api-keys/{id}", h.Revoke)
+}
+
+// List returns every API key of the tenant.
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.users.ListAPIKeys(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// Create creates an API key and returns it, with the key itself.
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	created, key, err := h.users.CreateAPIKey(r.Context(), domain.APIKey{
+		Name:           req.Name,
+		UserID:         req.UserID,
+		ServiceAccount: req.ServiceAccount,
+		Permissions:    req.Permissions,
+		ExpiresAt:      req.ExpiresAt,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, apiKeyResponse{APIKey: created, Key: key})
+}
+
+// Revoke revokes an API key.
+func (h *APIKeyHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid api key id"})
+		return
+	}
+	if err := h.users.RevokeAPIKey(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,92 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rejectTokens is a TokenVerifier rejecting every access token.
+type rejectTokens struct{}
+
+func (rejectTokens) Verify(string) (auth.Claims, error) {
+	return auth.Claims{}, auth.ErrInvalidToken
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	users := service.NewUserService(repo, service.WithAuthorization(repo), service.WithAPIKeys(repo))
+	system := actor.With(ctx, actor.Service("test"))
+	admin, err := users.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, users.SetRoles(system, admin.ID, domain.RoleAdmin))
+
+	keys := http.NewServeMux()
+	api.NewAPIKeyHandler(users).Register(keys)
+	manage := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequestWithContext(actor.With(ctx, actor.User(admin.ID.String())), method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		keys.ServeHTTP(rec, req)
+		return rec
+	}
+	protected := http.NewServeMux()
+	api.NewUserHandler(users).Register(protected)
+	handler := api.RequireAuth(rejectTokens{}, api.WithAPIKeys(users))(protected)
+	call := func(key, method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequestWithContext(t.Context(), method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set(api.TenantHeader, "acme")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := manage(http.MethodPost, "/api-keys", `{"name":"reports","service_account":"reports","permissions":["users:everything"]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = manage(http.MethodPost, "/api-keys", `{"name":"reports","service_account":"reports","permissions":["users:read"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var created struct {
+		ID     string `json:"id"`
+		Prefix string `json:"prefix"`
+		Key    string `json:"key"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix+"_"))
+
+	rec = manage(http.MethodGet, "/api-keys", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), created.Prefix)
+	assert.NotContains(t, rec.Body.String(), created.Key, "keys are only shown at creation")
+
+	rec = call(created.Key, http.MethodGet, "/users")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = call(created.Key, http.MethodDelete, "/users/"+admin.ID.String())
+	assert.Equal(t, http.StatusForbidden, rec.Code, "the key is scoped to users:read")
+	rec = call(created.Key+"x", http.MethodGet, "/users")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = call("not.an.api.key", http.MethodGet, "/users")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "other tokens are left to the verifier")
+
+	rec = manage(http.MethodDelete, "/api-keys/"+created.ID, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = manage(http.MethodDelete, "/api-keys/"+created.ID, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = call(created.Key, http.MethodGet, "/users")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
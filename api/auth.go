@@ -0,0 +1,247 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/domain"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+)
+
+// TenantHeader carries the tenant of the requests made before authenticating, such as logins.
+// Authenticated requests take their tenant from their access token instead.
+const TenantHeader = "X-Tenant-ID"
+
+// maxBodySize bounds the JSON bodies of requests.
+const maxBodySize = 1 << 12
+
+// Authenticator checks the password of a user and verifies emails, as UserService does.
+type Authenticator interface {
+	Authenticate(ctx context.Context, email, password string) (*domain.User, error)
+	VerifyEmail(ctx context.Context, token string) (*domain.User, error)
+}
+
+// TokenVerifier returns the claims of a valid access token, as auth.Issuer does.
+type TokenVerifier interface {
+	Verify(accessToken string) (auth.Claims, error)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type verifyRequest struct {
+	Token string `json:"token"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// AuthHandler serves the login, refresh, logout and email verification endpoints.
+type AuthHandler struct {
+	users  Authenticator
+	issuer *auth.Issuer
+}
+
+// NewAuthHandler creates an AuthHandler checking passwords with users and issuing tokens with issuer.
+func NewAuthHandler(users Authenticator, issuer *auth.Issuer) *AuthHandler {
+	return &AuthHandler{users: users, issuer: issuer}
+}
+
+// Register mounts POST /auth/login, /auth/refresh, /auth/logout and /auth/verify on the given mux.
+func (h *AuthHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /auth/login", h.Login)
+	mux.HandleFunc("POST /auth/refresh", h.Refresh)
+	mux.HandleFunc("POST /auth/logout", h.Logout)
+	mux.HandleFunc("POST /auth/verify", h.Verify)
+}
+
+// Login exchanges an email and password for tokens.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	ctx := requestTenant(r)
+	user, err := h.users.Authenticate(ctx, req.Email, req.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "invalid email or password"})
+		return
+	}
+	if errors.Is(err, service.ErrUserInactive) {
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: service.ErrUserInactive.Error()})
+		return
+	}
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	tokens, err := h.issuer.Issue(ctx, user.ID)
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeTokens(w, tokens)
+}
+
+// Refresh exchanges a refresh token for new tokens. The refresh token cannot be used again.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	tokens, err := h.issuer.Refresh(requestTenant(r), req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrTokenExpired) {
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	writeTokens(w, tokens)
+}
+
+// Logout revokes a refresh token. Access tokens already issued stay valid until they expire.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	err := h.issuer.Revoke(requestTenant(r), req.RefreshToken)
+	if err != nil && !errors.Is(err, auth.ErrInvalidToken) {
+		internalError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Verify activates the pending user of a verification token and returns it.
+func (h *AuthHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	var req verifyRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	user, err := h.users.VerifyEmail(requestTenant(r), req.Token)
+	switch {
+	case errors.Is(err, service.ErrInvalidVerificationToken):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: service.ErrInvalidVerificationToken.Error()})
+	case err != nil:
+		writeError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, user)
+	}
+}
+
+// APIKeyAuthenticator returns the active API key matching a key, as UserService does.
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*domain.APIKey, error)
+}
+
+// AuthOption configures RequireAuth.
+type AuthOption func(*authConfig)
+
+type authConfig struct {
+	apiKeys APIKeyAuthenticator
+}
+
+// WithAPIKeys makes RequireAuth also accept API keys as bearer tokens, checked by keys. As with logins, the tenant
+// of requests made with an API key is the one of their TenantHeader.
+func WithAPIKeys(keys APIKeyAuthenticator) AuthOption {
+	return func(c *authConfig) {
+		c.apiKeys = keys
+	}
+}
+
+// RequireAuth returns a middleware rejecting requests without a valid "Authorization: Bearer" access token.
+// The tenant of the token and its user, as the actor, are put in the context of the requests it lets through.
+func RequireAuth(verifier TokenVerifier, opts ...AuthOption) func(http.Handler) http.Handler {
+	var cfg authConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "missing bearer token"})
+				return
+			}
+			token = strings.TrimSpace(token)
+			if cfg.apiKeys != nil && auth.IsAPIKey(token) {
+				serveWithAPIKey(w, r, cfg.apiKeys, token, next)
+				return
+			}
+			claims, err := verifier.Verify(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeJSON(w, http.StatusUnauthorized, errorResponse{Error: err.Error()})
+				return
+			}
+			ctx := tenant.WithID(r.Context(), claims.Tenant)
+			ctx = actor.With(ctx, actor.User(claims.Subject))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// serveWithAPIKey serves r with next if key is valid, with the owner of the key as the actor, restricted to
+// the scope of the key.
+func serveWithAPIKey(w http.ResponseWriter, r *http.Request, keys APIKeyAuthenticator, key string, next http.Handler) {
+	ctx := requestTenant(r)
+	apiKey, err := keys.AuthenticateAPIKey(ctx, key)
+	if errors.Is(err, service.ErrInvalidAPIKey) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	ctx = actor.With(ctx, apiKey.Actor())
+	ctx = actor.WithScope(ctx, apiKey.Permissions)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requestTenant returns the context of r scoped to the tenant of its TenantHeader, or the default tenant.
+func requestTenant(r *http.Request) context.Context {
+	id := r.Header.Get(TenantHeader)
+	if id == "" {
+		id = tenant.Default
+	}
+	return tenant.WithID(r.Context(), id)
+}
+
+// decodeBody decodes the JSON body of r into v, or writes a 400 response and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return false
+	}
+	return true
+}
+
+func writeTokens(w http.ResponseWriter, tokens *auth.Tokens) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, tokens)
+}
+
+func internalError(w http.ResponseWriter, err error) {
+	log.Printf("Error handling request: %v", err)
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: http.StatusText(http.StatusInternalServerError)})
+}
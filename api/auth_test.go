@@ -0,0 +1,143 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/mail"
+	"github.com/davidyannick/repository-pattern/password"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type authServer struct {
+	t       *testing.T
+	handler http.Handler
+}
+
+func newAuthServer(t *testing.T) (*authServer, *domain.User) {
+	t.Helper()
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	hasher := password.NewHasher(password.WithArgon2id(password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}))
+	users := service.NewUserService(repo, service.WithCredentials(repo, hasher))
+	user, err := users.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, users.SetPassword(ctx, user.ID, "correct horse battery staple"))
+
+	key, err := auth.NewHS256Key(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	issuer := auth.NewIssuer(key, repo, repo)
+
+	mux := http.NewServeMux()
+	api.NewAuthHandler(users, issuer).Register(mux)
+	// /users/me echoes the principal found in the context.
+	mux.Handle("GET /users/me", api.RequireAuth(issuer)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID, _ := tenant.FromContext(r.Context())
+		_ = json.NewEncoder(w).Encode(map[string]string{"tenant": tenantID, "actor": actor.Of(r.Context()).ID})
+	})))
+	return &authServer{t: t, handler: mux}, user
+}
+
+func (s *authServer) do(method, path string, body any, headers map[string]string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(s.t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequestWithContext(s.t.Context(), method, path, &buf)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	s.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthHandler(t *testing.T) {
+	server, user := newAuthServer(t)
+	acme := map[string]string{api.TenantHeader: "acme"}
+
+	rec := server.do(http.MethodPost, "/auth/login", map[string]string{"email": "john@example.com", "password": "wrong password!"}, acme)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = server.do(http.MethodPost, "/auth/login", map[string]string{"email": "john@example.com", "password": "correct horse battery staple"}, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "the user belongs to another tenant than the default one")
+
+	rec = server.do(http.MethodPost, "/auth/login", map[string]string{"email": "john@example.com", "password": "correct horse battery staple"}, acme)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var tokens auth.Tokens
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&tokens))
+
+	rec = server.do(http.MethodGet, "/users/me", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	rec = server.do(http.MethodGet, "/users/me", nil, map[string]string{"Authorization": "Bearer nope"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = server.do(http.MethodGet, "/users/me", nil, map[string]string{"Authorization": "Bearer " + tokens.AccessToken})
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"tenant":"acme","actor":"`+user.ID.String()+`"}`, rec.Body.String())
+
+	rec = server.do(http.MethodPost, "/auth/refresh", map[string]string{"refresh_token": tokens.RefreshToken}, acme)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var refreshed auth.Tokens
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&refreshed))
+
+	rec = server.do(http.MethodPost, "/auth/logout", map[string]string{"refresh_token": refreshed.RefreshToken}, acme)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = server.do(http.MethodPost, "/auth/refresh", map[string]string{"refresh_token": refreshed.RefreshToken}, acme)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = server.do(http.MethodPost, "/auth/login", "not an object", acme)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAuthHandler_Verify(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	hasher := password.NewHasher(password.WithArgon2id(password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}))
+	var mails bytes.Buffer
+	users := service.NewUserService(repo, service.WithCredentials(repo, hasher),
+		service.WithEmailVerification(repo, mail.NewWriterSender(&mails), "noreply@example.com", 0))
+	user, err := users.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, users.SetPassword(ctx, user.ID, "correct horse battery staple"))
+	fields := strings.Fields(mails.String())
+	require.NotEmpty(t, fields)
+	token := fields[len(fields)-1]
+
+	key, err := auth.NewHS256Key(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	mux := http.NewServeMux()
+	api.NewAuthHandler(users, auth.NewIssuer(key, repo, repo)).Register(mux)
+	server := &authServer{t: t, handler: mux}
+	acme := map[string]string{api.TenantHeader: "acme"}
+	login := map[string]string{"email": "john@example.com", "password": "correct horse battery staple"}
+
+	rec := server.do(http.MethodPost, "/auth/login", login, acme)
+	assert.Equal(t, http.StatusForbidden, rec.Code, "pending users cannot log in")
+
+	rec = server.do(http.MethodPost, "/auth/verify", map[string]string{"token": "nope"}, acme)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = server.do(http.MethodPost, "/auth/verify", map[string]string{"token": token}, acme)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var verified domain.User
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&verified))
+	assert.Equal(t, domain.StatusActive, verified.Status)
+	rec = server.do(http.MethodPost, "/auth/verify", map[string]string{"token": token}, acme)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = server.do(http.MethodPost, "/auth/login", login, acme)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReplaySize        = 1000
+	defaultHeartbeatInterval = 15 * time.Second
+
+	// eventChange carries a repository.UserChange; eventReset tells the client that it missed changes
+	// and should reload its state before applying the next ones.
+	eventChange = "change"
+	eventReset  = "reset"
+)
+
+// streamEvent is a change kept in the replay buffer.
+type streamEvent struct {
+	seq    uint64
+	op     repository.ChangeOp
+	tenant string
+	user   uuid.UUID
+	data   []byte
+	gap    bool
+}
+
+// ChangeStream serves the user change feed of a repository as Server-Sent Events.
+// A single watch on the repository feeds a bounded replay buffer shared by every client, so that a client
+// reconnecting with Last-Event-ID receives the changes it missed, or a reset event when they are no longer buffered.
+// Clients need the users:read permission and only receive the changes of their tenant. Once a user is deleted,
+// erasures included, the buffered changes of the user only carry its ID.
+type ChangeStream struct {
+	watcher   repository.Watcher
+	users     *service.UserService
+	replay    int
+	heartbeat time.Duration
+	// epoch distinguishes the event IDs of this process from those of a previous run.
+	epoch string
+
+	mu      sync.Mutex
+	events  []streamEvent
+	lastSeq uint64
+	waiters map[chan struct{}]struct{}
+
+	// closed is closed by Close to end the open streams.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// ChangeStreamOption configures a ChangeStream.
+type ChangeStreamOption func(*ChangeStream)
+
+// WithReplaySize sets the number of changes kept for clients resuming with Last-Event-ID.
+func WithReplaySize(n int) ChangeStreamOption {
+	return func(s *ChangeStream) {
+		s.replay = n
+	}
+}
+
+// WithHeartbeat sets the interval between the comments sent to keep idle connections open.
+func WithHeartbeat(d time.Duration) ChangeStreamOption {
+	return func(s *ChangeStream) {
+		s.heartbeat = d
+	}
+}
+
+// NewChangeStream creates a ChangeStream over watcher, checking the permissions of clients with users.
+// Run must be called for changes to flow.
+func NewChangeStream(watcher repository.Watcher, users *service.UserService, opts ...ChangeStreamOption) *ChangeStream {
+	s := &ChangeStream{
+		watcher:   watcher,
+		users:     users,
+		replay:    defaultReplaySize,
+		heartbeat: defaultHeartbeatInterval,
+		epoch:     strconv.FormatInt(time.Now().UnixNano(), 36),
+		waiters:   make(map[chan struct{}]struct{}),
+		closed:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register mounts GET /users/changes on the given mux.
+func (s *ChangeStream) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /users/changes", s.ServeHTTP)
+}
+
+// Run watches the repository and buffers its changes until ctx is canceled.
+func (s *ChangeStream) Run(ctx context.Context) {
+	for change := range s.watcher.Watch(ctx) {
+		if change.Op == repository.ChangeGap {
+			s.publish(streamEvent{gap: true})
+			continue
+		}
+		if change.Op == repository.ChangeDelete {
+			change.User = domain.User{ID: change.User.ID}
+		}
+		data, err := json.Marshal(change)
+		if err != nil {
+			continue
+		}
+		s.publish(streamEvent{op: change.Op, tenant: change.TenantID, user: change.User.ID, data: data})
+	}
+}
+
+// Close ends every open stream. Streams only end when their client disconnects otherwise, so Close should be
+// registered with http.Server.RegisterOnShutdown for Shutdown not to wait for them.
+func (s *ChangeStream) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
+
+func (s *ChangeStream) publish(event streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.op == repository.ChangeDelete {
+		// Strip the personal data of the deleted user from the changes still buffered.
+		for i, buffered := range s.events {
+			if buffered.user != event.user || buffered.op == repository.ChangeDelete {
+				continue
+			}
+			data, err := json.Marshal(repository.UserChange{Op: buffered.op, TenantID: buffered.tenant, User: domain.User{ID: buffered.user}})
+			if err != nil {
+				continue
+			}
+			s.events[i].data = data
+		}
+	}
+	s.lastSeq++
+	event.seq = s.lastSeq
+	s.events = append(s.events, event)
+	if len(s.events) > s.replay {
+		s.events = s.events[len(s.events)-s.replay:]
+	}
+	for waiter := range s.waiters {
+		select {
+		case waiter <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// since returns the buffered events after seq. When some of them are no longer buffered, or seq is unknown,
+// it returns no events, missed set and the sequence number of the latest event.
+func (s *ChangeStream) since(seq uint64) (events []streamEvent, missed bool, head uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seq > s.lastSeq {
+		return nil, true, s.lastSeq
+	}
+	for i, event := range s.events {
+		if event.seq > seq {
+			if event.seq != seq+1 {
+				return nil, true, s.lastSeq
+			}
+			return append([]streamEvent(nil), s.events[i:]...), false, s.lastSeq
+		}
+	}
+	return nil, false, s.lastSeq
+}
+
+// ServeHTTP streams the changes of the tenant of the request to the client until it disconnects or the stream is closed.
+// Gaps concern every tenant and are sent to every client.
+func (s *ChangeStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenantID, err := tenant.Require(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := s.users.Authorize(r.Context(), domain.PermUsersRead); err != nil {
+		writeError(w, err)
+		return
+	}
+	rc := http.NewResponseController(w)
+
+	waiter := make(chan struct{}, 1)
+	s.mu.Lock()
+	s.waiters[waiter] = struct{}{}
+	last := s.lastSeq
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiters, waiter)
+		s.mu.Unlock()
+	}()
+
+	resume := r.Header.Get("Last-Event-ID")
+	if resume != "" {
+		seq, ok := s.parseEventID(resume)
+		if ok {
+			last = seq
+		} else {
+			// An ID from a previous run or an unknown one: start from now, after telling the client.
+			last = ^uint64(0)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, missed, head := s.since(last)
+		if missed {
+			last = head
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: {}\n\n", s.eventID(last), eventReset); err != nil {
+				return
+			}
+		}
+		for _, event := range events {
+			var err error
+			switch {
+			case event.gap:
+				_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: {}\n\n", s.eventID(event.seq), eventReset)
+			case event.tenant == tenantID:
+				_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", s.eventID(event.seq), eventChange, event.data)
+			}
+			if err != nil {
+				return
+			}
+			last = event.seq
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			return
+		case <-waiter:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *ChangeStream) eventID(seq uint64) string {
+	return s.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+func (s *ChangeStream) parseEventID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != s.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
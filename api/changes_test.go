@@ -0,0 +1,300 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanWatcher is a Watcher fed by the test.
+type chanWatcher chan repository.UserChange
+
+func (w chanWatcher) Watch(ctx context.Context) <-chan repository.UserChange {
+	out := make(chan repository.UserChange)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change := <-w:
+				select {
+				case out <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// sseClient reads the events of a change stream, skipping comments.
+type sseClient struct {
+	t      *testing.T
+	events chan sseEvent
+	lines  chan string
+}
+
+// tenantHeader names the tenant of a request to the test server, standing in for RequireAuth.
+const tenantHeader = "X-Test-Tenant"
+
+func connect(t *testing.T, url, lastEventID string) *sseClient {
+	t.Helper()
+	return connectAs(t, "acme", url, lastEventID)
+}
+
+func connectAs(t *testing.T, tenantID, url, lastEventID string) *sseClient {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set(tenantHeader, tenantID)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	c := &sseClient{t: t, events: make(chan sseEvent, 16), lines: make(chan string, 16)}
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		var current sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			c.lines <- line
+			switch {
+			case line == "":
+				if current.event != "" {
+					c.events <- current
+				}
+				current = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				current.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				current.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				current.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return c
+}
+
+func (c *sseClient) next() sseEvent {
+	c.t.Helper()
+	select {
+	case event := <-c.events:
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(c.t, "no event received")
+		return sseEvent{}
+	}
+}
+
+func startChangeStream(t *testing.T, opts ...api.ChangeStreamOption) (chanWatcher, *httptest.Server) {
+	t.Helper()
+	return startChangeStreamFor(t, service.NewUserService(repository.NewMemoryRepository()), opts...)
+}
+
+func startChangeStreamFor(t *testing.T, users *service.UserService, opts ...api.ChangeStreamOption) (chanWatcher, *httptest.Server) {
+	t.Helper()
+	watcher := make(chanWatcher)
+	stream := api.NewChangeStream(watcher, users, opts...)
+	ctx, cancel := context.WithCancel(context.Background())
+	go stream.Run(ctx)
+
+	mux := http.NewServeMux()
+	stream.Register(mux)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), r.Header.Get(tenantHeader))))
+	}))
+	t.Cleanup(func() {
+		server.CloseClientConnections()
+		server.Close()
+		cancel()
+	})
+	return watcher, server
+}
+
+func userChange(op repository.ChangeOp, name string) repository.UserChange {
+	return repository.UserChange{
+		Op:       op,
+		TenantID: "acme",
+		User:     domain.User{ID: uuid.New(), Name: name, Email: name + "@example.com"},
+	}
+}
+
+func TestChangeStream_StreamsChanges(t *testing.T) {
+	watcher, server := startChangeStream(t)
+	client := connect(t, server.URL+"/users/changes", "")
+
+	created := userChange(repository.ChangeInsert, "alice")
+	watcher <- created
+	watcher <- userChange(repository.ChangeDelete, "bob")
+
+	event := client.next()
+	assert.Equal(t, "change", event.event)
+	var change repository.UserChange
+	require.NoError(t, json.Unmarshal([]byte(event.data), &change))
+	assert.Equal(t, created, change)
+
+	event = client.next()
+	assert.Equal(t, "change", event.event)
+	assert.Contains(t, event.data, `"op":"delete"`)
+}
+
+func TestChangeStream_Resume(t *testing.T) {
+	watcher, server := startChangeStream(t)
+	first := connect(t, server.URL+"/users/changes", "")
+
+	watcher <- userChange(repository.ChangeInsert, "alice")
+	seen := first.next()
+	watcher <- userChange(repository.ChangeInsert, "bob")
+	watcher <- userChange(repository.ChangeInsert, "carol")
+	first.next()
+	first.next()
+
+	// Reconnecting after alice replays bob and carol
+	resumed := connect(t, server.URL+"/users/changes", seen.id)
+	assert.Contains(t, resumed.next().data, "bob")
+	assert.Contains(t, resumed.next().data, "carol")
+}
+
+func TestChangeStream_ResumeTooOld(t *testing.T) {
+	watcher, server := startChangeStream(t, api.WithReplaySize(1))
+	first := connect(t, server.URL+"/users/changes", "")
+
+	watcher <- userChange(repository.ChangeInsert, "alice")
+	seen := first.next()
+	watcher <- userChange(repository.ChangeInsert, "bob")
+	first.next()
+	watcher <- userChange(repository.ChangeInsert, "carol")
+	first.next()
+
+	// bob is no longer buffered: the client is told to reload
+	resumed := connect(t, server.URL+"/users/changes", seen.id)
+	assert.Equal(t, "reset", resumed.next().event)
+
+	// An ID from another run also resets
+	other := connect(t, server.URL+"/users/changes", "abc-1")
+	assert.Equal(t, "reset", other.next().event)
+}
+
+func TestChangeStream_GapResets(t *testing.T) {
+	watcher, server := startChangeStream(t)
+	client := connect(t, server.URL+"/users/changes", "")
+
+	watcher <- repository.UserChange{Op: repository.ChangeGap}
+
+	assert.Equal(t, "reset", client.next().event)
+}
+
+func TestChangeStream_Heartbeat(t *testing.T) {
+	_, server := startChangeStream(t, api.WithHeartbeat(10*time.Millisecond))
+	client := connect(t, server.URL+"/users/changes", "")
+
+	require.Eventually(t, func() bool {
+		select {
+		case line := <-client.lines:
+			return line == ": heartbeat"
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestChangeStream_RequiresUsersRead(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, server := startChangeStreamFor(t, service.NewUserService(repo, service.WithAuthorization(repo)))
+
+	// The request carries no actor, as when RequireAuth is not in front of the stream
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+"/users/changes", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set(tenantHeader, "acme")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestChangeStream_DeletionStripsBufferedChanges(t *testing.T) {
+	watcher, server := startChangeStream(t)
+	first := connect(t, server.URL+"/users/changes", "")
+
+	watcher <- userChange(repository.ChangeInsert, "bob")
+	seen := first.next()
+	alice := userChange(repository.ChangeInsert, "alice")
+	watcher <- alice
+	first.next()
+	deleted := alice
+	deleted.Op = repository.ChangeDelete
+	watcher <- deleted
+	first.next()
+
+	// Replaying alice's changes no longer discloses her name or email
+	resumed := connect(t, server.URL+"/users/changes", seen.id)
+	for _, op := range []repository.ChangeOp{repository.ChangeInsert, repository.ChangeDelete} {
+		var change repository.UserChange
+		require.NoError(t, json.Unmarshal([]byte(resumed.next().data), &change))
+		assert.Equal(t, repository.UserChange{Op: op, TenantID: "acme", User: domain.User{ID: alice.User.ID}}, change)
+	}
+}
+
+func TestChangeStream_FiltersByTenant(t *testing.T) {
+	watcher, server := startChangeStream(t)
+	acme := connect(t, server.URL+"/users/changes", "")
+	globex := connectAs(t, "globex", server.URL+"/users/changes", "")
+
+	other := userChange(repository.ChangeInsert, "bob")
+	other.TenantID = "globex"
+	watcher <- other
+	watcher <- userChange(repository.ChangeInsert, "alice")
+
+	assert.Contains(t, acme.next().data, "alice", "changes of other tenants are skipped")
+	assert.Contains(t, globex.next().data, "bob")
+	select {
+	case event := <-globex.events:
+		assert.Failf(t, "unexpected event", "%+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestChangeStream_CloseOnShutdown(t *testing.T) {
+	stream := api.NewChangeStream(make(chanWatcher), service.NewUserService(repository.NewMemoryRepository()))
+	mux := http.NewServeMux()
+	stream.Register(mux)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), r.Header.Get(tenantHeader))))
+	}))
+	server.Config.RegisterOnShutdown(stream.Close)
+	server.Start()
+	t.Cleanup(server.Close)
+	connect(t, server.URL+"/users/changes", "")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, server.Config.Shutdown(ctx))
+	assert.Less(t, time.Since(start), time.Second, "the open stream must not hold the shutdown")
+}
@@ -0,0 +1,103 @@
+// Package api exposes the application over HTTP.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/repository"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+
+	defaultHealthTimeout = 2 * time.Second
+)
+
+// CheckResult is the outcome of a single dependency check.
+type CheckResult struct {
+	Status  string                   `json:"status"`
+	Error   string                   `json:"error,omitempty"`
+	Details repository.HealthDetails `json:"details,omitempty"`
+}
+
+// HealthResponse is the body returned by the health endpoints.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// HealthHandler serves the liveness and readiness endpoints.
+type HealthHandler struct {
+	checks  map[string]repository.HealthChecker
+	timeout time.Duration
+}
+
+// NewHealthHandler creates a HealthHandler checking the given dependencies, keyed by name.
+func NewHealthHandler(checks map[string]repository.HealthChecker) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: defaultHealthTimeout}
+}
+
+// Register mounts /healthz and /readyz on the given mux.
+func (h *HealthHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /healthz", h.Liveness)
+	mux.HandleFunc("GET /readyz", h.Readiness)
+}
+
+// Liveness reports that the process is up. It never touches the dependencies.
+func (h *HealthHandler) Liveness(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{Status: statusOK})
+}
+
+// Readiness checks every dependency concurrently and reports 503 if any of them fails.
+func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+
+	resp := HealthResponse{Status: statusOK, Checks: make(map[string]CheckResult, len(h.checks))}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, checker := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := CheckResult{Status: statusOK}
+			details, err := checker.CheckHealth(ctx)
+			result.Details = details
+			if err != nil {
+				result.Status = statusUnavailable
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[name] = result
+			if err != nil {
+				resp.Status = statusUnavailable
+			}
+		}()
+	}
+	wg.Wait()
+
+	code := http.StatusOK
+	if resp.Status != statusOK {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, resp)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %v", err)
+	}
+}
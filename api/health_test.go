@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubChecker struct {
+	details repository.HealthDetails
+	err     error
+}
+
+func (c stubChecker) CheckHealth(context.Context) (repository.HealthDetails, error) {
+	return c.details, c.err
+}
+
+func serveHealth(t *testing.T, checks map[string]repository.HealthChecker, path string) (code int, body api.HealthResponse) {
+	t.Helper()
+	mux := http.NewServeMux()
+	api.NewHealthHandler(checks).Register(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, path, http.NoBody))
+
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return rec.Code, body
+}
+
+func TestHealthHandler_Liveness(t *testing.T) {
+	checks := map[string]repository.HealthChecker{
+		"db": stubChecker{err: errors.New("down")},
+	}
+
+	// Liveness does not depend on the database
+	code, body := serveHealth(t, checks, "/healthz")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body.Status)
+}
+
+func TestHealthHandler_Readiness(t *testing.T) {
+	checks := map[string]repository.HealthChecker{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": stubChecker{details: repository.HealthDetails{"quick_check": "ok"}},
+	}
+
+	code, body := serveHealth(t, checks, "/readyz")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", body.Status)
+	require.Len(t, body.Checks, 2)
+	assert.Equal(t, "ok", body.Checks["sqlite"].Status)
+	assert.Equal(t, "ok", body.Checks["sqlite"].Details["quick_check"])
+}
+
+func TestHealthHandler_Readiness_Unavailable(t *testing.T) {
+	checks := map[string]repository.HealthChecker{
+		"memory":   repository.NewMemoryRepository(),
+		"postgres": stubChecker{err: errors.New("connection refused")},
+	}
+
+	code, body := serveHealth(t, checks, "/readyz")
+
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unavailable", body.Status)
+	assert.Equal(t, "ok", body.Checks["memory"].Status)
+	assert.Equal(t, "unavailable", body.Checks["postgres"].Status)
+	assert.Equal(t, "connection refused", body.Checks["postgres"].Error)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/davidyannick/repository-pattern/api"
+
+// TracingOption configures Tracing.
+type TracingOption func(*tracingConfig)
+
+type tracingConfig struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the provider used to create spans instead of the global one.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(c *tracingConfig) {
+		c.provider = provider
+	}
+}
+
+// WithPropagator sets the propagator extracting the incoming trace context instead of the global one.
+func WithPropagator(propagator propagation.TextMapPropagator) TracingOption {
+	return func(c *tracingConfig) {
+		c.propagator = propagator
+	}
+}
+
+// Tracing returns a middleware that extracts the incoming trace context from the request headers
+// and wraps the request in a server span, so that service and repository spans share the caller's trace.
+func Tracing(next http.Handler, opts ...TracingOption) http.Handler {
+	cfg := tracingConfig{provider: otel.GetTracerProvider(), propagator: otel.GetTextMapPropagator()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	tracer := cfg.provider.Tracer(tracerName)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := cfg.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		name := r.Method + " " + r.URL.Path
+		if r.Pattern != "" {
+			name = r.Pattern
+		}
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
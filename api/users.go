@@ -0,0 +1,255 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/utils"
+	"github.com/google/uuid"
+)
+
+type userRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type statusRequest struct {
+	Status domain.UserStatus `json:"status"`
+}
+
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+type rolesRequest struct {
+	Roles []domain.Role `json:"roles"`
+}
+
+// UserHandler serves the user endpoints. It expects the tenant and actor of the requests in their context,
+// as put there by RequireAuth, and leaves permission checks to the service.
+type UserHandler struct {
+	users *service.UserService
+}
+
+// NewUserHandler creates a UserHandler over users.
+func NewUserHandler(users *service.UserService) *UserHandler {
+	return &UserHandler{users: users}
+}
+
+// Register mounts the user endpoints on the given mux.
+func (h *UserHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /users", h.List)
+	mux.HandleFunc("POST /users", h.Create)
+	mux.HandleFunc("GET /users/{id}", h.Get)
+	mux.HandleFunc("PUT /users/{id}", h.Update)
+	mux.HandleFunc("DELETE /users/{id}", h.Delete)
+	mux.HandleFunc("GET /users/{id}/roles", h.GetRoles)
+	mux.HandleFunc("PUT /users/{id}/roles", h.SetRoles)
+	mux.HandleFunc("PUT /users/{id}/status", h.SetStatus)
+	mux.HandleFunc("PUT /users/{id}/password", h.SetPassword)
+	mux.HandleFunc("POST /users/{id}/verification", h.SendVerification)
+}
+
+// List returns every user of the tenant.
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	users, err := h.users.GetAllUsers(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+// Create adds a user.
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	user := domain.User{Name: req.Name, Email: req.Email}
+	if err := utils.ValidateUser(user); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	created, err := h.users.AddUser(r.Context(), user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// Get returns a user.
+func (h *UserHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	user, err := h.users.GetUser(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Update replaces the name and email of a user.
+func (h *UserHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req userRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	user := domain.User{ID: id, Name: req.Name, Email: req.Email}
+	if err := utils.ValidateUser(user); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	updated, err := h.users.UpdateUser(r.Context(), user)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// Delete deletes a user.
+func (h *UserHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.users.DeleteUser(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetRoles returns the roles of a user.
+func (h *UserHandler) GetRoles(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	roles, err := h.users.GetRoles(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rolesRequest{Roles: roles})
+}
+
+// SetRoles replaces the roles of a user.
+func (h *UserHandler) SetRoles(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req rolesRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if err := h.users.SetRoles(r.Context(), id, req.Roles...); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetStatus changes the status of a user and returns the user.
+func (h *UserHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req statusRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	user, err := h.users.SetStatus(r.Context(), id, req.Status)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// SetPassword sets the password of a user and ends its sessions.
+func (h *UserHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req passwordRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if err := h.users.SetPassword(r.Context(), id, req.Password); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendVerification mails a new verification token to a pending user.
+func (h *UserHandler) SendVerification(w http.ResponseWriter, r *http.Request) {
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := h.users.SendVerification(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// pathID parses the {id} path value of r, or writes a 400 response and returns false.
+func pathID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid user id"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// writeError writes the response matching a service error. The details of forbidden and internal errors
+// are not disclosed.
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrForbidden):
+		writeJSON(w, http.StatusForbidden, errorResponse{Error: http.StatusText(http.StatusForbidden)})
+	case errors.Is(err, repository.ErrUserNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: repository.ErrUserNotFound.Error()})
+	case errors.Is(err, repository.ErrAPIKeyNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: repository.ErrAPIKeyNotFound.Error()})
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: repository.ErrSubscriptionNotFound.Error()})
+	case errors.Is(err, repository.ErrDeliveryNotFound):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: repository.ErrDeliveryNotFound.Error()})
+	case errors.Is(err, service.ErrVerificationDisabled):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: service.ErrVerificationDisabled.Error()})
+	case errors.Is(err, service.ErrCredentialsDisabled):
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: service.ErrCredentialsDisabled.Error()})
+	case errors.Is(err, repository.ErrEmailAlreadyExists):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: repository.ErrEmailAlreadyExists.Error()})
+	case errors.Is(err, repository.ErrUserAlreadyExists):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: repository.ErrUserAlreadyExists.Error()})
+	case errors.Is(err, service.ErrStatusTransition):
+		writeJSON(w, http.StatusConflict, errorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrWeakPassword),
+		errors.Is(err, service.ErrInvalidAPIKeyRequest), errors.Is(err, service.ErrInvalidStatus),
+		errors.Is(err, service.ErrInvalidWebhook):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+	default:
+		internalError(w, err)
+	}
+}
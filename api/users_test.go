@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserHandler(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	users := service.NewUserService(repo, service.WithAuthorization(repo))
+	system := actor.With(ctx, actor.Service("test"))
+	admin, err := users.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, users.SetRoles(system, admin.ID, domain.RoleAdmin))
+	member, err := users.AddUser(system, domain.User{Name: "Member", Email: "member@example.com"})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	api.NewUserHandler(users).Register(mux)
+	serve := func(as *domain.User, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequestWithContext(actor.With(ctx, actor.User(as.ID.String())), method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(member, http.MethodGet, "/users", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.JSONEq(t, `{"error":"Forbidden"}`, rec.Body.String())
+	rec = serve(member, http.MethodGet, "/users/"+member.ID.String(), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(member, http.MethodDelete, "/users/"+admin.ID.String(), "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = serve(member, http.MethodPut, "/users/"+member.ID.String()+"/roles", `{"roles":["admin"]}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serve(admin, http.MethodPost, "/users", `{"name":"New","email":"new@example.com"}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var created domain.User
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	rec = serve(admin, http.MethodPost, "/users", `{"name":"Dup","email":"new@example.com"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = serve(admin, http.MethodPost, "/users", `{"name":"Bad","email":"not an email"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(admin, http.MethodPut, "/users/"+created.ID.String(), `{"name":"Renamed","email":"new@example.com"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = serve(admin, http.MethodPut, "/users/"+created.ID.String()+"/roles", `{"roles":["owner"]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(admin, http.MethodPut, "/users/"+created.ID.String()+"/roles", `{"roles":["viewer"]}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = serve(admin, http.MethodGet, "/users/"+created.ID.String()+"/roles", "")
+	assert.JSONEq(t, `{"roles":["viewer"]}`, rec.Body.String())
+	rec = serve(member, http.MethodPut, "/users/"+created.ID.String()+"/status", `{"status":"suspended"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = serve(admin, http.MethodPut, "/users/"+created.ID.String()+"/status", `{"status":"banned"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(admin, http.MethodPut, "/users/"+created.ID.String()+"/status", `{"status":"pending"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	rec = serve(admin, http.MethodPut, "/users/"+created.ID.String()+"/status", `{"status":"suspended"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"status":"suspended"`)
+	rec = serve(admin, http.MethodPost, "/users/"+created.ID.String()+"/verification", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code, "emails are not verified")
+	rec = serve(admin, http.MethodDelete, "/users/"+created.ID.String(), "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = serve(admin, http.MethodGet, "/users/"+created.ID.String(), "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = serve(admin, http.MethodGet, "/users/nope", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
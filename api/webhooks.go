@@ -0,0 +1,139 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/google/uuid"
+)
+
+type webhookRequest struct {
+	URL        string             `json:"url"`
+	EventTypes []domain.EventType `json:"event_types"`
+}
+
+// webhookResponse is a created subscription along with its signing secret, only ever returned at creation.
+type webhookResponse struct {
+	*domain.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// WebhookHandler serves the webhook endpoints. Like UserHandler, it leaves permission checks to the service.
+type WebhookHandler struct {
+	webhooks *service.WebhookService
+}
+
+// NewWebhookHandler creates a WebhookHandler over webhooks.
+func NewWebhookHandler(webhooks *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+// Register mounts the webhook subscription and delivery endpoints on the given mux.
+func (h *WebhookHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /webhooks", h.List)
+	mux.HandleFunc("POST /webhooks", h.Subscribe)
+	mux.HandleFunc("DELETE /webhooks/{id}", h.Unsubscribe)
+	mux.HandleFunc("GET /webhooks/deliveries", h.ListDeliveries)
+	mux.HandleFunc("GET /webhooks/deliveries/{id}", h.GetDelivery)
+	mux.HandleFunc("POST /webhooks/deliveries/{id}/redeliver", h.Redeliver)
+}
+
+// List returns every webhook subscription.
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.webhooks.ListSubscriptions(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, subs)
+}
+
+// Subscribe creates a subscription and returns it, with its secret.
+func (h *WebhookHandler) Subscribe(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	sub, err := h.webhooks.Subscribe(r.Context(), req.URL, req.EventTypes...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, webhookResponse{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// Unsubscribe deletes a subscription along with its deliveries.
+func (h *WebhookHandler) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid subscription id"})
+		return
+	}
+	if err := h.webhooks.Unsubscribe(r.Context(), id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the delivery log, filtered by the subscription_id, status and limit query parameters.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := repository.DeliveryFilter{Status: domain.DeliveryStatus(query.Get("status"))}
+	if raw := query.Get("subscription_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid subscription id"})
+			return
+		}
+		filter.SubscriptionID = id
+	}
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid limit"})
+			return
+		}
+		filter.Limit = limit
+	}
+	deliveries, err := h.webhooks.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// GetDelivery returns a delivery.
+func (h *WebhookHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid delivery id"})
+		return
+	}
+	delivery, err := h.webhooks.GetDelivery(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// Redeliver queues a dead delivery again.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid delivery id"})
+		return
+	}
+	delivery, err := h.webhooks.Redeliver(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
@@ -0,0 +1,72 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	users := service.NewUserService(repo, service.WithAuthorization(repo))
+	system := actor.With(ctx, actor.Service("test"))
+	admin, err := users.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, users.SetRoles(system, admin.ID, domain.RoleAdmin))
+	viewer, err := users.AddUser(system, domain.User{Name: "Viewer", Email: "viewer@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, users.SetRoles(system, viewer.ID, domain.RoleViewer))
+
+	mux := http.NewServeMux()
+	api.NewWebhookHandler(service.NewWebhookService(repo, service.WithWebhookAuthorization(repo))).Register(mux)
+	call := func(as *domain.User, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequestWithContext(actor.With(ctx, actor.User(as.ID.String())), method, path, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := call(admin, http.MethodPost, "/webhooks", `{"url":"ftp://example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = call(viewer, http.MethodPost, "/webhooks", `{"url":"https://example.com/hook"}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = call(admin, http.MethodPost, "/webhooks", `{"url":"https://example.com/hook","event_types":["UserCreated"]}`)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var created struct {
+		ID     string `json:"id"`
+		Secret string `json:"secret"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.NotEmpty(t, created.Secret)
+
+	rec = call(admin, http.MethodGet, "/webhooks", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), created.ID)
+	assert.NotContains(t, rec.Body.String(), created.Secret, "secrets are only shown at creation")
+	rec = call(viewer, http.MethodGet, "/webhooks/deliveries", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = call(admin, http.MethodGet, "/webhooks/deliveries?subscription_id="+created.ID+"&limit=10", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, "[]", rec.Body.String())
+	rec = call(admin, http.MethodGet, "/webhooks/deliveries?limit=many", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = call(admin, http.MethodDelete, "/webhooks/"+created.ID, "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = call(admin, http.MethodDelete, "/webhooks/"+created.ID, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
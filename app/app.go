@@ -0,0 +1,183 @@
+// Package app manages the lifecycle of the application: servers, signals and ordered shutdown.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// ExitOK is returned by Run after a clean shutdown.
+	ExitOK = 0
+	// ExitFailure is returned by Run when a server failed or the shutdown did not complete cleanly.
+	ExitFailure = 1
+
+	defaultShutdownTimeout = 15 * time.Second
+)
+
+type server struct {
+	srv *http.Server
+	ln  net.Listener
+}
+
+type closer struct {
+	name string
+	fn   func() error
+}
+
+// App starts HTTP servers, waits for a termination signal and then shuts everything down in order:
+// servers first, draining in-flight requests, then the registered closers in reverse order.
+type App struct {
+	shutdownTimeout time.Duration
+	signals         []os.Signal
+
+	mu       sync.Mutex
+	servers  []server
+	closers  []closer
+	shutdown bool
+}
+
+// Option configures an App.
+type Option func(*App)
+
+// WithShutdownTimeout sets the deadline given to servers to drain in-flight requests.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(a *App) {
+		a.shutdownTimeout = d
+	}
+}
+
+// WithSignals overrides the signals that trigger a shutdown (SIGINT and SIGTERM by default).
+func WithSignals(signals ...os.Signal) Option {
+	return func(a *App) {
+		a.signals = signals
+	}
+}
+
+// New creates an App with the given options.
+func New(opts ...Option) *App {
+	a := &App{
+		shutdownTimeout: defaultShutdownTimeout,
+		signals:         []os.Signal{os.Interrupt, syscall.SIGTERM},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// AddServer registers an HTTP server started by Run. If ln is nil, Run listens on srv.Addr.
+func (a *App) AddServer(srv *http.Server, ln net.Listener) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.servers = append(a.servers, server{srv: srv, ln: ln})
+}
+
+// AddCloser registers a function called on shutdown, after the servers have stopped.
+// Closers run in reverse registration order, so dependencies should be registered first.
+func (a *App) AddCloser(name string, fn func() error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.closers = append(a.closers, closer{name: name, fn: fn})
+}
+
+// Run starts the servers and blocks until ctx is canceled, a shutdown signal is received or a server fails.
+// It then shuts the application down and returns the process exit code.
+func (a *App) Run(ctx context.Context) int {
+	ctx, stop := signal.NotifyContext(ctx, a.signals...)
+	defer stop()
+
+	a.mu.Lock()
+	servers := a.servers
+	a.mu.Unlock()
+
+	errCh := make(chan error, len(servers))
+	var lc net.ListenConfig
+	for _, s := range servers {
+		ln := s.ln
+		if ln == nil {
+			var err error
+			if ln, err = lc.Listen(ctx, "tcp", s.srv.Addr); err != nil {
+				log.Printf("Error listening on %s: %v", s.srv.Addr, err)
+				_ = a.Shutdown(context.Background())
+				return ExitFailure
+			}
+		}
+
+		log.Printf("Listening on %s", ln.Addr())
+		go func() {
+			if err := s.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("server %s: %w", ln.Addr(), err)
+			}
+		}()
+	}
+
+	code := ExitOK
+	select {
+	case <-ctx.Done():
+		log.Printf("Shutting down")
+	case err := <-errCh:
+		log.Printf("Server error, shutting down: %v", err)
+		code = ExitFailure
+	}
+	stop()
+
+	if err := a.Shutdown(context.Background()); err != nil {
+		log.Printf("Shutdown error: %v", err)
+		code = ExitFailure
+	}
+	return code
+}
+
+// Shutdown stops the servers, waiting for in-flight requests up to the shutdown timeout and closing their connections
+// past it, then runs the closers in reverse order. It is safe to call more than once; only the first call does the work.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	if a.shutdown {
+		a.mu.Unlock()
+		return nil
+	}
+	a.shutdown = true
+	servers, closers := a.servers, a.closers
+	a.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, a.shutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.srv.Shutdown(ctx); err != nil {
+				if errors.Is(err, ctx.Err()) {
+					// The requests still running past the deadline get their context canceled by closing their connection,
+					// rather than outliving the closers.
+					_ = s.srv.Close()
+				}
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("failed to shut down server: %w", err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].fn(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", closers[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	var lc net.ListenConfig
+	ln, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return ln
+}
+
+func TestApp_DrainsInFlightRequestsThenClosesInReverseOrder(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var order []string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		order = append(order, "request")
+		_, _ = io.WriteString(w, "done")
+	})
+
+	ln := listen(t)
+	application := app.New(app.WithShutdownTimeout(5 * time.Second))
+	application.AddServer(&http.Server{Handler: mux, ReadHeaderTimeout: time.Second}, ln)
+	application.AddCloser("first", func() error {
+		order = append(order, "first")
+		return nil
+	})
+	application.AddCloser("second", func() error {
+		order = append(order, "second")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	exitCode := make(chan int, 1)
+	go func() { exitCode <- application.Run(ctx) }()
+
+	// Start a request and shut down while it is still running
+	respCh := make(chan string, 1)
+	go func() {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://"+ln.Addr().String()+"/slow", http.NoBody)
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respCh <- string(body)
+	}()
+	<-started
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "done", <-respCh)
+	assert.Equal(t, app.ExitOK, <-exitCode)
+	assert.Equal(t, []string{"request", "second", "first"}, order)
+}
+
+func TestApp_ClosesHangingRequestsAfterTheShutdownTimeout(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hang", func(_ http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(canceled)
+	})
+
+	ln := listen(t)
+	application := app.New(app.WithShutdownTimeout(100 * time.Millisecond))
+	application.AddServer(&http.Server{Handler: mux, ReadHeaderTimeout: time.Second}, ln)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	exitCode := make(chan int, 1)
+	go func() { exitCode <- application.Run(ctx) }()
+	go func() {
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://"+ln.Addr().String()+"/hang", http.NoBody)
+		if err != nil {
+			return
+		}
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	assert.Equal(t, app.ExitFailure, <-exitCode, "the shutdown timed out")
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the hanging request was not canceled")
+	}
+}
+
+func TestApp_ServerErrorReturnsFailure(t *testing.T) {
+	ln := listen(t)
+	// Closing the listener makes Serve fail immediately
+	require.NoError(t, ln.Close())
+
+	closed := false
+	application := app.New()
+	application.AddServer(&http.Server{ReadHeaderTimeout: time.Second}, ln)
+	application.AddCloser("repository", func() error {
+		closed = true
+		return nil
+	})
+
+	assert.Equal(t, app.ExitFailure, application.Run(t.Context()))
+	assert.True(t, closed, "closers should run even when a server fails")
+}
+
+func TestApp_CloserErrorReturnsFailure(t *testing.T) {
+	application := app.New()
+	application.AddCloser("repository", func() error { return errors.New("boom") })
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	assert.Equal(t, app.ExitFailure, application.Run(ctx))
+}
+
+func TestApp_ShutdownIsIdempotent(t *testing.T) {
+	calls := 0
+	application := app.New()
+	application.AddCloser("repository", func() error {
+		calls++
+		return nil
+	})
+
+	require.NoError(t, application.Shutdown(t.Context()))
+	require.NoError(t, application.Shutdown(t.Context()))
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,32 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey(t *testing.T) {
+	key, prefix, hash, err := auth.NewAPIKey()
+	require.NoError(t, err)
+	assert.True(t, auth.IsAPIKey(key))
+	assert.Len(t, prefix, len(auth.APIKeyPrefix)+12)
+	assert.Equal(t, hash, auth.HashAPIKey(key))
+	assert.NotContains(t, hash, key)
+
+	parsed, err := auth.ParseAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, parsed)
+
+	other, otherPrefix, _, err := auth.NewAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+	assert.NotEqual(t, prefix, otherPrefix)
+
+	for _, invalid := range []string{"", "Bearer", prefix, "rpk_zzzzzzzzzzzz_secret", "rpk_abc_secret", "xyz_" + key[4:]} {
+		_, err := auth.ParseAPIKey(invalid)
+		assert.ErrorIs(t, err, auth.ErrInvalidToken, invalid)
+	}
+}
@@ -0,0 +1,160 @@
+// Package auth issues and verifies the tokens authenticating API callers: short-lived JWT access tokens
+// signed with HS256 or EdDSA, and refresh tokens persisted so that they can be revoked.
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// minHS256KeySize is the minimum size of an HS256 secret, the size of the SHA-256 output.
+const minHS256KeySize = 32
+
+var (
+	// ErrInvalidToken is returned when a token is malformed, badly signed or revoked.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrTokenExpired is returned when a token is well-formed but expired.
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Key signs and verifies JWTs with a single algorithm.
+type Key interface {
+	// Algorithm returns the JWS "alg" of the key.
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+	Verify(data, signature []byte) bool
+}
+
+type hs256Key []byte
+
+// NewHS256Key returns a key signing with HMAC-SHA256, with a secret of at least 32 bytes.
+func NewHS256Key(secret []byte) (Key, error) {
+	if len(secret) < minHS256KeySize {
+		return nil, fmt.Errorf("hs256 secret must be at least %d bytes", minHS256KeySize)
+	}
+	return hs256Key(bytes.Clone(secret)), nil
+}
+
+func (k hs256Key) Algorithm() string { return "HS256" }
+
+func (k hs256Key) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k hs256Key) Verify(data, signature []byte) bool {
+	expected, _ := k.Sign(data)
+	return hmac.Equal(expected, signature)
+}
+
+type eddsaKey struct {
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// NewEdDSAKey returns a key signing with Ed25519. Verifying only needs the public part of the key.
+func NewEdDSAKey(private ed25519.PrivateKey) Key {
+	return eddsaKey{private: private, public: private.Public().(ed25519.PublicKey)}
+}
+
+// NewEdDSAVerifier returns a key verifying Ed25519 signatures, for services that only check tokens.
+// Its Sign method always fails.
+func NewEdDSAVerifier(public ed25519.PublicKey) Key {
+	return eddsaKey{public: public}
+}
+
+func (k eddsaKey) Algorithm() string { return "EdDSA" }
+
+func (k eddsaKey) Sign(data []byte) ([]byte, error) {
+	if k.private == nil {
+		return nil, errors.New("eddsa key has no private part")
+	}
+	return ed25519.Sign(k.private, data), nil
+}
+
+func (k eddsaKey) Verify(data, signature []byte) bool {
+	return ed25519.Verify(k.public, data, signature)
+}
+
+// Claims are the claims of an access token. Times are in seconds since the epoch, as JWT requires.
+type Claims struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	Tenant    string `json:"tid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+// Encode returns the compact serialization of a JWT holding claims, signed with key.
+func Encode(key Key, claims Claims) (string, error) {
+	h, err := json.Marshal(header{Algorithm: key.Algorithm(), Type: "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token header: %w", err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token claims: %w", err)
+	}
+	signingInput := encode(h) + "." + encode(c)
+	signature, err := key.Sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signingInput + "." + encode(signature), nil
+}
+
+// Decode verifies a JWT produced by Encode with key and returns its claims. The token must use the algorithm
+// of key, so that a token cannot pick a weaker one, must be issued by issuer, so that the tokens of another
+// service sharing the key are refused, and must not be expired at now.
+func Decode(key Key, token, issuer string, now time.Time) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, ErrInvalidToken
+	}
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil || h.Algorithm != key.Algorithm() {
+		return claims, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !key.Verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return claims, ErrInvalidToken
+	}
+	if err := decodeJSON(parts[1], &claims); err != nil || claims.Subject == "" || claims.Tenant == "" {
+		return claims, ErrInvalidToken
+	}
+	if claims.Issuer != issuer {
+		return claims, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeJSON(part string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
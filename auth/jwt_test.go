@@ -0,0 +1,86 @@
+package auth_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hs256Key(t *testing.T) auth.Key {
+	t.Helper()
+	key, err := auth.NewHS256Key(bytes.Repeat([]byte{0x42}, 32))
+	require.NoError(t, err)
+	return key
+}
+
+func TestEncodeDecode(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	now := time.Now()
+	claims := auth.Claims{ID: "1", Subject: "user-1", Tenant: "acme", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+
+	keys := map[string]auth.Key{"HS256": hs256Key(t), "EdDSA": auth.NewEdDSAKey(private)}
+	for alg, key := range keys {
+		t.Run(alg, func(t *testing.T) {
+			token, err := auth.Encode(key, claims)
+			require.NoError(t, err)
+			header, _, _ := strings.Cut(token, ".")
+			decoded, err := base64.RawURLEncoding.DecodeString(header)
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"alg":"`+alg+`","typ":"JWT"}`, string(decoded))
+
+			got, err := auth.Decode(key, token, "", now)
+			require.NoError(t, err)
+			assert.Equal(t, claims, got)
+
+			_, err = auth.Decode(key, token, "", now.Add(time.Minute))
+			require.ErrorIs(t, err, auth.ErrTokenExpired)
+			_, err = auth.Decode(key, token[:len(token)-2], "", now)
+			require.ErrorIs(t, err, auth.ErrInvalidToken)
+			_, err = auth.Decode(key, token, "billing", now)
+			require.ErrorIs(t, err, auth.ErrInvalidToken, "tokens must come from the expected issuer")
+
+			foreign := claims
+			foreign.Issuer = "billing"
+			token, err = auth.Encode(key, foreign)
+			require.NoError(t, err)
+			_, err = auth.Decode(key, token, "", now)
+			require.ErrorIs(t, err, auth.ErrInvalidToken, "tokens of a foreign issuer are refused")
+			got, err = auth.Decode(key, token, "billing", now)
+			require.NoError(t, err)
+			assert.Equal(t, foreign, got)
+		})
+	}
+
+	// A token verifies with the public key only, but not with a key of another algorithm.
+	token, err := auth.Encode(keys["EdDSA"], claims)
+	require.NoError(t, err)
+	_, err = auth.Decode(auth.NewEdDSAVerifier(private.Public().(ed25519.PublicKey)), token, "", now)
+	require.NoError(t, err)
+	_, err = auth.Decode(keys["HS256"], token, "", now)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestDecode_RejectsUnsignedTokens(t *testing.T) {
+	key := hs256Key(t)
+	token, err := auth.Encode(key, auth.Claims{Subject: "user-1", Tenant: "acme", ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	require.NoError(t, err)
+	_, claims, _ := strings.Cut(token, ".")
+	claims, _, _ = strings.Cut(claims, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+
+	_, err = auth.Decode(key, none+"."+claims+".", "", time.Now())
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestNewHS256Key_RejectsShortSecrets(t *testing.T) {
+	_, err := auth.NewHS256Key([]byte("short"))
+	require.Error(t, err)
+}
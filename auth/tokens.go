@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAccessTTL  = 15 * time.Minute
+	defaultRefreshTTL = 30 * 24 * time.Hour
+
+	// secretSize is the number of random bytes in the secret part of opaque tokens.
+	secretSize = 32
+)
+
+// Tokens are the tokens returned at login and refresh, in the shape of an OAuth 2 token response.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Issuer issues access tokens along with refresh tokens persisted in a store.
+// Access tokens are not persisted: they stay valid until they expire, so their TTL should be short.
+type Issuer struct {
+	key        Key
+	store      repository.RefreshTokenStore
+	users      repository.UserRepository
+	name       string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	now        func() time.Time
+}
+
+// IssuerOption configures an Issuer.
+type IssuerOption func(*Issuer)
+
+// WithAccessTTL sets the lifetime of access tokens, 15 minutes by default.
+func WithAccessTTL(d time.Duration) IssuerOption {
+	return func(i *Issuer) {
+		i.accessTTL = d
+	}
+}
+
+// WithRefreshTTL sets the lifetime of refresh tokens, 30 days by default.
+func WithRefreshTTL(d time.Duration) IssuerOption {
+	return func(i *Issuer) {
+		i.refreshTTL = d
+	}
+}
+
+// WithIssuerName sets the "iss" claim of access tokens.
+func WithIssuerName(name string) IssuerOption {
+	return func(i *Issuer) {
+		i.name = name
+	}
+}
+
+// WithClock sets the function returning the current time.
+func WithClock(now func() time.Time) IssuerOption {
+	return func(i *Issuer) {
+		i.now = now
+	}
+}
+
+// NewIssuer creates an Issuer signing access tokens with key and persisting refresh tokens in store.
+// Refreshes look the user up in users, so that only active users get new tokens.
+func NewIssuer(key Key, store repository.RefreshTokenStore, users repository.UserRepository, opts ...IssuerOption) *Issuer {
+	i := &Issuer{key: key, store: store, users: users, accessTTL: defaultAccessTTL, refreshTTL: defaultRefreshTTL, now: time.Now}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// Issue returns new tokens for the user with the given ID, in the tenant of ctx.
+func (i *Issuer) Issue(ctx context.Context, userID uuid.UUID) (*Tokens, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := i.now()
+	access, err := Encode(i.key, Claims{
+		ID:        uuid.NewString(),
+		Issuer:    i.name,
+		Subject:   userID.String(),
+		Tenant:    tenantID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(i.accessTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	id, refreshToken, hash, err := NewOpaqueToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	refresh := domain.RefreshToken{
+		ID:        id,
+		UserID:    userID,
+		TokenHash: hash,
+		ExpiresAt: now.Add(i.refreshTTL),
+		CreatedAt: now,
+	}
+	if err := i.store.AddRefreshToken(ctx, refresh); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return &Tokens{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(i.accessTTL / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Verify returns the claims of a valid access token issued under the name of i.
+func (i *Issuer) Verify(accessToken string) (Claims, error) {
+	return Decode(i.key, accessToken, i.name, i.now())
+}
+
+// Refresh exchanges a refresh token for new tokens and revokes it. Presenting a token that was already
+// revoked means it leaked, so every refresh token of its user is revoked then, as they are when the user
+// no longer exists or is not active.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (*Tokens, error) {
+	token, err := i.lookup(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if token.RevokedAt != nil {
+		if _, err := i.store.RevokeUserRefreshTokens(ctx, token.UserID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return nil, ErrInvalidToken
+	}
+	if !token.Active(i.now()) {
+		return nil, ErrTokenExpired
+	}
+	user, err := i.users.GetUserByID(ctx, token.UserID)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err != nil || (user.Status != "" && user.Status != domain.StatusActive) {
+		// The revocation done when the user was suspended or disabled may have failed.
+		if _, err := i.store.RevokeUserRefreshTokens(ctx, token.UserID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		return nil, ErrInvalidToken
+	}
+	// A concurrent refresh with the same token loses the race here.
+	if err := i.store.RevokeRefreshToken(ctx, token.ID); errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return i.Issue(ctx, token.UserID)
+}
+
+// Revoke revokes a refresh token, at logout. Revoking a token twice is not an error.
+func (i *Issuer) Revoke(ctx context.Context, refreshToken string) error {
+	token, err := i.lookup(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if err := i.store.RevokeRefreshToken(ctx, token.ID); err != nil && !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the stored token matching refreshToken, or ErrInvalidToken.
+func (i *Issuer) lookup(ctx context.Context, refreshToken string) (*domain.RefreshToken, error) {
+	id, hash, err := ParseOpaqueToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	token, err := i.store.GetRefreshToken(ctx, id)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(token.TokenHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+	return token, nil
+}
+
+// NewOpaqueToken returns a random token of the form "<id>.<secret>", as refresh and verification tokens are,
+// along with its ID and the hash of its secret to store.
+func NewOpaqueToken() (id uuid.UUID, token, hash string, err error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return uuid.Nil, "", "", err
+	}
+	id = uuid.New()
+	return id, id.String() + "." + base64.RawURLEncoding.EncodeToString(secret), hashSecret(secret), nil
+}
+
+// ParseOpaqueToken returns the ID of a token made by NewOpaqueToken and the hash of its secret, or ErrInvalidToken.
+func ParseOpaqueToken(token string) (id uuid.UUID, hash string, err error) {
+	rawID, rawSecret, ok := strings.Cut(token, ".")
+	if !ok {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	id, err = uuid.Parse(rawID)
+	if err != nil {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(rawSecret)
+	if err != nil || len(secret) == 0 {
+		return uuid.Nil, "", ErrInvalidToken
+	}
+	return id, hashSecret(secret), nil
+}
+
+// hashSecret returns the hash of a token secret. A fast hash is enough for a random 256-bit secret.
+func hashSecret(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,108 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuer(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	user, err := repo.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	issuer := auth.NewIssuer(hs256Key(t), repo, repo, auth.WithAccessTTL(time.Minute), auth.WithRefreshTTL(time.Hour),
+		auth.WithIssuerName("test"), auth.WithClock(func() time.Time { return now }))
+
+	tokens, err := issuer.Issue(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int64(60), tokens.ExpiresIn)
+	claims, err := issuer.Verify(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID.String(), claims.Subject)
+	assert.Equal(t, "acme", claims.Tenant)
+	assert.Equal(t, "test", claims.Issuer)
+	_, err = auth.NewIssuer(hs256Key(t), repo, repo, auth.WithIssuerName("other"), auth.WithClock(func() time.Time { return now })).
+		Verify(tokens.AccessToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken, "access tokens of another issuer sharing the key are refused")
+
+	// Refreshing rotates the refresh token.
+	refreshed, err := issuer.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	// Reusing the old one revokes every token of the user.
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = issuer.Refresh(ctx, refreshed.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// Logged out tokens cannot be refreshed, nor can those of other tenants or with a wrong secret.
+	tokens, err = issuer.Issue(ctx, user.ID)
+	require.NoError(t, err)
+	_, err = issuer.Refresh(tenant.WithID(ctx, "other"), tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken[:len(tokens.RefreshToken)-2]+"AA")
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+	require.NoError(t, issuer.Revoke(ctx, tokens.RefreshToken))
+	require.NoError(t, issuer.Revoke(ctx, tokens.RefreshToken))
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// The tokens of users who are not active cannot be refreshed, even when their revocation failed.
+	tokens, err = issuer.Issue(ctx, user.ID)
+	require.NoError(t, err)
+	user.Status = domain.StatusSuspended
+	_, err = repo.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+	user.Status = domain.StatusActive
+	_, err = repo.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken, "the tokens were revoked")
+
+	tokens, err = issuer.Issue(ctx, user.ID)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteUser(ctx, user.ID))
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrInvalidToken)
+	_, err = issuer.Issue(ctx, user.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestIssuer_Expiry(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	user, err := repo.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+
+	now := time.Now()
+	issuer := auth.NewIssuer(hs256Key(t), repo, repo, auth.WithAccessTTL(time.Minute), auth.WithRefreshTTL(time.Hour),
+		auth.WithClock(func() time.Time { return now }))
+	tokens, err := issuer.Issue(ctx, user.ID)
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Minute)
+	_, err = issuer.Verify(tokens.AccessToken)
+	require.ErrorIs(t, err, auth.ErrTokenExpired)
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Hour)
+	tokens, err = issuer.Issue(ctx, user.ID)
+	require.NoError(t, err)
+	now = now.Add(2 * time.Hour)
+	_, err = issuer.Refresh(ctx, tokens.RefreshToken)
+	require.ErrorIs(t, err, auth.ErrTokenExpired)
+}
@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// APIKey authenticates a non-interactive caller on behalf of either a user or a service account, with at most
+// the permissions it is scoped to. Only the hash of the key is stored; its prefix is kept to tell keys apart.
+type APIKey struct {
+	ID             uuid.UUID    `json:"id"`
+	Prefix         string       `json:"prefix"`
+	KeyHash        string       `json:"-"`
+	Name           string       `json:"name"`
+	UserID         *uuid.UUID   `json:"user_id,omitempty"`
+	ServiceAccount string       `json:"service_account,omitempty"`
+	Permissions    []Permission `json:"permissions"`
+	ExpiresAt      *time.Time   `json:"expires_at,omitempty"`
+	LastUsedAt     *time.Time   `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	RevokedAt      *time.Time   `json:"revoked_at,omitempty"`
+}
+
+// Active reports whether the key can still be used at the given time.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Allows reports whether the key is scoped to p.
+func (k APIKey) Allows(p Permission) bool {
+	return slices.Contains(k.Permissions, p)
+}
+
+// Actor returns the principal acting with the key.
+func (k APIKey) Actor() Actor {
+	if k.UserID != nil {
+		return Actor{Kind: ActorUser, ID: k.UserID.String()}
+	}
+	return Actor{Kind: ActorService, ID: k.ServiceAccount}
+}
@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ActorKind tells whether an actor is a person or a program.
+type ActorKind string
+
+// Actor kinds. ActorUnknown is recorded for changes made without an actor in their context.
+const (
+	ActorUser    ActorKind = "user"
+	ActorService ActorKind = "service"
+	ActorUnknown ActorKind = "unknown"
+)
+
+// Actor is the principal performing a change: an end user, an operator or a service.
+type Actor struct {
+	Kind ActorKind `json:"kind"`
+	ID   string    `json:"id"`
+}
+
+// AuditAction is the kind of change recorded by an audit entry.
+type AuditAction string
+
+// Audit actions, one per UserService write.
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+	AuditErase  AuditAction = "erase"
+)
+
+// FieldChange is a field of a user that a change modified, with its values before and after.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// AuditEntry records who changed a user, when and what changed. Seq orders the entries of a repository.
+type AuditEntry struct {
+	Seq        int64         `json:"seq"`
+	ID         uuid.UUID     `json:"id"`
+	TenantID   string        `json:"tenant_id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	Actor      Actor         `json:"actor"`
+	Action     AuditAction   `json:"action"`
+	Changes    []FieldChange `json:"changes"`
+	OccurredAt time.Time     `json:"occurred_at"`
+}
+
+// NewAuditEntry creates an entry for a change of the user with the given ID, from before to after.
+// A nil user stands for a user that does not exist, before its creation or after its deletion.
+func NewAuditEntry(action AuditAction, actor Actor, userID uuid.UUID, before, after *User) AuditEntry {
+	return AuditEntry{
+		ID:         uuid.New(),
+		UserID:     userID,
+		Actor:      actor,
+		Action:     action,
+		Changes:    DiffUsers(before, after),
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// DiffUsers returns the fields that differ between before and after, nil standing for a user with empty fields.
+func DiffUsers(before, after *User) []FieldChange {
+	var b, a User
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+	changes := make([]FieldChange, 0, 3)
+	if b.Name != a.Name {
+		changes = append(changes, FieldChange{Field: "name", Before: b.Name, After: a.Name})
+	}
+	if b.Email != a.Email {
+		changes = append(changes, FieldChange{Field: "email", Before: b.Email, After: a.Email})
+	}
+	if b.Status != a.Status {
+		changes = append(changes, FieldChange{Field: "status", Before: string(b.Status), After: string(a.Status)})
+	}
+	return changes
+}
+
+// Redacted returns the entry with the values of its changes removed, keeping which fields changed.
+func (e AuditEntry) Redacted() AuditEntry {
+	changes := make([]FieldChange, len(e.Changes))
+	for i, change := range e.Changes {
+		changes[i] = FieldChange{Field: change.Field}
+	}
+	e.Changes = changes
+	return e
+}
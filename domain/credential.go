@@ -0,0 +1,15 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Credential is the password of a user, stored as a hash encoding its algorithm and parameters.
+// It is kept apart from User, so that the hash never leaves the credential store along with the user.
+type Credential struct {
+	UserID       uuid.UUID `json:"user_id"`
+	PasswordHash string    `json:"-"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
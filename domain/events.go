@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventType names a change that happened to a user.
+type EventType string
+
+// Event types recorded in the outbox.
+const (
+	UserCreated EventType = "UserCreated"
+	UserUpdated EventType = "UserUpdated"
+	UserDeleted EventType = "UserDeleted"
+	// UserErased follows the erasure of a user's personal data; consumers should erase their copies too.
+	UserErased EventType = "UserErased"
+)
+
+// Event describes a change to a user, as published to downstream systems.
+type Event struct {
+	ID         uuid.UUID `json:"id"`
+	Type       EventType `json:"type"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	UserID     uuid.UUID `json:"user_id"`
+	User       User      `json:"user"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// NewUserEvent creates an event of the given type for user, with a new ID and the current time.
+func NewUserEvent(eventType EventType, user User) Event {
+	return Event{
+		ID:         uuid.New(),
+		Type:       eventType,
+		UserID:     user.ID,
+		User:       user,
+		OccurredAt: time.Now().UTC(),
+	}
+}
+
+// Anonymized returns the event with the user reduced to its ID.
+func (e Event) Anonymized() Event {
+	e.User = User{ID: e.UserID}
+	return e
+}
@@ -0,0 +1,53 @@
+package domain
+
+import "slices"
+
+// Permission allows an operation on users or on the resources of a tenant.
+type Permission string
+
+// Permissions checked by UserService. Users may read and edit their own record without any of them.
+const (
+	PermUsersRead   Permission = "users:read"
+	PermUsersWrite  Permission = "users:write"
+	PermUsersDelete Permission = "users:delete"
+	PermRolesWrite  Permission = "roles:write"
+	// PermAPIKeysManage allows listing every API key and managing the keys of others and of service accounts.
+	PermAPIKeysManage Permission = "api_keys:manage"
+	// PermWebhooksManage allows managing the webhook subscriptions of the tenant and reading their deliveries.
+	PermWebhooksManage Permission = "webhooks:manage"
+	// PermCredentialsWrite allows setting the password of others.
+	PermCredentialsWrite Permission = "credentials:write"
+)
+
+// Valid reports whether p is a known permission. The admin role grants them all.
+func (p Permission) Valid() bool {
+	return RoleAdmin.Grants(p)
+}
+
+// Role is a named set of permissions assigned to users.
+type Role string
+
+// Roles. A user without roles can only read and edit their own record.
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// rolePermissions lists the permissions granted by each role.
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:  {PermUsersRead, PermUsersWrite, PermUsersDelete, PermRolesWrite, PermAPIKeysManage, PermWebhooksManage, PermCredentialsWrite},
+	RoleEditor: {PermUsersRead, PermUsersWrite},
+	RoleViewer: {PermUsersRead},
+}
+
+// Valid reports whether r is a known role.
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Grants reports whether r grants p.
+func (r Role) Grants(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
@@ -0,0 +1,36 @@
+package domain
+
+import "slices"
+
+// UserStatus is the stage of a user in its lifecycle.
+type UserStatus string
+
+// User statuses. Users stored without a status are active.
+const (
+	// StatusPending users have not verified their email yet.
+	StatusPending UserStatus = "pending"
+	StatusActive  UserStatus = "active"
+	// StatusSuspended users are locked out until they are reactivated.
+	StatusSuspended UserStatus = "suspended"
+	// StatusDisabled users are locked out for good.
+	StatusDisabled UserStatus = "disabled"
+)
+
+// statusTransitions lists the statuses each status may change to.
+var statusTransitions = map[UserStatus][]UserStatus{
+	StatusPending:   {StatusActive, StatusDisabled},
+	StatusActive:    {StatusSuspended, StatusDisabled},
+	StatusSuspended: {StatusActive, StatusDisabled},
+	StatusDisabled:  nil,
+}
+
+// Valid reports whether s is a known status.
+func (s UserStatus) Valid() bool {
+	_, ok := statusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether a user may change from s to the given status.
+func (s UserStatus) CanTransitionTo(to UserStatus) bool {
+	return slices.Contains(statusTransitions[s], to)
+}
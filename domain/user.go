@@ -6,7 +6,8 @@ import (
 
 // User represents a user in the system.
 type User struct {
-	ID    uuid.UUID `bson:"id" json:"id"`
-	Name  string    `bson:"name" json:"name"`
-	Email string    `bson:"email" json:"email"`
+	ID     uuid.UUID  `bson:"id" json:"id"`
+	Name   string     `bson:"name" json:"name"`
+	Email  string     `bson:"email" json:"email"`
+	Status UserStatus `bson:"status" json:"status,omitempty"`
 }
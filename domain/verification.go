@@ -0,0 +1,23 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VerificationToken is a single-use token mailed to a user to verify their email. Only the hash of its secret
+// is stored.
+type VerificationToken struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// Active reports whether the token can still be used at the given time.
+func (t VerificationToken) Active(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
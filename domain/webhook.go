@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebhookSubscription asks for the user events of the given types to be posted to URL.
+// An empty EventTypes subscribes to every event. A subscription only receives the events of its tenant.
+type WebhookSubscription struct {
+	ID         uuid.UUID   `json:"id"`
+	TenantID   string      `json:"-"`
+	URL        string      `json:"url"`
+	Secret     string      `json:"-"`
+	EventTypes []EventType `json:"event_types"`
+	CreatedAt  time.Time   `json:"created_at"`
+}
+
+// Matches reports whether the subscription wants events of the given type.
+func (s WebhookSubscription) Matches(eventType EventType) bool {
+	return len(s.EventTypes) == 0 || slices.Contains(s.EventTypes, eventType)
+}
+
+// DeliveryStatus is the state of a webhook delivery.
+type DeliveryStatus string
+
+// Delivery states. A pending delivery that failed keeps its last error until it succeeds or runs out of attempts.
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryDead      DeliveryStatus = "dead"
+)
+
+// WebhookDelivery is the delivery of one event to one subscription, along with its latest attempt.
+// TenantID is the tenant of the subscription.
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	TenantID       string          `json:"-"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      EventType       `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseCode   int             `json:"response_code,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
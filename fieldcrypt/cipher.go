@@ -0,0 +1,157 @@
+// Package fieldcrypt encrypts individual column values with envelope encryption and computes blind indexes
+// allowing exact lookups on encrypted values.
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix marks an encrypted value: "enc:v1:<key id>:<wrapped data key>:<ciphertext>", both parts in base64.
+const prefix = "enc:v1:"
+
+// dataKeySize is the size of the AES-256 key generated for every value.
+const dataKeySize = 32
+
+// ErrMalformed is returned when decrypting a value that looks encrypted but cannot be parsed or authenticated.
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// Cipher encrypts values with a fresh data key, itself encrypted (wrapped) with the current key of the provider.
+// Both layers use AES-256-GCM. The wrapped data key and the ID of the key that wrapped it are stored along
+// with the value, so that values encrypted with an older key stay readable as long as the provider knows it.
+type Cipher struct {
+	keys KeyProvider
+}
+
+// New creates a Cipher using the keys of provider.
+func New(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys}
+}
+
+// KeyID returns the ID of the key used by Encrypt.
+func (c *Cipher) KeyID() string {
+	return c.keys.CurrentKeyID()
+}
+
+// Encrypt returns the encrypted form of plaintext.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	keyID := c.keys.CurrentKeyID()
+	kek, err := c.keys.Key(keyID)
+	if err != nil {
+		return "", err
+	}
+
+	dek := make([]byte, dataKeySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	// The key ID is authenticated with the data key, so that a wrapped key cannot be moved to another key ID.
+	wrapped, err := seal(kek, dek, []byte(keyID))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(dek, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return prefix + keyID + ":" + encode(wrapped) + ":" + encode(ciphertext), nil
+}
+
+// Decrypt returns the plaintext of a value produced by Encrypt. Values without the encryption prefix are
+// returned as is, so that values stored before encryption was enabled remain readable until re-encrypted.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+	parts := strings.Split(rest, ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	wrapped, err := decode(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ciphertext, err := decode(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	kek, err := c.keys.Key(parts[0])
+	if err != nil {
+		return "", err
+	}
+	dek, err := open(kek, wrapped, []byte(parts[0]))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dek, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// BlindIndex returns the hex HMAC-SHA256 of value under the index key. Equal values get equal indexes,
+// which is what allows unique constraints and lookups, and also what an attacker with the database can compare.
+func (c *Cipher) BlindIndex(value string) string {
+	mac := hmac.New(sha256.New, c.keys.IndexKey())
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seal encrypts plaintext with key and returns the nonce followed by the ciphertext.
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,127 @@
+package fieldcrypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/fieldcrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T, current string, ids ...string) *fieldcrypt.StaticKeys {
+	t.Helper()
+	keys := make(map[string][]byte, len(ids))
+	for i, id := range ids {
+		keys[id] = bytes.Repeat([]byte{byte(i + 1)}, 32)
+	}
+	provider, err := fieldcrypt.NewStaticKeys(current, keys, bytes.Repeat([]byte{0xff}, 32))
+	require.NoError(t, err)
+	return provider
+}
+
+func TestCipher_EncryptDecrypt(t *testing.T) {
+	c := fieldcrypt.New(testKeys(t, "k1", "k1"))
+
+	first, err := c.Encrypt("alice@example.com")
+	require.NoError(t, err)
+	second, err := c.Encrypt("alice@example.com")
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first, "enc:v1:k1:"))
+	assert.NotContains(t, first, "alice")
+	assert.NotEqual(t, first, second, "every value gets its own data key and nonce")
+
+	got, err := c.Decrypt(first)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", got)
+}
+
+func TestCipher_DecryptPlaintext(t *testing.T) {
+	c := fieldcrypt.New(testKeys(t, "k1", "k1"))
+
+	got, err := c.Decrypt("legacy@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy@example.com", got)
+}
+
+func TestCipher_DecryptWithRetiredKey(t *testing.T) {
+	old := fieldcrypt.New(testKeys(t, "k1", "k1", "k2"))
+	value, err := old.Encrypt("alice@example.com")
+	require.NoError(t, err)
+
+	rotated := fieldcrypt.New(testKeys(t, "k2", "k1", "k2"))
+	assert.Equal(t, "k2", rotated.KeyID())
+	got, err := rotated.Decrypt(value)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", got)
+
+	removed := fieldcrypt.New(testKeys(t, "k2", "k0", "k2"))
+	_, err = removed.Decrypt(value)
+	require.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+}
+
+func TestCipher_DecryptTampered(t *testing.T) {
+	c := fieldcrypt.New(testKeys(t, "k1", "k1", "k2"))
+	value, err := c.Encrypt("alice@example.com")
+	require.NoError(t, err)
+
+	parts := strings.Split(value, ":")
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[4])
+	require.NoError(t, err)
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	tests := map[string]string{
+		"ciphertext": strings.Join(append(parts[:4:4], base64.RawURLEncoding.EncodeToString(ciphertext)), ":"),
+		"key id":     strings.Replace(value, ":k1:", ":k2:", 1),
+		"truncated":  strings.Join(parts[:4], ":"),
+		"encoding":   value + "!",
+	}
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := c.Decrypt(tampered)
+			require.ErrorIs(t, err, fieldcrypt.ErrMalformed)
+		})
+	}
+}
+
+func TestCipher_BlindIndex(t *testing.T) {
+	c := fieldcrypt.New(testKeys(t, "k1", "k1"))
+	rotated := fieldcrypt.New(testKeys(t, "k2", "k1", "k2"))
+
+	index := c.BlindIndex("alice@example.com")
+	assert.Len(t, index, 64)
+	assert.Equal(t, index, c.BlindIndex("alice@example.com"))
+	assert.Equal(t, index, rotated.BlindIndex("alice@example.com"), "the index does not depend on the encryption key")
+	assert.NotEqual(t, index, c.BlindIndex("bob@example.com"))
+}
+
+func TestParseStaticKeys(t *testing.T) {
+	key := func(b byte) string { return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32)) }
+
+	provider, err := fieldcrypt.ParseStaticKeys("k2="+key(2)+", k1="+key(1), key(9))
+	require.NoError(t, err)
+	assert.Equal(t, "k2", provider.CurrentKeyID())
+	k1, err := provider.Key("k1")
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{1}, 32), k1)
+	_, err = provider.Key("k3")
+	require.ErrorIs(t, err, fieldcrypt.ErrUnknownKey)
+
+	invalid := map[string][2]string{
+		"missing id":      {key(1), key(9)},
+		"short key":       {"k1=" + base64.StdEncoding.EncodeToString([]byte("short")), key(9)},
+		"bad base64":      {"k1=???", key(9)},
+		"colon in id":     {"k:1=" + key(1), key(9)},
+		"missing index":   {"k1=" + key(1), ""},
+		"short index key": {"k1=" + key(1), base64.StdEncoding.EncodeToString([]byte("short"))},
+	}
+	for name, args := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := fieldcrypt.ParseStaticKeys(args[0], args[1])
+			require.Error(t, err)
+		})
+	}
+}
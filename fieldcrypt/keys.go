@@ -0,0 +1,97 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// keySize is the size of the AES-256 key encryption keys and of the index key.
+const keySize = 32
+
+// ErrUnknownKey is returned when a value was encrypted with a key the provider does not know.
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// KeyProvider supplies the key encryption keys, for instance from a KMS or a secret store.
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the key encrypting new values.
+	CurrentKeyID() string
+	// Key returns the 32-byte key with the given ID, or ErrUnknownKey.
+	Key(id string) ([]byte, error)
+	// IndexKey returns the 32-byte key of the blind indexes. Changing it requires rebuilding every index,
+	// so it is not rotated with the encryption keys.
+	IndexKey() []byte
+}
+
+// StaticKeys is a KeyProvider holding its keys in memory.
+type StaticKeys struct {
+	current  string
+	keys     map[string][]byte
+	indexKey []byte
+}
+
+// NewStaticKeys creates a StaticKeys encrypting with the key current. Retired keys stay in keys
+// until every value encrypted with them has been re-encrypted.
+func NewStaticKeys(current string, keys map[string][]byte, indexKey []byte) (*StaticKeys, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %q", ErrUnknownKey, current)
+	}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("key %q must be %d bytes long", id, keySize)
+		}
+	}
+	if len(indexKey) != keySize {
+		return nil, fmt.Errorf("index key must be %d bytes long", keySize)
+	}
+	return &StaticKeys{current: current, keys: keys, indexKey: indexKey}, nil
+}
+
+// ParseStaticKeys reads keys written as "id=base64,id=base64", the first one being the current key,
+// and a base64 index key. Both are typically taken from the environment.
+func ParseStaticKeys(spec, indexKey string) (*StaticKeys, error) {
+	var current string
+	keys := make(map[string][]byte)
+	for entry := range strings.SplitSeq(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid key entry %q, expected id=base64", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", id, err)
+		}
+		if current == "" {
+			current = id
+		}
+		keys[id] = key
+	}
+	index, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index key: %w", err)
+	}
+	return NewStaticKeys(current, keys, index)
+}
+
+// CurrentKeyID returns the ID of the key encrypting new values.
+func (k *StaticKeys) CurrentKeyID() string {
+	return k.current
+}
+
+// Key returns the key with the given ID.
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key, nil
+}
+
+// IndexKey returns the key of the blind indexes.
+func (k *StaticKeys) IndexKey() []byte {
+	return k.indexKey
+}
@@ -0,0 +1,106 @@
+package fieldcrypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+)
+
+const (
+	defaultRotateInterval  = time.Minute
+	defaultRotateBatchSize = 100
+)
+
+// Rotator re-encrypts the stored emails of every tenant in the background, so that plaintext emails and emails
+// encrypted with a retired key end up encrypted with the current key. A retired key can be removed from the
+// provider once a pass leaves nothing to re-encrypt.
+type Rotator struct {
+	store     repository.EmailReencrypter
+	logger    *slog.Logger
+	interval  time.Duration
+	batchSize int
+}
+
+// RotatorOption configures a Rotator.
+type RotatorOption func(*Rotator)
+
+// WithRotateInterval sets how long the rotator waits once every tenant is up to date.
+func WithRotateInterval(d time.Duration) RotatorOption {
+	return func(r *Rotator) {
+		r.interval = d
+	}
+}
+
+// WithRotateBatchSize sets the maximum number of emails re-encrypted in one transaction.
+func WithRotateBatchSize(n int) RotatorOption {
+	return func(r *Rotator) {
+		r.batchSize = n
+	}
+}
+
+// WithRotatorLogger sets the logger used to report failures.
+func WithRotatorLogger(logger *slog.Logger) RotatorOption {
+	return func(r *Rotator) {
+		r.logger = logger
+	}
+}
+
+// NewRotator creates a Rotator re-encrypting the emails stored in store.
+func NewRotator(store repository.EmailReencrypter, opts ...RotatorOption) *Rotator {
+	r := &Rotator{
+		store:     store,
+		logger:    slog.Default(),
+		interval:  defaultRotateInterval,
+		batchSize: defaultRotateBatchSize,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run re-encrypts emails until ctx is canceled. Batches follow each other until a pass finds nothing left to do.
+func (r *Rotator) Run(ctx context.Context) {
+	for {
+		n, err := r.RotateOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.ErrorContext(ctx, "email re-encryption failed", slog.String("error", err.Error()))
+		}
+		if err == nil && n > 0 {
+			continue
+		}
+
+		timer := time.NewTimer(r.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// RotateOnce re-encrypts one batch of emails of each tenant holding stale ones and returns how many were re-encrypted.
+func (r *Rotator) RotateOnce(ctx context.Context) (int, error) {
+	tenants, err := r.store.StaleEmailTenants(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	var (
+		total int
+		errs  []error
+	)
+	for _, tenantID := range tenants {
+		n, err := r.store.ReencryptEmails(tenant.WithID(ctx, tenantID), r.batchSize)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to re-encrypt emails of tenant %s: %w", tenantID, err))
+		}
+	}
+	return total, errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package fieldcrypt_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/fieldcrypt"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotator_RotateOnce(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	acme := tenant.WithID(t.Context(), "acme")
+	globex := tenant.WithID(t.Context(), "globex")
+
+	// Users are stored with k1, then k2 becomes the current key.
+	old := repository.NewSQLLiteRepository(db, repository.WithSQLiteEmailCipher(fieldcrypt.New(testKeys(t, "k1", "k1", "k2"))))
+	require.NoError(t, old.Migrate(t.Context()))
+	for i, ctx := range []context.Context{acme, acme, acme, globex} {
+		_, err := old.AddUser(ctx, domain.User{Name: "User", Email: fmt.Sprintf("user%d@example.com", i)})
+		require.NoError(t, err)
+	}
+
+	repo := repository.NewSQLLiteRepository(db, repository.WithSQLiteEmailCipher(fieldcrypt.New(testKeys(t, "k2", "k1", "k2"))))
+	rotator := fieldcrypt.NewRotator(repo, fieldcrypt.WithRotateBatchSize(2))
+
+	n, err := rotator.RotateOnce(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = rotator.RotateOnce(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = rotator.RotateOnce(t.Context())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// k1 can now be retired.
+	retired := repository.NewSQLLiteRepository(db, repository.WithSQLiteEmailCipher(fieldcrypt.New(testKeys(t, "k2", "k0", "k2"))))
+	got, err := retired.GetUserByEmail(acme, "user1@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "user1@example.com", got.Email)
+	users, err := retired.GetAllUsers(globex)
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestRotator_EncryptionDisabled(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	rotator := fieldcrypt.NewRotator(repository.NewSQLLiteRepository(db))
+	_, err = rotator.RotateOnce(t.Context())
+	require.ErrorIs(t, err, repository.ErrEncryptionDisabled)
+}
@@ -4,14 +4,249 @@ CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 -- Create users table
 CREATE TABLE IF NOT EXISTS users (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    tenant_id TEXT NOT NULL,
     name VARCHAR(255) NOT NULL,
-    email VARCHAR(255) NOT NULL UNIQUE
+    -- Holds the ciphertext when email encryption is enabled
+    email TEXT NOT NULL,
+    -- Blind index and key ID of encrypted emails, NULL for plaintext ones
+    email_index TEXT,
+    email_key_id TEXT,
+    -- pending, active, suspended or disabled
+    status TEXT NOT NULL DEFAULT 'active'
 );
 
--- Add index on email for faster lookups
-CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+-- Emails are unique within a tenant; the indexes also serve lookups by email
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant_id, email);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email_index ON users(tenant_id, email_index);
+
+-- Create the outbox of user events, read by the relay
+CREATE TABLE IF NOT EXISTS outbox (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    type VARCHAR(64) NOT NULL,
+    tenant_id TEXT NOT NULL DEFAULT '',
+    user_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(seq) WHERE delivered_at IS NULL;
+-- Serves the event history of a user, for data subject requests
+CREATE INDEX IF NOT EXISTS idx_outbox_user ON outbox(tenant_id, user_id);
+
+-- Create the webhook subscriptions and their deliveries, read by the webhook worker
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id UUID PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    response_code INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+-- Serve the subscriptions and the delivery log of a tenant
+CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_tenant ON webhook_subscriptions(tenant_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_tenant ON webhook_deliveries(tenant_id, created_at);
+
+-- Create the append-only audit trail of user changes; erasures may only redact the changes
+CREATE TABLE IF NOT EXISTS user_audit (
+    seq BIGSERIAL PRIMARY KEY,
+    id UUID NOT NULL UNIQUE,
+    tenant_id TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    actor_kind VARCHAR(16) NOT NULL,
+    actor_id TEXT NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    changes JSONB NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_audit_user ON user_audit(tenant_id, user_id, seq);
+
+CREATE OR REPLACE FUNCTION user_audit_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' OR (NEW.seq, NEW.id, NEW.tenant_id, NEW.user_id, NEW.actor_kind, NEW.actor_id, NEW.action, NEW.occurred_at)
+        IS DISTINCT FROM (OLD.seq, OLD.id, OLD.tenant_id, OLD.user_id, OLD.actor_kind, OLD.actor_id, OLD.action, OLD.occurred_at) THEN
+        RAISE EXCEPTION 'user_audit is append-only';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS user_audit_append_only ON user_audit;
+CREATE TRIGGER user_audit_append_only BEFORE UPDATE OR DELETE ON user_audit
+    FOR EACH ROW EXECUTE FUNCTION user_audit_append_only();
+
+-- Password hashes, kept apart from users so that they never travel with them
+CREATE TABLE IF NOT EXISTS user_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id TEXT NOT NULL,
+    password_hash TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Roles of the users, granting them permissions on other users
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tenant_id TEXT NOT NULL,
+    role VARCHAR(32) NOT NULL,
+    PRIMARY KEY (user_id, role)
+);
+
+-- Refresh tokens issued at login; only the hash of their secret is stored
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(tenant_id, user_id);
+
+-- Single-use tokens mailed to users to verify their email; only the hash of their secret is stored
+CREATE TABLE IF NOT EXISTS verification_tokens (
+    id UUID PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ
+);
+
+-- API keys of users and service accounts; only the hash of the keys is stored, along with their visible prefix
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY,
+    tenant_id TEXT NOT NULL,
+    prefix TEXT NOT NULL UNIQUE,
+    key_hash TEXT NOT NULL,
+    name TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    service_account TEXT,
+    permissions TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    CHECK ((user_id IS NULL) <> (service_account IS NULL))
+);
+
+-- Notify the user_changes channel on every change, for PsqlRepository.Watch
+CREATE OR REPLACE FUNCTION notify_user_change() RETURNS trigger AS $$
+DECLARE
+    changed users%ROWTYPE;
+BEGIN
+    IF TG_OP = 'DELETE' THEN changed := OLD; ELSE changed := NEW; END IF;
+    PERFORM pg_notify('user_changes', json_build_object(
+        'op', lower(TG_OP),
+        'tenant_id', changed.tenant_id,
+        'user', json_build_object('id', changed.id, 'name', changed.name, 'email', changed.email, 'status', changed.status)
+    )::text);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS users_notify ON users;
+CREATE TRIGGER users_notify AFTER INSERT OR UPDATE OR DELETE ON users
+    FOR EACH ROW EXECUTE FUNCTION notify_user_change();
+
+-- Restrict users to the tenant set in app.tenant_id by PsqlRepository; superusers bypass these policies
+ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+ALTER TABLE users FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS users_tenant_isolation ON users;
+CREATE POLICY users_tenant_isolation ON users
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- Let the email rotator list the tenants holding users, in read-only transactions setting app.list_tenants
+DROP POLICY IF EXISTS users_tenant_listing ON users;
+CREATE POLICY users_tenant_listing ON users FOR SELECT
+    USING (current_setting('app.list_tenants', true) = 'on');
+
+ALTER TABLE user_audit ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_audit FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS user_audit_tenant_isolation ON user_audit;
+CREATE POLICY user_audit_tenant_isolation ON user_audit
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE user_credentials ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_credentials FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS user_credentials_tenant_isolation ON user_credentials;
+CREATE POLICY user_credentials_tenant_isolation ON user_credentials
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE user_roles ENABLE ROW LEVEL SECURITY;
+ALTER TABLE user_roles FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS user_roles_tenant_isolation ON user_roles;
+CREATE POLICY user_roles_tenant_isolation ON user_roles
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE refresh_tokens ENABLE ROW LEVEL SECURITY;
+ALTER TABLE refresh_tokens FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS refresh_tokens_tenant_isolation ON refresh_tokens;
+CREATE POLICY refresh_tokens_tenant_isolation ON refresh_tokens
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE verification_tokens ENABLE ROW LEVEL SECURITY;
+ALTER TABLE verification_tokens FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS verification_tokens_tenant_isolation ON verification_tokens;
+CREATE POLICY verification_tokens_tenant_isolation ON verification_tokens
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS api_keys_tenant_isolation ON api_keys;
+CREATE POLICY api_keys_tenant_isolation ON api_keys
+    USING (tenant_id = current_setting('app.tenant_id', true))
+    WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- A regular role for the application, subject to row-level security
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'app_user') THEN
+        CREATE ROLE app_user LOGIN PASSWORD 'app_user';
+    END IF;
+END
+$$;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO app_user;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO app_user;
 
 -- Add some sample data
-INSERT INTO users (name, email) VALUES 
-    ('John Doe', 'john.doe@example.com'),
-    ('Jane Smith', 'jane.smith@example.com');
\ No newline at end of file
+INSERT INTO users (tenant_id, name, email) VALUES
+    ('default', 'John Doe', 'john.doe@example.com'),
+    ('default', 'Jane Smith', 'jane.smith@example.com');
\ No newline at end of file
@@ -0,0 +1,49 @@
+// Package mail sends the emails of the application through a pluggable Sender.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// WriterSender writes emails to a writer, such as stdout or a file, instead of delivering them. It is meant for
+// local use.
+type WriterSender struct {
+	mu  sync.Mutex
+	w   io.Writer
+	now func() time.Time
+}
+
+// NewWriterSender creates a WriterSender writing to w.
+func NewWriterSender(w io.Writer) *WriterSender {
+	return &WriterSender{w: w, now: time.Now}
+}
+
+// Send writes msg in the format of an email, followed by a blank line.
+func (s *WriterSender) Send(_ context.Context, msg Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintf(s.w, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n\r\n%s\r\n\r\n",
+		msg.From, msg.To, msg.Subject, s.now().Format(time.RFC1123Z), msg.Body)
+	if err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	return nil
+}
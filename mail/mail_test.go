@@ -0,0 +1,29 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/mail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterSender(t *testing.T) {
+	var out strings.Builder
+	sender := mail.NewWriterSender(&out)
+
+	require.NoError(t, sender.Send(t.Context(), mail.Message{
+		From:    "noreply@example.com",
+		To:      "john@example.com",
+		Subject: "Hello",
+		Body:    "Hi John",
+	}))
+	require.NoError(t, sender.Send(t.Context(), mail.Message{To: "jane@example.com", Subject: "Hello", Body: "Hi Jane"}))
+
+	written := out.String()
+	assert.True(t, strings.HasPrefix(written, "From: noreply@example.com\r\nTo: john@example.com\r\nSubject: Hello\r\nDate: "))
+	assert.Contains(t, written, "\r\n\r\nHi John\r\n\r\nFrom: ")
+	assert.Contains(t, written, "To: jane@example.com\r\n")
+	assert.True(t, strings.HasSuffix(written, "\r\n\r\nHi Jane\r\n\r\n"))
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/api"
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/password"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	t.Setenv("BOOTSTRAP_ADMIN_EMAIL", "admin@example.com")
+	t.Setenv("BOOTSTRAP_ADMIN_PASSWORD", "correct horse battery staple")
+	ctx := actor.With(tenant.WithID(t.Context(), tenant.Default), actor.Service("bootstrap"))
+	repo := repository.NewMemoryRepository()
+	hasher := password.NewHasher(password.WithArgon2id(password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}))
+	users := service.NewUserService(repo, service.WithCredentials(repo, hasher), service.WithAuthorization(repo))
+	require.NoError(t, bootstrapAdmin(ctx, users, repo))
+
+	key, err := auth.NewHS256Key(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	issuer := auth.NewIssuer(key, repo, repo)
+	mux := http.NewServeMux()
+	api.NewAuthHandler(users, issuer).Register(mux)
+	protected := http.NewServeMux()
+	api.NewUserHandler(users).Register(protected)
+	mux.Handle("/users", api.RequireAuth(issuer)(protected))
+	mux.Handle("/users/", api.RequireAuth(issuer)(protected))
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		var buf bytes.Buffer
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		req := httptest.NewRequestWithContext(t.Context(), method, path, &buf)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+	login := func(pw string) (*auth.Tokens, int) {
+		t.Helper()
+		rec := do(http.MethodPost, "/auth/login", "", map[string]string{"email": "admin@example.com", "password": pw})
+		if rec.Code != http.StatusOK {
+			return nil, rec.Code
+		}
+		var tokens auth.Tokens
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&tokens))
+		return &tokens, rec.Code
+	}
+
+	tokens, code := login("correct horse battery staple")
+	require.Equal(t, http.StatusOK, code)
+	rec := do(http.MethodGet, "/users", tokens.AccessToken, nil)
+	require.Equal(t, http.StatusOK, rec.Code, "the bootstrapped user is an admin")
+	var listed []struct {
+		ID string `json:"id"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&listed))
+	require.Len(t, listed, 1)
+
+	rec = do(http.MethodPut, "/users/"+listed[0].ID+"/password", tokens.AccessToken, map[string]string{"password": "short"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = do(http.MethodPut, "/users/"+listed[0].ID+"/password", tokens.AccessToken, map[string]string{"password": "another horse battery staple"})
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = do(http.MethodPost, "/auth/refresh", "", map[string]string{"refresh_token": tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code, "changing the password ends the sessions")
+
+	// Bootstrapping again keeps the password set over the API.
+	require.NoError(t, bootstrapAdmin(ctx, users, repo))
+	_, code = login("correct horse battery staple")
+	assert.Equal(t, http.StatusUnauthorized, code)
+	_, code = login("another horse battery staple")
+	assert.Equal(t, http.StatusOK, code)
+}
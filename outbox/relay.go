@@ -0,0 +1,182 @@
+// Package outbox delivers the user events recorded in the repository outbox to downstream systems.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultConcurrency  = 4
+)
+
+// Publisher sends an event to a downstream system. It may be called more than once for the same event,
+// so consumers should deduplicate on Event.ID.
+type Publisher interface {
+	Publish(ctx context.Context, event domain.Event) error
+}
+
+// PublisherFunc adapts a function to the Publisher interface.
+type PublisherFunc func(ctx context.Context, event domain.Event) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(ctx context.Context, event domain.Event) error {
+	return f(ctx, event)
+}
+
+// Relay polls the outbox and publishes pending events at least once.
+// Events of the same user are published in the order they were recorded; an event that fails
+// holds back the later events of its user until it is delivered. Only one Relay should read a given outbox.
+type Relay struct {
+	store       repository.OutboxStore
+	publisher   Publisher
+	logger      *slog.Logger
+	interval    time.Duration
+	batchSize   int
+	concurrency int
+}
+
+// Option configures a Relay.
+type Option func(*Relay)
+
+// WithPollInterval sets how long the relay waits before polling again once the outbox is drained.
+func WithPollInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithBatchSize sets the maximum number of events read from the outbox at once.
+func WithBatchSize(n int) Option {
+	return func(r *Relay) {
+		r.batchSize = n
+	}
+}
+
+// WithConcurrency sets how many users have their events published concurrently.
+func WithConcurrency(n int) Option {
+	return func(r *Relay) {
+		r.concurrency = n
+	}
+}
+
+// WithLogger sets the logger used to report delivery failures.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Relay) {
+		r.logger = logger
+	}
+}
+
+// NewRelay creates a Relay publishing the events of store with publisher.
+func NewRelay(store repository.OutboxStore, publisher Publisher, opts ...Option) *Relay {
+	r := &Relay{
+		store:       store,
+		publisher:   publisher,
+		logger:      slog.Default(),
+		interval:    defaultPollInterval,
+		batchSize:   defaultBatchSize,
+		concurrency: defaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Run delivers events until ctx is canceled. A full batch is followed immediately by the next one.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		delivered, err := r.Flush(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.ErrorContext(ctx, "outbox delivery failed", slog.String("error", err.Error()))
+		}
+		if err == nil && delivered == r.batchSize {
+			continue
+		}
+
+		timer := time.NewTimer(r.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// Flush publishes one batch of pending events and returns how many were delivered.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	records, err := r.store.PendingEvents(ctx, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	// The batch is ordered by sequence, so each group keeps the order of its user's events.
+	var users []uuid.UUID
+	groups := make(map[uuid.UUID][]repository.OutboxRecord)
+	for _, record := range records {
+		id := record.Event.UserID
+		if _, ok := groups[id]; !ok {
+			users = append(users, id)
+		}
+		groups[id] = append(groups[id], record)
+	}
+
+	var (
+		mu        sync.Mutex
+		delivered int
+		errs      []error
+	)
+	var g errgroup.Group
+	g.SetLimit(max(r.concurrency, 1))
+	for _, id := range users {
+		g.Go(func() error {
+			n, err := r.deliver(ctx, groups[id])
+			mu.Lock()
+			defer mu.Unlock()
+			delivered += n
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return delivered, errors.Join(errs...)
+}
+
+// deliver publishes the events of one user in order and stops at the first failure.
+func (r *Relay) deliver(ctx context.Context, records []repository.OutboxRecord) (int, error) {
+	for i, record := range records {
+		if err := r.publisher.Publish(ctx, record.Event); err != nil {
+			return i, fmt.Errorf("failed to publish event %s: %w", record.Event.ID, err)
+		}
+		if err := r.store.MarkDelivered(ctx, record.Seq); err != nil {
+			return i, fmt.Errorf("failed to mark event %s as delivered: %w", record.Event.ID, err)
+		}
+	}
+	return len(records), nil
+}
+
+// NewLogPublisher returns a Publisher that only logs the events, useful until a real broker is plugged in.
+func NewLogPublisher(logger *slog.Logger) Publisher {
+	return PublisherFunc(func(ctx context.Context, event domain.Event) error {
+		logger.InfoContext(ctx, "user event",
+			slog.String("id", event.ID.String()),
+			slog.String("type", string(event.Type)),
+			slog.String("user_id", event.UserID.String()),
+		)
+		return nil
+	})
+}
@@ -0,0 +1,148 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/outbox"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is an in-memory OutboxStore.
+type memoryStore struct {
+	mu        sync.Mutex
+	records   []repository.OutboxRecord
+	delivered map[int64]bool
+}
+
+func newMemoryStore(events ...domain.Event) *memoryStore {
+	s := &memoryStore{delivered: make(map[int64]bool)}
+	for i, event := range events {
+		s.records = append(s.records, repository.OutboxRecord{Seq: int64(i + 1), Event: event})
+	}
+	return s
+}
+
+func (s *memoryStore) PendingEvents(_ context.Context, limit int) ([]repository.OutboxRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []repository.OutboxRecord
+	for _, record := range s.records {
+		if !s.delivered[record.Seq] && len(pending) < limit {
+			pending = append(pending, record)
+		}
+	}
+	return pending, nil
+}
+
+func (s *memoryStore) MarkDelivered(_ context.Context, seq int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered[seq] = true
+	return nil
+}
+
+// recorder is a Publisher remembering the published events and failing the ones listed in fail.
+type recorder struct {
+	mu        sync.Mutex
+	published []domain.Event
+	fail      map[uuid.UUID]bool
+}
+
+func (r *recorder) Publish(_ context.Context, event domain.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[event.ID] {
+		return errors.New("broker unavailable")
+	}
+	r.published = append(r.published, event)
+	return nil
+}
+
+func (r *recorder) typesOf(userID uuid.UUID) []domain.EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []domain.EventType
+	for _, event := range r.published {
+		if event.UserID == userID {
+			types = append(types, event.Type)
+		}
+	}
+	return types
+}
+
+func TestRelay_Flush_OrderPerUser(t *testing.T) {
+	alice := domain.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com"}
+	bob := domain.User{ID: uuid.New(), Name: "Bob", Email: "bob@example.com"}
+	store := newMemoryStore(
+		domain.NewUserEvent(domain.UserCreated, alice),
+		domain.NewUserEvent(domain.UserCreated, bob),
+		domain.NewUserEvent(domain.UserUpdated, alice),
+		domain.NewUserEvent(domain.UserDeleted, bob),
+		domain.NewUserEvent(domain.UserDeleted, alice),
+	)
+	publisher := &recorder{}
+
+	delivered, err := outbox.NewRelay(store, publisher).Flush(t.Context())
+
+	require.NoError(t, err)
+	assert.Equal(t, 5, delivered)
+	assert.Equal(t, []domain.EventType{domain.UserCreated, domain.UserUpdated, domain.UserDeleted}, publisher.typesOf(alice.ID))
+	assert.Equal(t, []domain.EventType{domain.UserCreated, domain.UserDeleted}, publisher.typesOf(bob.ID))
+}
+
+func TestRelay_Flush_FailureHoldsBackUser(t *testing.T) {
+	alice := domain.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com"}
+	bob := domain.User{ID: uuid.New(), Name: "Bob", Email: "bob@example.com"}
+	aliceCreated := domain.NewUserEvent(domain.UserCreated, alice)
+	store := newMemoryStore(
+		aliceCreated,
+		domain.NewUserEvent(domain.UserCreated, bob),
+		domain.NewUserEvent(domain.UserUpdated, alice),
+	)
+	publisher := &recorder{fail: map[uuid.UUID]bool{aliceCreated.ID: true}}
+	relay := outbox.NewRelay(store, publisher)
+
+	// Alice's update waits for her creation; Bob is not affected
+	delivered, err := relay.Flush(t.Context())
+	require.Error(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Empty(t, publisher.typesOf(alice.ID))
+	assert.Equal(t, []domain.EventType{domain.UserCreated}, publisher.typesOf(bob.ID))
+
+	// Once the broker recovers, the held back events go out in order
+	publisher.fail = nil
+	delivered, err = relay.Flush(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []domain.EventType{domain.UserCreated, domain.UserUpdated}, publisher.typesOf(alice.ID))
+}
+
+func TestRelay_Run(t *testing.T) {
+	user := domain.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com"}
+	store := newMemoryStore(
+		domain.NewUserEvent(domain.UserCreated, user),
+		domain.NewUserEvent(domain.UserUpdated, user),
+		domain.NewUserEvent(domain.UserDeleted, user),
+	)
+	publisher := &recorder{}
+	relay := outbox.NewRelay(store, publisher, outbox.WithBatchSize(1), outbox.WithPollInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return len(publisher.typesOf(user.ID)) == 3 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}
@@ -0,0 +1,163 @@
+// Package password hashes passwords with argon2id or bcrypt and verifies them in constant time.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrMismatch is returned by Verify when the password does not match the hash.
+	ErrMismatch = errors.New("password does not match")
+	// ErrUnknownHash is returned by Verify when the hash was not produced by a supported algorithm.
+	ErrUnknownHash = errors.New("unknown password hash format")
+)
+
+// Algorithm is a password hashing algorithm.
+type Algorithm string
+
+// Supported algorithms.
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+)
+
+// Argon2Params are the cost parameters of argon2id.
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106, lowered to 64 MiB of memory.
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+// DefaultBcryptCost is the bcrypt cost used unless configured otherwise.
+const DefaultBcryptCost = 12
+
+// Hasher hashes new passwords with its algorithm and parameters, and verifies passwords against hashes
+// of any supported algorithm, telling when they were produced with other ones.
+type Hasher struct {
+	algorithm  Algorithm
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+// HasherOption configures a Hasher.
+type HasherOption func(*Hasher)
+
+// WithArgon2id makes the Hasher hash with argon2id and the given parameters. This is the default.
+func WithArgon2id(params Argon2Params) HasherOption {
+	return func(h *Hasher) {
+		h.algorithm = Argon2id
+		h.argon2 = params
+	}
+}
+
+// WithBcrypt makes the Hasher hash with bcrypt and the given cost.
+func WithBcrypt(cost int) HasherOption {
+	return func(h *Hasher) {
+		h.algorithm = Bcrypt
+		h.bcryptCost = cost
+	}
+}
+
+// NewHasher creates a Hasher, hashing with argon2id and DefaultArgon2Params unless configured otherwise.
+func NewHasher(opts ...HasherOption) *Hasher {
+	h := &Hasher{algorithm: Argon2id, argon2: DefaultArgon2Params, bcryptCost: DefaultBcryptCost}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Hash returns the encoded hash of password, which includes its algorithm, parameters and salt.
+// Argon2id hashes use the PHC string format, bcrypt hashes the usual $2a$ format.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.Iterations, h.argon2.Memory, h.argon2.Parallelism, h.argon2.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.argon2.Memory, h.argon2.Iterations,
+		h.argon2.Parallelism, encode(salt), encode(key)), nil
+}
+
+// Verify checks password against hash in constant time. It returns ErrMismatch when they do not match, and
+// whether hash should be replaced by a new one because it was produced with another algorithm or parameters.
+func (h *Hasher) Verify(hash, password string) (rehash bool, err error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, ErrMismatch
+		}
+		params.SaltLength = uint32(len(salt))
+		return h.algorithm != Argon2id || params != h.argon2, nil
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, ErrUnknownHash
+	}
+	// CompareHashAndPassword compares in constant time.
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrMismatch
+		}
+		return false, fmt.Errorf("failed to verify password: %w", err)
+	}
+	return h.algorithm != Bcrypt || cost != h.bcryptCost, nil
+}
+
+// decodeArgon2 parses an argon2id hash in the PHC string format.
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHash
+	}
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil || params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+func encode(b []byte) string {
+	return base64.RawStdEncoding.EncodeToString(b)
+}
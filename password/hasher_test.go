@@ -0,0 +1,71 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var fastArgon2 = password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasher_Argon2id(t *testing.T) {
+	h := password.NewHasher(password.WithArgon2id(fastArgon2))
+
+	hash, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+	other, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "hashes must be salted")
+
+	rehash, err := h.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, rehash)
+	_, err = h.Verify(hash, "correct horse battery stapler")
+	require.ErrorIs(t, err, password.ErrMismatch)
+
+	_, err = h.Verify("$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5", "x")
+	require.ErrorIs(t, err, password.ErrUnknownHash)
+	_, err = h.Verify("plaintext", "plaintext")
+	require.ErrorIs(t, err, password.ErrUnknownHash)
+}
+
+func TestHasher_Bcrypt(t *testing.T) {
+	h := password.NewHasher(password.WithBcrypt(bcrypt.MinCost))
+
+	hash, err := h.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"), hash)
+
+	rehash, err := h.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.False(t, rehash)
+	_, err = h.Verify(hash, "wrong")
+	require.ErrorIs(t, err, password.ErrMismatch)
+}
+
+func TestHasher_VerifyTellsWhenToRehash(t *testing.T) {
+	bcryptHash, err := password.NewHasher(password.WithBcrypt(bcrypt.MinCost)).Hash("correct horse battery staple")
+	require.NoError(t, err)
+	argonHash, err := password.NewHasher(password.WithArgon2id(fastArgon2)).Hash("correct horse battery staple")
+	require.NoError(t, err)
+
+	stronger := fastArgon2
+	stronger.Iterations = 2
+	h := password.NewHasher(password.WithArgon2id(stronger))
+	for name, hash := range map[string]string{"other algorithm": bcryptHash, "other parameters": argonHash} {
+		t.Run(name, func(t *testing.T) {
+			rehash, err := h.Verify(hash, "correct horse battery staple")
+			require.NoError(t, err)
+			assert.True(t, rehash)
+		})
+	}
+
+	rehash, err := password.NewHasher(password.WithBcrypt(bcrypt.MinCost+1)).Verify(bcryptHash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, rehash)
+}
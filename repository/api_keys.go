@@ -0,0 +1,455 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// insertAPIKeyQuery only stores keys of service accounts or of existing users of the tenant.
+	insertAPIKeyQuery = `
+    INSERT INTO api_keys (id, tenant_id, prefix, key_hash, name, user_id, service_account, permissions, expires_at, created_at)
+    SELECT $2, $1, $3, $4, $5, $6, $7, $8, $9, $10
+     WHERE $6::uuid IS NULL OR EXISTS (SELECT 1 FROM users WHERE tenant_id = $1 AND id = $6)
+    `
+
+	selectAPIKeysQuery = `
+    SELECT id, prefix, key_hash, name, user_id, service_account, permissions, expires_at, last_used_at, created_at, revoked_at
+      FROM api_keys
+     WHERE tenant_id = $1
+    `
+
+	revokeAPIKeyQuery = `
+    UPDATE api_keys SET revoked_at = $3 WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL
+    `
+
+	touchAPIKeyQuery = `
+    UPDATE api_keys SET last_used_at = $3 WHERE tenant_id = $1 AND id = $2
+    `
+
+	insertAPIKeyQuery2 = `
+    INSERT INTO api_keys(id, tenant_id, prefix, key_hash, name, user_id, service_account, permissions, expires_at, created_at)
+    SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+     WHERE ? IS NULL OR EXISTS (SELECT 1 FROM users WHERE tenant_id = ? AND id = ?);
+`
+
+	selectAPIKeysQuery2 = `
+    SELECT id, prefix, key_hash, name, user_id, service_account, permissions, expires_at, last_used_at, created_at, revoked_at
+      FROM api_keys
+     WHERE tenant_id = ?
+`
+
+	revokeAPIKeyQuery2 = `
+    UPDATE api_keys
+       SET revoked_at = ?
+     WHERE tenant_id = ? AND id = ? AND revoked_at IS NULL;
+`
+
+	touchAPIKeyQuery2 = `
+    UPDATE api_keys
+       SET last_used_at = ?
+     WHERE tenant_id = ? AND id = ?;
+`
+)
+
+// APIKeyStore is implemented by repositories persisting API keys. The keys of a user are deleted along with it.
+type APIKeyStore interface {
+	// AddAPIKey stores a new key, or returns ErrUserNotFound when it belongs to an unknown user.
+	AddAPIKey(ctx context.Context, key domain.APIKey) error
+	// GetAPIKey returns a key, revoked or not, or ErrAPIKeyNotFound.
+	GetAPIKey(ctx context.Context, id uuid.UUID) (*domain.APIKey, error)
+	// GetAPIKeyByPrefix returns the key with the given prefix, revoked or not, or ErrAPIKeyNotFound.
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error)
+	// ListAPIKeys returns every key of the tenant, oldest first.
+	ListAPIKeys(ctx context.Context) ([]domain.APIKey, error)
+	// RevokeAPIKey revokes a key, or returns ErrAPIKeyNotFound when it is unknown or already revoked.
+	RevokeAPIKey(ctx context.Context, id uuid.UUID) error
+	// TouchAPIKey records that a key was used at the given time.
+	TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error
+}
+
+// tenantAPIKey is a stored API key along with the tenant owning it.
+type tenantAPIKey struct {
+	tenant string
+	key    domain.APIKey
+}
+
+// AddAPIKey stores an API key in memory.
+func (r *MemoryRepository) AddAPIKey(ctx context.Context, key domain.APIKey) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key.UserID != nil && r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == *key.UserID }) < 0 {
+		return ErrUserNotFound
+	}
+	key.Permissions = slices.Clone(key.Permissions)
+	r.apiKeys = append(r.apiKeys, tenantAPIKey{tenant: tenantID, key: key})
+	return nil
+}
+
+// GetAPIKey returns an API key of the tenant.
+func (r *MemoryRepository) GetAPIKey(ctx context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	return r.findAPIKey(ctx, func(k domain.APIKey) bool { return k.ID == id })
+}
+
+// GetAPIKeyByPrefix returns the API key of the tenant with the given prefix.
+func (r *MemoryRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	return r.findAPIKey(ctx, func(k domain.APIKey) bool { return k.Prefix == prefix })
+}
+
+// ListAPIKeys returns the API keys of the tenant.
+func (r *MemoryRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := []domain.APIKey{}
+	for _, k := range r.apiKeys {
+		if k.tenant == tenantID {
+			key := k.key
+			key.Permissions = slices.Clone(key.Permissions)
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an active API key of the tenant.
+func (r *MemoryRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	return r.updateAPIKey(ctx, id, func(k *domain.APIKey) bool {
+		if k.RevokedAt != nil {
+			return false
+		}
+		now := time.Now()
+		k.RevokedAt = &now
+		return true
+	})
+}
+
+// TouchAPIKey sets the last use of an API key of the tenant.
+func (r *MemoryRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.updateAPIKey(ctx, id, func(k *domain.APIKey) bool {
+		k.LastUsedAt = &at
+		return true
+	})
+}
+
+func (r *MemoryRepository) findAPIKey(ctx context.Context, match func(domain.APIKey) bool) (*domain.APIKey, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.apiKeys {
+		if k.tenant == tenantID && match(k.key) {
+			key := k.key
+			key.Permissions = slices.Clone(key.Permissions)
+			return &key, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// updateAPIKey applies update to the API key of the tenant with the given ID, or returns ErrAPIKeyNotFound
+// when there is none or update reports no change.
+func (r *MemoryRepository) updateAPIKey(ctx context.Context, id uuid.UUID, update func(*domain.APIKey) bool) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.apiKeys {
+		k := &r.apiKeys[i]
+		if k.tenant == tenantID && k.key.ID == id {
+			if !update(&k.key) {
+				return ErrAPIKeyNotFound
+			}
+			return nil
+		}
+	}
+	return ErrAPIKeyNotFound
+}
+
+// AddAPIKey stores an API key.
+func (r *PsqlRepository) AddAPIKey(ctx context.Context, key domain.APIKey) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		tag, err := tx.Exec(ctx, insertAPIKeyQuery, tenantID, key.ID, key.Prefix, key.KeyHash, key.Name, key.UserID,
+			nullString(key.ServiceAccount), permissionStrings(key.Permissions), key.ExpiresAt, key.CreatedAt)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute insert api key query: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return struct{}{}, ErrUserNotFound
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// GetAPIKey returns an API key.
+func (r *PsqlRepository) GetAPIKey(ctx context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	return r.getAPIKey(ctx, "id", id)
+}
+
+// GetAPIKeyByPrefix returns the API key with the given prefix, read from the primary so that a revocation
+// is seen at once.
+func (r *PsqlRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	return r.getAPIKey(ctx, "prefix", prefix)
+}
+
+func (r *PsqlRepository) getAPIKey(ctx context.Context, column string, value any) (*domain.APIKey, error) {
+	keys, err := r.selectAPIKeys(ctx, selectAPIKeysQuery+" AND "+column+" = $2", value)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &keys[0], nil
+}
+
+// ListAPIKeys returns the API keys of the tenant.
+func (r *PsqlRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	return r.selectAPIKeys(ctx, selectAPIKeysQuery+" ORDER BY created_at, id")
+}
+
+func (r *PsqlRepository) selectAPIKeys(ctx context.Context, query string, args ...any) ([]domain.APIKey, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) ([]domain.APIKey, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := tx.Query(ctx, query, append([]any{tenantID}, args...)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute select api keys query: %w", err)
+		}
+		defer rows.Close()
+
+		keys := []domain.APIKey{}
+		for rows.Next() {
+			var k domain.APIKey
+			var serviceAccount *string
+			var permissions []string
+			if err := rows.Scan(&k.ID, &k.Prefix, &k.KeyHash, &k.Name, &k.UserID, &serviceAccount, &permissions,
+				&k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt, &k.RevokedAt); err != nil {
+				return nil, fmt.Errorf("failed to scan api key: %w", err)
+			}
+			if serviceAccount != nil {
+				k.ServiceAccount = *serviceAccount
+			}
+			k.Permissions = toPermissions(permissions)
+			keys = append(keys, k)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to iterate api keys: %w", err)
+		}
+		return keys, nil
+	})
+}
+
+// RevokeAPIKey revokes an active API key.
+func (r *PsqlRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	return r.updateAPIKey(ctx, revokeAPIKeyQuery, id, time.Now())
+}
+
+// TouchAPIKey sets the last use of an API key.
+func (r *PsqlRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.updateAPIKey(ctx, touchAPIKeyQuery, id, at)
+}
+
+func (r *PsqlRepository) updateAPIKey(ctx context.Context, query string, id uuid.UUID, at time.Time) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		tag, err := tx.Exec(ctx, query, tenantID, id, at)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute update api key query: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return struct{}{}, ErrAPIKeyNotFound
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// AddAPIKey stores an API key.
+func (r *SqlliteRepository) AddAPIKey(ctx context.Context, key domain.APIKey) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, insertAPIKeyQuery2, key.ID, tenantID, key.Prefix, key.KeyHash, key.Name, key.UserID,
+		nullString(key.ServiceAccount), strings.Join(permissionStrings(key.Permissions), ","), key.ExpiresAt, key.CreatedAt,
+		key.UserID, tenantID, key.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to insert api key: %w", err)
+	}
+	n, err := rowsAffected(res)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetAPIKey returns an API key.
+func (r *SqlliteRepository) GetAPIKey(ctx context.Context, id uuid.UUID) (*domain.APIKey, error) {
+	return r.getAPIKey(ctx, "id", id)
+}
+
+// GetAPIKeyByPrefix returns the API key with the given prefix.
+func (r *SqlliteRepository) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	return r.getAPIKey(ctx, "prefix", prefix)
+}
+
+func (r *SqlliteRepository) getAPIKey(ctx context.Context, column string, value any) (*domain.APIKey, error) {
+	keys, err := r.selectAPIKeys(ctx, selectAPIKeysQuery2+" AND "+column+" = ?", value)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &keys[0], nil
+}
+
+// ListAPIKeys returns the API keys of the tenant.
+func (r *SqlliteRepository) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	return r.selectAPIKeys(ctx, selectAPIKeysQuery2+" ORDER BY created_at, id")
+}
+
+func (r *SqlliteRepository) selectAPIKeys(ctx context.Context, query string, args ...any) ([]domain.APIKey, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, query, append([]any{tenantID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		var k domain.APIKey
+		var userID, serviceAccount sql.NullString
+		var permissions string
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Prefix, &k.KeyHash, &k.Name, &userID, &serviceAccount, &permissions,
+			&expiresAt, &lastUsedAt, &k.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		if userID.Valid {
+			id, err := uuid.Parse(userID.String)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse api key user: %w", err)
+			}
+			k.UserID = &id
+		}
+		k.ServiceAccount = serviceAccount.String
+		if permissions != "" {
+			k.Permissions = toPermissions(strings.Split(permissions, ","))
+		}
+		k.ExpiresAt = nullTimePtr(expiresAt)
+		k.LastUsedAt = nullTimePtr(lastUsedAt)
+		k.RevokedAt = nullTimePtr(revokedAt)
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an active API key.
+func (r *SqlliteRepository) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	return r.updateAPIKey(ctx, revokeAPIKeyQuery2, id, time.Now())
+}
+
+// TouchAPIKey sets the last use of an API key.
+func (r *SqlliteRepository) TouchAPIKey(ctx context.Context, id uuid.UUID, at time.Time) error {
+	return r.updateAPIKey(ctx, touchAPIKeyQuery2, id, at)
+}
+
+func (r *SqlliteRepository) updateAPIKey(ctx context.Context, query string, id uuid.UUID, at time.Time) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, query, at, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+	n, err := rowsAffected(res)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// nullString returns nil for the empty string, so that it is stored as NULL.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func permissionStrings(permissions []domain.Permission) []string {
+	s := make([]string, len(permissions))
+	for i, p := range permissions {
+		s[i] = string(p)
+	}
+	return s
+}
+
+func toPermissions(s []string) []domain.Permission {
+	permissions := make([]domain.Permission, len(s))
+	for i, p := range s {
+		permissions[i] = domain.Permission(p)
+	}
+	return permissions
+}
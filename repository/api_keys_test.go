@@ -0,0 +1,110 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	sqlite := repository.NewSQLLiteRepository(db)
+	require.NoError(t, sqlite.Migrate(testContext(t)))
+
+	stores := map[string]interface {
+		repository.UserRepository
+		repository.APIKeyStore
+	}{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": sqlite,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := testContext(t)
+			user, err := store.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com"})
+			require.NoError(t, err)
+
+			now := time.Now().UTC().Truncate(time.Second)
+			expiresAt := now.Add(time.Hour)
+			userKey := domain.APIKey{
+				ID:          uuid.New(),
+				Prefix:      "rpk_" + name + "1",
+				KeyHash:     "hash1",
+				Name:        "nightly export",
+				UserID:      &user.ID,
+				Permissions: []domain.Permission{domain.PermUsersRead},
+				ExpiresAt:   &expiresAt,
+				CreatedAt:   now,
+			}
+			serviceKey := domain.APIKey{
+				ID:             uuid.New(),
+				Prefix:         "rpk_" + name + "2",
+				KeyHash:        "hash2",
+				Name:           "billing",
+				ServiceAccount: "billing",
+				Permissions:    []domain.Permission{domain.PermUsersRead, domain.PermUsersWrite},
+				CreatedAt:      now.Add(time.Second),
+			}
+			require.NoError(t, store.AddAPIKey(ctx, userKey))
+			require.NoError(t, store.AddAPIKey(ctx, serviceKey))
+			unknown := uuid.New()
+			require.ErrorIs(t, store.AddAPIKey(ctx, domain.APIKey{ID: uuid.New(), Prefix: "rpk_" + name + "3", UserID: &unknown,
+				Permissions: []domain.Permission{domain.PermUsersRead}, CreatedAt: now}), repository.ErrUserNotFound)
+
+			got, err := store.GetAPIKeyByPrefix(ctx, userKey.Prefix)
+			require.NoError(t, err)
+			assert.Equal(t, userKey.ID, got.ID)
+			assert.Equal(t, "hash1", got.KeyHash)
+			assert.Equal(t, &user.ID, got.UserID)
+			assert.Equal(t, userKey.Permissions, got.Permissions)
+			require.NotNil(t, got.ExpiresAt)
+			assert.True(t, expiresAt.Equal(*got.ExpiresAt))
+			assert.Nil(t, got.LastUsedAt)
+
+			got, err = store.GetAPIKey(ctx, serviceKey.ID)
+			require.NoError(t, err)
+			assert.Nil(t, got.UserID)
+			assert.Equal(t, "billing", got.ServiceAccount)
+			assert.Nil(t, got.ExpiresAt)
+
+			keys, err := store.ListAPIKeys(ctx)
+			require.NoError(t, err)
+			require.Len(t, keys, 2)
+			assert.Equal(t, userKey.ID, keys[0].ID)
+			assert.Equal(t, serviceKey.ID, keys[1].ID)
+
+			require.NoError(t, store.TouchAPIKey(ctx, userKey.ID, now))
+			require.NoError(t, store.RevokeAPIKey(ctx, serviceKey.ID))
+			require.ErrorIs(t, store.RevokeAPIKey(ctx, serviceKey.ID), repository.ErrAPIKeyNotFound)
+			got, err = store.GetAPIKey(ctx, userKey.ID)
+			require.NoError(t, err)
+			require.NotNil(t, got.LastUsedAt)
+			assert.True(t, now.Equal(*got.LastUsedAt))
+			got, err = store.GetAPIKey(ctx, serviceKey.ID)
+			require.NoError(t, err)
+			assert.NotNil(t, got.RevokedAt)
+
+			other := tenant.WithID(ctx, "other")
+			_, err = store.GetAPIKeyByPrefix(other, userKey.Prefix)
+			require.ErrorIs(t, err, repository.ErrAPIKeyNotFound)
+			require.ErrorIs(t, store.TouchAPIKey(other, userKey.ID, now), repository.ErrAPIKeyNotFound)
+
+			require.NoError(t, store.DeleteUser(ctx, user.ID))
+			_, err = store.GetAPIKey(ctx, userKey.ID)
+			require.ErrorIs(t, err, repository.ErrAPIKeyNotFound)
+			keys, err = store.ListAPIKeys(ctx)
+			require.NoError(t, err)
+			assert.Len(t, keys, 1, "service account keys outlive users")
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultAuditPageSize = 100
+
+	insertAuditQuery = `
+    INSERT INTO user_audit (id, tenant_id, user_id, actor_kind, actor_id, action, changes, occurred_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+
+	selectAuditQuery = `
+    SELECT seq, id, tenant_id, user_id, actor_kind, actor_id, action, changes, occurred_at
+      FROM user_audit
+     WHERE tenant_id = $1 AND user_id = $2 AND seq > $3
+     ORDER BY seq
+     LIMIT $4
+    `
+
+	selectAuditChangesQuery = `SELECT id, changes FROM user_audit WHERE tenant_id = $1 AND user_id = $2`
+
+	// Only the changes of an entry may be updated, see the user_audit_append_only trigger.
+	redactAuditQuery = `UPDATE user_audit SET changes = $2 WHERE id = $1`
+
+	insertAuditQuery2 = `
+    INSERT INTO user_audit(id, tenant_id, user_id, actor_kind, actor_id, action, changes, occurred_at)
+    VALUES(?, ?, ?, ?, ?, ?, ?, ?);
+`
+
+	selectAuditQuery2 = `
+    SELECT seq, id, tenant_id, user_id, actor_kind, actor_id, action, changes, occurred_at
+      FROM user_audit
+     WHERE tenant_id = ? AND user_id = ? AND seq > ?
+     ORDER BY seq
+     LIMIT ?;
+`
+
+	selectAuditChangesQuery2 = `
+    SELECT id, changes
+      FROM user_audit
+     WHERE tenant_id = ? AND user_id = ?;
+`
+
+	redactAuditQuery2 = `
+    UPDATE user_audit
+       SET changes = ?
+     WHERE id = ?;
+`
+)
+
+// AuditQuery selects a page of the audit history of a user.
+type AuditQuery struct {
+	// After is the Next cursor of the previous page; zero starts from the oldest entry.
+	After int64
+	// Limit caps the number of entries returned (100 by default).
+	Limit int
+}
+
+func (q AuditQuery) limit() int {
+	if q.Limit <= 0 {
+		return defaultAuditPageSize
+	}
+	return q.Limit
+}
+
+// AuditPage is a page of audit entries, oldest first.
+type AuditPage struct {
+	Entries []domain.AuditEntry `json:"entries"`
+	// Next is the After of the following page, or zero on the last page.
+	Next int64 `json:"next,omitempty"`
+}
+
+// AuditAppender records audit entries. The Tx of repositories with an audit trail implement it,
+// so that entries are committed or rolled back with the change they describe.
+type AuditAppender interface {
+	// AppendAudit records entries; entries without a tenant are recorded under the tenant of ctx.
+	AppendAudit(ctx context.Context, entries ...domain.AuditEntry) error
+}
+
+// AuditStore is implemented by repositories keeping an append-only audit trail of user changes.
+type AuditStore interface {
+	AuditAppender
+	// AuditHistory returns a page of the audit entries of the user in the tenant of ctx.
+	AuditHistory(ctx context.Context, userID uuid.UUID, query AuditQuery) (AuditPage, error)
+}
+
+// pageOf builds the page of a query that fetched up to one entry more than its limit.
+func pageOf(entries []domain.AuditEntry, query AuditQuery) AuditPage {
+	if len(entries) <= query.limit() {
+		return AuditPage{Entries: entries}
+	}
+	entries = entries[:query.limit()]
+	return AuditPage{Entries: entries, Next: entries[len(entries)-1].Seq}
+}
+
+// withTenant returns entry with its tenant set to tenantID if it has none.
+func withTenant(entry domain.AuditEntry, tenantID string) domain.AuditEntry {
+	if entry.TenantID == "" {
+		entry.TenantID = tenantID
+	}
+	return entry
+}
+
+// AppendAudit stores audit entries in memory.
+func (r *MemoryRepository) AppendAudit(ctx context.Context, entries ...domain.AuditEntry) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, entry := range entries {
+		entry = withTenant(entry, tenantID)
+		entry.Seq = int64(len(r.audit) + 1)
+		entry.Changes = slices.Clone(entry.Changes)
+		r.audit = append(r.audit, entry)
+	}
+	return nil
+}
+
+// AuditHistory returns a page of the audit entries of the user.
+func (r *MemoryRepository) AuditHistory(ctx context.Context, userID uuid.UUID, query AuditQuery) (AuditPage, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return AuditPage{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]domain.AuditEntry, 0)
+	for _, entry := range r.audit {
+		if entry.TenantID == tenantID && entry.UserID == userID && entry.Seq > query.After {
+			entry.Changes = slices.Clone(entry.Changes)
+			entries = append(entries, entry)
+			if len(entries) > query.limit() {
+				break
+			}
+		}
+	}
+	return pageOf(entries, query), nil
+}
+
+// AppendAudit records audit entries in their own transaction.
+func (r *PsqlRepository) AppendAudit(ctx context.Context, entries ...domain.AuditEntry) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		return struct{}{}, psqlAppendAudit(ctx, tx, r.emails, entries)
+	})
+	return err
+}
+
+// AuditHistory returns a page of the audit entries of the user, read from the primary.
+func (r *PsqlRepository) AuditHistory(ctx context.Context, userID uuid.UUID, query AuditQuery) (AuditPage, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) (AuditPage, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		rows, err := tx.Query(ctx, selectAuditQuery, tenantID, userID, query.After, query.limit()+1)
+		if err != nil {
+			return AuditPage{}, fmt.Errorf("failed to execute select audit query: %w", err)
+		}
+		defer rows.Close()
+		entries, err := scanAudit(rows, r.emails)
+		if err != nil {
+			return AuditPage{}, err
+		}
+		return pageOf(entries, query), nil
+	})
+}
+
+// AppendAudit records audit entries in the transaction.
+func (t *psqlTx) AppendAudit(ctx context.Context, entries ...domain.AuditEntry) error {
+	return psqlAppendAudit(ctx, t.tx, t.emails, entries)
+}
+
+func psqlAppendAudit(ctx context.Context, q psqlQuerier, emails emailCodec, entries []domain.AuditEntry) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entry = withTenant(entry, tenantID)
+		sealed, err := emails.sealChanges(entry.Changes)
+		if err != nil {
+			return err
+		}
+		changes, err := json.Marshal(sealed)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit changes: %w", err)
+		}
+		_, err = q.Exec(ctx, insertAuditQuery, entry.ID, entry.TenantID, entry.UserID, entry.Actor.Kind, entry.Actor.ID,
+			entry.Action, changes, entry.OccurredAt)
+		if err != nil {
+			return fmt.Errorf("failed to execute insert audit query: %w", err)
+		}
+	}
+	return nil
+}
+
+// psqlRedactAudit removes the values from the audit entries of the user and returns how many entries it redacted.
+func psqlRedactAudit(ctx context.Context, tx pgx.Tx, tenantID string, userID uuid.UUID) (int, error) {
+	rows, err := tx.Query(ctx, selectAuditChangesQuery, tenantID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute select audit changes query: %w", err)
+	}
+	entries, err := scanAuditChanges(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Redacted().Changes)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode audit changes: %w", err)
+		}
+		if _, err := tx.Exec(ctx, redactAuditQuery, entry.ID, changes); err != nil {
+			return 0, fmt.Errorf("failed to execute redact audit query: %w", err)
+		}
+	}
+	return len(entries), nil
+}
+
+// AppendAudit records audit entries.
+func (r *SqlliteRepository) AppendAudit(ctx context.Context, entries ...domain.AuditEntry) error {
+	return sqliteAppendAudit(ctx, r.db, r.emails, entries)
+}
+
+// AuditHistory returns a page of the audit entries of the user.
+func (r *SqlliteRepository) AuditHistory(ctx context.Context, userID uuid.UUID, query AuditQuery) (AuditPage, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return AuditPage{}, err
+	}
+	rows, err := r.db.QueryContext(ctx, selectAuditQuery2, tenantID, userID, query.After, query.limit()+1)
+	if err != nil {
+		return AuditPage{}, fmt.Errorf("failed to query audit entries: %w", err)
+	}
+	defer rows.Close()
+	entries, err := scanAudit(rows, r.emails)
+	if err != nil {
+		return AuditPage{}, err
+	}
+	return pageOf(entries, query), nil
+}
+
+// AppendAudit records audit entries in the transaction.
+func (t *sqliteTx) AppendAudit(ctx context.Context, entries ...domain.AuditEntry) error {
+	return sqliteAppendAudit(ctx, t.tx, t.emails, entries)
+}
+
+func sqliteAppendAudit(ctx context.Context, q sqlQuerier, emails emailCodec, entries []domain.AuditEntry) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		entry = withTenant(entry, tenantID)
+		sealed, err := emails.sealChanges(entry.Changes)
+		if err != nil {
+			return err
+		}
+		changes, err := json.Marshal(sealed)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit changes: %w", err)
+		}
+		_, err = q.ExecContext(ctx, insertAuditQuery2, entry.ID, entry.TenantID, entry.UserID, entry.Actor.Kind, entry.Actor.ID,
+			entry.Action, string(changes), entry.OccurredAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// sqliteRedactAudit removes the values from the audit entries of the user and returns how many entries it redacted.
+func sqliteRedactAudit(ctx context.Context, tx *sql.Tx, tenantID string, userID uuid.UUID) (int, error) {
+	rows, err := tx.QueryContext(ctx, selectAuditChangesQuery2, tenantID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query audit changes: %w", err)
+	}
+	entries, err := scanAuditChanges(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		changes, err := json.Marshal(entry.Redacted().Changes)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encode audit changes: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, redactAuditQuery2, string(changes), entry.ID); err != nil {
+			return 0, fmt.Errorf("failed to redact audit entry: %w", err)
+		}
+	}
+	return len(entries), nil
+}
+
+// scanAudit reads audit entries, decrypting the emails of their changes.
+func scanAudit(rows outboxRows, emails emailCodec) ([]domain.AuditEntry, error) {
+	entries := make([]domain.AuditEntry, 0)
+	for rows.Next() {
+		var (
+			entry   domain.AuditEntry
+			changes []byte
+		)
+		err := rows.Scan(&entry.Seq, &entry.ID, &entry.TenantID, &entry.UserID, &entry.Actor.Kind, &entry.Actor.ID,
+			&entry.Action, &changes, &entry.OccurredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit row: %w", err)
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode audit changes: %w", err)
+		}
+		if entry.Changes, err = emails.openChanges(entry.Changes); err != nil {
+			return nil, err
+		}
+		entry.OccurredAt = entry.OccurredAt.UTC()
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return entries, nil
+}
+
+// scanAuditChanges reads the ID and changes of audit entries.
+func scanAuditChanges(rows outboxRows) ([]domain.AuditEntry, error) {
+	var entries []domain.AuditEntry
+	for rows.Next() {
+		var (
+			entry   domain.AuditEntry
+			changes []byte
+		)
+		if err := rows.Scan(&entry.ID, &changes); err != nil {
+			return nil, fmt.Errorf("failed to scan audit row: %w", err)
+		}
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode audit changes: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return entries, nil
+}
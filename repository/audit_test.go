@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditStore_AuditHistory(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	sqlite := repository.NewSQLLiteRepository(db)
+	require.NoError(t, sqlite.Migrate(testContext(t)))
+
+	stores := map[string]repository.AuditStore{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": sqlite,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := testContext(t)
+			userID := uuid.New()
+			operator := domain.Actor{Kind: domain.ActorUser, ID: "operator"}
+			alice := &domain.User{ID: userID, Name: "Alice", Email: "alice@example.com"}
+			renamed := &domain.User{ID: userID, Name: "Alicia", Email: "alice@example.com"}
+			require.NoError(t, store.AppendAudit(ctx,
+				domain.NewAuditEntry(domain.AuditCreate, operator, userID, nil, alice),
+				domain.NewAuditEntry(domain.AuditUpdate, operator, userID, alice, renamed),
+				domain.NewAuditEntry(domain.AuditCreate, operator, uuid.New(), nil, alice),
+				domain.NewAuditEntry(domain.AuditDelete, operator, userID, renamed, nil),
+			))
+
+			page, err := store.AuditHistory(ctx, userID, repository.AuditQuery{Limit: 2})
+			require.NoError(t, err)
+			require.Len(t, page.Entries, 2)
+			assert.NotZero(t, page.Next)
+			assert.Equal(t, domain.AuditCreate, page.Entries[0].Action)
+			assert.Equal(t, "test", page.Entries[0].TenantID)
+			assert.Equal(t, operator, page.Entries[1].Actor)
+			assert.Equal(t, []domain.FieldChange{{Field: "name", Before: "Alice", After: "Alicia"}}, page.Entries[1].Changes)
+
+			page, err = store.AuditHistory(ctx, userID, repository.AuditQuery{After: page.Next, Limit: 2})
+			require.NoError(t, err)
+			require.Len(t, page.Entries, 1)
+			assert.Zero(t, page.Next)
+			assert.Equal(t, domain.AuditDelete, page.Entries[0].Action)
+			assert.Len(t, page.Entries[0].Changes, 2)
+		})
+	}
+}
+
+func TestSqlLiteRepository_AuditIsAppendOnly(t *testing.T) {
+	ctx := testContext(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	repo := repository.NewSQLLiteRepository(db)
+	require.NoError(t, repo.Migrate(ctx))
+
+	user := domain.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com"}
+	entry := domain.NewAuditEntry(domain.AuditCreate, domain.Actor{Kind: domain.ActorService, ID: "seed"}, user.ID, nil, &user)
+	err = repo.InTx(ctx, func(ctx context.Context, tx repository.Tx) error {
+		return tx.(repository.AuditAppender).AppendAudit(ctx, entry)
+	})
+	require.NoError(t, err)
+
+	_, err = db.Exec(`DELETE FROM user_audit`)
+	require.Error(t, err)
+	_, err = db.Exec(`UPDATE user_audit SET action = 'delete'`)
+	require.Error(t, err)
+
+	page, err := repo.AuditHistory(ctx, user.ID, repository.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, domain.AuditCreate, page.Entries[0].Action)
+}
@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+)
+
+const defaultBackfillBatchSize = 100
+
+// Checkpoint stores the ID of the last user copied by Backfill so that an interrupted run can resume.
+type Checkpoint interface {
+	// Load returns the last copied ID, or uuid.Nil when nothing has been copied yet.
+	Load(ctx context.Context) (uuid.UUID, error)
+	// Save records id as the last copied ID.
+	Save(ctx context.Context, id uuid.UUID) error
+}
+
+// FileCheckpoint is a Checkpoint kept in a file, replaced atomically on every save.
+type FileCheckpoint struct {
+	path string
+}
+
+// NewFileCheckpoint returns a Checkpoint stored at path.
+func NewFileCheckpoint(path string) *FileCheckpoint {
+	return &FileCheckpoint{path: path}
+}
+
+// Load reads the checkpoint file. A missing file means the backfill starts from the beginning.
+func (c *FileCheckpoint) Load(_ context.Context) (uuid.UUID, error) {
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return uuid.Nil, nil
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	id, err := uuid.Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return id, nil
+}
+
+// Save writes id to a temporary file and renames it over the checkpoint file.
+func (c *FileCheckpoint) Save(_ context.Context, id uuid.UUID) error {
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(id.String() + "\n"); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// BackfillOption configures Backfill.
+type BackfillOption func(*backfillConfig)
+
+type backfillConfig struct {
+	batchSize int
+}
+
+// WithBatchSize sets the number of users read per page, which is also the number of users copied between two
+// checkpoint saves.
+func WithBatchSize(n int) BackfillOption {
+	return func(c *backfillConfig) {
+		c.batchSize = n
+	}
+}
+
+// BackfillResult counts the users written to the destination by a Backfill run.
+type BackfillResult struct {
+	// Copied is the number of users copied after the checkpoint.
+	Copied int
+	// Repaired is the number of users the reconcile pass added to the destination or overwrote there.
+	Repaired int
+	// Deleted is the number of users the reconcile pass deleted from the destination.
+	Deleted int
+}
+
+// Backfill copies every user of the tenant of ctx from src into dst, keeping their IDs, then reconciles both.
+//
+// Users are copied in ID order, a page at a time, and the last copied ID is saved in cp after every page so that
+// an interrupted run resumes after it. Since IDs are random, users added to src during or between runs may
+// sort before the checkpoint: the reconcile pass then walks both repositories in ID order from the start and
+// fixes every user of dst that is missing, differs from src or is no longer in src, such as the ones left behind
+// by the failed secondary writes of a DualWriteRepository. Users are upserted by ID, so writing one twice is harmless.
+// Pages are read with ListUsers when the repositories implement UserPager, and by listing every user otherwise.
+func Backfill(ctx context.Context, src, dst UserRepository, cp Checkpoint, opts ...BackfillOption) (BackfillResult, error) {
+	cfg := backfillConfig{batchSize: defaultBackfillBatchSize}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.batchSize <= 0 {
+		cfg.batchSize = defaultBackfillBatchSize
+	}
+
+	var result BackfillResult
+	last, err := cp.Load(ctx)
+	if err != nil {
+		return result, err
+	}
+	for {
+		users, err := listUsers(ctx, src, last, cfg.batchSize)
+		if err != nil {
+			return result, fmt.Errorf("failed to list source users: %w", err)
+		}
+		if len(users) == 0 {
+			break
+		}
+		for _, user := range users {
+			if _, err := upsertUser(ctx, dst, user); err != nil {
+				return result, fmt.Errorf("failed to copy user %s: %w", user.ID, err)
+			}
+			result.Copied++
+		}
+		last = users[len(users)-1].ID
+		if err := cp.Save(ctx, last); err != nil {
+			return result, err
+		}
+		if len(users) < cfg.batchSize {
+			break
+		}
+	}
+
+	err = reconcile(ctx, src, dst, cfg.batchSize, &result)
+	return result, err
+}
+
+// reconcile walks src and dst together in ID order and syncs every user that differs between them.
+func reconcile(ctx context.Context, src, dst UserRepository, pageSize int, result *BackfillResult) error {
+	srcUsers := &userCursor{repo: src, pageSize: pageSize}
+	dstUsers := &userCursor{repo: dst, pageSize: pageSize}
+	// Users whose email is still held by a user of dst that is yet to be deleted are synced at the end.
+	var conflicts []uuid.UUID
+
+	s, sOK, err := srcUsers.next(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list source users: %w", err)
+	}
+	d, dOK, err := dstUsers.next(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list destination users: %w", err)
+	}
+	for sOK || dOK {
+		var order int
+		switch {
+		case !dOK:
+			order = -1
+		case !sOK:
+			order = 1
+		default:
+			order = bytes.Compare(s.ID[:], d.ID[:])
+		}
+
+		var id uuid.UUID
+		switch {
+		case order < 0:
+			id = s.ID
+		case order > 0:
+			id = d.ID
+		case s != d:
+			id = s.ID
+		}
+		if id != uuid.Nil {
+			err := syncUser(ctx, src, dst, id, result)
+			if errors.Is(err, ErrEmailAlreadyExists) {
+				conflicts = append(conflicts, id)
+			} else if err != nil {
+				return err
+			}
+		}
+
+		if order <= 0 {
+			if s, sOK, err = srcUsers.next(ctx); err != nil {
+				return fmt.Errorf("failed to list source users: %w", err)
+			}
+		}
+		if order >= 0 {
+			if d, dOK, err = dstUsers.next(ctx); err != nil {
+				return fmt.Errorf("failed to list destination users: %w", err)
+			}
+		}
+	}
+
+	for _, id := range conflicts {
+		if err := syncUser(ctx, src, dst, id, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncUser makes the user with the given ID in dst match the one in src, deleting it when src has none.
+// The user is read from src again so that changes made since it was listed are not undone.
+func syncUser(ctx context.Context, src, dst UserRepository, id uuid.UUID, result *BackfillResult) error {
+	user, err := src.GetUserByID(ctx, id)
+	if errors.Is(err, ErrUserNotFound) {
+		err := dst.DeleteUser(ctx, id)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete user %s: %w", id, err)
+		}
+		result.Deleted++
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read user %s: %w", id, err)
+	}
+	if _, err := upsertUser(ctx, dst, *user); err != nil {
+		return fmt.Errorf("failed to repair user %s: %w", id, err)
+	}
+	result.Repaired++
+	return nil
+}
+
+// userCursor walks the users of a repository in ID order, a page at a time.
+type userCursor struct {
+	repo     UserRepository
+	pageSize int
+	page     []domain.User
+	after    uuid.UUID
+	done     bool
+}
+
+// next returns the next user, and false once every user has been returned.
+func (c *userCursor) next(ctx context.Context) (domain.User, bool, error) {
+	if len(c.page) == 0 && !c.done {
+		page, err := listUsers(ctx, c.repo, c.after, c.pageSize)
+		if err != nil {
+			return domain.User{}, false, err
+		}
+		c.page = page
+		c.done = len(page) < c.pageSize
+		if len(page) > 0 {
+			c.after = page[len(page)-1].ID
+		}
+	}
+	if len(c.page) == 0 {
+		return domain.User{}, false, nil
+	}
+	user := c.page[0]
+	c.page = c.page[1:]
+	return user, true, nil
+}
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheSize        = 1024
+	defaultCacheTTL         = time.Minute
+	defaultCacheNegativeTTL = 10 * time.Second
+)
+
+// CachingRepository is a read-through UserRepository decorator caching lookups by ID and by email.
+// Entries expire after a TTL and the least recently used ones are evicted when the cache is full.
+// Not-found results are cached for a shorter TTL, concurrent misses for the same key share a single
+// call to the wrapped repository, and every successful write invalidates the affected keys.
+// GetAllUsers is never cached.
+type CachingRepository struct {
+	next        UserRepository
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// emails maps a cached user ID to its email key so that updates and deletes can invalidate it.
+	emails map[uuid.UUID]string
+	// version is bumped by every write; loads started before a write do not populate the cache.
+	version uint64
+}
+
+type cacheEntry struct {
+	key     string
+	user    *domain.User // nil for a cached not-found result
+	expires time.Time
+}
+
+// CacheOption configures a CachingRepository.
+type CacheOption func(*CachingRepository)
+
+// WithCacheSize sets the maximum number of cached entries.
+func WithCacheSize(size int) CacheOption {
+	return func(r *CachingRepository) {
+		r.size = size
+	}
+}
+
+// WithCacheTTL sets how long a found user stays cached.
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return func(r *CachingRepository) {
+		r.ttl = ttl
+	}
+}
+
+// WithNegativeCacheTTL sets how long a not-found result stays cached. Zero disables negative caching.
+func WithNegativeCacheTTL(ttl time.Duration) CacheOption {
+	return func(r *CachingRepository) {
+		r.negativeTTL = ttl
+	}
+}
+
+// NewCachingRepository wraps next with an in-process LRU/TTL cache.
+func NewCachingRepository(next UserRepository, opts ...CacheOption) *CachingRepository {
+	r := &CachingRepository{
+		next:        next,
+		size:        defaultCacheSize,
+		ttl:         defaultCacheTTL,
+		negativeTTL: defaultCacheNegativeTTL,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+		emails:      make(map[uuid.UUID]string),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// AddUser delegates to the wrapped repository and invalidates the keys of the new user.
+func (r *CachingRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	u, err := r.next.AddUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	r.invalidate(ctx, u.ID, u.Email)
+	return u, nil
+}
+
+// GetAllUsers delegates to the wrapped repository without caching.
+func (r *CachingRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	return r.next.GetAllUsers(ctx)
+}
+
+// GetUserByID returns the cached user or loads it from the wrapped repository.
+func (r *CachingRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return r.get(ctx, func(tenantID string) string { return idKey(tenantID, id) }, func(ctx context.Context) (*domain.User, error) {
+		return r.next.GetUserByID(ctx, id)
+	})
+}
+
+// GetUserByEmail returns the cached user or loads it from the wrapped repository.
+func (r *CachingRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return r.get(ctx, func(tenantID string) string { return emailKey(tenantID, email) }, func(ctx context.Context) (*domain.User, error) {
+		return r.next.GetUserByEmail(ctx, email)
+	})
+}
+
+// UpdateUser delegates to the wrapped repository and invalidates the old and new keys of the user.
+func (r *CachingRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	u, err := r.next.UpdateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	r.invalidate(ctx, u.ID, u.Email)
+	return u, nil
+}
+
+// DeleteUser delegates to the wrapped repository and invalidates the keys of the user.
+func (r *CachingRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if err := r.next.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, id, "")
+	return nil
+}
+
+// Forget drops the cached entries of the user, for writes made behind the cache such as an erasure.
+func (r *CachingRepository) Forget(ctx context.Context, id uuid.UUID) {
+	r.invalidate(ctx, id, "")
+}
+
+// get looks up the key built for the tenant of ctx, so that tenants never share entries.
+func (r *CachingRepository) get(ctx context.Context, keyOf func(tenantID string) string, load func(context.Context) (*domain.User, error)) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := keyOf(tenantID)
+	if user, found, ok := r.lookup(key); ok {
+		if !found {
+			return nil, ErrUserNotFound
+		}
+		return user, nil
+	}
+
+	r.mu.Lock()
+	version := r.version
+	r.mu.Unlock()
+
+	v, err, _ := r.group.Do(key, func() (any, error) {
+		// The load is shared by every waiting caller, so it must not be canceled by the first one leaving.
+		user, err := load(context.WithoutCancel(ctx))
+		switch {
+		case errors.Is(err, ErrUserNotFound):
+			r.store(key, nil, version)
+		case err == nil:
+			r.store(key, user, version)
+		}
+		return user, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	loaded, _ := v.(*domain.User)
+	user := *loaded
+	return &user, nil
+}
+
+// lookup returns the cached user for key. ok is false on a miss; found is false for a cached not-found result.
+func (r *CachingRepository) lookup(key string) (user *domain.User, found, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, hit := r.entries[key]
+	if !hit {
+		return nil, false, false
+	}
+	entry := entryOf(elem)
+	if time.Now().After(entry.expires) {
+		r.remove(elem)
+		return nil, false, false
+	}
+	r.lru.MoveToFront(elem)
+	if entry.user == nil {
+		return nil, false, true
+	}
+	u := *entry.user
+	return &u, true, true
+}
+
+func (r *CachingRepository) store(key string, user *domain.User, version uint64) {
+	ttl := r.ttl
+	if user == nil {
+		ttl = r.negativeTTL
+	}
+	if ttl <= 0 || r.size <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// A write happened while loading, the result may already be stale.
+	if r.version != version {
+		return
+	}
+	if elem, ok := r.entries[key]; ok {
+		r.remove(elem)
+	}
+
+	var cached *domain.User
+	if user != nil {
+		u := *user
+		cached = &u
+		if strings.HasPrefix(key, "email:") {
+			r.emails[u.ID] = key
+		}
+	}
+	r.entries[key] = r.lru.PushFront(&cacheEntry{key: key, user: cached, expires: time.Now().Add(ttl)})
+
+	for r.lru.Len() > r.size {
+		r.remove(r.lru.Back())
+	}
+}
+
+// invalidate drops the ID key, the given email key and the email key previously cached for the ID.
+// A write succeeded, so ctx has a tenant.
+func (r *CachingRepository) invalidate(ctx context.Context, id uuid.UUID, email string) {
+	tenantID, _ := tenant.FromContext(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.version++
+	keys := []string{idKey(tenantID, id)}
+	if email != "" {
+		keys = append(keys, emailKey(tenantID, email))
+	}
+	if key, ok := r.emails[id]; ok {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if elem, ok := r.entries[key]; ok {
+			r.remove(elem)
+		}
+	}
+}
+
+// remove deletes an element from the cache. The caller must hold the lock.
+func (r *CachingRepository) remove(elem *list.Element) {
+	entry := entryOf(elem)
+	r.lru.Remove(elem)
+	delete(r.entries, entry.key)
+	if entry.user != nil && r.emails[entry.user.ID] == entry.key {
+		delete(r.emails, entry.user.ID)
+	}
+}
+
+func entryOf(elem *list.Element) *cacheEntry {
+	entry, _ := elem.Value.(*cacheEntry)
+	return entry
+}
+
+// The tenant is followed by a NUL byte, which is not expected in a tenant ID or an email.
+func idKey(tenantID string, id uuid.UUID) string {
+	return "id:" + tenantID + "\x00" + id.String()
+}
+
+func emailKey(tenantID, email string) string {
+	return "email:" + tenantID + "\x00" + email
+}
@@ -0,0 +1,179 @@
+package repository_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	mock_repository "github.com/davidyannick/repository-pattern/mocks"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestCachingRepository_ReadThrough(t *testing.T) {
+	ctx := testContext(t)
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	user := domain.User{ID: uuid.New(), Name: "John Doe", Email: "john@example.com"}
+	// Each key is loaded only once
+	mockRepo.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(&user, nil).Times(1)
+	mockRepo.EXPECT().GetUserByEmail(gomock.Any(), user.Email).Return(&user, nil).Times(1)
+
+	repo := repository.NewCachingRepository(mockRepo)
+
+	for range 3 {
+		found, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+
+		found, err = repo.GetUserByEmail(ctx, user.Email)
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+	}
+}
+
+func TestCachingRepository_ReturnsCopies(t *testing.T) {
+	ctx := testContext(t)
+	memory := repository.NewMemoryRepository()
+	added, err := memory.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+
+	repo := repository.NewCachingRepository(memory)
+	found, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	found.Name = "Mutated"
+
+	again, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "John Doe", again.Name)
+}
+
+func TestCachingRepository_NegativeCaching(t *testing.T) {
+	ctx := testContext(t)
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	user := domain.User{ID: uuid.New(), Name: "John Doe", Email: "john@example.com"}
+	gomock.InOrder(
+		mockRepo.EXPECT().GetUserByEmail(gomock.Any(), user.Email).Return(nil, repository.ErrUserNotFound).Times(1),
+		mockRepo.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(&user, nil),
+		mockRepo.EXPECT().GetUserByEmail(gomock.Any(), user.Email).Return(&user, nil).Times(1),
+	)
+
+	repo := repository.NewCachingRepository(mockRepo)
+
+	// The not-found result is cached
+	for range 2 {
+		_, err := repo.GetUserByEmail(ctx, user.Email)
+		require.ErrorIs(t, err, repository.ErrUserNotFound)
+	}
+
+	// Adding the user invalidates the negative entry
+	_, err := repo.AddUser(ctx, domain.User{Name: user.Name, Email: user.Email})
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByEmail(ctx, user.Email)
+	require.NoError(t, err)
+	assert.Equal(t, user, *found)
+}
+
+func TestCachingRepository_InvalidationOnUpdateAndDelete(t *testing.T) {
+	ctx := testContext(t)
+	memory := repository.NewMemoryRepository()
+	added, err := memory.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+
+	repo := repository.NewCachingRepository(memory)
+
+	// Warm both keys
+	_, err = repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	_, err = repo.GetUserByEmail(ctx, added.Email)
+	require.NoError(t, err)
+
+	// Update the email: the old email key must not return the user anymore
+	_, err = repo.UpdateUser(ctx, domain.User{ID: added.ID, Name: "John Updated", Email: "new@example.com"})
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "John Updated", found.Name)
+
+	_, err = repo.GetUserByEmail(ctx, "john@example.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	found, err = repo.GetUserByEmail(ctx, "new@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, added.ID, found.ID)
+
+	// Delete invalidates both keys
+	require.NoError(t, repo.DeleteUser(ctx, added.ID))
+	_, err = repo.GetUserByID(ctx, added.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = repo.GetUserByEmail(ctx, "new@example.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestCachingRepository_TTLAndEviction(t *testing.T) {
+	ctx := testContext(t)
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	first := domain.User{ID: uuid.New(), Name: "First", Email: "first@example.com"}
+	second := domain.User{ID: uuid.New(), Name: "Second", Email: "second@example.com"}
+	mockRepo.EXPECT().GetUserByID(gomock.Any(), first.ID).Return(&first, nil).Times(3)
+	mockRepo.EXPECT().GetUserByID(gomock.Any(), second.ID).Return(&second, nil).Times(1)
+
+	repo := repository.NewCachingRepository(mockRepo, repository.WithCacheSize(1), repository.WithCacheTTL(20*time.Millisecond))
+
+	// Load 1: first is cached, then expires
+	_, err := repo.GetUserByID(ctx, first.ID)
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+
+	// Load 2: first again after expiry, then evicted by second
+	_, err = repo.GetUserByID(ctx, first.ID)
+	require.NoError(t, err)
+	_, err = repo.GetUserByID(ctx, second.ID)
+	require.NoError(t, err)
+
+	// Load 3: first was evicted
+	_, err = repo.GetUserByID(ctx, first.ID)
+	require.NoError(t, err)
+}
+
+func TestCachingRepository_Singleflight(t *testing.T) {
+	ctx := testContext(t)
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	user := domain.User{ID: uuid.New(), Name: "John Doe", Email: "john@example.com"}
+	release := make(chan struct{})
+	mockRepo.EXPECT().GetUserByID(gomock.Any(), user.ID).DoAndReturn(func(context.Context, uuid.UUID) (*domain.User, error) {
+		<-release
+		return &user, nil
+	}).Times(1)
+
+	repo := repository.NewCachingRepository(mockRepo)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := repo.GetUserByID(ctx, user.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, user, *found)
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// upsertCredentialQuery only stores the credential of an existing user of the tenant.
+	upsertCredentialQuery = `
+    INSERT INTO user_credentials (user_id, tenant_id, password_hash, updated_at)
+    SELECT id, tenant_id, $3, $4 FROM users WHERE tenant_id = $1 AND id = $2
+    ON CONFLICT (user_id) DO UPDATE SET password_hash = EXCLUDED.password_hash, updated_at = EXCLUDED.updated_at
+    `
+
+	selectCredentialQuery = `
+    SELECT user_id, password_hash, updated_at FROM user_credentials WHERE tenant_id = $1 AND user_id = $2
+    `
+
+	upsertCredentialQuery2 = `
+    INSERT INTO user_credentials(user_id, tenant_id, password_hash, updated_at)
+    SELECT id, tenant_id, ?, ? FROM users WHERE tenant_id = ? AND id = ?
+    ON CONFLICT(user_id) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at;
+`
+
+	selectCredentialQuery2 = `
+    SELECT user_id, password_hash, updated_at
+      FROM user_credentials
+     WHERE tenant_id = ? AND user_id = ?;
+`
+)
+
+// CredentialStore is implemented by repositories storing the password hashes of users. Credentials are
+// deleted along with their user.
+type CredentialStore interface {
+	// SetCredential creates or replaces the credential of a user, or returns ErrUserNotFound.
+	SetCredential(ctx context.Context, credential domain.Credential) error
+	// GetCredential returns the credential of a user, or ErrCredentialNotFound.
+	GetCredential(ctx context.Context, userID uuid.UUID) (*domain.Credential, error)
+}
+
+// SetCredential stores the credential of a user in memory.
+func (r *MemoryRepository) SetCredential(ctx context.Context, credential domain.Credential) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == credential.UserID }) < 0 {
+		return ErrUserNotFound
+	}
+	if r.credentials == nil {
+		r.credentials = make(map[uuid.UUID]domain.Credential)
+	}
+	r.credentials[credential.UserID] = credential
+	return nil
+}
+
+// GetCredential returns the credential of a user of the tenant.
+func (r *MemoryRepository) GetCredential(ctx context.Context, userID uuid.UUID) (*domain.Credential, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	credential, ok := r.credentials[userID]
+	if !ok || r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == userID }) < 0 {
+		return nil, ErrCredentialNotFound
+	}
+	return &credential, nil
+}
+
+// SetCredential creates or replaces the credential of a user.
+func (r *PsqlRepository) SetCredential(ctx context.Context, credential domain.Credential) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		tag, err := tx.Exec(ctx, upsertCredentialQuery, tenantID, credential.UserID, credential.PasswordHash, credential.UpdatedAt)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute upsert credential query: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return struct{}{}, ErrUserNotFound
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// GetCredential returns the credential of a user, read from the primary so that a password just changed
+// is taken into account.
+func (r *PsqlRepository) GetCredential(ctx context.Context, userID uuid.UUID) (*domain.Credential, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) (*domain.Credential, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var c domain.Credential
+		err = tx.QueryRow(ctx, selectCredentialQuery, tenantID, userID).Scan(&c.UserID, &c.PasswordHash, &c.UpdatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCredentialNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute select credential query: %w", err)
+		}
+		return &c, nil
+	})
+}
+
+// SetCredential creates or replaces the credential of a user.
+func (r *SqlliteRepository) SetCredential(ctx context.Context, credential domain.Credential) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, upsertCredentialQuery2, credential.PasswordHash, credential.UpdatedAt, tenantID, credential.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to store credential: %w", err)
+	}
+	n, err := rowsAffected(res)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetCredential returns the credential of a user.
+func (r *SqlliteRepository) GetCredential(ctx context.Context, userID uuid.UUID) (*domain.Credential, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var c domain.Credential
+	err = r.db.QueryRowContext(ctx, selectCredentialQuery2, tenantID, userID).Scan(&c.UserID, &c.PasswordHash, &c.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCredentialNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query credential: %w", err)
+	}
+	return &c, nil
+}
@@ -0,0 +1,62 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	sqlite := repository.NewSQLLiteRepository(db)
+	require.NoError(t, sqlite.Migrate(testContext(t)))
+
+	stores := map[string]interface {
+		repository.UserRepository
+		repository.CredentialStore
+	}{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": sqlite,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := testContext(t)
+			user, err := store.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com"})
+			require.NoError(t, err)
+
+			_, err = store.GetCredential(ctx, user.ID)
+			require.ErrorIs(t, err, repository.ErrCredentialNotFound)
+			err = store.SetCredential(ctx, domain.Credential{UserID: uuid.New(), PasswordHash: "h", UpdatedAt: time.Now()})
+			require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+			require.NoError(t, store.SetCredential(ctx, domain.Credential{UserID: user.ID, PasswordHash: "h1", UpdatedAt: time.Now()}))
+			require.NoError(t, store.SetCredential(ctx, domain.Credential{UserID: user.ID, PasswordHash: "h2", UpdatedAt: time.Now()}))
+			got, err := store.GetCredential(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, got.UserID)
+			assert.Equal(t, "h2", got.PasswordHash)
+
+			// Other tenants can neither read nor replace the credential.
+			other := tenant.WithID(ctx, "other")
+			_, err = store.GetCredential(other, user.ID)
+			require.ErrorIs(t, err, repository.ErrCredentialNotFound)
+			err = store.SetCredential(other, domain.Credential{UserID: user.ID, PasswordHash: "h3", UpdatedAt: time.Now()})
+			require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+			// The credential goes away with its user.
+			require.NoError(t, store.DeleteUser(ctx, user.ID))
+			_, err = store.GetCredential(ctx, user.ID)
+			require.ErrorIs(t, err, repository.ErrCredentialNotFound)
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+)
+
+// DualWriteRepository is a UserRepository used while moving users from one backend to another.
+// Reads are served by the primary and writes go to the primary first, then to the secondary with the same ID.
+// A failed secondary write is logged but does not fail the call; the reconcile pass of Backfill repairs the secondary afterwards.
+// Swapping primary and secondary moves the reads to the new backend while keeping the old one up to date.
+type DualWriteRepository struct {
+	primary     UserRepository
+	secondary   UserRepository
+	logger      *slog.Logger
+	shadowReads bool
+}
+
+// DualWriteOption configures a DualWriteRepository.
+type DualWriteOption func(*DualWriteRepository)
+
+// WithShadowReads also reads from the secondary on every lookup and logs the results that differ from the primary.
+// Shadow reads run after the primary read and add their latency to the call.
+func WithShadowReads() DualWriteOption {
+	return func(r *DualWriteRepository) {
+		r.shadowReads = true
+	}
+}
+
+// NewDualWriteRepository writes to both primary and secondary and reads from primary.
+func NewDualWriteRepository(primary, secondary UserRepository, logger *slog.Logger, opts ...DualWriteOption) *DualWriteRepository {
+	r := &DualWriteRepository{
+		primary:   primary,
+		secondary: secondary,
+		logger:    logger,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// AddUser stores the user in the primary, then copies it to the secondary under the ID chosen by the primary.
+func (r *DualWriteRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	u, err := r.primary.AddUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := upsertUser(ctx, r.secondary, *u); err != nil {
+		r.secondaryFailed(ctx, "AddUser", u.ID, err)
+	}
+	return u, nil
+}
+
+// GetAllUsers reads from the primary.
+func (r *DualWriteRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	users, err := r.primary.GetAllUsers(ctx)
+	if err != nil || !r.shadowReads {
+		return users, err
+	}
+
+	shadow, shadowErr := r.secondary.GetAllUsers(ctx)
+	if shadowErr != nil {
+		r.shadowFailed(ctx, "GetAllUsers", shadowErr)
+		return users, nil
+	}
+	missing, extra, different := diffUsers(users, shadow)
+	if missing+extra+different > 0 {
+		r.logger.WarnContext(ctx, "shadow read mismatch",
+			slog.String("operation", "GetAllUsers"),
+			slog.Int("missing", missing),
+			slog.Int("extra", extra),
+			slog.Int("different", different),
+		)
+	}
+	return users, nil
+}
+
+// GetUserByID reads from the primary.
+func (r *DualWriteRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	u, err := r.primary.GetUserByID(ctx, id)
+	if r.shadowReads {
+		r.compare(ctx, "GetUserByID", u, err, func(ctx context.Context) (*domain.User, error) {
+			return r.secondary.GetUserByID(ctx, id)
+		})
+	}
+	return u, err
+}
+
+// GetUserByEmail reads from the primary.
+func (r *DualWriteRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	u, err := r.primary.GetUserByEmail(ctx, email)
+	if r.shadowReads {
+		r.compare(ctx, "GetUserByEmail", u, err, func(ctx context.Context) (*domain.User, error) {
+			return r.secondary.GetUserByEmail(ctx, email)
+		})
+	}
+	return u, err
+}
+
+// UpdateUser updates the primary, then the secondary. A user not yet copied to the secondary is inserted there.
+// The secondary is given the whole user as stored by the primary, status included.
+func (r *DualWriteRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	u, err := r.primary.UpdateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	_, err = r.secondary.UpdateUser(ctx, *u)
+	if errors.Is(err, ErrUserNotFound) {
+		_, err = upsertUser(ctx, r.secondary, *u)
+	}
+	if err != nil {
+		r.secondaryFailed(ctx, "UpdateUser", u.ID, err)
+	}
+	return u, nil
+}
+
+// DeleteUser deletes the user from the primary, then from the secondary.
+func (r *DualWriteRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if err := r.primary.DeleteUser(ctx, id); err != nil {
+		return err
+	}
+	if err := r.secondary.DeleteUser(ctx, id); err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.secondaryFailed(ctx, "DeleteUser", id, err)
+	}
+	return nil
+}
+
+// compare runs the shadow lookup and logs when its outcome differs from the primary one.
+func (r *DualWriteRepository) compare(ctx context.Context, operation string, want *domain.User, wantErr error, shadow func(context.Context) (*domain.User, error)) {
+	// Errors other than not found say nothing about the data.
+	if wantErr != nil && !errors.Is(wantErr, ErrUserNotFound) {
+		return
+	}
+	got, err := shadow(ctx)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		r.shadowFailed(ctx, operation, err)
+		return
+	}
+
+	switch {
+	case want == nil && got == nil:
+		return
+	case want == nil:
+		r.logger.WarnContext(ctx, "shadow read mismatch", slog.String("operation", operation),
+			slog.String("id", got.ID.String()), slog.String("reason", "extra"))
+	case got == nil:
+		r.logger.WarnContext(ctx, "shadow read mismatch", slog.String("operation", operation),
+			slog.String("id", want.ID.String()), slog.String("reason", "missing"))
+	case *want != *got:
+		r.logger.WarnContext(ctx, "shadow read mismatch", slog.String("operation", operation),
+			slog.String("id", want.ID.String()), slog.String("reason", "different"))
+	}
+}
+
+func (r *DualWriteRepository) secondaryFailed(ctx context.Context, operation string, id uuid.UUID, err error) {
+	r.logger.ErrorContext(ctx, "secondary write failed",
+		slog.String("operation", operation),
+		slog.String("id", id.String()),
+		slog.String("error", err.Error()),
+	)
+}
+
+func (r *DualWriteRepository) shadowFailed(ctx context.Context, operation string, err error) {
+	r.logger.WarnContext(ctx, "shadow read failed",
+		slog.String("operation", operation),
+		slog.String("error", err.Error()),
+	)
+}
+
+// diffUsers counts the users of want absent from got, the users of got absent from want and the users present in both that differ.
+func diffUsers(want, got []domain.User) (missing, extra, different int) {
+	byID := make(map[uuid.UUID]domain.User, len(got))
+	for _, u := range got {
+		byID[u.ID] = u
+	}
+	for _, u := range want {
+		shadow, ok := byID[u.ID]
+		switch {
+		case !ok:
+			missing++
+		case shadow != u:
+			different++
+		}
+		delete(byID, u.ID)
+	}
+	return missing, len(byID), different
+}
@@ -0,0 +1,185 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	mock_repository "github.com/davidyannick/repository-pattern/mocks"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDualWriteRepository_Writes(t *testing.T) {
+	ctx := testContext(t)
+	logger, records := newTestLogger(t)
+	primary, secondary := repository.NewMemoryRepository(), repository.NewMemoryRepository()
+	repo := repository.NewDualWriteRepository(primary, secondary, logger)
+
+	user, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	// The secondary gets the ID chosen by the primary
+	copied, err := secondary.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, *user, *copied)
+
+	user.Name = "Updated"
+	_, err = repo.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	copied, err = secondary.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", copied.Name)
+
+	require.NoError(t, repo.DeleteUser(ctx, user.ID))
+	_, err = secondary.GetUserByID(ctx, user.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	assert.Empty(t, records())
+}
+
+func TestDualWriteRepository_UpdateNotYetBackfilled(t *testing.T) {
+	ctx := testContext(t)
+	logger, _ := newTestLogger(t)
+	primary, secondary := repository.NewMemoryRepository(), repository.NewMemoryRepository()
+	user, err := primary.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	user.Name = "Updated"
+	_, err = repository.NewDualWriteRepository(primary, secondary, logger).UpdateUser(ctx, *user)
+	require.NoError(t, err)
+
+	copied, err := secondary.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, *user, *copied)
+}
+
+func TestDualWriteRepository_SecondaryFailure(t *testing.T) {
+	ctx := testContext(t)
+	ctrl := gomock.NewController(t)
+	logger, records := newTestLogger(t)
+	secondary := mock_repository.NewMockUserRepository(ctrl)
+	secondary.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(nil, errors.New("connection refused"))
+	repo := repository.NewDualWriteRepository(repository.NewMemoryRepository(), secondary, logger)
+
+	// The primary is the source of truth, the call succeeds
+	_, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	logged := records()
+	require.Len(t, logged, 1)
+	assert.Equal(t, "ERROR", logged[0]["level"])
+	assert.Equal(t, "secondary write failed", logged[0]["msg"])
+	assert.Equal(t, "AddUser", logged[0]["operation"])
+}
+
+func TestDualWriteRepository_ShadowReads(t *testing.T) {
+	ctx := testContext(t)
+	logger, records := newTestLogger(t)
+	primary, secondary := repository.NewMemoryRepository(), repository.NewMemoryRepository()
+	repo := repository.NewDualWriteRepository(primary, secondary, logger, repository.WithShadowReads())
+
+	user, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+	_, err = repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, records())
+
+	// Drift the secondary behind the wrapper's back
+	drifted := *user
+	drifted.Name = "Drifted"
+	_, err = secondary.UpdateUser(ctx, drifted)
+	require.NoError(t, err)
+	_, err = primary.AddUser(ctx, domain.User{Name: "Primary Only", Email: "primary@example.com"})
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Test User", found.Name)
+	_, err = repo.GetUserByEmail(ctx, "primary@example.com")
+	require.NoError(t, err)
+	_, err = repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+
+	logged := records()
+	require.Len(t, logged, 3)
+	assert.Equal(t, "shadow read mismatch", logged[0]["msg"])
+	assert.Equal(t, "different", logged[0]["reason"])
+	assert.Equal(t, "missing", logged[1]["reason"])
+	assert.Equal(t, "GetAllUsers", logged[2]["operation"])
+	assert.InDelta(t, 1, logged[2]["missing"], 0)
+	assert.InDelta(t, 1, logged[2]["different"], 0)
+}
+
+func TestBackfill_Resumes(t *testing.T) {
+	ctx := testContext(t)
+	src, dst := repository.NewMemoryRepository(), repository.NewMemoryRepository()
+	users := addUsers(t, src, 25)
+	checkpoint := repository.NewFileCheckpoint(filepath.Join(t.TempDir(), "backfill.checkpoint"))
+
+	// Interrupt the first run by making the destination fail halfway
+	ctrl := gomock.NewController(t)
+	failing := mock_repository.NewMockUserRepository(ctrl)
+	calls := 0
+	failing.EXPECT().AddUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, u domain.User) (*domain.User, error) {
+		calls++
+		if calls > 12 {
+			return nil, errors.New("connection reset")
+		}
+		return dst.AddUser(ctx, u)
+	}).AnyTimes()
+
+	result, err := repository.Backfill(ctx, src, failing, checkpoint, repository.WithBatchSize(5))
+	require.Error(t, err)
+	assert.Equal(t, 12, result.Copied)
+
+	// The second run restarts after the last saved batch
+	result, err = repository.Backfill(ctx, src, dst, checkpoint, repository.WithBatchSize(5))
+	require.NoError(t, err)
+	assert.Equal(t, repository.BackfillResult{Copied: 15}, result)
+
+	all, err := dst.GetAllUsers(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, users, all)
+
+	// Nothing left to copy
+	result, err = repository.Backfill(ctx, src, dst, checkpoint)
+	require.NoError(t, err)
+	assert.Zero(t, result)
+}
+
+func TestBackfill_ReconcilesUsersBehindTheCheckpoint(t *testing.T) {
+	ctx := testContext(t)
+	src, dst := repository.NewMemoryRepository(), repository.NewMemoryRepository()
+	users := addUsers(t, src, 10)
+	checkpoint := repository.NewFileCheckpoint(filepath.Join(t.TempDir(), "backfill.checkpoint"))
+	_, err := repository.Backfill(ctx, src, dst, checkpoint, repository.WithBatchSize(3))
+	require.NoError(t, err)
+
+	// A user added below the checkpoint
+	_, err = src.AddUser(ctx, domain.User{ID: uuid.MustParse("00000000-0000-4000-8000-000000000001"), Name: "Early", Email: "reused@example.com"})
+	require.NoError(t, err)
+	// Secondary writes lost by a dual write: an update, a deletion and a user whose email is now taken by the new one
+	drifted := users[3]
+	drifted.Name = "Drifted"
+	_, err = dst.UpdateUser(ctx, drifted)
+	require.NoError(t, err)
+	require.NoError(t, src.DeleteUser(ctx, users[5].ID))
+	_, err = dst.AddUser(ctx, domain.User{ID: uuid.MustParse("ffffffff-ffff-4fff-bfff-ffffffffffff"), Name: "Stale", Email: "reused@example.com"})
+	require.NoError(t, err)
+
+	result, err := repository.Backfill(ctx, src, dst, checkpoint, repository.WithBatchSize(3))
+	require.NoError(t, err)
+	assert.Equal(t, repository.BackfillResult{Repaired: 2, Deleted: 2}, result)
+
+	want, err := src.GetAllUsers(ctx)
+	require.NoError(t, err)
+	got, err := dst.GetAllUsers(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, want, got)
+}
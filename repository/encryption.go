@@ -0,0 +1,343 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// emailField is the field of the audit changes holding emails, see domain.DiffUsers.
+const emailField = "email"
+
+// ErrEncryptionDisabled is returned by ReencryptEmails when the repository has no EmailCipher.
+var ErrEncryptionDisabled = errors.New("email encryption is not enabled")
+
+// EmailCipher encrypts the emails stored by the SQL repositories; fieldcrypt.Cipher implements it.
+// Emails are stored encrypted along with a blind index, which the repositories use to enforce
+// uniqueness and to look users up by email. The copies of emails kept in outbox events, webhook deliveries
+// and audit entries are encrypted too, but never re-encrypted: a key must be kept as long as they use it.
+type EmailCipher interface {
+	// KeyID returns the ID of the key used by Encrypt.
+	KeyID() string
+	Encrypt(email string) (string, error)
+	// Decrypt returns stored values that are not encrypted as is.
+	Decrypt(stored string) (string, error)
+	// BlindIndex returns a deterministic keyed hash of email.
+	BlindIndex(email string) string
+}
+
+// EmailReencrypter is implemented by repositories able to re-encrypt the stored emails with the current key.
+type EmailReencrypter interface {
+	// StaleEmailTenants returns the tenants holding emails stored in plaintext or with another key than
+	// the current one. It needs no tenant in ctx.
+	StaleEmailTenants(ctx context.Context) ([]string, error)
+	// ReencryptEmails re-encrypts up to limit emails of the tenant of ctx that are stored in plaintext
+	// or with another key than the current one, and returns how many were re-encrypted.
+	ReencryptEmails(ctx context.Context, limit int) (int, error)
+}
+
+// emailCodec converts emails to and from their stored form. Without a cipher, emails are stored in plaintext
+// with no index nor key ID. Rows without an index are still matched on the plaintext email, so that a database
+// can be switched to encryption and re-encrypted progressively.
+type emailCodec struct {
+	cipher EmailCipher
+}
+
+// storedEmail holds the email, index and key ID columns of a user. index and keyID are nil for plaintext.
+type storedEmail struct {
+	value string
+	index *string
+	keyID *string
+}
+
+func (c emailCodec) encode(email string) (storedEmail, error) {
+	if c.cipher == nil {
+		return storedEmail{value: email}, nil
+	}
+	value, err := c.cipher.Encrypt(email)
+	if err != nil {
+		return storedEmail{}, fmt.Errorf("failed to encrypt email: %w", err)
+	}
+	index := c.cipher.BlindIndex(email)
+	keyID := c.cipher.KeyID()
+	return storedEmail{value: value, index: &index, keyID: &keyID}, nil
+}
+
+func (c emailCodec) decode(stored string) (string, error) {
+	if c.cipher == nil {
+		return stored, nil
+	}
+	email, err := c.cipher.Decrypt(stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	return email, nil
+}
+
+// lookup returns the index and plaintext arguments of the users-by-email query, which matches
+// email_index = index OR (email_index IS NULL AND email = plaintext).
+func (c emailCodec) lookup(email string) (index *string, plaintext string) {
+	if c.cipher == nil {
+		return nil, email
+	}
+	i := c.cipher.BlindIndex(email)
+	return &i, email
+}
+
+// sealUser returns user with its email encrypted, for the copies of users kept in events.
+func (c emailCodec) sealUser(user domain.User) (domain.User, error) {
+	if user.Email == "" {
+		return user, nil
+	}
+	stored, err := c.encode(user.Email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.Email = stored.value
+	return user, nil
+}
+
+// openUser reverses sealUser.
+func (c emailCodec) openUser(user domain.User) (domain.User, error) {
+	email, err := c.decode(user.Email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	user.Email = email
+	return user, nil
+}
+
+// sealPayload encrypts the email of the user carried by an encoded event, such as a webhook delivery payload.
+// Payloads that are not events with a user email are returned as is.
+func (c emailCodec) sealPayload(payload []byte) ([]byte, error) {
+	return c.mapPayload(payload, c.sealUser)
+}
+
+// openPayload reverses sealPayload.
+func (c emailCodec) openPayload(payload []byte) ([]byte, error) {
+	return c.mapPayload(payload, c.openUser)
+}
+
+func (c emailCodec) mapPayload(payload []byte, fn func(domain.User) (domain.User, error)) ([]byte, error) {
+	if c.cipher == nil {
+		return payload, nil
+	}
+	var event domain.Event
+	if err := json.Unmarshal(payload, &event); err != nil || event.User.Email == "" {
+		return payload, nil //nolint:nilerr // not an event carrying an email
+	}
+	user, err := fn(event.User)
+	if err != nil {
+		return nil, err
+	}
+	event.User = user
+	payload, err = json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	return payload, nil
+}
+
+// sealChanges returns changes with the values of the email field encrypted.
+func (c emailCodec) sealChanges(changes []domain.FieldChange) ([]domain.FieldChange, error) {
+	return c.mapChanges(changes, func(value string) (string, error) {
+		stored, err := c.encode(value)
+		return stored.value, err
+	})
+}
+
+// openChanges reverses sealChanges.
+func (c emailCodec) openChanges(changes []domain.FieldChange) ([]domain.FieldChange, error) {
+	return c.mapChanges(changes, c.decode)
+}
+
+func (c emailCodec) mapChanges(changes []domain.FieldChange, fn func(string) (string, error)) ([]domain.FieldChange, error) {
+	if c.cipher == nil {
+		return changes, nil
+	}
+	mapped := make([]domain.FieldChange, len(changes))
+	for i, change := range changes {
+		if change.Field == emailField {
+			for _, value := range []*string{&change.Before, &change.After} {
+				if *value == "" {
+					continue
+				}
+				v, err := fn(*value)
+				if err != nil {
+					return nil, err
+				}
+				*value = v
+			}
+		}
+		mapped[i] = change
+	}
+	return mapped, nil
+}
+
+// staleEmail is a stored email to re-encrypt.
+type staleEmail struct {
+	id    uuid.UUID
+	value string
+}
+
+// reencrypt returns the stored email re-encrypted with the current key.
+func (c emailCodec) reencrypt(stored string) (storedEmail, error) {
+	email, err := c.decode(stored)
+	if err != nil {
+		return storedEmail{}, err
+	}
+	return c.encode(email)
+}
+
+// StaleEmailTenants returns the tenants holding emails in plaintext or encrypted with a retired key.
+// Row-level security lets it read every tenant through the users_tenant_listing policy.
+func (r *PsqlRepository) StaleEmailTenants(ctx context.Context) ([]string, error) {
+	if r.emails.cipher == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // read-only, nothing to commit
+
+	if _, err := tx.Exec(ctx, setTenantListingQuery); err != nil {
+		return nil, fmt.Errorf("failed to allow tenant listing: %w", err)
+	}
+	rows, err := tx.Query(ctx, selectStaleEmailTenantsQuery, r.emails.cipher.KeyID())
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select stale email tenants query: %w", err)
+	}
+	tenants, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan stale email tenant row: %w", err)
+	}
+	return tenants, nil
+}
+
+// ReencryptEmails re-encrypts up to limit emails of the tenant of ctx that are in plaintext or encrypted
+// with a retired key. The selected rows are locked until they are rewritten.
+func (r *PsqlRepository) ReencryptEmails(ctx context.Context, limit int) (int, error) {
+	if r.emails.cipher == nil {
+		return 0, ErrEncryptionDisabled
+	}
+	n, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (int, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return 0, err
+		}
+		rows, err := tx.Query(ctx, selectStaleEmailsQuery, tenantID, r.emails.cipher.KeyID(), limit)
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute select stale emails query: %w", err)
+		}
+		stale, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (staleEmail, error) {
+			var s staleEmail
+			err := row.Scan(&s.id, &s.value)
+			return s, err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to scan stale email row: %w", err)
+		}
+		for _, s := range stale {
+			email, err := r.emails.reencrypt(s.value)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := tx.Exec(ctx, updateEmailQuery, tenantID, s.id, email.value, email.index, email.keyID); err != nil {
+				return 0, fmt.Errorf("failed to execute update email query: %w", err)
+			}
+		}
+		return len(stale), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	r.reads.recordWrite(ctx)
+	return n, nil
+}
+
+// StaleEmailTenants returns the tenants holding emails in plaintext or encrypted with a retired key.
+func (r *SqlliteRepository) StaleEmailTenants(ctx context.Context) ([]string, error) {
+	if r.emails.cipher == nil {
+		return nil, ErrEncryptionDisabled
+	}
+	rows, err := r.db.QueryContext(ctx, selectStaleEmailTenantsQuery2, r.emails.cipher.KeyID())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale email tenants: %w", err)
+	}
+	defer rows.Close()
+	var tenants []string
+	for rows.Next() {
+		var tenantID string
+		if err := rows.Scan(&tenantID); err != nil {
+			return nil, fmt.Errorf("failed to scan stale email tenant row: %w", err)
+		}
+		tenants = append(tenants, tenantID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return tenants, nil
+}
+
+// ReencryptEmails re-encrypts up to limit emails of the tenant of ctx that are in plaintext or encrypted
+// with a retired key.
+func (r *SqlliteRepository) ReencryptEmails(ctx context.Context, limit int) (int, error) {
+	if r.emails.cipher == nil {
+		return 0, ErrEncryptionDisabled
+	}
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	stale, err := sqliteStaleEmails(ctx, tx, tenantID, r.emails.cipher.KeyID(), limit)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range stale {
+		email, err := r.emails.reencrypt(s.value)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, updateEmailQuery2, email.value, email.index, email.keyID, tenantID, s.id); err != nil {
+			return 0, fmt.Errorf("failed to update email: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return len(stale), nil
+}
+
+func sqliteStaleEmails(ctx context.Context, tx *sql.Tx, tenantID, keyID string, limit int) ([]staleEmail, error) {
+	rows, err := tx.QueryContext(ctx, selectStaleEmailsQuery2, tenantID, keyID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale emails: %w", err)
+	}
+	defer rows.Close()
+	var stale []staleEmail
+	for rows.Next() {
+		var s staleEmail
+		if err := rows.Scan(&s.id, &s.value); err != nil {
+			return nil, fmt.Errorf("failed to scan stale email row: %w", err)
+		}
+		stale = append(stale, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return stale, nil
+}
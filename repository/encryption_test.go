@@ -0,0 +1,190 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/fieldcrypt"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testCipher(t *testing.T) *fieldcrypt.Cipher {
+	t.Helper()
+	keys, err := fieldcrypt.NewStaticKeys("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	return fieldcrypt.New(keys)
+}
+
+func TestSqlLiteRepository_EncryptedEmails(t *testing.T) {
+	ctx := testContext(t)
+	db, cleanup := setupSQLiteDatabase(t)
+	defer cleanup()
+
+	// A user stored before encryption was enabled.
+	plain := repository.NewSQLLiteRepository(db)
+	legacy, err := plain.AddUser(ctx, domain.User{Name: "Legacy", Email: "legacy@example.com"})
+	require.NoError(t, err)
+
+	repo := repository.NewSQLLiteRepository(db, repository.WithSQLiteEmailCipher(testCipher(t)))
+	alice, err := repo.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT email FROM users WHERE id = ?`, alice.ID).Scan(&stored))
+	assert.True(t, strings.HasPrefix(stored, "enc:v1:k1:"))
+
+	got, err := repo.GetUserByEmail(ctx, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+	got, err = repo.GetUserByEmail(ctx, "legacy@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, got)
+	users, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []domain.User{*legacy, *alice}, users)
+
+	// The blind index keeps emails unique although the ciphertexts differ.
+	_, err = repo.AddUser(ctx, domain.User{Name: "Other Alice", Email: "alice@example.com"})
+	require.Error(t, err)
+
+	_, err = repo.UpdateUser(ctx, domain.User{ID: alice.ID, Name: "Alice", Email: "alice@example.org"})
+	require.NoError(t, err)
+	_, err = repo.GetUserByEmail(ctx, "alice@example.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	got, err = repo.GetUserByEmail(ctx, "alice@example.org")
+	require.NoError(t, err)
+	assert.Equal(t, alice.ID, got.ID)
+
+	// Plaintext emails are not covered by the blind index but stay unique.
+	_, err = repo.AddUser(ctx, domain.User{Name: "Other Legacy", Email: "legacy@example.com"})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+	_, err = repo.UpdateUser(ctx, domain.User{ID: alice.ID, Name: "Alice", Email: "legacy@example.com"})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+	_, err = repo.UpsertUser(ctx, domain.User{ID: uuid.New(), Name: "Other Legacy", Email: "legacy@example.com"})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+
+	// Re-encryption only touches the plaintext user.
+	tenants, err := repo.StaleEmailTenants(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test"}, tenants)
+	n, err := repo.ReencryptEmails(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.NoError(t, db.QueryRow(`SELECT email FROM users WHERE id = ?`, legacy.ID).Scan(&stored))
+	assert.NotContains(t, stored, "legacy")
+	got, err = repo.GetUserByEmail(ctx, "legacy@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, got)
+	n, err = repo.ReencryptEmails(ctx, 10)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	tenants, err = repo.StaleEmailTenants(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, tenants)
+
+	_, err = plain.ReencryptEmails(ctx, 10)
+	require.ErrorIs(t, err, repository.ErrEncryptionDisabled)
+	_, err = repo.GetUserByID(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestSqlLiteRepository_EncryptedEmailCopies(t *testing.T) {
+	ctx := testContext(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	repo := repository.NewSQLLiteRepository(db, repository.WithSQLiteEmailCipher(testCipher(t)))
+	require.NoError(t, repo.Migrate(ctx))
+
+	alice := domain.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com"}
+	renamed := domain.User{ID: alice.ID, Name: "Alice", Email: "alice@example.org"}
+	created := domain.NewUserEvent(domain.UserCreated, alice)
+	audit := domain.NewAuditEntry(domain.AuditUpdate, domain.Actor{Kind: domain.ActorUser, ID: alice.ID.String()}, alice.ID, &alice, &renamed)
+	err = repo.InTx(ctx, func(ctx context.Context, tx repository.Tx) error {
+		if _, err := tx.AddUser(ctx, alice); err != nil {
+			return err
+		}
+		if _, err := tx.UpdateUser(ctx, renamed); err != nil {
+			return err
+		}
+		if err := tx.AppendEvents(ctx, created); err != nil {
+			return err
+		}
+		appender, ok := tx.(repository.AuditAppender)
+		require.True(t, ok)
+		return appender.AppendAudit(ctx, audit)
+	})
+	require.NoError(t, err)
+
+	sub, err := repo.AddSubscription(ctx, domain.WebhookSubscription{URL: "https://example.com/hook", Secret: "s", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	payload, err := json.Marshal(created)
+	require.NoError(t, err)
+	delivery := domain.WebhookDelivery{
+		ID: uuid.New(), TenantID: sub.TenantID, SubscriptionID: sub.ID, EventID: created.ID, EventType: created.Type, Payload: payload,
+		Status: domain.DeliveryPending, NextAttemptAt: time.Now(), CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	require.NoError(t, repo.EnqueueDelivery(ctx, delivery))
+
+	// No table holds the emails in plaintext.
+	tables, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table'`)
+	require.NoError(t, err)
+	var names []string
+	for tables.Next() {
+		var name string
+		require.NoError(t, tables.Scan(&name))
+		names = append(names, name)
+	}
+	require.NoError(t, tables.Err())
+	tables.Close()
+	for _, name := range names {
+		rows, err := db.Query(`SELECT * FROM ` + name) //nolint:gosec // names read from sqlite_master
+		require.NoError(t, err)
+		columns, err := rows.Columns()
+		require.NoError(t, err)
+		for rows.Next() {
+			values := make([]any, len(columns))
+			dest := make([]any, len(columns))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			require.NoError(t, rows.Scan(dest...))
+			for i, value := range values {
+				if b, ok := value.([]byte); ok {
+					value = string(b)
+				}
+				assert.NotContains(t, fmt.Sprint(value), "alice@", "%s.%s", name, columns[i])
+			}
+		}
+		require.NoError(t, rows.Err())
+		rows.Close()
+	}
+
+	// They are read back decrypted.
+	events, err := repo.UserEvents(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, alice, events[0].User)
+	pending, err := repo.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, alice, pending[0].Event.User)
+	page, err := repo.AuditHistory(ctx, alice.ID, repository.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, audit.Changes, page.Entries[0].Changes)
+	got, err := repo.GetDelivery(ctx, delivery.ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(payload), string(got.Payload))
+}
@@ -0,0 +1,24 @@
+package repository
+
+import "errors"
+
+var (
+	// ErrUserNotFound is returned when no user matches the requested ID or email.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrEmailAlreadyExists is returned when the email is already taken in the tenant.
+	ErrEmailAlreadyExists = errors.New("email already exists")
+	// ErrUserAlreadyExists is returned by AddUser when the ID of the new user is already taken.
+	ErrUserAlreadyExists = errors.New("user already exists")
+	// ErrSubscriptionNotFound is returned when no webhook subscription matches the requested ID.
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+	// ErrCredentialNotFound is returned when the user has no password set.
+	ErrCredentialNotFound = errors.New("credential not found")
+	// ErrRefreshTokenNotFound is returned when no active refresh token matches the requested ID.
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrVerificationTokenNotFound is returned when no unused verification token matches the requested ID.
+	ErrVerificationTokenNotFound = errors.New("verification token not found")
+	// ErrAPIKeyNotFound is returned when no API key matches the requested ID or prefix.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrDeliveryNotFound is returned when no webhook delivery matches the requested ID.
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HealthDetails holds backend specific information reported by a health check.
+type HealthDetails map[string]any
+
+// HealthChecker is implemented by repositories able to report whether their backend is reachable.
+// A non-nil error means the backend is not ready; details are returned in both cases when available.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) (HealthDetails, error)
+}
+
+// CheckHealth pings the PostgreSQL pool and reports its statistics.
+func (r *PsqlRepository) CheckHealth(ctx context.Context) (HealthDetails, error) {
+	stat := r.pool.Stat()
+	details := HealthDetails{
+		"total_conns":            stat.TotalConns(),
+		"idle_conns":             stat.IdleConns(),
+		"acquired_conns":         stat.AcquiredConns(),
+		"max_conns":              stat.MaxConns(),
+		"acquire_count":          stat.AcquireCount(),
+		"empty_acquire_count":    stat.EmptyAcquireCount(),
+		"canceled_acquire_count": stat.CanceledAcquireCount(),
+	}
+	// Replicas are optional: reads fall back to the primary, so they are reported but never fail the check.
+	if len(r.reads.replicas) > 0 {
+		now := time.Now()
+		healthy := 0
+		for _, rep := range r.reads.replicas {
+			if rep.healthy(now) && rep.pool.Ping(ctx) == nil {
+				healthy++
+			}
+		}
+		details["replicas"] = len(r.reads.replicas)
+		details["replicas_healthy"] = healthy
+	}
+	if err := r.pool.Ping(ctx); err != nil {
+		return details, fmt.Errorf("failed to ping postgres: %w", err)
+	}
+	return details, nil
+}
+
+// CheckHealth pings the SQLite database, reports its statistics and runs the configured integrity check.
+func (r *SqlliteRepository) CheckHealth(ctx context.Context) (HealthDetails, error) {
+	stats := r.db.Stats()
+	details := HealthDetails{
+		"open_connections": stats.OpenConnections,
+		"in_use":           stats.InUse,
+		"idle":             stats.Idle,
+		"wait_count":       stats.WaitCount,
+	}
+	if err := r.db.PingContext(ctx); err != nil {
+		return details, fmt.Errorf("failed to ping sqlite: %w", err)
+	}
+
+	if r.integrityCheck == "" {
+		return details, nil
+	}
+	var result string
+	// The pragma name comes from a fixed set of options, never from user input.
+	if err := r.db.QueryRowContext(ctx, "PRAGMA "+r.integrityCheck).Scan(&result); err != nil {
+		return details, fmt.Errorf("failed to run %s: %w", r.integrityCheck, err)
+	}
+	details[r.integrityCheck] = result
+	if result != "ok" {
+		return details, fmt.Errorf("%s failed: %s", r.integrityCheck, result)
+	}
+	return details, nil
+}
+
+// CheckHealth always succeeds for the in-memory repository and reports the number of stored users.
+func (r *MemoryRepository) CheckHealth(_ context.Context) (HealthDetails, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return HealthDetails{"users": len(r.users)}, nil
+}
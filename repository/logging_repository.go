@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+const defaultSlowThreshold = 200 * time.Millisecond
+
+// LoggingRepository is a UserRepository decorator that emits a slog record for every call.
+// Successful calls are logged at debug level, calls slower than the threshold at warn level and failures at error level.
+type LoggingRepository struct {
+	next          UserRepository
+	logger        *slog.Logger
+	slowThreshold time.Duration
+	redactEmails  bool
+}
+
+// LoggingOption configures a LoggingRepository.
+type LoggingOption func(*LoggingRepository)
+
+// WithSlowThreshold sets the duration above which a call is logged as slow.
+func WithSlowThreshold(d time.Duration) LoggingOption {
+	return func(r *LoggingRepository) {
+		r.slowThreshold = d
+	}
+}
+
+// WithEmailRedaction enables or disables the masking of email addresses in log records (enabled by default).
+func WithEmailRedaction(enabled bool) LoggingOption {
+	return func(r *LoggingRepository) {
+		r.redactEmails = enabled
+	}
+}
+
+// NewLoggingRepository wraps next so that every call is logged with the given logger.
+func NewLoggingRepository(next UserRepository, logger *slog.Logger, opts ...LoggingOption) *LoggingRepository {
+	r := &LoggingRepository{
+		next:          next,
+		logger:        logger,
+		slowThreshold: defaultSlowThreshold,
+		redactEmails:  true,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// AddUser logs and delegates to the wrapped repository.
+func (r *LoggingRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	start := time.Now()
+	u, err := r.next.AddUser(ctx, user)
+	r.log(ctx, "AddUser", start, rowCount(err), err, slog.String("email", r.email(user.Email)))
+	return u, err
+}
+
+// GetAllUsers logs and delegates to the wrapped repository.
+func (r *LoggingRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	start := time.Now()
+	users, err := r.next.GetAllUsers(ctx)
+	r.log(ctx, "GetAllUsers", start, len(users), err)
+	return users, err
+}
+
+// GetUserByID logs and delegates to the wrapped repository.
+func (r *LoggingRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	start := time.Now()
+	u, err := r.next.GetUserByID(ctx, id)
+	r.log(ctx, "GetUserByID", start, rowCount(err), err, slog.String("id", id.String()))
+	return u, err
+}
+
+// GetUserByEmail logs and delegates to the wrapped repository.
+func (r *LoggingRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	start := time.Now()
+	u, err := r.next.GetUserByEmail(ctx, email)
+	r.log(ctx, "GetUserByEmail", start, rowCount(err), err, slog.String("email", r.email(email)))
+	return u, err
+}
+
+// UpdateUser logs and delegates to the wrapped repository.
+func (r *LoggingRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	start := time.Now()
+	u, err := r.next.UpdateUser(ctx, user)
+	r.log(ctx, "UpdateUser", start, rowCount(err), err, slog.String("id", user.ID.String()), slog.String("email", r.email(user.Email)))
+	return u, err
+}
+
+// DeleteUser logs and delegates to the wrapped repository.
+func (r *LoggingRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	start := time.Now()
+	err := r.next.DeleteUser(ctx, id)
+	r.log(ctx, "DeleteUser", start, rowCount(err), err, slog.String("id", id.String()))
+	return err
+}
+
+// rowCount returns the number of rows touched by a single-row operation.
+func rowCount(err error) int {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
+
+func (r *LoggingRepository) log(ctx context.Context, operation string, start time.Time, rows int, err error, attrs ...slog.Attr) {
+	duration := time.Since(start)
+	attrs = append(attrs,
+		slog.String("operation", operation),
+		slog.Duration("duration", duration),
+		slog.Int("rows", rows),
+	)
+
+	switch {
+	case err != nil:
+		attrs = append(attrs, slog.String("error_class", ErrorClass(err)), slog.String("error", err.Error()))
+		r.logger.LogAttrs(ctx, slog.LevelError, "repository call failed", attrs...)
+	case duration >= r.slowThreshold:
+		r.logger.LogAttrs(ctx, slog.LevelWarn, "slow repository call", attrs...)
+	default:
+		r.logger.LogAttrs(ctx, slog.LevelDebug, "repository call", attrs...)
+	}
+}
+
+func (r *LoggingRepository) email(email string) string {
+	if !r.redactEmails {
+		return email
+	}
+	return RedactEmail(email)
+}
+
+// RedactEmail masks the local part of an email address, keeping its first character and the domain.
+func RedactEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || local == "" {
+		return "***"
+	}
+	_, size := utf8.DecodeRuneInString(local)
+	return local[:size] + "***@" + domain
+}
+
+// ErrorClass returns a short, low-cardinality description of err suitable for logs and metrics.
+func ErrorClass(err error) string {
+	var pgErr *pgconn.PgError
+	var sqliteErr sqlite3.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline_exceeded"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, ErrUserNotFound):
+		return "not_found"
+	case errors.Is(err, ErrEmailAlreadyExists), errors.Is(err, ErrUserAlreadyExists):
+		return "conflict"
+	case errors.As(err, &pgErr):
+		if pgErr.Code == "23505" {
+			return "conflict"
+		}
+		return "postgres_" + pgErr.Code
+	case errors.As(err, &sqliteErr):
+		if sqliteErr.Code == sqlite3.ErrConstraint {
+			return "conflict"
+		}
+		return "sqlite_" + strings.ReplaceAll(strings.ToLower(sqliteErr.Code.Error()), " ", "_")
+	case pgconn.SafeToRetry(err) || pgconn.Timeout(err):
+		return "connection"
+	default:
+		return "internal"
+	}
+}
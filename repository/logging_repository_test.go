@@ -0,0 +1,118 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	mock_repository "github.com/davidyannick/repository-pattern/mocks"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestLogger(t *testing.T) (logger *slog.Logger, records func() []map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	records = func() []map[string]any {
+		var out []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var record map[string]any
+			require.NoError(t, dec.Decode(&record))
+			out = append(out, record)
+		}
+		return out
+	}
+	return logger, records
+}
+
+func TestLoggingRepository_AddUser(t *testing.T) {
+	ctx := testContext(t)
+	logger, records := newTestLogger(t)
+	repo := repository.NewLoggingRepository(repository.NewMemoryRepository(), logger)
+
+	_, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "john.doe@example.com"})
+	require.NoError(t, err)
+
+	logged := records()
+	require.Len(t, logged, 1)
+	assert.Equal(t, "DEBUG", logged[0]["level"])
+	assert.Equal(t, "AddUser", logged[0]["operation"])
+	assert.InDelta(t, 1, logged[0]["rows"], 0)
+	assert.Equal(t, "j***@example.com", logged[0]["email"])
+	assert.Contains(t, logged[0], "duration")
+}
+
+func TestLoggingRepository_WithoutRedaction(t *testing.T) {
+	ctx := testContext(t)
+	logger, records := newTestLogger(t)
+	repo := repository.NewLoggingRepository(repository.NewMemoryRepository(), logger, repository.WithEmailRedaction(false))
+
+	_, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "john.doe@example.com"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "john.doe@example.com", records()[0]["email"])
+}
+
+func TestLoggingRepository_SlowCall(t *testing.T) {
+	ctx := testContext(t)
+	logger, records := newTestLogger(t)
+
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+	mockRepo.EXPECT().GetAllUsers(gomock.Any()).DoAndReturn(func(context.Context) ([]domain.User, error) {
+		time.Sleep(5 * time.Millisecond)
+		return []domain.User{{Name: "User 1"}, {Name: "User 2"}}, nil
+	})
+
+	repo := repository.NewLoggingRepository(mockRepo, logger, repository.WithSlowThreshold(time.Millisecond))
+
+	_, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+
+	logged := records()
+	require.Len(t, logged, 1)
+	assert.Equal(t, "WARN", logged[0]["level"])
+	assert.InDelta(t, 2, logged[0]["rows"], 0)
+}
+
+func TestLoggingRepository_Error(t *testing.T) {
+	ctx := testContext(t)
+	logger, records := newTestLogger(t)
+	repo := repository.NewLoggingRepository(repository.NewMemoryRepository(), logger)
+
+	_, err := repo.AddUser(ctx, domain.User{Name: "User 1", Email: "dup@example.com"})
+	require.NoError(t, err)
+	_, err = repo.AddUser(ctx, domain.User{Name: "User 2", Email: "dup@example.com"})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+
+	logged := records()
+	require.Len(t, logged, 2)
+	assert.Equal(t, "ERROR", logged[1]["level"])
+	assert.Equal(t, "conflict", logged[1]["error_class"])
+	assert.InDelta(t, 0, logged[1]["rows"], 0)
+}
+
+func TestErrorClass(t *testing.T) {
+	ctx, cancel := context.WithCancel(testContext(t))
+	cancel()
+
+	_, err := repository.NewMemoryRepository().GetAllUsers(ctx)
+
+	assert.Equal(t, "canceled", repository.ErrorClass(err))
+	assert.Equal(t, "", repository.ErrorClass(nil))
+}
+
+func TestRedactEmail(t *testing.T) {
+	assert.Equal(t, "j***@example.com", repository.RedactEmail("john@example.com"))
+	assert.Equal(t, "***", repository.RedactEmail("not-an-email"))
+	assert.Equal(t, "é***@example.com", repository.RedactEmail("éloise@example.com"))
+}
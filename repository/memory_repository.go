@@ -0,0 +1,212 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+)
+
+// MemoryRepository provides an in-process, non-persistent implementation of UserRepository.
+type MemoryRepository struct {
+	mu            sync.RWMutex
+	users         []tenantUser
+	subscriptions []domain.WebhookSubscription
+	deliveries    []domain.WebhookDelivery
+	audit         []domain.AuditEntry
+	credentials   map[uuid.UUID]domain.Credential
+	refreshTokens []tenantRefreshToken
+	roles         map[uuid.UUID][]domain.Role
+	apiKeys       []tenantAPIKey
+
+	verificationTokens []tenantVerificationToken
+}
+
+// tenantUser is a stored user along with the tenant owning it.
+type tenantUser struct {
+	tenant string
+	user   domain.User
+}
+
+// NewMemoryRepository creates a new empty in-memory repository.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{}
+}
+
+// AddUser stores a new user in memory and returns the created user.
+// A new ID is generated unless the user already has one; an ID already taken is reported as ErrUserAlreadyExists.
+func (r *MemoryRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return r.storeUser(ctx, user, false)
+}
+
+// UpsertUser stores a user in memory under its ID, replacing the user of the tenant with that ID.
+func (r *MemoryRepository) UpsertUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return r.storeUser(ctx, user, true)
+}
+
+func (r *MemoryRepository) storeUser(ctx context.Context, user domain.User, replace bool) (*domain.User, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	if user.Status == "" {
+		user.Status = domain.StatusActive
+	}
+	i := slices.IndexFunc(r.users, func(u tenantUser) bool { return u.user.ID == user.ID })
+	switch {
+	case i >= 0 && !replace:
+		return nil, ErrUserAlreadyExists
+	case i >= 0 && r.users[i].tenant != tenantID:
+		return nil, ErrUserNotFound
+	}
+	if r.indexOf(tenantID, func(u *domain.User) bool { return u.Email == user.Email && u.ID != user.ID }) >= 0 {
+		return nil, ErrEmailAlreadyExists
+	}
+
+	if i >= 0 {
+		r.users[i].user = user
+		return &user, nil
+	}
+	r.users = append(r.users, tenantUser{tenant: tenantID, user: user})
+	return &user, nil
+}
+
+// GetAllUsers returns all users of the tenant in insertion order.
+func (r *MemoryRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]domain.User, 0, len(r.users))
+	for _, u := range r.users {
+		if u.tenant == tenantID {
+			users = append(users, u.user)
+		}
+	}
+	return users, nil
+}
+
+// ListUsers returns up to limit users with an ID greater than after, ordered by ID.
+func (r *MemoryRepository) ListUsers(ctx context.Context, after uuid.UUID, limit int) ([]domain.User, error) {
+	users, err := r.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return usersAfter(users, after, limit), nil
+}
+
+// GetUserByID returns the user with the given ID.
+func (r *MemoryRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == id })
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	user := r.users[i].user
+	return &user, nil
+}
+
+// GetUserByEmail returns the user with the given email.
+func (r *MemoryRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := r.indexOf(tenantID, func(u *domain.User) bool { return u.Email == email })
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	user := r.users[i].user
+	return &user, nil
+}
+
+// UpdateUser replaces the name and email of an existing user.
+func (r *MemoryRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == user.ID })
+	if i < 0 {
+		return nil, ErrUserNotFound
+	}
+	if j := r.indexOf(tenantID, func(u *domain.User) bool { return u.Email == user.Email }); j >= 0 && j != i {
+		return nil, ErrEmailAlreadyExists
+	}
+	if user.Status == "" {
+		user.Status = r.users[i].user.Status
+	}
+	r.users[i].user = user
+	return &user, nil
+}
+
+// DeleteUser removes the user with the given ID.
+func (r *MemoryRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == id })
+	if i < 0 {
+		return ErrUserNotFound
+	}
+	r.users = append(r.users[:i], r.users[i+1:]...)
+	delete(r.credentials, id)
+	delete(r.roles, id)
+	r.refreshTokens = slices.DeleteFunc(r.refreshTokens, func(t tenantRefreshToken) bool { return t.token.UserID == id })
+	r.verificationTokens = slices.DeleteFunc(r.verificationTokens, func(t tenantVerificationToken) bool { return t.token.UserID == id })
+	r.apiKeys = slices.DeleteFunc(r.apiKeys, func(k tenantAPIKey) bool { return k.key.UserID != nil && *k.key.UserID == id })
+	return nil
+}
+
+// indexOf returns the index of the first user of the tenant matching the predicate, or -1.
+// The caller must hold the lock.
+func (r *MemoryRepository) indexOf(tenantID string, match func(*domain.User) bool) int {
+	for i := range r.users {
+		if r.users[i].tenant == tenantID && match(&r.users[i].user) {
+			return i
+		}
+	}
+	return -1
+}
+
+// requireTenant returns the tenant of ctx, failing like the other backends when ctx is done or has no tenant.
+func requireTenant(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return tenant.Require(ctx)
+}
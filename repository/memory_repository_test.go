@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepository_AddUser(t *testing.T) {
+	ctx := testContext(t)
+	repo := repository.NewMemoryRepository()
+
+	user := domain.User{Name: "Test User", Email: "test@example.com"}
+
+	result, err := repo.AddUser(ctx, user)
+
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, result.ID)
+	assert.Equal(t, user.Name, result.Name)
+	assert.Equal(t, user.Email, result.Email)
+
+	users, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, *result, users[0])
+}
+
+func TestMemoryRepository_AddUser_DuplicateEmail(t *testing.T) {
+	ctx := testContext(t)
+	repo := repository.NewMemoryRepository()
+
+	_, err := repo.AddUser(ctx, domain.User{Name: "User 1", Email: "dup@example.com"})
+	require.NoError(t, err)
+
+	result, err := repo.AddUser(ctx, domain.User{Name: "User 2", Email: "dup@example.com"})
+
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+	assert.Nil(t, result)
+}
+
+func TestMemoryRepository_GetAllUsers_Order(t *testing.T) {
+	ctx := testContext(t)
+	repo := repository.NewMemoryRepository()
+
+	testUsers := []domain.User{
+		{Name: "User 1", Email: "user1@example.com"},
+		{Name: "User 2", Email: "user2@example.com"},
+		{Name: "User 3", Email: "user3@example.com"},
+	}
+	for _, user := range testUsers {
+		_, err := repo.AddUser(ctx, user)
+		require.NoError(t, err)
+	}
+
+	users, err := repo.GetAllUsers(ctx)
+
+	require.NoError(t, err)
+	require.Len(t, users, len(testUsers))
+	for i := range testUsers {
+		assert.Equal(t, testUsers[i].Email, users[i].Email)
+	}
+}
+
+func TestMemoryRepository_GetUpdateDeleteUser(t *testing.T) {
+	ctx := testContext(t)
+	repo := repository.NewMemoryRepository()
+
+	added, err := repo.AddUser(ctx, domain.User{Name: "User 1", Email: "user1@example.com"})
+	require.NoError(t, err)
+	other, err := repo.AddUser(ctx, domain.User{Name: "User 2", Email: "user2@example.com"})
+	require.NoError(t, err)
+
+	byEmail, err := repo.GetUserByEmail(ctx, "user1@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, *added, *byEmail)
+
+	// Email stays unique on update
+	_, err = repo.UpdateUser(ctx, domain.User{ID: added.ID, Name: "User 1", Email: other.Email})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+
+	added.Name = "Updated"
+	_, err = repo.UpdateUser(ctx, *added)
+	require.NoError(t, err)
+
+	byID, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", byID.Name)
+
+	require.NoError(t, repo.DeleteUser(ctx, added.ID))
+	_, err = repo.GetUserByID(ctx, added.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	require.ErrorIs(t, repo.DeleteUser(ctx, added.ID), repository.ErrUserNotFound)
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// RepositoryMetrics holds the Prometheus metrics shared by every MetricsRepository.
+type RepositoryMetrics struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// NewRepositoryMetrics creates the repository metrics and registers them with reg.
+func NewRepositoryMetrics(reg prometheus.Registerer) (*RepositoryMetrics, error) {
+	m := &RepositoryMetrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_operation_duration_seconds",
+			Help:    "Duration of repository operations.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"backend", "operation"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "repository_operation_errors_total",
+			Help: "Number of failed repository operations by error class.",
+		}, []string{"backend", "operation", "class"}),
+	}
+	for _, c := range []prometheus.Collector{m.duration, m.errors} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("failed to register repository metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// MetricsRepository is a UserRepository decorator recording the latency and errors of every call.
+type MetricsRepository struct {
+	next    UserRepository
+	backend string
+	metrics *RepositoryMetrics
+}
+
+// NewMetricsRepository wraps next so that its calls are recorded under the given backend label.
+func NewMetricsRepository(next UserRepository, backend string, metrics *RepositoryMetrics) *MetricsRepository {
+	return &MetricsRepository{next: next, backend: backend, metrics: metrics}
+}
+
+// AddUser records and delegates to the wrapped repository.
+func (r *MetricsRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	defer r.observe("AddUser", time.Now())
+	u, err := r.next.AddUser(ctx, user)
+	r.countError("AddUser", err)
+	return u, err
+}
+
+// GetAllUsers records and delegates to the wrapped repository.
+func (r *MetricsRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	defer r.observe("GetAllUsers", time.Now())
+	users, err := r.next.GetAllUsers(ctx)
+	r.countError("GetAllUsers", err)
+	return users, err
+}
+
+// GetUserByID records and delegates to the wrapped repository.
+func (r *MetricsRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	defer r.observe("GetUserByID", time.Now())
+	u, err := r.next.GetUserByID(ctx, id)
+	r.countError("GetUserByID", err)
+	return u, err
+}
+
+// GetUserByEmail records and delegates to the wrapped repository.
+func (r *MetricsRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	defer r.observe("GetUserByEmail", time.Now())
+	u, err := r.next.GetUserByEmail(ctx, email)
+	r.countError("GetUserByEmail", err)
+	return u, err
+}
+
+// UpdateUser records and delegates to the wrapped repository.
+func (r *MetricsRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	defer r.observe("UpdateUser", time.Now())
+	u, err := r.next.UpdateUser(ctx, user)
+	r.countError("UpdateUser", err)
+	return u, err
+}
+
+// DeleteUser records and delegates to the wrapped repository.
+func (r *MetricsRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	defer r.observe("DeleteUser", time.Now())
+	err := r.next.DeleteUser(ctx, id)
+	r.countError("DeleteUser", err)
+	return err
+}
+
+func (r *MetricsRepository) observe(operation string, start time.Time) {
+	r.metrics.duration.WithLabelValues(r.backend, operation).Observe(time.Since(start).Seconds())
+}
+
+func (r *MetricsRepository) countError(operation string, err error) {
+	if err != nil {
+		r.metrics.errors.WithLabelValues(r.backend, operation, ErrorClass(err)).Inc()
+	}
+}
+
+// PoolCollectorProvider is implemented by repositories exposing their connection pool statistics to Prometheus.
+type PoolCollectorProvider interface {
+	PoolCollector(name string) prometheus.Collector
+}
+
+// PoolCollector returns a collector exporting pgxpool.Stat() under the given db_name label.
+// Replica pools are labeled name-replica-N.
+func (r *PsqlRepository) PoolCollector(name string) prometheus.Collector {
+	pools := collectorList{newPgxPoolCollector(r.pool, name)}
+	for i, rep := range r.reads.replicas {
+		pools = append(pools, newPgxPoolCollector(rep.pool, fmt.Sprintf("%s-replica-%d", name, i+1)))
+	}
+	return pools
+}
+
+// collectorList groups several collectors into one.
+type collectorList []prometheus.Collector
+
+// Describe implements prometheus.Collector.
+func (l collectorList) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range l {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (l collectorList) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range l {
+		c.Collect(ch)
+	}
+}
+
+// PoolCollector returns a collector exporting sql.DBStats under the given db_name label.
+func (r *SqlliteRepository) PoolCollector(name string) prometheus.Collector {
+	return collectors.NewDBStatsCollector(r.db, name)
+}
+
+// pgxPoolCollector exports pgxpool statistics, following the naming of collectors.NewDBStatsCollector.
+type pgxPoolCollector struct {
+	pool *pgxpool.Pool
+
+	maxConns          *prometheus.Desc
+	totalConns        *prometheus.Desc
+	idleConns         *prometheus.Desc
+	acquiredConns     *prometheus.Desc
+	acquireCount      *prometheus.Desc
+	acquireDuration   *prometheus.Desc
+	emptyAcquireCount *prometheus.Desc
+	canceledAcquire   *prometheus.Desc
+}
+
+func newPgxPoolCollector(pool *pgxpool.Pool, name string) *pgxPoolCollector {
+	labels := prometheus.Labels{"db_name": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("pgxpool", "", metric), help, nil, labels)
+	}
+	return &pgxPoolCollector{
+		pool:              pool,
+		maxConns:          desc("max_conns", "Maximum size of the pool."),
+		totalConns:        desc("total_conns", "Total number of resources currently in the pool."),
+		idleConns:         desc("idle_conns", "Number of currently idle connections in the pool."),
+		acquiredConns:     desc("acquired_conns", "Number of currently acquired connections in the pool."),
+		acquireCount:      desc("acquire_count_total", "Cumulative count of successful acquires from the pool."),
+		acquireDuration:   desc("acquire_duration_seconds_total", "Total duration of all successful acquires from the pool."),
+		emptyAcquireCount: desc("empty_acquire_count_total", "Cumulative count of acquires that waited for a connection."),
+		canceledAcquire:   desc("canceled_acquire_count_total", "Cumulative count of acquires canceled by a context."),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *pgxPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxConns
+	ch <- c.totalConns
+	ch <- c.idleConns
+	ch <- c.acquiredConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquireCount
+	ch <- c.canceledAcquire
+}
+
+// Collect implements prometheus.Collector.
+func (c *pgxPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(stat.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(stat.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(stat.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(stat.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(stat.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, stat.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquireCount, prometheus.CounterValue, float64(stat.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquire, prometheus.CounterValue, float64(stat.CanceledAcquireCount()))
+}
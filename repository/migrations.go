@@ -0,0 +1,530 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	psqlSchema = `
+    CREATE TABLE IF NOT EXISTS users (
+      id        UUID PRIMARY KEY,
+      tenant_id TEXT NOT NULL,
+      name      VARCHAR(255) NOT NULL,
+      email     VARCHAR(255) NOT NULL
+    );
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE users ALTER COLUMN tenant_id DROP DEFAULT;
+    ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+    DROP INDEX IF EXISTS idx_users_email;
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email ON users(tenant_id, email);
+    ALTER TABLE users ALTER COLUMN email TYPE TEXT;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index TEXT;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS email_key_id TEXT;
+    ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active';
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email_index ON users(tenant_id, email_index);
+    ALTER TABLE users ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE users FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS users_tenant_isolation ON users;
+    CREATE POLICY users_tenant_isolation ON users
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    DROP POLICY IF EXISTS users_tenant_listing ON users;
+    CREATE POLICY users_tenant_listing ON users FOR SELECT
+      USING (current_setting('app.list_tenants', true) = 'on');
+    CREATE TABLE IF NOT EXISTS outbox (
+      seq          BIGSERIAL PRIMARY KEY,
+      id           UUID NOT NULL UNIQUE,
+      type         VARCHAR(64) NOT NULL,
+      tenant_id    TEXT NOT NULL DEFAULT '',
+      user_id      UUID NOT NULL,
+      payload      JSONB NOT NULL,
+      occurred_at  TIMESTAMPTZ NOT NULL,
+      delivered_at TIMESTAMPTZ
+    );
+    ALTER TABLE outbox ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT '';
+    CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(seq) WHERE delivered_at IS NULL;
+    CREATE INDEX IF NOT EXISTS idx_outbox_user ON outbox(tenant_id, user_id);
+    CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+      id          UUID PRIMARY KEY,
+      tenant_id   TEXT NOT NULL,
+      url         TEXT NOT NULL,
+      secret      TEXT NOT NULL,
+      event_types TEXT[] NOT NULL DEFAULT '{}',
+      created_at  TIMESTAMPTZ NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+      id              UUID PRIMARY KEY,
+      tenant_id       TEXT NOT NULL,
+      subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+      event_id        UUID NOT NULL,
+      event_type      VARCHAR(64) NOT NULL,
+      payload         JSONB NOT NULL,
+      status          VARCHAR(16) NOT NULL,
+      attempts        INTEGER NOT NULL DEFAULT 0,
+      last_error      TEXT NOT NULL DEFAULT '',
+      response_code   INTEGER NOT NULL DEFAULT 0,
+      next_attempt_at TIMESTAMPTZ NOT NULL,
+      created_at      TIMESTAMPTZ NOT NULL,
+      updated_at      TIMESTAMPTZ NOT NULL,
+      UNIQUE (subscription_id, event_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+    ALTER TABLE webhook_subscriptions ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE webhook_subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+    ALTER TABLE webhook_deliveries ADD COLUMN IF NOT EXISTS tenant_id TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE webhook_deliveries ALTER COLUMN tenant_id DROP DEFAULT;
+    CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_tenant ON webhook_subscriptions(tenant_id);
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_tenant ON webhook_deliveries(tenant_id, created_at);
+    CREATE TABLE IF NOT EXISTS user_audit (
+      seq         BIGSERIAL PRIMARY KEY,
+      id          UUID NOT NULL UNIQUE,
+      tenant_id   TEXT NOT NULL,
+      user_id     UUID NOT NULL,
+      actor_kind  VARCHAR(16) NOT NULL,
+      actor_id    TEXT NOT NULL,
+      action      VARCHAR(16) NOT NULL,
+      changes     JSONB NOT NULL,
+      occurred_at TIMESTAMPTZ NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_user_audit_user ON user_audit(tenant_id, user_id, seq);
+    CREATE OR REPLACE FUNCTION user_audit_append_only() RETURNS trigger AS $$
+    BEGIN
+      IF TG_OP = 'DELETE' OR (NEW.seq, NEW.id, NEW.tenant_id, NEW.user_id, NEW.actor_kind, NEW.actor_id, NEW.action, NEW.occurred_at)
+          IS DISTINCT FROM (OLD.seq, OLD.id, OLD.tenant_id, OLD.user_id, OLD.actor_kind, OLD.actor_id, OLD.action, OLD.occurred_at) THEN
+        RAISE EXCEPTION 'user_audit is append-only';
+      END IF;
+      RETURN NEW;
+    END;
+    $$ LANGUAGE plpgsql;
+    DROP TRIGGER IF EXISTS user_audit_append_only ON user_audit;
+    CREATE TRIGGER user_audit_append_only BEFORE UPDATE OR DELETE ON user_audit
+      FOR EACH ROW EXECUTE FUNCTION user_audit_append_only();
+    ALTER TABLE user_audit ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE user_audit FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS user_audit_tenant_isolation ON user_audit;
+    CREATE POLICY user_audit_tenant_isolation ON user_audit
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    CREATE TABLE IF NOT EXISTS user_credentials (
+      user_id       UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+      tenant_id     TEXT NOT NULL,
+      password_hash TEXT NOT NULL,
+      updated_at    TIMESTAMPTZ NOT NULL
+    );
+    ALTER TABLE user_credentials ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE user_credentials FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS user_credentials_tenant_isolation ON user_credentials;
+    CREATE POLICY user_credentials_tenant_isolation ON user_credentials
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    CREATE TABLE IF NOT EXISTS user_roles (
+      user_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+      tenant_id TEXT NOT NULL,
+      role      VARCHAR(32) NOT NULL,
+      PRIMARY KEY (user_id, role)
+    );
+    ALTER TABLE user_roles ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE user_roles FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS user_roles_tenant_isolation ON user_roles;
+    CREATE POLICY user_roles_tenant_isolation ON user_roles
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    CREATE TABLE IF NOT EXISTS refresh_tokens (
+      id         UUID PRIMARY KEY,
+      tenant_id  TEXT NOT NULL,
+      user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+      token_hash TEXT NOT NULL,
+      expires_at TIMESTAMPTZ NOT NULL,
+      created_at TIMESTAMPTZ NOT NULL,
+      revoked_at TIMESTAMPTZ
+    );
+    CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(tenant_id, user_id);
+    ALTER TABLE refresh_tokens ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE refresh_tokens FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS refresh_tokens_tenant_isolation ON refresh_tokens;
+    CREATE POLICY refresh_tokens_tenant_isolation ON refresh_tokens
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    CREATE TABLE IF NOT EXISTS verification_tokens (
+      id         UUID PRIMARY KEY,
+      tenant_id  TEXT NOT NULL,
+      user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+      token_hash TEXT NOT NULL,
+      expires_at TIMESTAMPTZ NOT NULL,
+      created_at TIMESTAMPTZ NOT NULL,
+      used_at    TIMESTAMPTZ
+    );
+    ALTER TABLE verification_tokens ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE verification_tokens FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS verification_tokens_tenant_isolation ON verification_tokens;
+    CREATE POLICY verification_tokens_tenant_isolation ON verification_tokens
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    CREATE TABLE IF NOT EXISTS api_keys (
+      id              UUID PRIMARY KEY,
+      tenant_id       TEXT NOT NULL,
+      prefix          TEXT NOT NULL UNIQUE,
+      key_hash        TEXT NOT NULL,
+      name            TEXT NOT NULL,
+      user_id         UUID REFERENCES users(id) ON DELETE CASCADE,
+      service_account TEXT,
+      permissions     TEXT[] NOT NULL,
+      expires_at      TIMESTAMPTZ,
+      last_used_at    TIMESTAMPTZ,
+      created_at      TIMESTAMPTZ NOT NULL,
+      revoked_at      TIMESTAMPTZ,
+      CHECK ((user_id IS NULL) <> (service_account IS NULL))
+    );
+    ALTER TABLE api_keys ENABLE ROW LEVEL SECURITY;
+    ALTER TABLE api_keys FORCE ROW LEVEL SECURITY;
+    DROP POLICY IF EXISTS api_keys_tenant_isolation ON api_keys;
+    CREATE POLICY api_keys_tenant_isolation ON api_keys
+      USING (tenant_id = current_setting('app.tenant_id', true))
+      WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+    CREATE OR REPLACE FUNCTION notify_user_change() RETURNS trigger AS $$
+    DECLARE
+      changed users%ROWTYPE;
+    BEGIN
+      IF TG_OP = 'DELETE' THEN changed := OLD; ELSE changed := NEW; END IF;
+      PERFORM pg_notify('user_changes', json_build_object(
+        'op', lower(TG_OP),
+        'tenant_id', changed.tenant_id,
+        'user', json_build_object('id', changed.id, 'name', changed.name, 'email', changed.email, 'status', changed.status)
+      )::text);
+      RETURN NULL;
+    END;
+    $$ LANGUAGE plpgsql;
+    DROP TRIGGER IF EXISTS users_notify ON users;
+    CREATE TRIGGER users_notify AFTER INSERT OR UPDATE OR DELETE ON users
+      FOR EACH ROW EXECUTE FUNCTION notify_user_change();
+    `
+
+	sqliteSchema = `
+    CREATE TABLE IF NOT EXISTS users (
+      id           TEXT PRIMARY KEY,
+      tenant_id    TEXT NOT NULL,
+      name         TEXT NOT NULL,
+      email        TEXT NOT NULL,
+      email_index  TEXT,
+      email_key_id TEXT,
+      status       TEXT NOT NULL DEFAULT 'active',
+      UNIQUE (tenant_id, email)
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_users_tenant_email_index ON users(tenant_id, email_index);
+    CREATE TABLE IF NOT EXISTS outbox (
+      seq          INTEGER PRIMARY KEY AUTOINCREMENT,
+      id           TEXT NOT NULL UNIQUE,
+      type         TEXT NOT NULL,
+      tenant_id    TEXT NOT NULL DEFAULT '',
+      user_id      TEXT NOT NULL,
+      payload      TEXT NOT NULL,
+      occurred_at  TIMESTAMP NOT NULL,
+      delivered_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(seq) WHERE delivered_at IS NULL;
+    CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+      id          TEXT PRIMARY KEY,
+      tenant_id   TEXT NOT NULL,
+      url         TEXT NOT NULL,
+      secret      TEXT NOT NULL,
+      event_types TEXT NOT NULL DEFAULT '[]',
+      created_at  TIMESTAMP NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+      id              TEXT PRIMARY KEY,
+      tenant_id       TEXT NOT NULL,
+      subscription_id TEXT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+      event_id        TEXT NOT NULL,
+      event_type      TEXT NOT NULL,
+      payload         TEXT NOT NULL,
+      status          TEXT NOT NULL,
+      attempts        INTEGER NOT NULL DEFAULT 0,
+      last_error      TEXT NOT NULL DEFAULT '',
+      response_code   INTEGER NOT NULL DEFAULT 0,
+      next_attempt_at TIMESTAMP NOT NULL,
+      created_at      TIMESTAMP NOT NULL,
+      updated_at      TIMESTAMP NOT NULL,
+      UNIQUE (subscription_id, event_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+    CREATE TABLE IF NOT EXISTS user_audit (
+      seq         INTEGER PRIMARY KEY AUTOINCREMENT,
+      id          TEXT NOT NULL UNIQUE,
+      tenant_id   TEXT NOT NULL,
+      user_id     TEXT NOT NULL,
+      actor_kind  TEXT NOT NULL,
+      actor_id    TEXT NOT NULL,
+      action      TEXT NOT NULL,
+      changes     TEXT NOT NULL,
+      occurred_at TIMESTAMP NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_user_audit_user ON user_audit(tenant_id, user_id, seq);
+    CREATE TRIGGER IF NOT EXISTS user_audit_no_delete BEFORE DELETE ON user_audit BEGIN
+      SELECT RAISE(ABORT, 'user_audit is append-only');
+    END;
+    CREATE TRIGGER IF NOT EXISTS user_audit_no_update
+      BEFORE UPDATE OF seq, id, tenant_id, user_id, actor_kind, actor_id, action, occurred_at ON user_audit BEGIN
+      SELECT RAISE(ABORT, 'user_audit is append-only');
+    END;
+    CREATE TABLE IF NOT EXISTS user_credentials (
+      user_id       TEXT PRIMARY KEY,
+      tenant_id     TEXT NOT NULL,
+      password_hash TEXT NOT NULL,
+      updated_at    TIMESTAMP NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS user_roles (
+      user_id   TEXT NOT NULL,
+      tenant_id TEXT NOT NULL,
+      role      TEXT NOT NULL,
+      PRIMARY KEY (user_id, role)
+    );
+    CREATE TRIGGER IF NOT EXISTS users_delete_roles AFTER DELETE ON users BEGIN
+      DELETE FROM user_roles WHERE user_id = OLD.id;
+    END;
+    CREATE TABLE IF NOT EXISTS refresh_tokens (
+      id         TEXT PRIMARY KEY,
+      tenant_id  TEXT NOT NULL,
+      user_id    TEXT NOT NULL,
+      token_hash TEXT NOT NULL,
+      expires_at TIMESTAMP NOT NULL,
+      created_at TIMESTAMP NOT NULL,
+      revoked_at TIMESTAMP
+    );
+    CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user ON refresh_tokens(tenant_id, user_id);
+    CREATE TRIGGER IF NOT EXISTS users_delete_credentials AFTER DELETE ON users BEGIN
+      DELETE FROM user_credentials WHERE user_id = OLD.id;
+    END;
+    CREATE TRIGGER IF NOT EXISTS users_delete_refresh_tokens AFTER DELETE ON users BEGIN
+      DELETE FROM refresh_tokens WHERE user_id = OLD.id;
+    END;
+    CREATE TABLE IF NOT EXISTS verification_tokens (
+      id         TEXT PRIMARY KEY,
+      tenant_id  TEXT NOT NULL,
+      user_id    TEXT NOT NULL,
+      token_hash TEXT NOT NULL,
+      expires_at TIMESTAMP NOT NULL,
+      created_at TIMESTAMP NOT NULL,
+      used_at    TIMESTAMP
+    );
+    CREATE TRIGGER IF NOT EXISTS users_delete_verification_tokens AFTER DELETE ON users BEGIN
+      DELETE FROM verification_tokens WHERE user_id = OLD.id;
+    END;
+    CREATE TABLE IF NOT EXISTS api_keys (
+      id              TEXT PRIMARY KEY,
+      tenant_id       TEXT NOT NULL,
+      prefix          TEXT NOT NULL UNIQUE,
+      key_hash        TEXT NOT NULL,
+      name            TEXT NOT NULL,
+      user_id         TEXT,
+      service_account TEXT,
+      permissions     TEXT NOT NULL,
+      expires_at      TIMESTAMP,
+      last_used_at    TIMESTAMP,
+      created_at      TIMESTAMP NOT NULL,
+      revoked_at      TIMESTAMP
+    );
+    CREATE TRIGGER IF NOT EXISTS users_delete_api_keys AFTER DELETE ON users BEGIN
+      DELETE FROM api_keys WHERE user_id = OLD.id;
+    END;
+    CREATE TABLE IF NOT EXISTS user_changes (
+      seq       INTEGER PRIMARY KEY AUTOINCREMENT,
+      op        TEXT NOT NULL,
+      tenant_id TEXT NOT NULL DEFAULT '',
+      id        TEXT NOT NULL,
+      name      TEXT NOT NULL,
+      email     TEXT NOT NULL,
+      status    TEXT NOT NULL DEFAULT ''
+    );
+    CREATE TRIGGER IF NOT EXISTS users_insert_change AFTER INSERT ON users BEGIN
+      INSERT INTO user_changes(op, tenant_id, id, name, email, status)
+      VALUES('insert', NEW.tenant_id, NEW.id, NEW.name, NEW.email, NEW.status);
+    END;
+    CREATE TRIGGER IF NOT EXISTS users_update_change AFTER UPDATE ON users BEGIN
+      INSERT INTO user_changes(op, tenant_id, id, name, email, status)
+      VALUES('update', NEW.tenant_id, NEW.id, NEW.name, NEW.email, NEW.status);
+    END;
+    CREATE TRIGGER IF NOT EXISTS users_delete_change AFTER DELETE ON users BEGIN
+      INSERT INTO user_changes(op, tenant_id, id, name, email, status)
+      VALUES('delete', OLD.tenant_id, OLD.id, OLD.name, OLD.email, OLD.status);
+    END;
+    CREATE TRIGGER IF NOT EXISTS user_changes_prune AFTER INSERT ON user_changes BEGIN
+      DELETE FROM user_changes WHERE seq <= NEW.seq - 1000;
+    END;
+`
+
+	// sqliteTenantMigration rebuilds a users table created before tenants, since SQLite cannot drop the
+	// global email uniqueness constraint in place. The existing users go to the default tenant.
+	sqliteTenantMigration = `
+    CREATE TABLE users_tenant (
+      id        TEXT PRIMARY KEY,
+      tenant_id TEXT NOT NULL,
+      name      TEXT NOT NULL,
+      email     TEXT NOT NULL,
+      UNIQUE (tenant_id, email)
+    );
+    INSERT INTO users_tenant(id, tenant_id, name, email) SELECT id, 'default', name, email FROM users;
+    DROP TABLE users;
+    ALTER TABLE users_tenant RENAME TO users;
+`
+
+	// selectColumnMissingQuery2 tells whether a table exists without the given column.
+	selectColumnMissingQuery2 = `
+    SELECT COUNT(*) > 0 AND SUM(name = ?) = 0
+      FROM pragma_table_info(?);
+`
+
+	addOutboxTenantQuery2 = `
+    ALTER TABLE outbox ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+`
+
+	// createOutboxUserIndexQuery2 runs once outbox has its tenant_id column.
+	createOutboxUserIndexQuery2 = `
+    CREATE INDEX IF NOT EXISTS idx_outbox_user ON outbox(tenant_id, user_id);
+`
+
+	addUserStatusQuery2 = `
+    ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active';
+`
+
+	// addChangeStatusQuery2 drops the change triggers, so that the schema recreates them with the status.
+	addChangeStatusQuery2 = `
+    ALTER TABLE user_changes ADD COLUMN status TEXT NOT NULL DEFAULT '';
+    DROP TRIGGER IF EXISTS users_insert_change;
+    DROP TRIGGER IF EXISTS users_update_change;
+    DROP TRIGGER IF EXISTS users_delete_change;
+`
+
+	// addChangeTenantQuery2 drops the change triggers, so that the schema recreates them with the tenant.
+	addChangeTenantQuery2 = `
+    ALTER TABLE user_changes ADD COLUMN tenant_id TEXT NOT NULL DEFAULT '';
+    DROP TRIGGER IF EXISTS users_insert_change;
+    DROP TRIGGER IF EXISTS users_update_change;
+    DROP TRIGGER IF EXISTS users_delete_change;
+`
+
+	// addWebhookTenantQuery2 gives the subscriptions and deliveries stored before tenants to the default tenant.
+	addWebhookTenantQuery2 = `
+    ALTER TABLE webhook_subscriptions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE webhook_deliveries ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+`
+
+	// createWebhookTenantIndexesQuery2 runs once the webhook tables have their tenant_id column.
+	createWebhookTenantIndexesQuery2 = `
+    CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_tenant ON webhook_subscriptions(tenant_id);
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_tenant ON webhook_deliveries(tenant_id, created_at);
+`
+
+	addEmailEncryptionQuery2 = `
+    ALTER TABLE users ADD COLUMN email_index TEXT;
+    ALTER TABLE users ADD COLUMN email_key_id TEXT;
+`
+)
+
+// Migrator is implemented by repositories that can create or upgrade their own schema.
+type Migrator interface {
+	Migrate(ctx context.Context) error
+}
+
+// Migrate creates the users, credentials, roles, refresh token, verification token, API key, outbox, webhook and audit
+// tables and the change notification trigger in PostgreSQL.
+// Users stored before tenants were introduced are moved to the default tenant, and row-level security
+// restricts users to the tenant set in app.tenant_id. Superusers and roles with BYPASSRLS are not restricted,
+// so the application should connect with a regular role.
+func (r *PsqlRepository) Migrate(ctx context.Context) error {
+	if _, err := r.pool.Exec(ctx, psqlSchema); err != nil {
+		return fmt.Errorf("failed to migrate postgres schema: %w", err)
+	}
+	return nil
+}
+
+// Migrate creates the users, credentials, roles, refresh token, verification token, API key, outbox, webhook and audit
+// tables and the change log read by Watch in SQLite.
+// Users stored before tenants were introduced are moved to the default tenant.
+func (r *SqlliteRepository) Migrate(ctx context.Context) error {
+	if missing, err := r.columnMissing(ctx, "users", "tenant_id"); err != nil {
+		return err
+	} else if missing {
+		if err := r.migrateTenants(ctx); err != nil {
+			return err
+		}
+	}
+	// The schema indexes email_index, so it has to exist in older users tables first.
+	if missing, err := r.columnMissing(ctx, "users", "email_index"); err != nil {
+		return err
+	} else if missing {
+		if _, err := r.db.ExecContext(ctx, addEmailEncryptionQuery2); err != nil {
+			return fmt.Errorf("failed to add email encryption columns to sqlite users: %w", err)
+		}
+	}
+	// Users stored before statuses are active. The change triggers copy the status, so it has to exist first too.
+	if missing, err := r.columnMissing(ctx, "users", "status"); err != nil {
+		return err
+	} else if missing {
+		if _, err := r.db.ExecContext(ctx, addUserStatusQuery2); err != nil {
+			return fmt.Errorf("failed to add status to sqlite users: %w", err)
+		}
+	}
+	if missing, err := r.columnMissing(ctx, "user_changes", "status"); err != nil {
+		return err
+	} else if missing {
+		if _, err := r.db.ExecContext(ctx, addChangeStatusQuery2); err != nil {
+			return fmt.Errorf("failed to add status to sqlite user changes: %w", err)
+		}
+	}
+	if missing, err := r.columnMissing(ctx, "user_changes", "tenant_id"); err != nil {
+		return err
+	} else if missing {
+		if _, err := r.db.ExecContext(ctx, addChangeTenantQuery2); err != nil {
+			return fmt.Errorf("failed to add tenants to sqlite user changes: %w", err)
+		}
+	}
+	if _, err := r.db.ExecContext(ctx, sqliteSchema); err != nil {
+		return fmt.Errorf("failed to migrate sqlite schema: %w", err)
+	}
+	if missing, err := r.columnMissing(ctx, "outbox", "tenant_id"); err != nil {
+		return err
+	} else if missing {
+		if _, err := r.db.ExecContext(ctx, addOutboxTenantQuery2); err != nil {
+			return fmt.Errorf("failed to add tenants to sqlite outbox: %w", err)
+		}
+	}
+	if _, err := r.db.ExecContext(ctx, createOutboxUserIndexQuery2); err != nil {
+		return fmt.Errorf("failed to index sqlite outbox: %w", err)
+	}
+	if missing, err := r.columnMissing(ctx, "webhook_subscriptions", "tenant_id"); err != nil {
+		return err
+	} else if missing {
+		if _, err := r.db.ExecContext(ctx, addWebhookTenantQuery2); err != nil {
+			return fmt.Errorf("failed to add tenants to sqlite webhooks: %w", err)
+		}
+	}
+	if _, err := r.db.ExecContext(ctx, createWebhookTenantIndexesQuery2); err != nil {
+		return fmt.Errorf("failed to index sqlite webhooks: %w", err)
+	}
+	return nil
+}
+
+func (r *SqlliteRepository) columnMissing(ctx context.Context, table, column string) (bool, error) {
+	var missing bool
+	if err := r.db.QueryRowContext(ctx, selectColumnMissingQuery2, column, table).Scan(&missing); err != nil {
+		return false, fmt.Errorf("failed to inspect sqlite table %s: %w", table, err)
+	}
+	return missing, nil
+}
+
+func (r *SqlliteRepository) migrateTenants(ctx context.Context) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	if _, err := tx.ExecContext(ctx, sqliteTenantMigration); err != nil {
+		return fmt.Errorf("failed to add tenants to sqlite users: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
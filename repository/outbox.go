@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	insertOutboxQuery = `
+    INSERT INTO outbox (id, type, tenant_id, user_id, payload, occurred_at)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    `
+
+	selectPendingOutboxQuery = `
+    SELECT seq, id, type, tenant_id, user_id, payload, occurred_at
+      FROM outbox
+     WHERE delivered_at IS NULL
+     ORDER BY seq
+     LIMIT $1
+    `
+
+	markOutboxDeliveredQuery = `UPDATE outbox SET delivered_at = now() WHERE seq = $1`
+
+	insertOutboxQuery2 = `
+    INSERT INTO outbox(id, type, tenant_id, user_id, payload, occurred_at)
+    VALUES(?, ?, ?, ?, ?, ?);
+`
+
+	selectPendingOutboxQuery2 = `
+    SELECT seq, id, type, tenant_id, user_id, payload, occurred_at
+      FROM outbox
+     WHERE delivered_at IS NULL
+     ORDER BY seq
+     LIMIT ?;
+`
+
+	markOutboxDeliveredQuery2 = `
+    UPDATE outbox
+       SET delivered_at = CURRENT_TIMESTAMP
+     WHERE seq = ?;
+`
+)
+
+// Tx is a UserRepository bound to a transaction that can also append events to the outbox.
+type Tx interface {
+	UserRepository
+	// AppendEvents records events in the outbox; they are committed or rolled back with the user changes.
+	// Events without a tenant are recorded under the tenant of ctx.
+	AppendEvents(ctx context.Context, events ...domain.Event) error
+}
+
+// Transactor is implemented by repositories able to run user writes and outbox appends in a single transaction.
+type Transactor interface {
+	// InTx runs fn in a transaction, committed if fn returns nil and rolled back otherwise.
+	InTx(ctx context.Context, fn func(ctx context.Context, tx Tx) error) error
+}
+
+// OutboxRecord is an event stored in the outbox. Seq orders the events in the order they were committed.
+type OutboxRecord struct {
+	Seq   int64
+	Event domain.Event
+}
+
+// OutboxStore is the side of the outbox read by the relay.
+type OutboxStore interface {
+	// PendingEvents returns at most limit undelivered events, oldest first.
+	PendingEvents(ctx context.Context, limit int) ([]OutboxRecord, error)
+	// MarkDelivered flags the event with the given sequence number as delivered.
+	MarkDelivered(ctx context.Context, seq int64) error
+}
+
+// InTx runs fn in a PostgreSQL transaction on the primary pool, scoped to the tenant of ctx.
+func (r *PsqlRepository) InTx(ctx context.Context, fn func(ctx context.Context, tx Tx) error) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op once committed
+
+	if err := setTenant(ctx, tx, tenantID); err != nil {
+		return err
+	}
+
+	if err := fn(ctx, &psqlTx{tx: tx, emails: r.emails}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	r.reads.recordWrite(ctx)
+	return nil
+}
+
+// PendingEvents returns the oldest undelivered events from the primary.
+func (r *PsqlRepository) PendingEvents(ctx context.Context, limit int) ([]OutboxRecord, error) {
+	rows, err := r.pool.Query(ctx, selectPendingOutboxQuery, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select pending events query: %w", err)
+	}
+	defer rows.Close()
+	return scanOutbox(rows, r.emails)
+}
+
+// MarkDelivered flags an outbox event as delivered.
+func (r *PsqlRepository) MarkDelivered(ctx context.Context, seq int64) error {
+	if _, err := r.pool.Exec(ctx, markOutboxDeliveredQuery, seq); err != nil {
+		return fmt.Errorf("failed to mark event as delivered: %w", err)
+	}
+	return nil
+}
+
+// psqlTx is the Tx handed to InTx callbacks by PsqlRepository.
+type psqlTx struct {
+	tx     pgx.Tx
+	emails emailCodec
+}
+
+func (t *psqlTx) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return psqlAddUser(ctx, t.tx, t.emails, user)
+}
+
+func (t *psqlTx) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	return psqlGetUsers(ctx, t.tx, t.emails, selectAllUsersQuery)
+}
+
+func (t *psqlTx) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return psqlGetUser(ctx, t.tx, t.emails, selectUserByIDQuery, id)
+}
+
+func (t *psqlTx) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	index, plaintext := t.emails.lookup(email)
+	return psqlGetUser(ctx, t.tx, t.emails, selectUserByEmailQuery, index, plaintext)
+}
+
+func (t *psqlTx) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return psqlUpdateUser(ctx, t.tx, t.emails, user)
+}
+
+func (t *psqlTx) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return psqlDeleteUser(ctx, t.tx, id)
+}
+
+func (t *psqlTx) AppendEvents(ctx context.Context, events ...domain.Event) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if event.TenantID == "" {
+			event.TenantID = tenantID
+		}
+		user, err := t.emails.sealUser(event.User)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("failed to encode event payload: %w", err)
+		}
+		if _, err := t.tx.Exec(ctx, insertOutboxQuery, event.ID, event.Type, event.TenantID, event.UserID, payload, event.OccurredAt); err != nil {
+			return fmt.Errorf("failed to execute insert event query: %w", err)
+		}
+	}
+	return nil
+}
+
+// InTx runs fn in a SQLite transaction.
+func (r *SqlliteRepository) InTx(ctx context.Context, fn func(ctx context.Context, tx Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	if err := fn(ctx, &sqliteTx{tx: tx, emails: r.emails}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// PendingEvents returns the oldest undelivered events.
+func (r *SqlliteRepository) PendingEvents(ctx context.Context, limit int) ([]OutboxRecord, error) {
+	rows, err := r.db.QueryContext(ctx, selectPendingOutboxQuery2, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending events: %w", err)
+	}
+	defer rows.Close()
+	return scanOutbox(rows, r.emails)
+}
+
+// MarkDelivered flags an outbox event as delivered.
+func (r *SqlliteRepository) MarkDelivered(ctx context.Context, seq int64) error {
+	if _, err := r.db.ExecContext(ctx, markOutboxDeliveredQuery2, seq); err != nil {
+		return fmt.Errorf("failed to mark event as delivered: %w", err)
+	}
+	return nil
+}
+
+// sqliteTx is the Tx handed to InTx callbacks by SqlliteRepository.
+type sqliteTx struct {
+	tx     *sql.Tx
+	emails emailCodec
+}
+
+func (t *sqliteTx) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return sqliteAddUser(ctx, t.tx, t.emails, user)
+}
+
+func (t *sqliteTx) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	return sqliteGetUsers(ctx, t.tx, t.emails, selectAllUsersQuery2)
+}
+
+func (t *sqliteTx) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return sqliteGetUser(ctx, t.tx, t.emails, selectUserByIDQuery2, id)
+}
+
+func (t *sqliteTx) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	index, plaintext := t.emails.lookup(email)
+	return sqliteGetUser(ctx, t.tx, t.emails, selectUserByEmailQuery2, index, plaintext)
+}
+
+func (t *sqliteTx) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return sqliteUpdateUser(ctx, t.tx, t.emails, user)
+}
+
+func (t *sqliteTx) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return sqliteDeleteUser(ctx, t.tx, id)
+}
+
+func (t *sqliteTx) AppendEvents(ctx context.Context, events ...domain.Event) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if event.TenantID == "" {
+			event.TenantID = tenantID
+		}
+		user, err := t.emails.sealUser(event.User)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(user)
+		if err != nil {
+			return fmt.Errorf("failed to encode event payload: %w", err)
+		}
+		if _, err := t.tx.ExecContext(ctx, insertOutboxQuery2, event.ID, event.Type, event.TenantID, event.UserID, payload, event.OccurredAt); err != nil {
+			return fmt.Errorf("failed to insert event: %w", err)
+		}
+	}
+	return nil
+}
+
+// outboxRows is the part of the API shared by pgx.Rows and *sql.Rows used by scanOutbox and scanAudit.
+type outboxRows interface {
+	Next() bool
+	Scan(dest ...any) error
+	Err() error
+}
+
+// scanOutbox reads events selected with their sequence number, decrypting the email of their user.
+func scanOutbox(rows outboxRows, emails emailCodec) ([]OutboxRecord, error) {
+	records := make([]OutboxRecord, 0)
+	for rows.Next() {
+		var (
+			record  OutboxRecord
+			payload []byte
+		)
+		e := &record.Event
+		if err := rows.Scan(&record.Seq, &e.ID, &e.Type, &e.TenantID, &e.UserID, &payload, &e.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event row: %w", err)
+		}
+		if err := json.Unmarshal(payload, &e.User); err != nil {
+			return nil, fmt.Errorf("failed to decode event payload: %w", err)
+		}
+		user, err := emails.openUser(e.User)
+		if err != nil {
+			return nil, err
+		}
+		e.User = user
+		e.OccurredAt = e.OccurredAt.UTC()
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return records, nil
+}
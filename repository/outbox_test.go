@@ -0,0 +1,107 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSQLiteOutbox(t *testing.T) *repository.SqlliteRepository {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	// Every connection to :memory: opens a new database.
+	db.SetMaxOpenConns(1)
+
+	repo := repository.NewSQLLiteRepository(db)
+	require.NoError(t, repo.Migrate(testContext(t)))
+	return repo
+}
+
+// testOutbox checks that a committed transaction stores the user and its event, and a rolled back one neither.
+func testOutbox(t *testing.T, repo interface {
+	repository.UserRepository
+	repository.Transactor
+	repository.OutboxStore
+}) {
+	t.Helper()
+	ctx := testContext(t)
+
+	var created *domain.User
+	err := repo.InTx(ctx, func(ctx context.Context, tx repository.Tx) error {
+		var err error
+		created, err = tx.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+		if err != nil {
+			return err
+		}
+		return tx.AppendEvents(ctx, domain.NewUserEvent(domain.UserCreated, *created))
+	})
+	require.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = repo.InTx(ctx, func(ctx context.Context, tx repository.Tx) error {
+		u, err := tx.AddUser(ctx, domain.User{Name: "Other User", Email: "other@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, tx.AppendEvents(ctx, domain.NewUserEvent(domain.UserCreated, *u)))
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	users, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	pending, err := repo.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, domain.UserCreated, pending[0].Event.Type)
+	assert.Equal(t, "test", pending[0].Event.TenantID)
+	assert.Equal(t, created.ID, pending[0].Event.UserID)
+	assert.Equal(t, *created, pending[0].Event.User)
+
+	require.NoError(t, repo.MarkDelivered(ctx, pending[0].Seq))
+	pending, err = repo.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestSqlLiteRepository_Outbox(t *testing.T) {
+	testOutbox(t, setupSQLiteOutbox(t))
+}
+
+func TestSqlLiteRepository_PendingEventsOrder(t *testing.T) {
+	ctx := testContext(t)
+	repo := setupSQLiteOutbox(t)
+	user := domain.User{Name: "Test User", Email: "test@example.com"}
+
+	types := []domain.EventType{domain.UserCreated, domain.UserUpdated, domain.UserDeleted}
+	for _, eventType := range types {
+		require.NoError(t, repo.InTx(ctx, func(ctx context.Context, tx repository.Tx) error {
+			return tx.AppendEvents(ctx, domain.NewUserEvent(eventType, user))
+		}))
+	}
+
+	pending, err := repo.PendingEvents(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, domain.UserCreated, pending[0].Event.Type)
+	assert.Equal(t, domain.UserUpdated, pending[1].Event.Type)
+	assert.Less(t, pending[0].Seq, pending[1].Seq)
+}
+
+func TestPsqlRepository_Outbox(t *testing.T) {
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	repo, repoCleanup := setupRepository(t, container)
+	defer repoCleanup()
+
+	testOutbox(t, &repo)
+}
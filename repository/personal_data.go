@@ -0,0 +1,498 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	selectUserEventsQuery = `
+    SELECT seq, id, type, tenant_id, user_id, payload, occurred_at
+      FROM outbox
+     WHERE tenant_id = $1 AND user_id = $2
+     ORDER BY seq
+    `
+
+	anonymizeUserEventsQuery = `UPDATE outbox SET payload = $3 WHERE tenant_id = $1 AND user_id = $2`
+
+	anonymizeDeliveriesQuery = `UPDATE webhook_deliveries SET payload = $2 WHERE event_id = $1`
+
+	selectUserEventsQuery2 = `
+    SELECT seq, id, type, tenant_id, user_id, payload, occurred_at
+      FROM outbox
+     WHERE tenant_id = ? AND user_id = ?
+     ORDER BY seq;
+`
+
+	anonymizeUserEventsQuery2 = `
+    UPDATE outbox
+       SET payload = ?
+     WHERE tenant_id = ? AND user_id = ?;
+`
+
+	anonymizeDeliveriesQuery2 = `
+    UPDATE webhook_deliveries
+       SET payload = ?
+     WHERE event_id = ?;
+`
+
+	selectUserRefreshTokensQuery = `
+    SELECT id, user_id, expires_at, created_at, revoked_at
+      FROM refresh_tokens
+     WHERE tenant_id = $1 AND user_id = $2
+     ORDER BY created_at, id
+    `
+
+	selectUserVerificationTokensQuery = `
+    SELECT id, user_id, expires_at, created_at, used_at
+      FROM verification_tokens
+     WHERE tenant_id = $1 AND user_id = $2
+     ORDER BY created_at, id
+    `
+
+	deleteUserRolesQuery              = `DELETE FROM user_roles WHERE tenant_id = $1 AND user_id = $2`
+	deleteUserAPIKeysQuery            = `DELETE FROM api_keys WHERE tenant_id = $1 AND user_id = $2`
+	deleteUserRefreshTokensQuery      = `DELETE FROM refresh_tokens WHERE tenant_id = $1 AND user_id = $2`
+	deleteUserVerificationTokensQuery = `DELETE FROM verification_tokens WHERE tenant_id = $1 AND user_id = $2`
+	deleteUserCredentialsQuery        = `DELETE FROM user_credentials WHERE tenant_id = $1 AND user_id = $2`
+
+	selectUserRefreshTokensQuery2 = `
+    SELECT id, user_id, expires_at, created_at, revoked_at
+      FROM refresh_tokens
+     WHERE tenant_id = ? AND user_id = ?
+     ORDER BY created_at, id;
+`
+
+	selectUserVerificationTokensQuery2 = `
+    SELECT id, user_id, expires_at, created_at, used_at
+      FROM verification_tokens
+     WHERE tenant_id = ? AND user_id = ?
+     ORDER BY created_at, id;
+`
+
+	deleteUserRolesQuery2              = `DELETE FROM user_roles WHERE tenant_id = ? AND user_id = ?;`
+	deleteUserAPIKeysQuery2            = `DELETE FROM api_keys WHERE tenant_id = ? AND user_id = ?;`
+	deleteUserRefreshTokensQuery2      = `DELETE FROM refresh_tokens WHERE tenant_id = ? AND user_id = ?;`
+	deleteUserVerificationTokensQuery2 = `DELETE FROM verification_tokens WHERE tenant_id = ? AND user_id = ?;`
+	deleteUserCredentialsQuery2        = `DELETE FROM user_credentials WHERE tenant_id = ? AND user_id = ?;`
+
+	// The change log keeps the operations, so that watchers still see the deletion, but not the data.
+	anonymizeUserChangesQuery2 = `
+    UPDATE user_changes
+       SET name = '', email = ''
+     WHERE id = ?;
+`
+)
+
+// PersonalDataStore is implemented by repositories keeping records about users besides the users themselves,
+// so that data subject requests cover them too.
+type PersonalDataStore interface {
+	// UserEvents returns the outbox events of the user in the tenant of ctx, oldest first.
+	UserEvents(ctx context.Context, userID uuid.UUID) ([]domain.Event, error)
+	// UserRecords returns the roles, API keys and tokens of the user in the tenant of ctx.
+	UserRecords(ctx context.Context, userID uuid.UUID) (UserRecords, error)
+	// ErasePersonalData deletes the user from the tenant of ctx along with its roles, API keys, tokens and
+	// credentials, reduces the user carried by its events and their webhook deliveries to its ID and removes
+	// the values from its audit entries, then records a UserErased event and the audit entries given, all in
+	// one transaction. It returns ErrUserNotFound when nothing is held about the user.
+	ErasePersonalData(ctx context.Context, userID uuid.UUID, audit ...domain.AuditEntry) (ErasureCounts, error)
+}
+
+// Forgetter is implemented by repositories holding copies of users, such as caches, which must drop them
+// when the user is erased from the repository behind them.
+type Forgetter interface {
+	// Forget drops every copy of the user of the tenant of ctx.
+	Forget(ctx context.Context, id uuid.UUID)
+}
+
+// UserRecords are the roles, API keys and tokens of a user. Keys and tokens come without their hashes.
+type UserRecords struct {
+	Roles              []domain.Role              `json:"roles"`
+	APIKeys            []domain.APIKey            `json:"api_keys"`
+	RefreshTokens      []domain.RefreshToken      `json:"refresh_tokens"`
+	VerificationTokens []domain.VerificationToken `json:"verification_tokens"`
+}
+
+// ErasureCounts reports how many records ErasePersonalData deleted or anonymized.
+type ErasureCounts struct {
+	Users              int `json:"users"`
+	Roles              int `json:"roles"`
+	APIKeys            int `json:"api_keys"`
+	RefreshTokens      int `json:"refresh_tokens"`
+	VerificationTokens int `json:"verification_tokens"`
+	Credentials        int `json:"credentials"`
+	Events             int `json:"events"`
+	WebhookDeliveries  int `json:"webhook_deliveries"`
+	AuditEntries       int `json:"audit_entries"`
+}
+
+// deleted returns the number of deleted records: the user and the records kept with it.
+func (c ErasureCounts) deleted() int {
+	return c.Users + c.Roles + c.APIKeys + c.RefreshTokens + c.VerificationTokens + c.Credentials
+}
+
+// recordDelete is a query deleting records of a user, along with the count of the records it deletes.
+type recordDelete struct {
+	query string
+	n     *int
+}
+
+// UserEvents returns the outbox events of the user, read from the primary.
+func (r *PsqlRepository) UserEvents(ctx context.Context, userID uuid.UUID) ([]domain.Event, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, selectUserEventsQuery, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select user events query: %w", err)
+	}
+	defer rows.Close()
+	return eventsOf(scanOutbox(rows, r.emails))
+}
+
+// UserRecords returns the roles, API keys and tokens of the user, read from the primary.
+func (r *PsqlRepository) UserRecords(ctx context.Context, userID uuid.UUID) (UserRecords, error) {
+	var (
+		records UserRecords
+		err     error
+	)
+	if records.Roles, err = r.GetRoles(ctx, userID); err != nil {
+		return UserRecords{}, err
+	}
+	if records.APIKeys, err = r.selectAPIKeys(ctx, selectAPIKeysQuery+" AND user_id = $2 ORDER BY created_at, id", userID); err != nil {
+		return UserRecords{}, err
+	}
+	for i := range records.APIKeys {
+		records.APIKeys[i].KeyHash = ""
+	}
+	_, err = inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		rows, err := tx.Query(ctx, selectUserRefreshTokensQuery, tenantID, userID)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute select user refresh tokens query: %w", err)
+		}
+		records.RefreshTokens, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.RefreshToken, error) {
+			var t domain.RefreshToken
+			return t, row.Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.CreatedAt, &t.RevokedAt)
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		rows, err = tx.Query(ctx, selectUserVerificationTokensQuery, tenantID, userID)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute select user verification tokens query: %w", err)
+		}
+		records.VerificationTokens, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (domain.VerificationToken, error) {
+			var t domain.VerificationToken
+			return t, row.Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.CreatedAt, &t.UsedAt)
+		})
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to scan verification token: %w", err)
+		}
+		return struct{}{}, nil
+	})
+	if err != nil {
+		return UserRecords{}, err
+	}
+	return records, nil
+}
+
+// ErasePersonalData erases the user with its roles, API keys, tokens and credentials and anonymizes its events,
+// webhook deliveries and audit entries.
+func (r *PsqlRepository) ErasePersonalData(ctx context.Context, userID uuid.UUID, audit ...domain.AuditEntry) (ErasureCounts, error) {
+	counts, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (ErasureCounts, error) {
+		var counts ErasureCounts
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return counts, err
+		}
+		// The records are deleted before the user, which they would otherwise be deleted with uncounted.
+		deletes := []recordDelete{
+			{deleteUserRolesQuery, &counts.Roles},
+			{deleteUserAPIKeysQuery, &counts.APIKeys},
+			{deleteUserRefreshTokensQuery, &counts.RefreshTokens},
+			{deleteUserVerificationTokensQuery, &counts.VerificationTokens},
+			{deleteUserCredentialsQuery, &counts.Credentials},
+		}
+		for _, d := range deletes {
+			tag, err := tx.Exec(ctx, d.query, tenantID, userID)
+			if err != nil {
+				return counts, fmt.Errorf("failed to execute delete user records query: %w", err)
+			}
+			*d.n = int(tag.RowsAffected())
+		}
+		if err := psqlDeleteUser(ctx, tx, userID); err == nil {
+			counts.Users = 1
+		} else if !errors.Is(err, ErrUserNotFound) {
+			return counts, err
+		}
+
+		rows, err := tx.Query(ctx, selectUserEventsQuery, tenantID, userID)
+		if err != nil {
+			return counts, fmt.Errorf("failed to execute select user events query: %w", err)
+		}
+		events, err := eventsOf(scanOutbox(rows, r.emails))
+		rows.Close()
+		if err != nil {
+			return counts, err
+		}
+		if counts.AuditEntries, err = psqlRedactAudit(ctx, tx, tenantID, userID); err != nil {
+			return counts, err
+		}
+		if counts.deleted() == 0 && len(events) == 0 && counts.AuditEntries == 0 {
+			return counts, ErrUserNotFound
+		}
+
+		payload, err := json.Marshal(domain.User{ID: userID})
+		if err != nil {
+			return counts, fmt.Errorf("failed to encode event payload: %w", err)
+		}
+		tag, err := tx.Exec(ctx, anonymizeUserEventsQuery, tenantID, userID, payload)
+		if err != nil {
+			return counts, fmt.Errorf("failed to execute anonymize user events query: %w", err)
+		}
+		counts.Events = int(tag.RowsAffected())
+		for _, event := range events {
+			payload, err := json.Marshal(event.Anonymized())
+			if err != nil {
+				return counts, fmt.Errorf("failed to encode event: %w", err)
+			}
+			tag, err := tx.Exec(ctx, anonymizeDeliveriesQuery, event.ID, payload)
+			if err != nil {
+				return counts, fmt.Errorf("failed to execute anonymize deliveries query: %w", err)
+			}
+			counts.WebhookDeliveries += int(tag.RowsAffected())
+		}
+
+		erased := domain.NewUserEvent(domain.UserErased, domain.User{ID: userID})
+		if err := (&psqlTx{tx: tx, emails: r.emails}).AppendEvents(ctx, erased); err != nil {
+			return counts, err
+		}
+		return counts, psqlAppendAudit(ctx, tx, r.emails, audit)
+	})
+	if err != nil {
+		return counts, err
+	}
+	r.reads.recordWrite(ctx)
+	return counts, nil
+}
+
+// UserEvents returns the outbox events of the user.
+func (r *SqlliteRepository) UserEvents(ctx context.Context, userID uuid.UUID) ([]domain.Event, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, selectUserEventsQuery2, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user events: %w", err)
+	}
+	defer rows.Close()
+	return eventsOf(scanOutbox(rows, r.emails))
+}
+
+// UserRecords returns the roles, API keys and tokens of the user.
+func (r *SqlliteRepository) UserRecords(ctx context.Context, userID uuid.UUID) (UserRecords, error) {
+	var (
+		records UserRecords
+		err     error
+	)
+	if records.Roles, err = r.GetRoles(ctx, userID); err != nil {
+		return UserRecords{}, err
+	}
+	if records.APIKeys, err = r.selectAPIKeys(ctx, selectAPIKeysQuery2+" AND user_id = ? ORDER BY created_at, id", userID); err != nil {
+		return UserRecords{}, err
+	}
+	for i := range records.APIKeys {
+		records.APIKeys[i].KeyHash = ""
+	}
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return UserRecords{}, err
+	}
+	if records.RefreshTokens, err = r.userRefreshTokens(ctx, tenantID, userID); err != nil {
+		return UserRecords{}, err
+	}
+	if records.VerificationTokens, err = r.userVerificationTokens(ctx, tenantID, userID); err != nil {
+		return UserRecords{}, err
+	}
+	return records, nil
+}
+
+func (r *SqlliteRepository) userRefreshTokens(ctx context.Context, tenantID string, userID uuid.UUID) ([]domain.RefreshToken, error) {
+	rows, err := r.db.QueryContext(ctx, selectUserRefreshTokensQuery2, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user refresh tokens: %w", err)
+	}
+	defer rows.Close()
+	tokens := []domain.RefreshToken{}
+	for rows.Next() {
+		var (
+			t         domain.RefreshToken
+			revokedAt sql.NullTime
+		)
+		if err := rows.Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan refresh token: %w", err)
+		}
+		t.RevokedAt = nullTimePtr(revokedAt)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *SqlliteRepository) userVerificationTokens(ctx context.Context, tenantID string, userID uuid.UUID) ([]domain.VerificationToken, error) {
+	rows, err := r.db.QueryContext(ctx, selectUserVerificationTokensQuery2, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user verification tokens: %w", err)
+	}
+	defer rows.Close()
+	tokens := []domain.VerificationToken{}
+	for rows.Next() {
+		var (
+			t      domain.VerificationToken
+			usedAt sql.NullTime
+		)
+		if err := rows.Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.CreatedAt, &usedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan verification token: %w", err)
+		}
+		t.UsedAt = nullTimePtr(usedAt)
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return tokens, nil
+}
+
+// ErasePersonalData erases the user with its roles, API keys, tokens and credentials and anonymizes its events,
+// webhook deliveries, audit entries and change log entries.
+func (r *SqlliteRepository) ErasePersonalData(ctx context.Context, userID uuid.UUID, audit ...domain.AuditEntry) (ErasureCounts, error) {
+	var counts ErasureCounts
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return counts, err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return counts, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	// The records are deleted before the user, which they would otherwise be deleted with uncounted.
+	deletes := []recordDelete{
+		{deleteUserRolesQuery2, &counts.Roles},
+		{deleteUserAPIKeysQuery2, &counts.APIKeys},
+		{deleteUserRefreshTokensQuery2, &counts.RefreshTokens},
+		{deleteUserVerificationTokensQuery2, &counts.VerificationTokens},
+		{deleteUserCredentialsQuery2, &counts.Credentials},
+	}
+	for _, d := range deletes {
+		res, err := tx.ExecContext(ctx, d.query, tenantID, userID)
+		if err != nil {
+			return counts, fmt.Errorf("failed to delete user records: %w", err)
+		}
+		if *d.n, err = rowsAffected(res); err != nil {
+			return counts, err
+		}
+	}
+	if err := sqliteDeleteUser(ctx, tx, userID); err == nil {
+		counts.Users = 1
+	} else if !errors.Is(err, ErrUserNotFound) {
+		return counts, err
+	}
+	events, err := sqliteUserEvents(ctx, tx, r.emails, tenantID, userID)
+	if err != nil {
+		return counts, err
+	}
+	if counts.AuditEntries, err = sqliteRedactAudit(ctx, tx, tenantID, userID); err != nil {
+		return counts, err
+	}
+	if counts.deleted() == 0 && len(events) == 0 && counts.AuditEntries == 0 {
+		return counts, ErrUserNotFound
+	}
+
+	payload, err := json.Marshal(domain.User{ID: userID})
+	if err != nil {
+		return counts, fmt.Errorf("failed to encode event payload: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, anonymizeUserEventsQuery2, payload, tenantID, userID)
+	if err != nil {
+		return counts, fmt.Errorf("failed to anonymize user events: %w", err)
+	}
+	if counts.Events, err = rowsAffected(res); err != nil {
+		return counts, err
+	}
+	for _, event := range events {
+		payload, err := json.Marshal(event.Anonymized())
+		if err != nil {
+			return counts, fmt.Errorf("failed to encode event: %w", err)
+		}
+		res, err := tx.ExecContext(ctx, anonymizeDeliveriesQuery2, string(payload), event.ID)
+		if err != nil {
+			return counts, fmt.Errorf("failed to anonymize webhook deliveries: %w", err)
+		}
+		n, err := rowsAffected(res)
+		if err != nil {
+			return counts, err
+		}
+		counts.WebhookDeliveries += n
+	}
+	if _, err := tx.ExecContext(ctx, anonymizeUserChangesQuery2, userID); err != nil {
+		return counts, fmt.Errorf("failed to anonymize user changes: %w", err)
+	}
+
+	erased := domain.NewUserEvent(domain.UserErased, domain.User{ID: userID})
+	if err := (&sqliteTx{tx: tx, emails: r.emails}).AppendEvents(ctx, erased); err != nil {
+		return counts, err
+	}
+	if err := sqliteAppendAudit(ctx, tx, r.emails, audit); err != nil {
+		return counts, err
+	}
+	if err := tx.Commit(); err != nil {
+		return counts, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return counts, nil
+}
+
+func sqliteUserEvents(ctx context.Context, tx *sql.Tx, emails emailCodec, tenantID string, userID uuid.UUID) ([]domain.Event, error) {
+	rows, err := tx.QueryContext(ctx, selectUserEventsQuery2, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user events: %w", err)
+	}
+	defer rows.Close()
+	return eventsOf(scanOutbox(rows, emails))
+}
+
+func eventsOf(records []OutboxRecord, err error) ([]domain.Event, error) {
+	if err != nil {
+		return nil, err
+	}
+	events := make([]domain.Event, len(records))
+	for i, record := range records {
+		events[i] = record.Event
+	}
+	return events, nil
+}
+
+func rowsAffected(res sql.Result) (int, error) {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return int(n), nil
+}
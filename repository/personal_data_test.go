@@ -0,0 +1,113 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqlLiteRepository_ErasePersonalData(t *testing.T) {
+	ctx := testContext(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	repo := repository.NewSQLLiteRepository(db)
+	require.NoError(t, repo.Migrate(ctx))
+
+	alice := domain.User{ID: uuid.New(), Name: "Alice", Email: "alice@example.com"}
+	created := domain.NewUserEvent(domain.UserCreated, alice)
+	err = repo.InTx(ctx, func(ctx context.Context, tx repository.Tx) error {
+		if _, err := tx.AddUser(ctx, alice); err != nil {
+			return err
+		}
+		return tx.AppendEvents(ctx, created)
+	})
+	require.NoError(t, err)
+	bob, err := repo.AddUser(ctx, domain.User{Name: "Bob", Email: "bob@example.com"})
+	require.NoError(t, err)
+
+	sub, err := repo.AddSubscription(ctx, domain.WebhookSubscription{URL: "https://example.com/hook", Secret: "s", CreatedAt: time.Now()})
+	require.NoError(t, err)
+	payload, err := json.Marshal(created)
+	require.NoError(t, err)
+	delivery := domain.WebhookDelivery{
+		ID: uuid.New(), TenantID: sub.TenantID, SubscriptionID: sub.ID, EventID: created.ID, EventType: created.Type, Payload: payload,
+		Status: domain.DeliveryPending, NextAttemptAt: time.Now(), CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+	require.NoError(t, repo.EnqueueDelivery(ctx, delivery))
+
+	events, err := repo.UserEvents(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, alice, events[0].User)
+
+	counts, err := repo.ErasePersonalData(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, repository.ErasureCounts{Users: 1, Events: 1, WebhookDeliveries: 1}, counts)
+
+	_, err = repo.GetUserByID(ctx, alice.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	events, err = repo.UserEvents(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, domain.User{ID: alice.ID}, events[0].User)
+	assert.Equal(t, domain.UserErased, events[1].Type)
+
+	got, err := repo.GetDelivery(ctx, delivery.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, string(got.Payload), "alice")
+	assert.Contains(t, string(got.Payload), created.ID.String())
+
+	var leaks int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM user_changes WHERE email = ? OR name = ?`, alice.Email, alice.Name).Scan(&leaks))
+	assert.Zero(t, leaks)
+
+	// Other users are left alone.
+	_, err = repo.GetUserByID(ctx, bob.ID)
+	require.NoError(t, err)
+
+	// Erasing again still finds the events, unknown users have nothing to erase.
+	counts, err = repo.ErasePersonalData(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, counts.Users)
+	_, err = repo.ErasePersonalData(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestSqlLiteRepository_ErasePersonalDataAudit(t *testing.T) {
+	ctx := testContext(t)
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	repo := repository.NewSQLLiteRepository(db)
+	require.NoError(t, repo.Migrate(ctx))
+
+	alice, err := repo.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	created := domain.NewAuditEntry(domain.AuditCreate, domain.Actor{Kind: domain.ActorService, ID: "signup"}, alice.ID, nil, alice)
+	require.NoError(t, repo.AppendAudit(ctx, created))
+
+	// An audit entry that cannot be recorded rolls the erasure back.
+	_, err = repo.ErasePersonalData(ctx, alice.ID, created)
+	require.Error(t, err)
+	_, err = repo.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+
+	erased := domain.NewAuditEntry(domain.AuditErase, domain.Actor{Kind: domain.ActorService, ID: "privacy"}, alice.ID, nil, nil)
+	_, err = repo.ErasePersonalData(ctx, alice.ID, erased)
+	require.NoError(t, err)
+	page, err := repo.AuditHistory(ctx, alice.ID, repository.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, domain.AuditErase, page.Entries[1].Action)
+}
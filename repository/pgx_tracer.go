@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PgxTracer implements pgx.QueryTracer and creates a span for every query run on a connection.
+// Install it with pgxpool.Config.ConnConfig.Tracer.
+type PgxTracer struct {
+	tracer trace.Tracer
+}
+
+var _ pgx.QueryTracer = (*PgxTracer)(nil)
+
+// NewPgxTracer creates a PgxTracer using the given provider, or the global one if provider is nil.
+func NewPgxTracer(provider trace.TracerProvider) *PgxTracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &PgxTracer{tracer: provider.Tracer(tracerName)}
+}
+
+// TraceQueryStart starts a span carrying the sanitized statement.
+func (t *PgxTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := statementOperation(data.SQL)
+	ctx, _ = t.tracer.Start(ctx, "pgx."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrDBSystem.String("postgresql"),
+			attrDBOperation.String(operation),
+			attrDBStatement.String(SanitizeStatement(data.SQL)),
+		),
+	)
+	return ctx
+}
+
+// TraceQueryEnd ends the span started by TraceQueryStart.
+func (t *PgxTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	defer span.End()
+
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+		return
+	}
+	span.SetAttributes(attrDBRows.Int64(data.CommandTag.RowsAffected()))
+}
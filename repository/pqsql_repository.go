@@ -2,60 +2,392 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 const (
 	insertUserQuery = `
-    INSERT INTO users (id, name, email)
-    VALUES ($1, $2, $3)
+    INSERT INTO users (id, tenant_id, name, email, email_index, email_key_id, status)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+
+	// The upsert only overwrites a user of the same tenant; an ID taken by another tenant affects no row.
+	upsertUserQuery = `
+    INSERT INTO users (id, tenant_id, name, email, email_index, email_key_id, status)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
     ON CONFLICT (id) DO UPDATE
-      SET name       = EXCLUDED.name,
-          email      = EXCLUDED.email;
+      SET name         = EXCLUDED.name,
+          email        = EXCLUDED.email,
+          email_index  = EXCLUDED.email_index,
+          email_key_id = EXCLUDED.email_key_id,
+          status       = EXCLUDED.status
+      WHERE users.tenant_id = EXCLUDED.tenant_id;
     `
 
-	selectAllUsersQuery = `SELECT id, name, email FROM users`
+	selectAllUsersQuery = `SELECT id, name, email, status FROM users WHERE tenant_id = $1`
+
+	selectUsersPageQuery = `SELECT id, name, email, status FROM users WHERE tenant_id = $1 AND id > $2 ORDER BY id LIMIT $3`
+
+	selectUserByIDQuery = `SELECT id, name, email, status FROM users WHERE tenant_id = $1 AND id = $2`
+
+	// Users without a blind index have a plaintext email, stored before encryption was enabled.
+	selectUserByEmailQuery = `
+    SELECT id, name, email, status FROM users
+     WHERE tenant_id = $1 AND (email_index = $2 OR (email_index IS NULL AND email = $3))`
+
+	// Plaintext emails, stored before encryption was enabled, are not covered by the unique blind index.
+	selectPlaintextEmailTakenQuery = `
+    SELECT EXISTS (SELECT 1 FROM users WHERE tenant_id = $1 AND email_index IS NULL AND email = $2 AND id <> $3)`
+
+	// An empty status keeps the current one.
+	updateUserQuery = `
+    UPDATE users SET name = $3, email = $4, email_index = $5, email_key_id = $6, status = COALESCE(NULLIF($7, ''), status)
+     WHERE tenant_id = $1 AND id = $2
+    RETURNING status`
+
+	selectStaleEmailsQuery = `
+    SELECT id, email FROM users
+     WHERE tenant_id = $1 AND email_key_id IS DISTINCT FROM $2
+     LIMIT $3
+       FOR UPDATE`
+
+	updateEmailQuery = `UPDATE users SET email = $3, email_index = $4, email_key_id = $5 WHERE tenant_id = $1 AND id = $2`
+
+	selectStaleEmailTenantsQuery = `SELECT DISTINCT tenant_id FROM users WHERE email_key_id IS DISTINCT FROM $1 ORDER BY tenant_id`
+
+	deleteUserQuery = `DELETE FROM users WHERE tenant_id = $1 AND id = $2`
+
+	// setTenantQuery scopes the row-level security policies on users to a tenant until the end of the transaction.
+	setTenantQuery = `SELECT set_config('app.tenant_id', $1, true)`
+
+	// setTenantListingQuery lets the transaction read the users of every tenant, through the users_tenant_listing
+	// policy, until its end. It is only set by read-only transactions listing tenants.
+	setTenantListingQuery = `SELECT set_config('app.list_tenants', 'on', true)`
+
+	// insufficientPrivilege is the SQLSTATE raised when a write is rejected by a row-level security policy.
+	insufficientPrivilege = "42501"
+	// uniqueViolation is the SQLSTATE raised when a write conflicts with a unique index.
+	uniqueViolation = "23505"
+	// usersPrimaryKey is the constraint keeping user IDs unique.
+	usersPrimaryKey = "users_pkey"
 )
 
 // PsqlRepository provides methods for interacting with the users table in a PostgreSQL database.
+// Writes always go to the primary pool; reads may be routed to read replicas (see WithReplicas).
+// Every call runs in a transaction scoped to the tenant of its context, so that the row-level security
+// policies created by Migrate hide the rows of other tenants even from a query missing its tenant filter.
 type PsqlRepository struct {
-	pool *pgxpool.Pool
+	pool   *pgxpool.Pool
+	reads  *readRouter
+	emails emailCodec
 }
 
-// NewPsqlRepository creates a new instance of PsqlRepository with the given pgxpool.Pool.
-func NewPsqlRepository(pool *pgxpool.Pool) *PsqlRepository {
-	return &PsqlRepository{pool: pool}
+// NewPsqlRepository creates a new instance of PsqlRepository with the given primary pgxpool.Pool.
+func NewPsqlRepository(pool *pgxpool.Pool, opts ...PsqlOption) *PsqlRepository {
+	r := &PsqlRepository{
+		pool: pool,
+		reads: &readRouter{
+			cooldown:  defaultReplicaCooldown,
+			rywWindow: defaultReadYourWritesWindow,
+		},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // AddUser inserts a new user into the database and returns the created user.
+// A new ID is generated unless the user already has one; an ID already taken is reported as ErrUserAlreadyExists.
 func (r *PsqlRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
-	user.ID = uuid.New()
+	u, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (*domain.User, error) {
+		return psqlAddUser(ctx, tx, r.emails, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.reads.recordWrite(ctx)
+	return u, nil
+}
 
-	_, err := r.pool.Exec(ctx, insertUserQuery, user.ID, user.Name, user.Email)
+// UpsertUser stores a user under its ID, replacing the user of the tenant with that ID.
+// An ID held by another tenant is reported as ErrUserNotFound.
+func (r *PsqlRepository) UpsertUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	u, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (*domain.User, error) {
+		return psqlWriteUser(ctx, tx, r.emails, upsertUserQuery, user)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute insert user query: %w", err)
+		return nil, err
 	}
-	return &user, nil
+	r.reads.recordWrite(ctx)
+	return u, nil
 }
 
 // GetAllUsers retrieves all users from the database.
 func (r *PsqlRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	return readFrom(ctx, r, func(pool *pgxpool.Pool) ([]domain.User, error) {
+		return inTenantTx(ctx, pool, func(tx pgx.Tx) ([]domain.User, error) {
+			return psqlGetUsers(ctx, tx, r.emails, selectAllUsersQuery)
+		})
+	})
+}
+
+// ListUsers retrieves up to limit users with an ID greater than after, ordered by ID.
+func (r *PsqlRepository) ListUsers(ctx context.Context, after uuid.UUID, limit int) ([]domain.User, error) {
+	return readFrom(ctx, r, func(pool *pgxpool.Pool) ([]domain.User, error) {
+		return inTenantTx(ctx, pool, func(tx pgx.Tx) ([]domain.User, error) {
+			return psqlGetUsers(ctx, tx, r.emails, selectUsersPageQuery, after, limit)
+		})
+	})
+}
+
+// GetUserByID retrieves the user with the given ID from the database.
+func (r *PsqlRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return readFrom(ctx, r, func(pool *pgxpool.Pool) (*domain.User, error) {
+		return inTenantTx(ctx, pool, func(tx pgx.Tx) (*domain.User, error) {
+			return psqlGetUser(ctx, tx, r.emails, selectUserByIDQuery, id)
+		})
+	})
+}
+
+// GetUserByEmail retrieves the user with the given email from the database.
+func (r *PsqlRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return readFrom(ctx, r, func(pool *pgxpool.Pool) (*domain.User, error) {
+		return inTenantTx(ctx, pool, func(tx pgx.Tx) (*domain.User, error) {
+			index, plaintext := r.emails.lookup(email)
+			return psqlGetUser(ctx, tx, r.emails, selectUserByEmailQuery, index, plaintext)
+		})
+	})
+}
+
+// UpdateUser updates the name and email of an existing user.
+func (r *PsqlRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	u, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (*domain.User, error) {
+		return psqlUpdateUser(ctx, tx, r.emails, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.reads.recordWrite(ctx)
+	return u, nil
+}
+
+// DeleteUser deletes the user with the given ID from the database.
+func (r *PsqlRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		return struct{}{}, psqlDeleteUser(ctx, tx, id)
+	})
+	if err != nil {
+		return err
+	}
+	r.reads.recordWrite(ctx)
+	return nil
+}
+
+// inTenantTx runs fn in a transaction on pool with app.tenant_id set to the tenant of ctx.
+func inTenantTx[T any](ctx context.Context, pool *pgxpool.Pool, fn func(pgx.Tx) (T, error)) (T, error) {
+	var zero T
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return zero, err
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return zero, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck // no-op once committed
+
+	if err := setTenant(ctx, tx, tenantID); err != nil {
+		return zero, err
+	}
+	v, err := fn(tx)
+	if err != nil {
+		return zero, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return zero, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return v, nil
+}
+
+func setTenant(ctx context.Context, tx pgx.Tx, tenantID string) error {
+	if _, err := tx.Exec(ctx, setTenantQuery, tenantID); err != nil {
+		return fmt.Errorf("failed to set transaction tenant: %w", err)
+	}
+	return nil
+}
+
+// psqlQuerier is the part of the API shared by *pgxpool.Pool and pgx.Tx.
+type psqlQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func psqlAddUser(ctx context.Context, q psqlQuerier, emails emailCodec, user domain.User) (*domain.User, error) {
+	return psqlWriteUser(ctx, q, emails, insertUserQuery, user)
+}
+
+// psqlWriteUser stores user with query, the insert or the upsert of a user.
+func psqlWriteUser(ctx context.Context, q psqlQuerier, emails emailCodec, query string, user domain.User) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	if user.Status == "" {
+		user.Status = domain.StatusActive
+	}
+	email, err := emails.encode(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := psqlCheckPlaintextEmail(ctx, q, tenantID, user, email); err != nil {
+		return nil, err
+	}
+	tag, err := q.Exec(ctx, query, user.ID, tenantID, user.Name, email.value, email.index, email.keyID,
+		string(user.Status))
+	if err := psqlConstraintError(err); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute insert user query: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrUserNotFound
+	}
+	return &user, nil
+}
+
+// psqlConstraintError returns the error matching the constraint or policy a user write violated, or nil when err
+// is no such violation.
+func psqlConstraintError(err error) error {
+	pgErr := (*pgconn.PgError)(nil)
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+	switch {
+	// With row-level security, an upsert of an ID taken by another tenant fails the policy instead of affecting no row.
+	case pgErr.Code == insufficientPrivilege:
+		return ErrUserNotFound
+	case pgErr.Code == uniqueViolation && pgErr.ConstraintName == usersPrimaryKey:
+		return ErrUserAlreadyExists
+	case pgErr.Code == uniqueViolation:
+		return ErrEmailAlreadyExists
+	}
+	return nil
+}
+
+// psqlCheckPlaintextEmail returns ErrEmailAlreadyExists when another user of the tenant holds the email of user
+// in plaintext, which the unique blind index does not cover. Once encryption is enabled, plaintext emails are only
+// re-encrypted, never written, so one re-encrypted after the check is caught by the index instead.
+func psqlCheckPlaintextEmail(ctx context.Context, q psqlQuerier, tenantID string, user domain.User, email storedEmail) error {
+	if email.index == nil {
+		return nil
+	}
+	var taken bool
+	if err := q.QueryRow(ctx, selectPlaintextEmailTakenQuery, tenantID, user.Email, user.ID).Scan(&taken); err != nil {
+		return fmt.Errorf("failed to execute select plaintext email query: %w", err)
+	}
+	if taken {
+		return ErrEmailAlreadyExists
+	}
+	return nil
+}
+
+func psqlGetUsers(ctx context.Context, q psqlQuerier, emails emailCodec, query string, args ...any) ([]domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
 	users := make([]domain.User, 0)
-	rows, err := r.pool.Query(ctx, selectAllUsersQuery)
+	rows, err := q.Query(ctx, query, append([]any{tenantID}, args...)...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute select all users query: %w", err)
+		return nil, fmt.Errorf("failed to execute select users query: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var user domain.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Status); err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
+		if user.Email, err = emails.decode(user.Email); err != nil {
+			return nil, err
+		}
 		users = append(users, user)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
 	return users, nil
 }
+
+func psqlGetUser(ctx context.Context, q psqlQuerier, emails emailCodec, query string, args ...any) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var user domain.User
+	err = q.QueryRow(ctx, query, append([]any{tenantID}, args...)...).Scan(&user.ID, &user.Name, &user.Email, &user.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select user query: %w", err)
+	}
+	if user.Email, err = emails.decode(user.Email); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func psqlUpdateUser(ctx context.Context, q psqlQuerier, emails emailCodec, user domain.User) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	email, err := emails.encode(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := psqlCheckPlaintextEmail(ctx, q, tenantID, user, email); err != nil {
+		return nil, err
+	}
+	err = q.QueryRow(ctx, updateUserQuery, tenantID, user.ID, user.Name, email.value, email.index, email.keyID,
+		string(user.Status)).Scan(&user.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err := psqlConstraintError(err); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute update user query: %w", err)
+	}
+	return &user, nil
+}
+
+func psqlDeleteUser(ctx context.Context, q psqlQuerier, id uuid.UUID) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := q.Exec(ctx, deleteUserQuery, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete user query: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -20,7 +20,7 @@ import (
 
 func setupPostgresContainer(t *testing.T) (container *postgres.PostgresContainer, cleanup func()) {
 	t.Helper()
-	ctx := t.Context()
+	ctx := testContext(t)
 
 	// Get the absolute path to init.sql
 	workDir, err := os.Getwd()
@@ -55,7 +55,7 @@ func setupPostgresContainer(t *testing.T) (container *postgres.PostgresContainer
 
 func setupRepository(t *testing.T, container *postgres.PostgresContainer) (repo repository.PsqlRepository, cleanup func()) {
 	t.Helper()
-	ctx := t.Context()
+	ctx := testContext(t)
 
 	// Get connection details
 	connString, err := container.ConnectionString(ctx)
@@ -77,7 +77,7 @@ func setupRepository(t *testing.T, container *postgres.PostgresContainer) (repo
 
 func TestPsqlRepository_AddUser(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	container, containerCleanup := setupPostgresContainer(t)
 	defer containerCleanup()
 
@@ -117,7 +117,7 @@ func TestPsqlRepository_AddUser(t *testing.T) {
 
 func TestPsqlRepository_GetAllUsers(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	container, containerCleanup := setupPostgresContainer(t)
 	defer containerCleanup()
 
@@ -158,7 +158,7 @@ func TestPsqlRepository_GetAllUsers(t *testing.T) {
 
 func TestPsqlRepository_GetAllUsers_Error(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	container, containerCleanup := setupPostgresContainer(t)
 	defer containerCleanup()
 
@@ -177,7 +177,7 @@ func TestPsqlRepository_GetAllUsers_Error(t *testing.T) {
 
 func TestPsqlRepository_AddUser_Error(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	container, containerCleanup := setupPostgresContainer(t)
 	defer containerCleanup()
 
@@ -202,7 +202,7 @@ func TestPsqlRepository_AddUser_Error(t *testing.T) {
 
 func TestPsqlRepository_Integration(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	container, containerCleanup := setupPostgresContainer(t)
 	defer containerCleanup()
 
@@ -243,3 +243,112 @@ func TestPsqlRepository_Integration(t *testing.T) {
 	}
 	assert.True(t, found, "Added user should be found in the database")
 }
+
+func TestPsqlRepository_CheckHealth(t *testing.T) {
+	// Setup
+	ctx := testContext(t)
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	repo, repoCleanup := setupRepository(t, container)
+
+	// Execute
+	details, err := repo.CheckHealth(ctx)
+
+	// Verify
+	require.NoError(t, err)
+	assert.Contains(t, details, "total_conns")
+
+	// A closed pool is reported as unhealthy
+	repoCleanup()
+	_, err = repo.CheckHealth(ctx)
+	assert.Error(t, err)
+}
+
+func TestPsqlRepository_GetUpdateDeleteUser(t *testing.T) {
+	// Setup
+	ctx := testContext(t)
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	repo, repoCleanup := setupRepository(t, container)
+	defer repoCleanup()
+
+	added, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	// Get by ID and email
+	byID, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, *added, *byID)
+
+	byEmail, err := repo.GetUserByEmail(ctx, added.Email)
+	require.NoError(t, err)
+	assert.Equal(t, *added, *byEmail)
+
+	_, err = repo.GetUserByID(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// Update
+	added.Name = "Updated User"
+	_, err = repo.UpdateUser(ctx, *added)
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated User", found.Name)
+
+	_, err = repo.UpdateUser(ctx, domain.User{ID: uuid.New(), Name: "Nobody", Email: "nobody@example.com"})
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// Delete
+	require.NoError(t, repo.DeleteUser(ctx, added.ID))
+	require.ErrorIs(t, repo.DeleteUser(ctx, added.ID), repository.ErrUserNotFound)
+}
+
+func TestPsqlRepository_ReadYourWrites(t *testing.T) {
+	// Setup
+	ctx := testContext(t)
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	// A second, empty database stands in for a lagging replica
+	connString, err := container.ConnectionString(ctx)
+	require.NoError(t, err)
+	admin, err := pgxpool.New(ctx, connString)
+	require.NoError(t, err)
+	defer admin.Close()
+	_, err = admin.Exec(ctx, "CREATE DATABASE replica")
+	require.NoError(t, err)
+
+	replicaConfig, err := pgxpool.ParseConfig(connString)
+	require.NoError(t, err)
+	replicaConfig.ConnConfig.Database = "replica"
+	replicaPool, err := pgxpool.NewWithConfig(ctx, replicaConfig)
+	require.NoError(t, err)
+	defer replicaPool.Close()
+	require.NoError(t, repository.NewPsqlRepository(replicaPool).Migrate(ctx))
+
+	primaryPool, err := pgxpool.New(ctx, connString)
+	require.NoError(t, err)
+	defer primaryPool.Close()
+	repo := repository.NewPsqlRepository(primaryPool,
+		repository.WithReplicas(replicaPool),
+		repository.WithReadYourWritesWindow(200*time.Millisecond))
+
+	// Execute
+	added, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "ryw@example.com"})
+	require.NoError(t, err)
+
+	// Verify: inside the window the write is visible
+	_, err = repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+
+	// After the window reads go to the replica, which has not seen the write
+	time.Sleep(300 * time.Millisecond)
+	_, err = repo.GetUserByID(ctx, added.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	_, err = repo.GetUserByID(repository.ForcePrimary(ctx), added.ID)
+	require.NoError(t, err)
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultReplicaCooldown      = 10 * time.Second
+	defaultReadYourWritesWindow = 2 * time.Second
+)
+
+// PsqlOption configures optional behavior of a PsqlRepository.
+type PsqlOption func(*PsqlRepository)
+
+// WithReplicas routes reads to the given read replica pools, balanced round-robin among healthy ones.
+func WithReplicas(pools ...*pgxpool.Pool) PsqlOption {
+	return func(r *PsqlRepository) {
+		for _, pool := range pools {
+			r.reads.replicas = append(r.reads.replicas, &replica{pool: pool})
+		}
+	}
+}
+
+// WithPsqlEmailCipher encrypts the stored emails with cipher.
+func WithPsqlEmailCipher(cipher EmailCipher) PsqlOption {
+	return func(r *PsqlRepository) {
+		r.emails = emailCodec{cipher: cipher}
+	}
+}
+
+// WithReplicaCooldown sets how long a replica that failed a read is skipped before being tried again.
+func WithReplicaCooldown(d time.Duration) PsqlOption {
+	return func(r *PsqlRepository) {
+		r.reads.cooldown = d
+	}
+}
+
+// WithReadYourWritesWindow sets how long after a write the reads of the same caller, the actor of the tenant
+// of their context, are sent to the primary, so that it sees its own writes despite replication lag.
+// Callers without an actor share a window per tenant. Zero disables it.
+func WithReadYourWritesWindow(d time.Duration) PsqlOption {
+	return func(r *PsqlRepository) {
+		r.reads.rywWindow = d
+	}
+}
+
+type forcePrimaryKey struct{}
+
+// ForcePrimary returns a context whose reads are always served by the primary,
+// e.g. for reads inside a transaction or that must not observe replication lag.
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+func isPrimaryForced(ctx context.Context) bool {
+	forced, _ := ctx.Value(forcePrimaryKey{}).(bool)
+	return forced
+}
+
+// readRouter decides which pool serves a read.
+type readRouter struct {
+	replicas  []*replica
+	next      atomic.Uint64
+	cooldown  time.Duration
+	rywWindow time.Duration
+
+	mu sync.Mutex
+	// lastWrites holds the time of the last write of each caller within the window.
+	lastWrites map[string]time.Time
+	lastSweep  time.Time
+}
+
+type replica struct {
+	pool      *pgxpool.Pool
+	downUntil atomic.Int64
+}
+
+func (rep *replica) healthy(now time.Time) bool {
+	return now.UnixNano() >= rep.downUntil.Load()
+}
+
+// caller identifies the caller of ctx for the read-your-writes window.
+func caller(ctx context.Context) string {
+	tenantID, _ := tenant.FromContext(ctx)
+	a := actor.Of(ctx)
+	return tenantID + "\x00" + string(a.Kind) + "\x00" + a.ID
+}
+
+// recordWrite opens the read-your-writes window of the caller of ctx.
+func (r *readRouter) recordWrite(ctx context.Context) {
+	if len(r.replicas) == 0 || r.rywWindow <= 0 {
+		return
+	}
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastWrites == nil {
+		r.lastWrites = make(map[string]time.Time)
+	}
+	r.lastWrites[caller(ctx)] = now
+	// Closed windows are dropped once per window, so that the map only holds the recent callers.
+	if now.Sub(r.lastSweep) >= r.rywWindow {
+		for key, at := range r.lastWrites {
+			if now.Sub(at) >= r.rywWindow {
+				delete(r.lastWrites, key)
+			}
+		}
+		r.lastSweep = now
+	}
+}
+
+// recentlyWrote reports whether the read-your-writes window of the caller of ctx is open.
+func (r *readRouter) recentlyWrote(ctx context.Context, now time.Time) bool {
+	if r.rywWindow <= 0 {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	at, ok := r.lastWrites[caller(ctx)]
+	return ok && now.Sub(at) < r.rywWindow
+}
+
+// pickReplica returns the replica that should serve a read, or nil if the primary must be used.
+func (r *readRouter) pickReplica(ctx context.Context) *replica {
+	if len(r.replicas) == 0 || isPrimaryForced(ctx) {
+		return nil
+	}
+	now := time.Now()
+	if r.recentlyWrote(ctx, now) {
+		return nil
+	}
+
+	start := r.next.Add(1)
+	for i := range uint64(len(r.replicas)) {
+		rep := r.replicas[(start+i)%uint64(len(r.replicas))]
+		if rep.healthy(now) {
+			return rep
+		}
+	}
+	return nil
+}
+
+// readFrom runs a read on a replica when possible. If the replica fails for any reason other than a missing row,
+// it is marked down for the cooldown period and the read is retried on the primary.
+func readFrom[T any](ctx context.Context, r *PsqlRepository, read func(*pgxpool.Pool) (T, error)) (T, error) {
+	if rep := r.reads.pickReplica(ctx); rep != nil {
+		v, err := read(rep.pool)
+		if err == nil || errors.Is(err, ErrUserNotFound) || ctx.Err() != nil {
+			return v, err
+		}
+		rep.downUntil.Store(time.Now().Add(r.reads.cooldown).UnixNano())
+	}
+	return read(r.pool)
+}
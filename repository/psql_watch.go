@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// userChangesChannel is the LISTEN/NOTIFY channel fed by the users_notify trigger.
+const userChangesChannel = "user_changes"
+
+// Watch streams user changes notified by the users_notify trigger, listening on a dedicated connection.
+// The connection is re-established with backoff when it drops; since notifications sent in the meantime
+// are lost, a ChangeGap is emitted once listening again.
+// Watch listens before returning, so that no change committed after the call is missed; when it cannot,
+// the stream starts with a ChangeGap once listening.
+func (r *PsqlRepository) Watch(ctx context.Context) <-chan UserChange {
+	ch := make(chan UserChange, watchBufferSize)
+	conn, err := r.listen(ctx)
+	go r.watch(ctx, ch, conn, err != nil)
+	return ch
+}
+
+// watch forwards the notifications of conn to ch, listening again when conn is nil or fails.
+func (r *PsqlRepository) watch(ctx context.Context, ch chan<- UserChange, conn *pgx.Conn, missed bool) {
+	defer close(ch)
+
+	delay := watchReconnectBase
+	for ctx.Err() == nil {
+		if conn == nil {
+			var err error
+			if conn, err = r.listen(ctx); err != nil {
+				missed = true
+				if !sleepContext(ctx, delay) {
+					return
+				}
+				delay = min(2*delay, watchReconnectMax)
+				continue
+			}
+			delay = watchReconnectBase
+		}
+
+		if missed && !sendChange(ctx, ch, UserChange{Op: ChangeGap}) {
+			_ = conn.Close(context.WithoutCancel(ctx))
+			return
+		}
+		r.forward(ctx, conn, ch)
+		_ = conn.Close(context.WithoutCancel(ctx))
+		conn = nil
+		missed = true
+	}
+	if conn != nil {
+		_ = conn.Close(context.WithoutCancel(ctx))
+	}
+}
+
+// listen opens a connection to the primary outside of the pool and subscribes to the change channel.
+func (r *PsqlRepository) listen(ctx context.Context) (*pgx.Conn, error) {
+	conn, err := pgx.ConnectConfig(ctx, r.pool.Config().ConnConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect listener: %w", err)
+	}
+	if _, err := conn.Exec(ctx, "LISTEN "+userChangesChannel); err != nil {
+		_ = conn.Close(ctx)
+		return nil, fmt.Errorf("failed to listen for user changes: %w", err)
+	}
+	return conn, nil
+}
+
+// forward relays notifications to ch until the connection fails or ctx is done.
+func (r *PsqlRepository) forward(ctx context.Context, conn *pgx.Conn, ch chan<- UserChange) {
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return
+		}
+		var change UserChange
+		if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+			continue
+		}
+		if change.User.Email, err = r.emails.decode(change.User.Email); err != nil {
+			continue
+		}
+		if !sendChange(ctx, ch, change) {
+			return
+		}
+	}
+}
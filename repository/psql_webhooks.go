@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	insertSubscriptionQuery = `
+    INSERT INTO webhook_subscriptions (id, tenant_id, url, secret, event_types, created_at)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    `
+
+	subscriptionColumns = `id, tenant_id, url, secret, event_types, created_at`
+
+	selectSubscriptionQuery = `SELECT ` + subscriptionColumns + ` FROM webhook_subscriptions WHERE tenant_id = $1 AND id = $2`
+
+	selectSubscriptionsQuery = `
+    SELECT ` + subscriptionColumns + `
+      FROM webhook_subscriptions
+     WHERE tenant_id = $1
+     ORDER BY created_at, id
+    `
+
+	deleteSubscriptionQuery = `DELETE FROM webhook_subscriptions WHERE tenant_id = $1 AND id = $2`
+
+	insertDeliveryQuery = `
+    INSERT INTO webhook_deliveries (id, tenant_id, subscription_id, event_id, event_type, payload, status, attempts,
+                                    last_error, response_code, next_attempt_at, created_at, updated_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+    ON CONFLICT (subscription_id, event_id) DO NOTHING
+    `
+
+	deliveryColumns = `id, tenant_id, subscription_id, event_id, event_type, payload, status, attempts,
+           last_error, response_code, next_attempt_at, created_at, updated_at`
+
+	selectDueDeliveriesQuery = `
+    SELECT ` + deliveryColumns + `
+      FROM webhook_deliveries
+     WHERE status = 'pending' AND next_attempt_at <= $1
+     ORDER BY next_attempt_at
+     LIMIT $2
+    `
+
+	selectDeliveryQuery = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE tenant_id = $1 AND id = $2`
+
+	selectDeliveriesQuery = `
+    SELECT ` + deliveryColumns + `
+      FROM webhook_deliveries
+     WHERE tenant_id = $1
+       AND ($2 = '00000000-0000-0000-0000-000000000000'::uuid OR subscription_id = $2)
+       AND ($3 = '' OR status = $3)
+     ORDER BY created_at DESC
+     LIMIT $4
+    `
+
+	updateDeliveryQuery = `
+    UPDATE webhook_deliveries
+       SET status = $2, attempts = $3, last_error = $4, response_code = $5, next_attempt_at = $6, updated_at = $7
+     WHERE id = $1
+    `
+)
+
+// AddSubscription stores a webhook subscription for the tenant of ctx, generating its ID if needed.
+func (r *PsqlRepository) AddSubscription(ctx context.Context, sub domain.WebhookSubscription) (*domain.WebhookSubscription, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sub.TenantID = tenantID
+	if sub.ID == uuid.Nil {
+		sub.ID = uuid.New()
+	}
+	eventTypes := make([]string, len(sub.EventTypes))
+	for i, t := range sub.EventTypes {
+		eventTypes[i] = string(t)
+	}
+	if _, err := r.pool.Exec(ctx, insertSubscriptionQuery, sub.ID, sub.TenantID, sub.URL, sub.Secret, eventTypes, sub.CreatedAt); err != nil {
+		return nil, fmt.Errorf("failed to execute insert subscription query: %w", err)
+	}
+	return &sub, nil
+}
+
+// GetSubscription returns the webhook subscription of the tenant of ctx with the given ID.
+func (r *PsqlRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.WebhookSubscription, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := scanPsqlSubscription(r.pool.QueryRow(ctx, selectSubscriptionQuery, tenantID, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns the webhook subscriptions of the tenant of ctx in creation order.
+func (r *PsqlRepository) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.pool.Query(ctx, selectSubscriptionsQuery, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select subscriptions query: %w", err)
+	}
+	defer rows.Close()
+
+	subs := make([]domain.WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanPsqlSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes a webhook subscription; its deliveries are removed by the foreign key.
+func (r *PsqlRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tag, err := r.pool.Exec(ctx, deleteSubscriptionQuery, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to execute delete subscription query: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// EnqueueDelivery stores a delivery unless the event was already queued for the subscription.
+func (r *PsqlRepository) EnqueueDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	payload, err := r.emails.sealPayload(d.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = r.pool.Exec(ctx, insertDeliveryQuery, d.ID, d.TenantID, d.SubscriptionID, d.EventID, d.EventType, payload,
+		d.Status, d.Attempts, d.LastError, d.ResponseCode, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to execute insert delivery query: %w", err)
+	}
+	return nil
+}
+
+// DueDeliveries returns the pending deliveries due at now.
+func (r *PsqlRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	return r.queryDeliveries(ctx, selectDueDeliveriesQuery, now, limit)
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt.
+func (r *PsqlRepository) UpdateDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	tag, err := r.pool.Exec(ctx, updateDeliveryQuery, d.ID, d.Status, d.Attempts, d.LastError, d.ResponseCode, d.NextAttemptAt, d.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to execute update delivery query: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// GetDelivery returns the webhook delivery of the tenant of ctx with the given ID.
+func (r *PsqlRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d, err := scanDelivery(r.pool.QueryRow(ctx, selectDeliveryQuery, tenantID, id), r.emails)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDeliveries returns the deliveries of the tenant of ctx matching filter, most recent first.
+func (r *PsqlRepository) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]domain.WebhookDelivery, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.queryDeliveries(ctx, selectDeliveriesQuery, tenantID, filter.SubscriptionID, string(filter.Status), filter.limit())
+}
+
+func (r *PsqlRepository) queryDeliveries(ctx context.Context, query string, args ...any) ([]domain.WebhookDelivery, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute select deliveries query: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows, r.emails)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return deliveries, nil
+}
+
+// rowScanner is implemented by pgx.Row, pgx.Rows, *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPsqlSubscription(row rowScanner) (*domain.WebhookSubscription, error) {
+	var (
+		sub        domain.WebhookSubscription
+		eventTypes []string
+	)
+	if err := row.Scan(&sub.ID, &sub.TenantID, &sub.URL, &sub.Secret, &eventTypes, &sub.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan subscription row: %w", err)
+	}
+	for _, t := range eventTypes {
+		sub.EventTypes = append(sub.EventTypes, domain.EventType(t))
+	}
+	sub.CreatedAt = sub.CreatedAt.UTC()
+	return &sub, nil
+}
+
+// scanDelivery reads a delivery selected with deliveryColumns, decrypting the email in its payload. The no-rows errors
+// of both drivers are returned as is.
+func scanDelivery(row rowScanner, emails emailCodec) (*domain.WebhookDelivery, error) {
+	var (
+		d       domain.WebhookDelivery
+		payload []byte
+	)
+	err := row.Scan(&d.ID, &d.TenantID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+		&d.LastError, &d.ResponseCode, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) || errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan delivery row: %w", err)
+	}
+	if d.Payload, err = emails.openPayload(payload); err != nil {
+		return nil, err
+	}
+	d.NextAttemptAt = d.NextAttemptAt.UTC()
+	d.CreatedAt = d.CreatedAt.UTC()
+	d.UpdatedAt = d.UpdatedAt.UTC()
+	return &d, nil
+}
@@ -0,0 +1,295 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// insertRefreshTokenQuery only stores tokens of existing users of the tenant.
+	insertRefreshTokenQuery = `
+    INSERT INTO refresh_tokens (id, tenant_id, user_id, token_hash, expires_at, created_at)
+    SELECT $3, tenant_id, id, $4, $5, $6 FROM users WHERE tenant_id = $1 AND id = $2
+    `
+
+	selectRefreshTokenQuery = `
+    SELECT id, user_id, token_hash, expires_at, created_at, revoked_at
+      FROM refresh_tokens
+     WHERE tenant_id = $1 AND id = $2
+    `
+
+	revokeRefreshTokenQuery = `
+    UPDATE refresh_tokens SET revoked_at = $3 WHERE tenant_id = $1 AND id = $2 AND revoked_at IS NULL
+    `
+
+	revokeUserRefreshTokensQuery = `
+    UPDATE refresh_tokens SET revoked_at = $3 WHERE tenant_id = $1 AND user_id = $2 AND revoked_at IS NULL
+    `
+
+	insertRefreshTokenQuery2 = `
+    INSERT INTO refresh_tokens(id, tenant_id, user_id, token_hash, expires_at, created_at)
+    SELECT ?, tenant_id, id, ?, ?, ? FROM users WHERE tenant_id = ? AND id = ?;
+`
+
+	selectRefreshTokenQuery2 = `
+    SELECT id, user_id, token_hash, expires_at, created_at, revoked_at
+      FROM refresh_tokens
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	revokeRefreshTokenQuery2 = `
+    UPDATE refresh_tokens
+       SET revoked_at = ?
+     WHERE tenant_id = ? AND id = ? AND revoked_at IS NULL;
+`
+
+	revokeUserRefreshTokensQuery2 = `
+    UPDATE refresh_tokens
+       SET revoked_at = ?
+     WHERE tenant_id = ? AND user_id = ? AND revoked_at IS NULL;
+`
+)
+
+// RefreshTokenStore is implemented by repositories persisting refresh tokens. Tokens are deleted along
+// with their user.
+type RefreshTokenStore interface {
+	// AddRefreshToken stores a new token, or returns ErrUserNotFound.
+	AddRefreshToken(ctx context.Context, token domain.RefreshToken) error
+	// GetRefreshToken returns a token, revoked or not, or ErrRefreshTokenNotFound.
+	GetRefreshToken(ctx context.Context, id uuid.UUID) (*domain.RefreshToken, error)
+	// RevokeRefreshToken revokes a token, or returns ErrRefreshTokenNotFound when it is unknown or already revoked.
+	RevokeRefreshToken(ctx context.Context, id uuid.UUID) error
+	// RevokeUserRefreshTokens revokes every token of a user and returns how many it revoked.
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+// tenantRefreshToken is a stored refresh token along with the tenant owning it.
+type tenantRefreshToken struct {
+	tenant string
+	token  domain.RefreshToken
+}
+
+// AddRefreshToken stores a refresh token in memory.
+func (r *MemoryRepository) AddRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == token.UserID }) < 0 {
+		return ErrUserNotFound
+	}
+	r.refreshTokens = append(r.refreshTokens, tenantRefreshToken{tenant: tenantID, token: token})
+	return nil
+}
+
+// GetRefreshToken returns a refresh token of the tenant.
+func (r *MemoryRepository) GetRefreshToken(ctx context.Context, id uuid.UUID) (*domain.RefreshToken, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.refreshTokens {
+		if t.tenant == tenantID && t.token.ID == id {
+			token := t.token
+			return &token, nil
+		}
+	}
+	return nil, ErrRefreshTokenNotFound
+}
+
+// RevokeRefreshToken revokes an active refresh token of the tenant.
+func (r *MemoryRepository) RevokeRefreshToken(ctx context.Context, id uuid.UUID) error {
+	n, err := r.revokeRefreshTokens(ctx, func(t domain.RefreshToken) bool { return t.ID == id })
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes the active refresh tokens of a user of the tenant.
+func (r *MemoryRepository) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	return r.revokeRefreshTokens(ctx, func(t domain.RefreshToken) bool { return t.UserID == userID })
+}
+
+func (r *MemoryRepository) revokeRefreshTokens(ctx context.Context, match func(domain.RefreshToken) bool) (int, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var n int
+	for i := range r.refreshTokens {
+		t := &r.refreshTokens[i]
+		if t.tenant == tenantID && t.token.RevokedAt == nil && match(t.token) {
+			t.token.RevokedAt = &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+// AddRefreshToken stores a refresh token.
+func (r *PsqlRepository) AddRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		tag, err := tx.Exec(ctx, insertRefreshTokenQuery, tenantID, token.UserID, token.ID, token.TokenHash,
+			token.ExpiresAt, token.CreatedAt)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute insert refresh token query: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return struct{}{}, ErrUserNotFound
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// GetRefreshToken returns a refresh token, read from the primary so that a revocation is seen at once.
+func (r *PsqlRepository) GetRefreshToken(ctx context.Context, id uuid.UUID) (*domain.RefreshToken, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) (*domain.RefreshToken, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var t domain.RefreshToken
+		err = tx.QueryRow(ctx, selectRefreshTokenQuery, tenantID, id).
+			Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.RevokedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRefreshTokenNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute select refresh token query: %w", err)
+		}
+		return &t, nil
+	})
+}
+
+// RevokeRefreshToken revokes an active refresh token.
+func (r *PsqlRepository) RevokeRefreshToken(ctx context.Context, id uuid.UUID) error {
+	n, err := r.revokeRefreshTokens(ctx, revokeRefreshTokenQuery, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes the active refresh tokens of a user.
+func (r *PsqlRepository) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	return r.revokeRefreshTokens(ctx, revokeUserRefreshTokensQuery, userID)
+}
+
+func (r *PsqlRepository) revokeRefreshTokens(ctx context.Context, query string, id uuid.UUID) (int, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) (int, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return 0, err
+		}
+		tag, err := tx.Exec(ctx, query, tenantID, id, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute revoke refresh token query: %w", err)
+		}
+		return int(tag.RowsAffected()), nil
+	})
+}
+
+// AddRefreshToken stores a refresh token.
+func (r *SqlliteRepository) AddRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, insertRefreshTokenQuery2, token.ID, token.TokenHash, token.ExpiresAt, token.CreatedAt,
+		tenantID, token.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	n, err := rowsAffected(res)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetRefreshToken returns a refresh token.
+func (r *SqlliteRepository) GetRefreshToken(ctx context.Context, id uuid.UUID) (*domain.RefreshToken, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var t domain.RefreshToken
+	var revokedAt sql.NullTime
+	err = r.db.QueryRowContext(ctx, selectRefreshTokenQuery2, tenantID, id).
+		Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refresh token: %w", err)
+	}
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return &t, nil
+}
+
+// RevokeRefreshToken revokes an active refresh token.
+func (r *SqlliteRepository) RevokeRefreshToken(ctx context.Context, id uuid.UUID) error {
+	n, err := r.revokeRefreshTokens(ctx, revokeRefreshTokenQuery2, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes the active refresh tokens of a user.
+func (r *SqlliteRepository) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	return r.revokeRefreshTokens(ctx, revokeUserRefreshTokensQuery2, userID)
+}
+
+func (r *SqlliteRepository) revokeRefreshTokens(ctx context.Context, query string, id uuid.UUID) (int, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.db.ExecContext(ctx, query, time.Now(), tenantID, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return rowsAffected(res)
+}
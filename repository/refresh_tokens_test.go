@@ -0,0 +1,70 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshTokenStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	sqlite := repository.NewSQLLiteRepository(db)
+	require.NoError(t, sqlite.Migrate(testContext(t)))
+
+	stores := map[string]interface {
+		repository.UserRepository
+		repository.RefreshTokenStore
+	}{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": sqlite,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := testContext(t)
+			user, err := store.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com"})
+			require.NoError(t, err)
+			newToken := func(userID uuid.UUID) domain.RefreshToken {
+				now := time.Now().UTC().Truncate(time.Millisecond)
+				return domain.RefreshToken{ID: uuid.New(), UserID: userID, TokenHash: "hash", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+			}
+
+			require.ErrorIs(t, store.AddRefreshToken(ctx, newToken(uuid.New())), repository.ErrUserNotFound)
+			first, second := newToken(user.ID), newToken(user.ID)
+			require.NoError(t, store.AddRefreshToken(ctx, first))
+			require.NoError(t, store.AddRefreshToken(ctx, second))
+
+			got, err := store.GetRefreshToken(ctx, first.ID)
+			require.NoError(t, err)
+			assert.Equal(t, first.UserID, got.UserID)
+			assert.Equal(t, "hash", got.TokenHash)
+			assert.True(t, got.ExpiresAt.Equal(first.ExpiresAt))
+			assert.True(t, got.Active(time.Now()))
+			_, err = store.GetRefreshToken(tenant.WithID(ctx, "other"), first.ID)
+			require.ErrorIs(t, err, repository.ErrRefreshTokenNotFound)
+
+			require.NoError(t, store.RevokeRefreshToken(ctx, first.ID))
+			require.ErrorIs(t, store.RevokeRefreshToken(ctx, first.ID), repository.ErrRefreshTokenNotFound)
+			got, err = store.GetRefreshToken(ctx, first.ID)
+			require.NoError(t, err)
+			assert.NotNil(t, got.RevokedAt)
+
+			n, err := store.RevokeUserRefreshTokens(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+
+			require.NoError(t, store.DeleteUser(ctx, user.ID))
+			_, err = store.GetRefreshToken(ctx, second.ID)
+			require.ErrorIs(t, err, repository.ErrRefreshTokenNotFound)
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/mattn/go-sqlite3" // registers the sqlite3 driver
+)
+
+// ErrUnknownScheme is returned by Open when no backend is registered for the URL scheme.
+var ErrUnknownScheme = errors.New("unknown repository scheme")
+
+// migrateParam is the query parameter that asks Open to run the backend migrations.
+const migrateParam = "migrate"
+
+// CloseFunc releases the resources held by a repository returned by Open.
+type CloseFunc func() error
+
+// OpenOptions holds the options extracted from the URL or passed to Open.
+type OpenOptions struct {
+	// Migrate asks the backend to create its schema before returning.
+	Migrate bool
+	// EmailCipher, when set, makes the SQL backends encrypt the stored emails.
+	EmailCipher EmailCipher
+}
+
+// OpenOption sets options that cannot be written in the URL, such as keys.
+type OpenOption func(*OpenOptions)
+
+// WithEmailCipher makes the repository returned by Open encrypt the stored emails with cipher.
+func WithEmailCipher(cipher EmailCipher) OpenOption {
+	return func(o *OpenOptions) {
+		o.EmailCipher = cipher
+	}
+}
+
+// Opener builds a UserRepository for the given URL. The migrate parameter is removed from the URL beforehand.
+type Opener func(ctx context.Context, u *url.URL, opts OpenOptions) (UserRepository, CloseFunc, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]Opener)
+)
+
+func init() {
+	Register("postgres", openPostgres)
+	Register("postgresql", openPostgres)
+	Register("sqlite", openSQLite)
+	Register("memory", openMemory)
+}
+
+// Register makes a backend available to Open under the given URL scheme.
+// It panics if the opener is nil or if the scheme is already registered.
+func Register(scheme string, opener Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if opener == nil {
+		panic("repository: Register opener is nil")
+	}
+	scheme = strings.ToLower(scheme)
+	if _, dup := openers[scheme]; dup {
+		panic("repository: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = opener
+}
+
+// Schemes returns the sorted list of registered URL schemes.
+func Schemes() []string {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	schemes := make([]string, 0, len(openers))
+	for scheme := range openers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open returns a ready UserRepository for the given URL along with a function releasing its resources.
+// Adding migrate=true to the query string runs the backend migrations before returning.
+func Open(ctx context.Context, rawURL string, options ...OpenOption) (UserRepository, CloseFunc, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse repository url: %w", err)
+	}
+
+	openersMu.RLock()
+	opener, ok := openers[strings.ToLower(u.Scheme)]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", ErrUnknownScheme, u.Scheme)
+	}
+
+	var opts OpenOptions
+	for _, option := range options {
+		option(&opts)
+	}
+	query := u.Query()
+	if v := query.Get(migrateParam); v != "" {
+		if opts.Migrate, err = strconv.ParseBool(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid %s parameter: %w", migrateParam, err)
+		}
+	}
+	query.Del(migrateParam)
+	u.RawQuery = query.Encode()
+
+	repo, closeFn, err := opener(ctx, u, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !opts.Migrate {
+		return repo, closeFn, nil
+	}
+
+	migrator, ok := repo.(Migrator)
+	if !ok {
+		return repo, closeFn, nil
+	}
+	if err := migrator.Migrate(ctx); err != nil {
+		_ = closeFn()
+		return nil, nil, err
+	}
+	return repo, closeFn, nil
+}
+
+// openPostgres accepts a regular PostgreSQL URL. The replica_hosts parameter, a comma separated list of host:port,
+// adds read replicas sharing the credentials and database of the primary.
+func openPostgres(ctx context.Context, u *url.URL, options OpenOptions) (UserRepository, CloseFunc, error) {
+	query := u.Query()
+	var replicaHosts []string
+	if hosts := query.Get("replica_hosts"); hosts != "" {
+		replicaHosts = strings.Split(hosts, ",")
+	}
+	query.Del("replica_hosts")
+	u.RawQuery = query.Encode()
+
+	pool, err := newTracedPool(ctx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	pools := []*pgxpool.Pool{pool}
+	closeAll := func() error {
+		for _, p := range pools {
+			p.Close()
+		}
+		return nil
+	}
+	for _, host := range replicaHosts {
+		replicaURL := *u
+		replicaURL.Host = host
+		replicaPool, err := newTracedPool(ctx, &replicaURL)
+		if err != nil {
+			_ = closeAll()
+			return nil, nil, err
+		}
+		pools = append(pools, replicaPool)
+	}
+
+	opts := []PsqlOption{WithReplicas(pools[1:]...)}
+	if options.EmailCipher != nil {
+		opts = append(opts, WithPsqlEmailCipher(options.EmailCipher))
+	}
+	return NewPsqlRepository(pool, opts...), closeAll, nil
+}
+
+func newTracedPool(ctx context.Context, u *url.URL) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse postgres url: %w", err)
+	}
+	config.ConnConfig.Tracer = NewPgxTracer(nil)
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create postgres pool: %w", err)
+	}
+	return pool, nil
+}
+
+// openSQLite accepts sqlite://path/to/file.db, sqlite:///abs/path.db and sqlite://:memory:.
+// The check parameter (quick or full) selects the integrity check run by CheckHealth;
+// remaining query parameters are passed to the go-sqlite3 driver.
+func openSQLite(ctx context.Context, u *url.URL, options OpenOptions) (UserRepository, CloseFunc, error) {
+	var opts []SQLiteOption
+	if options.EmailCipher != nil {
+		opts = append(opts, WithSQLiteEmailCipher(options.EmailCipher))
+	}
+	query := u.Query()
+	switch query.Get("check") {
+	case "":
+	case "quick":
+		opts = append(opts, WithQuickCheck())
+	case "full":
+		opts = append(opts, WithIntegrityCheck())
+	default:
+		return nil, nil, fmt.Errorf("invalid check parameter %q", query.Get("check"))
+	}
+	query.Del("check")
+	u.RawQuery = query.Encode()
+
+	dsn := "file:" + u.Host + u.Path
+	if u.RawQuery != "" {
+		dsn += "?" + u.RawQuery
+	}
+
+	db, err := sql.Open(sqliteDriverName, dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	// Every connection to :memory: gets its own database, so keep a single one.
+	if u.Host == ":memory:" {
+		db.SetMaxOpenConns(1)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, nil, fmt.Errorf("failed to connect to sqlite: %w", err)
+	}
+	return NewSQLLiteRepository(db, opts...), db.Close, nil
+}
+
+func openMemory(_ context.Context, _ *url.URL, _ OpenOptions) (UserRepository, CloseFunc, error) {
+	return NewMemoryRepository(), func() error { return nil }, nil
+}
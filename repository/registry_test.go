@@ -0,0 +1,86 @@
+package repository_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpen_Memory(t *testing.T) {
+	ctx := testContext(t)
+
+	repo, closeRepo, err := repository.Open(ctx, "memory://")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, closeRepo()) }()
+
+	assert.IsType(t, &repository.MemoryRepository{}, repo)
+}
+
+func TestOpen_SQLiteWithMigrations(t *testing.T) {
+	ctx := testContext(t)
+
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, closeRepo()) }()
+
+	require.IsType(t, &repository.SqlliteRepository{}, repo)
+
+	// The schema exists, so the repository is ready to use
+	_, err = repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	users, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestOpen_SQLiteWithoutMigrations(t *testing.T) {
+	ctx := testContext(t)
+
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:")
+	require.NoError(t, err)
+	defer func() { require.NoError(t, closeRepo()) }()
+
+	// Without migrate=true the users table is not created
+	_, err = repo.GetAllUsers(ctx)
+	assert.Error(t, err)
+}
+
+func TestOpen_Errors(t *testing.T) {
+	ctx := testContext(t)
+
+	_, _, err := repository.Open(ctx, "mongodb://localhost:27017/mydb")
+	require.ErrorIs(t, err, repository.ErrUnknownScheme)
+
+	_, _, err = repository.Open(ctx, "memory://?migrate=maybe")
+	assert.Error(t, err)
+}
+
+func TestRegister(t *testing.T) {
+	ctx := testContext(t)
+	memory := repository.NewMemoryRepository()
+
+	repository.Register("test-register", func(_ context.Context, u *url.URL, opts repository.OpenOptions) (repository.UserRepository, repository.CloseFunc, error) {
+		// The migrate parameter is consumed by Open and never reaches the opener
+		assert.Equal(t, "name=value", u.RawQuery)
+		assert.True(t, opts.Migrate)
+		return memory, func() error { return nil }, nil
+	})
+
+	assert.Contains(t, repository.Schemes(), "test-register")
+
+	repo, _, err := repository.Open(ctx, "test-register://host?name=value&migrate=true")
+	require.NoError(t, err)
+	assert.Same(t, memory, repo)
+
+	assert.Panics(t, func() {
+		repository.Register("test-register", func(context.Context, *url.URL, repository.OpenOptions) (repository.UserRepository, repository.CloseFunc, error) {
+			return nil, nil, nil
+		})
+	})
+}
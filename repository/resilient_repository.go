@@ -0,0 +1,278 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrCircuitOpen is returned without calling the backend while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	defaultMaxAttempts      = 3
+	defaultBaseDelay        = 50 * time.Millisecond
+	defaultMaxDelay         = 2 * time.Second
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+// IsRetryable reports whether err is a transient database failure worth retrying:
+// dropped or refused connections, Postgres serialization failures (40001), deadlocks (40P01)
+// and connection exceptions (class 08), and SQLite busy or locked databases.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01" || strings.HasPrefix(pgErr.Code, "08")
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		pgconn.SafeToRetry(err)
+}
+
+// IsRetryableWrite reports whether a write that failed with err certainly did not take effect, so that it
+// can be retried: Postgres serialization failures and deadlocks, which roll the transaction back, errors
+// pgx reports as sent before any data, refused connections and SQLite busy or locked databases.
+// Unlike IsRetryable, it excludes connections dropped mid-call, after which the write may have committed.
+func IsRetryableWrite(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || pgconn.SafeToRetry(err)
+}
+
+// ResilientRepository is a UserRepository decorator that retries transient failures with jittered
+// exponential backoff, never sleeping past the context deadline, and stops calling the backend
+// for a while once too many consecutive calls have failed. Writes are only retried when IsRetryableWrite
+// tells they did not take effect.
+type ResilientRepository struct {
+	next        UserRepository
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	breaker     *circuitBreaker
+}
+
+// ResilienceOption configures a ResilientRepository.
+type ResilienceOption func(*ResilientRepository)
+
+// WithMaxAttempts sets the maximum number of attempts per call, including the first one.
+func WithMaxAttempts(n int) ResilienceOption {
+	return func(r *ResilientRepository) {
+		r.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the base and maximum delay between attempts.
+func WithBackoff(base, maxDelay time.Duration) ResilienceOption {
+	return func(r *ResilientRepository) {
+		r.baseDelay = base
+		r.maxDelay = maxDelay
+	}
+}
+
+// WithCircuitBreaker opens the circuit after threshold consecutive failed calls and lets a probe call through after openTimeout.
+func WithCircuitBreaker(threshold int, openTimeout time.Duration) ResilienceOption {
+	return func(r *ResilientRepository) {
+		r.breaker = &circuitBreaker{threshold: threshold, openTimeout: openTimeout}
+	}
+}
+
+// NewResilientRepository wraps next with retries and a circuit breaker.
+func NewResilientRepository(next UserRepository, opts ...ResilienceOption) *ResilientRepository {
+	r := &ResilientRepository{
+		next:        next,
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
+		breaker:     &circuitBreaker{threshold: defaultFailureThreshold, openTimeout: defaultOpenTimeout},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// AddUser delegates to the wrapped repository with retries. Users without an ID are given one first,
+// so that every attempt creates the same user.
+func (r *ResilientRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	return withRetry(ctx, r, IsRetryableWrite, func(ctx context.Context) (*domain.User, error) {
+		return r.next.AddUser(ctx, user)
+	})
+}
+
+// GetAllUsers delegates to the wrapped repository with retries.
+func (r *ResilientRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	return withRetry(ctx, r, IsRetryable, r.next.GetAllUsers)
+}
+
+// GetUserByID delegates to the wrapped repository with retries.
+func (r *ResilientRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return withRetry(ctx, r, IsRetryable, func(ctx context.Context) (*domain.User, error) {
+		return r.next.GetUserByID(ctx, id)
+	})
+}
+
+// GetUserByEmail delegates to the wrapped repository with retries.
+func (r *ResilientRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	return withRetry(ctx, r, IsRetryable, func(ctx context.Context) (*domain.User, error) {
+		return r.next.GetUserByEmail(ctx, email)
+	})
+}
+
+// UpdateUser delegates to the wrapped repository with retries.
+func (r *ResilientRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return withRetry(ctx, r, IsRetryableWrite, func(ctx context.Context) (*domain.User, error) {
+		return r.next.UpdateUser(ctx, user)
+	})
+}
+
+// DeleteUser delegates to the wrapped repository with retries.
+func (r *ResilientRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := withRetry(ctx, r, IsRetryableWrite, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, r.next.DeleteUser(ctx, id)
+	})
+	return err
+}
+
+// withRetry calls fn until it succeeds, fails with an error retryable does not accept, or runs out of attempts.
+func withRetry[T any](ctx context.Context, r *ResilientRepository, retryable func(error) bool,
+	fn func(context.Context) (T, error)) (T, error) {
+	var zero T
+	if !r.breaker.allow() {
+		return zero, ErrCircuitOpen
+	}
+
+	for attempt := 1; ; attempt++ {
+		v, err := fn(ctx)
+		if err == nil || !retryable(err) {
+			// Not found, conflicts and other application errors say nothing about the backend health,
+			// unlike the transient failures of writes that cannot be retried.
+			r.breaker.record(!IsRetryable(err))
+			return v, err
+		}
+		if attempt >= r.maxAttempts {
+			r.breaker.record(false)
+			return zero, err
+		}
+
+		delay := r.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			r.breaker.record(false)
+			return zero, err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			r.breaker.record(false)
+			return zero, err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns a random delay in [0, min(maxDelay, baseDelay*2^(attempt-1))] ("full jitter").
+func (r *ResilientRepository) backoff(attempt int) time.Duration {
+	ceiling := r.maxDelay
+	// The shift is bounded so that it cannot overflow.
+	if shift := attempt - 1; shift < 63 && r.baseDelay > 0 && r.baseDelay <= r.maxDelay>>shift {
+		ceiling = r.baseDelay << shift
+	}
+	return rand.N(ceiling + 1) // #nosec G404
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker counts consecutive failed calls. Once open it rejects calls until openTimeout has elapsed,
+// then lets a single probe through: its success closes the circuit, its failure opens it again.
+type circuitBreaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openTimeout {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// A probe is already in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,215 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	mock_repository "github.com/davidyannick/repository-pattern/mocks"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{"sqlite constraint", sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"not found", repository.ErrUserNotFound, false},
+		{"deadline", context.DeadlineExceeded, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, repository.IsRetryable(tt.err))
+		})
+	}
+}
+
+func TestIsRetryableWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"deadlock", fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, false},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), false},
+		{"unexpected eof", io.ErrUnexpectedEOF, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, repository.IsRetryableWrite(tt.err))
+		})
+	}
+}
+
+func TestResilientRepository_DoesNotRetryWritesThatMayHaveCommitted(t *testing.T) {
+	ctx := t.Context()
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	var ids []uuid.UUID
+	mockRepo.EXPECT().AddUser(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, user domain.User) (*domain.User, error) {
+		ids = append(ids, user.ID)
+		if len(ids) == 1 {
+			return nil, &pgconn.PgError{Code: "40001"}
+		}
+		return &user, nil
+	}).Times(2)
+	mockRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).Return(nil, syscall.ECONNRESET).Times(1)
+
+	repo := repository.NewResilientRepository(mockRepo, repository.WithBackoff(time.Millisecond, 5*time.Millisecond))
+
+	added, err := repo.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	require.Len(t, ids, 2)
+	assert.NotEqual(t, uuid.Nil, ids[0])
+	assert.Equal(t, ids[0], ids[1], "every attempt creates the same user")
+	assert.Equal(t, ids[0], added.ID)
+
+	_, err = repo.UpdateUser(ctx, *added)
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+}
+
+func TestResilientRepository_BackoffDoesNotOverflow(t *testing.T) {
+	ctx := t.Context()
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+	mockRepo.EXPECT().GetAllUsers(gomock.Any()).Return(nil, syscall.ECONNRESET).Times(100)
+
+	repo := repository.NewResilientRepository(mockRepo,
+		repository.WithMaxAttempts(100),
+		repository.WithBackoff(time.Hour, time.Microsecond),
+		repository.WithCircuitBreaker(0, 0))
+
+	_, err := repo.GetAllUsers(ctx)
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+}
+
+func TestResilientRepository_RetriesTransientErrors(t *testing.T) {
+	ctx := t.Context()
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	user := domain.User{ID: uuid.New(), Name: "John Doe", Email: "john@example.com"}
+	gomock.InOrder(
+		mockRepo.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(nil, &pgconn.PgError{Code: "40001"}).Times(2),
+		mockRepo.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(&user, nil),
+	)
+
+	repo := repository.NewResilientRepository(mockRepo, repository.WithBackoff(time.Millisecond, 5*time.Millisecond))
+
+	found, err := repo.GetUserByID(ctx, user.ID)
+
+	require.NoError(t, err)
+	assert.Equal(t, user, *found)
+}
+
+func TestResilientRepository_DoesNotRetryPermanentErrors(t *testing.T) {
+	ctx := t.Context()
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	id := uuid.New()
+	mockRepo.EXPECT().DeleteUser(gomock.Any(), id).Return(repository.ErrUserNotFound).Times(1)
+
+	repo := repository.NewResilientRepository(mockRepo, repository.WithBackoff(time.Millisecond, 5*time.Millisecond))
+
+	require.ErrorIs(t, repo.DeleteUser(ctx, id), repository.ErrUserNotFound)
+}
+
+func TestResilientRepository_GivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := t.Context()
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	busy := sqlite3.Error{Code: sqlite3.ErrBusy}
+	mockRepo.EXPECT().GetAllUsers(gomock.Any()).Return(nil, busy).Times(4)
+
+	repo := repository.NewResilientRepository(mockRepo,
+		repository.WithMaxAttempts(4),
+		repository.WithBackoff(time.Millisecond, 5*time.Millisecond))
+
+	_, err := repo.GetAllUsers(ctx)
+
+	var sqliteErr sqlite3.Error
+	require.ErrorAs(t, err, &sqliteErr)
+	assert.Equal(t, sqlite3.ErrBusy, sqliteErr.Code)
+}
+
+func TestResilientRepository_StopsAtContextDeadline(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	mockRepo.EXPECT().GetAllUsers(gomock.Any()).Return(nil, syscall.ECONNRESET).Times(1)
+
+	// The backoff is longer than the time left, so no second attempt is made
+	repo := repository.NewResilientRepository(mockRepo,
+		repository.WithMaxAttempts(10),
+		repository.WithBackoff(time.Hour, time.Hour))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := repo.GetAllUsers(ctx)
+
+	require.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestResilientRepository_CircuitBreaker(t *testing.T) {
+	ctx := t.Context()
+	mockCtrl := gomock.NewController(t)
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+
+	down := errors.Join(errors.New("dial"), syscall.ECONNREFUSED)
+	gomock.InOrder(
+		// Two failed calls open the circuit
+		mockRepo.EXPECT().GetAllUsers(gomock.Any()).Return(nil, down).Times(2),
+		// The probe after the open timeout succeeds and closes it
+		mockRepo.EXPECT().GetAllUsers(gomock.Any()).Return([]domain.User{}, nil).Times(2),
+	)
+
+	repo := repository.NewResilientRepository(mockRepo,
+		repository.WithMaxAttempts(1),
+		repository.WithCircuitBreaker(2, 20*time.Millisecond))
+
+	for range 2 {
+		_, err := repo.GetAllUsers(ctx)
+		require.ErrorIs(t, err, syscall.ECONNREFUSED)
+	}
+
+	_, err := repo.GetAllUsers(ctx)
+	require.ErrorIs(t, err, repository.ErrCircuitOpen)
+
+	time.Sleep(30 * time.Millisecond)
+
+	_, err = repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	_, err = repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	selectUserExistsQuery = `SELECT EXISTS (SELECT 1 FROM users WHERE tenant_id = $1 AND id = $2)`
+
+	deleteRolesQuery = `DELETE FROM user_roles WHERE tenant_id = $1 AND user_id = $2`
+
+	insertRoleQuery = `INSERT INTO user_roles (user_id, tenant_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+
+	selectRolesQuery = `SELECT role FROM user_roles WHERE tenant_id = $1 AND user_id = $2 ORDER BY role`
+
+	selectUserExistsQuery2 = `
+    SELECT EXISTS (SELECT 1 FROM users WHERE tenant_id = ? AND id = ?);
+`
+
+	deleteRolesQuery2 = `
+    DELETE FROM user_roles
+     WHERE tenant_id = ? AND user_id = ?;
+`
+
+	insertRoleQuery2 = `
+    INSERT OR IGNORE INTO user_roles(user_id, tenant_id, role)
+    VALUES(?, ?, ?);
+`
+
+	selectRolesQuery2 = `
+    SELECT role
+      FROM user_roles
+     WHERE tenant_id = ? AND user_id = ?
+     ORDER BY role;
+`
+)
+
+// RoleStore is implemented by repositories storing the roles of users. Roles are deleted along with their user.
+type RoleStore interface {
+	// SetRoles replaces the roles of a user, or returns ErrUserNotFound.
+	SetRoles(ctx context.Context, userID uuid.UUID, roles []domain.Role) error
+	// GetRoles returns the roles of a user, sorted, and none for unknown users.
+	GetRoles(ctx context.Context, userID uuid.UUID) ([]domain.Role, error)
+}
+
+// SetRoles replaces the roles of a user in memory.
+func (r *MemoryRepository) SetRoles(ctx context.Context, userID uuid.UUID, roles []domain.Role) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == userID }) < 0 {
+		return ErrUserNotFound
+	}
+	if r.roles == nil {
+		r.roles = make(map[uuid.UUID][]domain.Role)
+	}
+	roles = slices.Clone(roles)
+	slices.Sort(roles)
+	r.roles[userID] = slices.Compact(roles)
+	return nil
+}
+
+// GetRoles returns the roles of a user of the tenant.
+func (r *MemoryRepository) GetRoles(ctx context.Context, userID uuid.UUID) ([]domain.Role, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == userID }) < 0 {
+		return []domain.Role{}, nil
+	}
+	return append([]domain.Role{}, r.roles[userID]...), nil
+}
+
+// SetRoles replaces the roles of a user.
+func (r *PsqlRepository) SetRoles(ctx context.Context, userID uuid.UUID, roles []domain.Role) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		var exists bool
+		if err := tx.QueryRow(ctx, selectUserExistsQuery, tenantID, userID).Scan(&exists); err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute select user exists query: %w", err)
+		}
+		if !exists {
+			return struct{}{}, ErrUserNotFound
+		}
+		if _, err := tx.Exec(ctx, deleteRolesQuery, tenantID, userID); err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute delete roles query: %w", err)
+		}
+		for _, role := range roles {
+			if _, err := tx.Exec(ctx, insertRoleQuery, userID, tenantID, role); err != nil {
+				return struct{}{}, fmt.Errorf("failed to execute insert role query: %w", err)
+			}
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// GetRoles returns the roles of a user, read from the primary so that a revoked role is seen at once.
+func (r *PsqlRepository) GetRoles(ctx context.Context, userID uuid.UUID) ([]domain.Role, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) ([]domain.Role, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := tx.Query(ctx, selectRolesQuery, tenantID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute select roles query: %w", err)
+		}
+		roles, err := pgx.CollectRows(rows, pgx.RowTo[domain.Role])
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan roles: %w", err)
+		}
+		return append([]domain.Role{}, roles...), nil
+	})
+}
+
+// SetRoles replaces the roles of a user.
+func (r *SqlliteRepository) SetRoles(ctx context.Context, userID uuid.UUID, roles []domain.Role) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, selectUserExistsQuery2, tenantID, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to query user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+	if _, err := tx.ExecContext(ctx, deleteRolesQuery2, tenantID, userID); err != nil {
+		return fmt.Errorf("failed to delete roles: %w", err)
+	}
+	for _, role := range roles {
+		if _, err := tx.ExecContext(ctx, insertRoleQuery2, userID, tenantID, role); err != nil {
+			return fmt.Errorf("failed to insert role: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetRoles returns the roles of a user.
+func (r *SqlliteRepository) GetRoles(ctx context.Context, userID uuid.UUID) ([]domain.Role, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, selectRolesQuery2, tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	defer rows.Close()
+	roles := make([]domain.Role, 0)
+	for rows.Next() {
+		var role domain.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate roles: %w", err)
+	}
+	return roles, nil
+}
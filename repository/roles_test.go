@@ -0,0 +1,63 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	sqlite := repository.NewSQLLiteRepository(db)
+	require.NoError(t, sqlite.Migrate(testContext(t)))
+
+	stores := map[string]interface {
+		repository.UserRepository
+		repository.RoleStore
+	}{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": sqlite,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := testContext(t)
+			user, err := store.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com"})
+			require.NoError(t, err)
+
+			roles, err := store.GetRoles(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Empty(t, roles)
+			require.ErrorIs(t, store.SetRoles(ctx, uuid.New(), []domain.Role{domain.RoleAdmin}), repository.ErrUserNotFound)
+
+			require.NoError(t, store.SetRoles(ctx, user.ID, []domain.Role{domain.RoleViewer, domain.RoleAdmin, domain.RoleViewer}))
+			roles, err = store.GetRoles(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []domain.Role{domain.RoleAdmin, domain.RoleViewer}, roles)
+
+			require.NoError(t, store.SetRoles(ctx, user.ID, []domain.Role{domain.RoleEditor}))
+			roles, err = store.GetRoles(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, []domain.Role{domain.RoleEditor}, roles)
+
+			other := tenant.WithID(ctx, "other")
+			roles, err = store.GetRoles(other, user.ID)
+			require.NoError(t, err)
+			assert.Empty(t, roles)
+			require.ErrorIs(t, store.SetRoles(other, user.ID, []domain.Role{domain.RoleAdmin}), repository.ErrUserNotFound)
+
+			require.NoError(t, store.DeleteUser(ctx, user.ID))
+			roles, err = store.GetRoles(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Empty(t, roles)
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
+)
+
+const defaultVirtualNodes = 128
+
+// ShardedRepository implements UserRepository on top of several repositories, routing each user by ID
+// with consistent hashing. Lookups by email and listings fan out to every shard.
+// Email uniqueness is checked across shards before inserting, but is not atomic.
+type ShardedRepository struct {
+	virtualNodes int
+
+	mu     sync.RWMutex
+	shards map[string]UserRepository
+	ring   *hashRing
+	// previous is the ring in use before AddShard started. It is kept until every user is moved to the shard
+	// being added, even when a move fails, so that by-ID operations can fall back to it.
+	previous *hashRing
+	// adding is the name of the shard being added, and moving whether its users are being moved.
+	adding string
+	moving bool
+}
+
+// ShardOption configures a ShardedRepository.
+type ShardOption func(*ShardedRepository)
+
+// WithVirtualNodes sets the number of points each shard owns on the hash ring.
+func WithVirtualNodes(n int) ShardOption {
+	return func(r *ShardedRepository) {
+		r.virtualNodes = n
+	}
+}
+
+// NewShardedRepository creates a ShardedRepository over the given shards, keyed by a stable name.
+// Names, not map order, decide placement, so they must not change between restarts.
+func NewShardedRepository(shards map[string]UserRepository, opts ...ShardOption) (*ShardedRepository, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("at least one shard is required")
+	}
+	r := &ShardedRepository{
+		virtualNodes: defaultVirtualNodes,
+		shards:       make(map[string]UserRepository, len(shards)),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	names := make([]string, 0, len(shards))
+	for name, shard := range shards {
+		r.shards[name] = shard
+		names = append(names, name)
+	}
+	r.ring = newHashRing(names, r.virtualNodes)
+	return r, nil
+}
+
+// ShardFor returns the name of the shard owning the given user ID.
+func (r *ShardedRepository) ShardFor(id uuid.UUID) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.ring.owner(id)
+}
+
+// AddUser assigns an ID if needed and stores the user on its shard.
+func (r *ShardedRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	switch _, err := r.GetUserByEmail(ctx, user.Email); {
+	case err == nil:
+		return nil, ErrEmailAlreadyExists
+	case !errors.Is(err, ErrUserNotFound):
+		return nil, err
+	}
+
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	shard, _ := r.route(user.ID)
+	return shard.AddUser(ctx, user)
+}
+
+// GetAllUsers lists every shard concurrently and returns the users ordered by ID.
+func (r *ShardedRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	results, err := fanOut(ctx, r, func(ctx context.Context, shard UserRepository) ([]domain.User, error) {
+		return shard.GetAllUsers(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]domain.User, 0)
+	for _, result := range results {
+		users = append(users, result...)
+	}
+	sortUsersByID(users)
+	// A user being moved by AddShard may briefly exist on two shards.
+	return slices.CompactFunc(users, func(a, b domain.User) bool { return a.ID == b.ID }), nil
+}
+
+// GetUserByID reads the user from its shard, or from its previous shard while it is being moved.
+func (r *ShardedRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return withFallback(r, id, func(shard UserRepository) (*domain.User, error) {
+		return shard.GetUserByID(ctx, id)
+	})
+}
+
+// GetUserByEmail asks every shard concurrently and returns the first match.
+func (r *ShardedRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	results, err := fanOut(ctx, r, func(ctx context.Context, shard UserRepository) (*domain.User, error) {
+		u, err := shard.GetUserByEmail(ctx, email)
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, nil //nolint:nilnil // a miss on one shard is not an error for the fan-out
+		}
+		return u, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range results {
+		if u != nil {
+			return u, nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// UpdateUser updates the user on its shard, or on its previous shard while it is being moved.
+func (r *ShardedRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return withFallback(r, user.ID, func(shard UserRepository) (*domain.User, error) {
+		return shard.UpdateUser(ctx, user)
+	})
+}
+
+// DeleteUser deletes the user from its shard, or from its previous shard while it is being moved.
+func (r *ShardedRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := withFallback(r, id, func(shard UserRepository) (struct{}, error) {
+		return struct{}{}, shard.DeleteUser(ctx, id)
+	})
+	return err
+}
+
+// AddShard adds a shard and moves the users it now owns from the other shards, while the repository keeps serving.
+// During the move, by-ID operations that miss on the new owner are retried on the previous one.
+// It returns the number of users moved. Writes to a user racing with its move may be lost.
+// When the move fails, the fallback stays in place and no other shard can be added until AddShard is called
+// again with the same name, which resumes the move.
+func (r *ShardedRepository) AddShard(ctx context.Context, name string, shard UserRepository) (int, error) {
+	r.mu.Lock()
+	switch {
+	case r.moving || (r.previous != nil && r.adding != name):
+		r.mu.Unlock()
+		return 0, errors.New("a rebalancing is already in progress")
+	case r.previous == nil:
+		if _, exists := r.shards[name]; exists {
+			r.mu.Unlock()
+			return 0, fmt.Errorf("shard %q already exists", name)
+		}
+		r.previous = r.ring
+		r.ring = newHashRing(append(r.ring.names(), name), r.virtualNodes)
+		r.adding = name
+	}
+	r.shards[name] = shard
+	r.moving = true
+	oldShards := make(map[string]UserRepository, len(r.shards)-1)
+	for n, s := range r.shards {
+		if n != name {
+			oldShards[n] = s
+		}
+	}
+	ring := r.ring
+	r.mu.Unlock()
+
+	moved, err := moveUsers(ctx, ring, name, shard, oldShards)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.moving = false
+	if err == nil {
+		r.previous = nil
+		r.adding = ""
+	}
+	return moved, err
+}
+
+// moveUsers moves the users that ring assigns to the named shard from the old shards to it.
+func moveUsers(ctx context.Context, ring *hashRing, name string, shard UserRepository, oldShards map[string]UserRepository) (int, error) {
+	moved := 0
+	for oldName, oldShard := range oldShards {
+		users, err := oldShard.GetAllUsers(ctx)
+		if err != nil {
+			return moved, fmt.Errorf("failed to list users of shard %q: %w", oldName, err)
+		}
+		for _, user := range users {
+			if ring.owner(user.ID) != name {
+				continue
+			}
+			if _, err := upsertUser(ctx, shard, user); err != nil {
+				return moved, fmt.Errorf("failed to copy user %s to shard %q: %w", user.ID, name, err)
+			}
+			if err := oldShard.DeleteUser(ctx, user.ID); err != nil && !errors.Is(err, ErrUserNotFound) {
+				return moved, fmt.Errorf("failed to delete user %s from shard %q: %w", user.ID, oldName, err)
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// route returns the shard owning id and, during a rebalancing, the previous owner if it differs.
+func (r *ShardedRepository) route(id uuid.UUID) (owner, previous UserRepository) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	name := r.ring.owner(id)
+	owner = r.shards[name]
+	if r.previous != nil {
+		if prevName := r.previous.owner(id); prevName != name {
+			previous = r.shards[prevName]
+		}
+	}
+	return owner, previous
+}
+
+func withFallback[T any](r *ShardedRepository, id uuid.UUID, fn func(UserRepository) (T, error)) (T, error) {
+	owner, previous := r.route(id)
+	v, err := fn(owner)
+	if previous != nil && errors.Is(err, ErrUserNotFound) {
+		return fn(previous)
+	}
+	return v, err
+}
+
+// fanOut runs fn on every shard concurrently and returns the results ordered by shard name.
+func fanOut[T any](ctx context.Context, r *ShardedRepository, fn func(context.Context, UserRepository) (T, error)) ([]T, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.shards))
+	for name := range r.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	shards := make([]UserRepository, len(names))
+	for i, name := range names {
+		shards[i] = r.shards[name]
+	}
+	r.mu.RUnlock()
+
+	results := make([]T, len(shards))
+	g, ctx := errgroup.WithContext(ctx)
+	for i, shard := range shards {
+		g.Go(func() error {
+			v, err := fn(ctx, shard)
+			if err != nil {
+				return fmt.Errorf("shard %q: %w", names[i], err)
+			}
+			results[i] = v
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func sortUsersByID(users []domain.User) {
+	slices.SortFunc(users, func(a, b domain.User) int {
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+}
+
+// hashRing is an immutable consistent hash ring with virtual nodes.
+type hashRing struct {
+	points []uint64
+	owners map[uint64]string
+}
+
+func newHashRing(names []string, virtualNodes int) *hashRing {
+	ring := &hashRing{owners: make(map[uint64]string, len(names)*virtualNodes)}
+	for _, name := range names {
+		for i := range virtualNodes {
+			point := hashKey([]byte(name + "#" + strconv.Itoa(i)))
+			// On the unlikely collision keep the smallest name so placement stays deterministic.
+			if owner, taken := ring.owners[point]; taken && owner < name {
+				continue
+			}
+			ring.owners[point] = name
+		}
+	}
+	ring.points = make([]uint64, 0, len(ring.owners))
+	for point := range ring.owners {
+		ring.points = append(ring.points, point)
+	}
+	slices.Sort(ring.points)
+	return ring
+}
+
+func (h *hashRing) owner(id uuid.UUID) string {
+	key := hashKey(id[:])
+	i := sort.Search(len(h.points), func(i int) bool { return h.points[i] >= key })
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.owners[h.points[i]]
+}
+
+func (h *hashRing) names() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range h.owners {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func hashKey(b []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	return h.Sum64()
+}
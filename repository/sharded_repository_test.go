@@ -0,0 +1,205 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupShardedRepository(t *testing.T, names ...string) (*repository.ShardedRepository, map[string]*repository.MemoryRepository) {
+	t.Helper()
+	memories := make(map[string]*repository.MemoryRepository, len(names))
+	shards := make(map[string]repository.UserRepository, len(names))
+	for _, name := range names {
+		memories[name] = repository.NewMemoryRepository()
+		shards[name] = memories[name]
+	}
+	repo, err := repository.NewShardedRepository(shards)
+	require.NoError(t, err)
+	return repo, memories
+}
+
+func addUsers(t *testing.T, repo repository.UserRepository, n int) []domain.User {
+	t.Helper()
+	users := make([]domain.User, 0, n)
+	for i := range n {
+		u, err := repo.AddUser(testContext(t), domain.User{Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i)})
+		require.NoError(t, err)
+		users = append(users, *u)
+	}
+	return users
+}
+
+func TestShardedRepository_RoutesByID(t *testing.T) {
+	ctx := testContext(t)
+	repo, memories := setupShardedRepository(t, "a", "b", "c")
+
+	users := addUsers(t, repo, 60)
+
+	// Every user lives on exactly the shard the ring assigns it to
+	for _, user := range users {
+		owner := repo.ShardFor(user.ID)
+		for name, memory := range memories {
+			_, err := memory.GetUserByID(ctx, user.ID)
+			if name == owner {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, repository.ErrUserNotFound)
+			}
+		}
+	}
+
+	// Users are spread over all shards
+	for name, memory := range memories {
+		stored, err := memory.GetAllUsers(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, stored, "shard %s should own some users", name)
+	}
+}
+
+func TestShardedRepository_FanOut(t *testing.T) {
+	ctx := testContext(t)
+	repo, _ := setupShardedRepository(t, "a", "b", "c")
+	users := addUsers(t, repo, 20)
+
+	all, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, len(users))
+	for i := 1; i < len(all); i++ {
+		assert.Negative(t, bytes.Compare(all[i-1].ID[:], all[i].ID[:]), "users should be ordered by ID")
+	}
+
+	found, err := repo.GetUserByEmail(ctx, users[7].Email)
+	require.NoError(t, err)
+	assert.Equal(t, users[7], *found)
+
+	_, err = repo.GetUserByEmail(ctx, "missing@example.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// Emails stay unique across shards
+	_, err = repo.AddUser(ctx, domain.User{Name: "Duplicate", Email: users[3].Email})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+}
+
+func TestShardedRepository_UpdateAndDelete(t *testing.T) {
+	ctx := testContext(t)
+	repo, _ := setupShardedRepository(t, "a", "b")
+	user := addUsers(t, repo, 1)[0]
+
+	user.Name = "Updated"
+	_, err := repo.UpdateUser(ctx, user)
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Updated", found.Name)
+
+	require.NoError(t, repo.DeleteUser(ctx, user.ID))
+	_, err = repo.GetUserByID(ctx, user.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestShardedRepository_AddShard(t *testing.T) {
+	ctx := testContext(t)
+	repo, memories := setupShardedRepository(t, "a", "b")
+	users := addUsers(t, repo, 100)
+
+	newShard := repository.NewMemoryRepository()
+	moved, err := repo.AddShard(ctx, "c", newShard)
+	require.NoError(t, err)
+
+	stored, err := newShard.GetAllUsers(ctx)
+	require.NoError(t, err)
+	assert.Positive(t, moved)
+	assert.Len(t, stored, moved)
+
+	// Nothing is lost or duplicated and every user is reachable on its new owner
+	all, err := repo.GetAllUsers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, all, len(users))
+	for _, user := range users {
+		found, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+	}
+
+	total := len(stored)
+	for _, memory := range memories {
+		remaining, err := memory.GetAllUsers(ctx)
+		require.NoError(t, err)
+		total += len(remaining)
+	}
+	assert.Equal(t, len(users), total)
+
+	_, err = repo.AddShard(ctx, "c", repository.NewMemoryRepository())
+	assert.Error(t, err)
+}
+
+// failingShard fails to store users once it has stored limit of them.
+type failingShard struct {
+	*repository.MemoryRepository
+	limit int
+}
+
+func (s *failingShard) UpsertUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	if s.limit == 0 {
+		return nil, errors.New("shard unavailable")
+	}
+	s.limit--
+	return s.MemoryRepository.UpsertUser(ctx, user)
+}
+
+func TestShardedRepository_AddShardResumesFailedMove(t *testing.T) {
+	ctx := testContext(t)
+	repo, _ := setupShardedRepository(t, "a", "b")
+	users := addUsers(t, repo, 100)
+
+	newShard := &failingShard{MemoryRepository: repository.NewMemoryRepository(), limit: 3}
+	moved, err := repo.AddShard(ctx, "c", newShard)
+	require.Error(t, err)
+	assert.Equal(t, 3, moved)
+
+	// Users not moved yet are still found on their previous owner
+	for _, user := range users {
+		found, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+	}
+	_, err = repo.AddShard(ctx, "d", repository.NewMemoryRepository())
+	require.Error(t, err, "the failed move must be completed first")
+
+	newShard.limit = -1
+	moved, err = repo.AddShard(ctx, "c", newShard)
+	require.NoError(t, err)
+	assert.Positive(t, moved)
+	for _, user := range users {
+		found, err := repo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, user, *found)
+	}
+	_, err = repo.AddShard(ctx, "c", repository.NewMemoryRepository())
+	require.Error(t, err)
+}
+
+func TestNewShardedRepository_NoShards(t *testing.T) {
+	_, err := repository.NewShardedRepository(nil)
+	assert.Error(t, err)
+}
+
+func TestShardedRepository_StablePlacement(t *testing.T) {
+	first, _ := setupShardedRepository(t, "a", "b", "c")
+	second, _ := setupShardedRepository(t, "c", "b", "a")
+
+	for range 50 {
+		id := uuid.New()
+		assert.Equal(t, first.ShardFor(id), second.ShardFor(id))
+	}
+}
@@ -3,61 +3,287 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
 	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
 )
 
 const (
 	insertUserQuery2 = `
-    INSERT INTO users(id, name, email)
-    VALUES(?, ?, ?)
+    INSERT INTO users(id, tenant_id, name, email, email_index, email_key_id, status)
+    VALUES(?, ?, ?, ?, ?, ?, ?);
+`
+
+	// The upsert only overwrites a user of the same tenant; an ID taken by another tenant affects no row.
+	upsertUserQuery2 = `
+    INSERT INTO users(id, tenant_id, name, email, email_index, email_key_id, status)
+    VALUES(?, ?, ?, ?, ?, ?, ?)
     ON CONFLICT(id) DO UPDATE SET
-      name       = excluded.name,
-      email      = excluded.email;
+      name         = excluded.name,
+      email        = excluded.email,
+      email_index  = excluded.email_index,
+      email_key_id = excluded.email_key_id,
+      status       = excluded.status
+    WHERE users.tenant_id = excluded.tenant_id;
 `
 
 	selectAllUsersQuery2 = `
-    SELECT id, name, email
-      FROM users;
+    SELECT id, name, email, status
+      FROM users
+     WHERE tenant_id = ?;
+`
+
+	selectUsersPageQuery2 = `
+    SELECT id, name, email, status
+      FROM users
+     WHERE tenant_id = ? AND id > ?
+     ORDER BY id
+     LIMIT ?;
+`
+
+	selectUserByIDQuery2 = `
+    SELECT id, name, email, status
+      FROM users
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	// Users without a blind index have a plaintext email, stored before encryption was enabled.
+	selectUserByEmailQuery2 = `
+    SELECT id, name, email, status
+      FROM users
+     WHERE tenant_id = ? AND (email_index = ? OR (email_index IS NULL AND email = ?));
+`
+
+	// Plaintext emails, stored before encryption was enabled, are not covered by the unique blind index.
+	selectPlaintextEmailTakenQuery2 = `
+    SELECT EXISTS (
+      SELECT 1
+        FROM users
+       WHERE tenant_id = ? AND email_index IS NULL AND email = ? AND id <> ?
+    );
+`
+
+	// An empty status keeps the current one.
+	updateUserQuery2 = `
+    UPDATE users
+       SET name         = ?,
+           email        = ?,
+           email_index  = ?,
+           email_key_id = ?,
+           status       = COALESCE(NULLIF(?, ''), status)
+     WHERE tenant_id = ? AND id = ?
+    RETURNING status;
+`
+
+	selectStaleEmailsQuery2 = `
+    SELECT id, email
+      FROM users
+     WHERE tenant_id = ? AND email_key_id IS NOT ?
+     LIMIT ?;
+`
+
+	selectStaleEmailTenantsQuery2 = `
+    SELECT DISTINCT tenant_id
+      FROM users
+     WHERE email_key_id IS NOT ?
+     ORDER BY tenant_id;
+`
+
+	updateEmailQuery2 = `
+    UPDATE users
+       SET email        = ?,
+           email_index  = ?,
+           email_key_id = ?
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	deleteUserQuery2 = `
+    DELETE FROM users
+     WHERE tenant_id = ? AND id = ?;
 `
 )
 
 // SqlliteRepository provides methods for user data operations using SQLite.
 type SqlliteRepository struct {
-	db *sql.DB
+	db             *sql.DB
+	integrityCheck string
+	emails         emailCodec
+}
+
+// SQLiteOption configures optional behavior of a SqlliteRepository.
+type SQLiteOption func(*SqlliteRepository)
+
+// WithQuickCheck makes CheckHealth run PRAGMA quick_check.
+func WithQuickCheck() SQLiteOption {
+	return func(r *SqlliteRepository) {
+		r.integrityCheck = "quick_check"
+	}
+}
+
+// WithIntegrityCheck makes CheckHealth run the slower but exhaustive PRAGMA integrity_check.
+func WithIntegrityCheck() SQLiteOption {
+	return func(r *SqlliteRepository) {
+		r.integrityCheck = "integrity_check"
+	}
+}
+
+// WithSQLiteEmailCipher encrypts the stored emails with cipher.
+func WithSQLiteEmailCipher(cipher EmailCipher) SQLiteOption {
+	return func(r *SqlliteRepository) {
+		r.emails = emailCodec{cipher: cipher}
+	}
 }
 
 // NewSQLLiteRepository creates a new SQLite repository for user data.
-func NewSQLLiteRepository(db *sql.DB) *SqlliteRepository {
-	return &SqlliteRepository{db: db}
+func NewSQLLiteRepository(db *sql.DB, opts ...SQLiteOption) *SqlliteRepository {
+	r := &SqlliteRepository{db: db}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // AddUser adds a new user to the SQLite database and returns the created user.
+// A new ID is generated unless the user already has one; an ID already taken is reported as ErrUserAlreadyExists.
 func (r *SqlliteRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
-	user.ID = uuid.New()
-	_, err := r.db.ExecContext(ctx, insertUserQuery2, user.ID, user.Name, user.Email)
+	return sqliteAddUser(ctx, r.db, r.emails, user)
+}
+
+// UpsertUser stores a user under its ID, replacing the user of the tenant with that ID.
+// An ID held by another tenant is reported as ErrUserNotFound.
+func (r *SqlliteRepository) UpsertUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return sqliteWriteUser(ctx, r.db, r.emails, upsertUserQuery2, user)
+}
+
+// GetAllUsers retrieves all users from the SQLite database.
+func (r *SqlliteRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	return sqliteGetUsers(ctx, r.db, r.emails, selectAllUsersQuery2)
+}
+
+// ListUsers retrieves up to limit users with an ID greater than after, ordered by ID.
+func (r *SqlliteRepository) ListUsers(ctx context.Context, after uuid.UUID, limit int) ([]domain.User, error) {
+	return sqliteGetUsers(ctx, r.db, r.emails, selectUsersPageQuery2, after, limit)
+}
+
+// GetUserByID retrieves the user with the given ID from the SQLite database.
+func (r *SqlliteRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return sqliteGetUser(ctx, r.db, r.emails, selectUserByIDQuery2, id)
+}
+
+// GetUserByEmail retrieves the user with the given email from the SQLite database.
+func (r *SqlliteRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	index, plaintext := r.emails.lookup(email)
+	return sqliteGetUser(ctx, r.db, r.emails, selectUserByEmailQuery2, index, plaintext)
+}
+
+// UpdateUser updates the name and email of an existing user in the SQLite database.
+func (r *SqlliteRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	return sqliteUpdateUser(ctx, r.db, r.emails, user)
+}
+
+// DeleteUser deletes the user with the given ID from the SQLite database.
+func (r *SqlliteRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	return sqliteDeleteUser(ctx, r.db, id)
+}
+
+// sqlQuerier is the part of the API shared by *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func sqliteAddUser(ctx context.Context, q sqlQuerier, emails emailCodec, user domain.User) (*domain.User, error) {
+	return sqliteWriteUser(ctx, q, emails, insertUserQuery2, user)
+}
+
+// sqliteWriteUser stores user with query, the insert or the upsert of a user.
+func sqliteWriteUser(ctx context.Context, q sqlQuerier, emails emailCodec, query string, user domain.User) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == uuid.Nil {
+		user.ID = uuid.New()
+	}
+	if user.Status == "" {
+		user.Status = domain.StatusActive
+	}
+	email, err := emails.encode(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqliteCheckPlaintextEmail(ctx, q, tenantID, user, email); err != nil {
+		return nil, err
+	}
+	res, err := q.ExecContext(ctx, query, user.ID, tenantID, user.Name, email.value, email.index, email.keyID,
+		user.Status)
+	if err := sqliteConstraintError(err); err != nil {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to add user: %w", err)
 	}
+	// No row is affected when the upserted ID belongs to another tenant.
+	if err := checkRowsAffected(res); err != nil {
+		return nil, err
+	}
 	return &user, nil
 }
 
-// GetAllUsers retrieves all users from the SQLite database.
-func (r *SqlliteRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+// sqliteConstraintError returns the error matching the constraint a user write violated, or nil when err is not
+// a constraint violation.
+func sqliteConstraintError(err error) error {
+	if sqliteErr := (sqlite3.Error{}); errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		if sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return ErrUserAlreadyExists
+		}
+		return ErrEmailAlreadyExists
+	}
+	return nil
+}
+
+// sqliteCheckPlaintextEmail returns ErrEmailAlreadyExists when another user of the tenant holds the email of user
+// in plaintext, which the unique blind index does not cover. Once encryption is enabled, plaintext emails are only
+// re-encrypted, never written, so one re-encrypted after the check is caught by the index instead.
+func sqliteCheckPlaintextEmail(ctx context.Context, q sqlQuerier, tenantID string, user domain.User, email storedEmail) error {
+	if email.index == nil {
+		return nil
+	}
+	var taken bool
+	if err := q.QueryRowContext(ctx, selectPlaintextEmailTakenQuery2, tenantID, user.Email, user.ID).Scan(&taken); err != nil {
+		return fmt.Errorf("failed to query plaintext email: %w", err)
+	}
+	if taken {
+		return ErrEmailAlreadyExists
+	}
+	return nil
+}
+
+func sqliteGetUsers(ctx context.Context, q sqlQuerier, emails emailCodec, query string, args ...any) ([]domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
 	// Preallocate users slice with a reasonable capacity (e.g., 10)
 	users := make([]domain.User, 0, 10)
-	rows, err := r.db.QueryContext(ctx, selectAllUsersQuery2)
+	rows, err := q.QueryContext(ctx, query, append([]any{tenantID}, args...)...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query all users: %w", err)
+		return nil, fmt.Errorf("failed to query users: %w", err)
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var user domain.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Status); err != nil {
 			return nil, fmt.Errorf("failed to scan user row: %w", err)
 		}
+		if user.Email, err = emails.decode(user.Email); err != nil {
+			return nil, err
+		}
 		users = append(users, user)
 	}
 	if err := rows.Err(); err != nil {
@@ -65,3 +291,72 @@ func (r *SqlliteRepository) GetAllUsers(ctx context.Context) ([]domain.User, err
 	}
 	return users, nil
 }
+
+func sqliteGetUser(ctx context.Context, q sqlQuerier, emails emailCodec, query string, args ...any) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var user domain.User
+	err = q.QueryRowContext(ctx, query, append([]any{tenantID}, args...)...).Scan(&user.ID, &user.Name, &user.Email, &user.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user: %w", err)
+	}
+	if user.Email, err = emails.decode(user.Email); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func sqliteUpdateUser(ctx context.Context, q sqlQuerier, emails emailCodec, user domain.User) (*domain.User, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	email, err := emails.encode(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqliteCheckPlaintextEmail(ctx, q, tenantID, user, email); err != nil {
+		return nil, err
+	}
+	err = q.QueryRowContext(ctx, updateUserQuery2, user.Name, email.value, email.index, email.keyID, user.Status,
+		tenantID, user.ID).Scan(&user.Status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err := sqliteConstraintError(err); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return &user, nil
+}
+
+func sqliteDeleteUser(ctx context.Context, q sqlQuerier, id uuid.UUID) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := q.ExecContext(ctx, deleteUserQuery2, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	return checkRowsAffected(res)
+}
+
+// checkRowsAffected returns ErrUserNotFound when the statement did not touch any row.
+func checkRowsAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package repository_test
 
 import (
+	"bytes"
 	"database/sql"
+	"slices"
 	"testing"
 
 	"github.com/davidyannick/repository-pattern/domain"
@@ -21,9 +23,15 @@ func setupSQLiteDatabase(t *testing.T) (db *sql.DB, cleanup func()) {
 	// Création du schéma de la base de données
 	schema := `
 		CREATE TABLE IF NOT EXISTS users (
-		  id          TEXT PRIMARY KEY,
-		  name        TEXT NOT NULL,
-		  email       TEXT NOT NULL UNIQUE
+		  id           TEXT PRIMARY KEY,
+		  tenant_id    TEXT NOT NULL,
+		  name         TEXT NOT NULL,
+		  email        TEXT NOT NULL,
+		  email_index  TEXT,
+		  email_key_id TEXT,
+		  status       TEXT NOT NULL DEFAULT 'active',
+		  UNIQUE (tenant_id, email),
+		  UNIQUE (tenant_id, email_index)
 		);`
 	_, err = db.Exec(schema)
 	require.NoError(t, err)
@@ -47,7 +55,7 @@ func setupSQLiteRepository(t *testing.T) (repo repository.SqlliteRepository, cle
 
 func TestSqlLiteRepository_AddUser(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	repo, cleanup := setupSQLiteRepository(t)
 	defer cleanup()
 
@@ -84,7 +92,7 @@ func TestSqlLiteRepository_AddUser(t *testing.T) {
 
 func TestSqlLiteRepository_GetAllUsers(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	repo, cleanup := setupSQLiteRepository(t)
 	defer cleanup()
 
@@ -120,7 +128,7 @@ func TestSqlLiteRepository_GetAllUsers(t *testing.T) {
 
 func TestSqlLiteRepository_GetAllUsers_Error(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	repo, cleanup := setupSQLiteRepository(t)
 
 	// Force an error by closing the database connection before calling GetAllUsers
@@ -136,7 +144,7 @@ func TestSqlLiteRepository_GetAllUsers_Error(t *testing.T) {
 
 func TestSqlLiteRepository_AddUser_Error(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	repo, cleanup := setupSQLiteRepository(t)
 
 	// Test data
@@ -158,7 +166,7 @@ func TestSqlLiteRepository_AddUser_Error(t *testing.T) {
 
 func TestSqlLiteRepository_Integration(t *testing.T) {
 	// Setup
-	ctx := t.Context()
+	ctx := testContext(t)
 	repo, cleanup := setupSQLiteRepository(t)
 	defer cleanup()
 
@@ -210,3 +218,101 @@ func TestSqlLiteRepository_Integration(t *testing.T) {
 	}
 	assert.True(t, found, "L'utilisateur ajouté devrait être trouvé dans la base de données")
 }
+
+func TestSqlLiteRepository_CheckHealth(t *testing.T) {
+	// Setup
+	ctx := testContext(t)
+	db, cleanup := setupSQLiteDatabase(t)
+	defer cleanup()
+
+	repo := repository.NewSQLLiteRepository(db, repository.WithQuickCheck())
+
+	// Execute
+	details, err := repo.CheckHealth(ctx)
+
+	// Verify
+	require.NoError(t, err)
+	assert.Equal(t, "ok", details["quick_check"])
+
+	// A closed database is reported as unhealthy
+	cleanup()
+	_, err = repo.CheckHealth(ctx)
+	assert.Error(t, err)
+}
+
+func TestSqlLiteRepository_GetUser(t *testing.T) {
+	// Setup
+	ctx := testContext(t)
+	repo, cleanup := setupSQLiteRepository(t)
+	defer cleanup()
+
+	added, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	// Exécution et vérification
+	byID, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, *added, *byID)
+
+	byEmail, err := repo.GetUserByEmail(ctx, added.Email)
+	require.NoError(t, err)
+	assert.Equal(t, *added, *byEmail)
+
+	_, err = repo.GetUserByID(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	_, err = repo.GetUserByEmail(ctx, "missing@example.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestSqlLiteRepository_UpdateAndDeleteUser(t *testing.T) {
+	// Setup
+	ctx := testContext(t)
+	repo, cleanup := setupSQLiteRepository(t)
+	defer cleanup()
+
+	added, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	// Mise à jour
+	added.Name = "Updated User"
+	added.Email = "updated@example.com"
+	_, err = repo.UpdateUser(ctx, *added)
+	require.NoError(t, err)
+
+	found, err := repo.GetUserByID(ctx, added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, *added, *found)
+
+	_, err = repo.UpdateUser(ctx, domain.User{ID: uuid.New(), Name: "Nobody", Email: "nobody@example.com"})
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// Suppression
+	require.NoError(t, repo.DeleteUser(ctx, added.ID))
+	_, err = repo.GetUserByID(ctx, added.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	require.ErrorIs(t, repo.DeleteUser(ctx, added.ID), repository.ErrUserNotFound)
+}
+
+func TestSqlLiteRepository_ListUsers(t *testing.T) {
+	ctx := testContext(t)
+	repo, cleanup := setupSQLiteRepository(t)
+	defer cleanup()
+	users := addUsers(t, &repo, 7)
+	slices.SortFunc(users, func(a, b domain.User) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+
+	// Pages follow the byte order of the IDs, as MemoryRepository does
+	var listed []domain.User
+	after := uuid.Nil
+	for {
+		page, err := repo.ListUsers(ctx, after, 3)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+		assert.LessOrEqual(t, len(page), 3)
+		listed = append(listed, page...)
+		after = page[len(page)-1].ID
+	}
+	assert.Equal(t, users, listed)
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	// sqliteDriverName is the go-sqlite3 driver used by Open, with hooks waking up the in-process watchers.
+	sqliteDriverName = "sqlite3_repository"
+
+	selectMaxChangeSeqQuery = `SELECT COALESCE(MAX(seq), 0) FROM user_changes;`
+
+	selectChangesQuery = `
+    SELECT seq, op, tenant_id, id, name, email, status
+      FROM user_changes
+     WHERE seq > ?
+     ORDER BY seq
+     LIMIT 100;
+`
+)
+
+func init() {
+	sql.Register(sqliteDriverName, &sqlite3.SQLiteDriver{ConnectHook: registerChangeHooks})
+}
+
+// sqliteWakers holds one channel per running SQLite watcher, signaled when a transaction writing user_changes commits.
+var sqliteWakers = struct {
+	sync.Mutex
+	chans map[chan struct{}]struct{}
+}{chans: make(map[chan struct{}]struct{})}
+
+// registerChangeHooks installs the update, commit and rollback hooks on a new connection.
+// The update hook only sees a rowid, so the changes themselves are read from user_changes, filled by triggers.
+func registerChangeHooks(conn *sqlite3.SQLiteConn) error {
+	changed := false
+	conn.RegisterUpdateHook(func(op int, _, table string, _ int64) {
+		if op == sqlite3.SQLITE_INSERT && table == "user_changes" {
+			changed = true
+		}
+	})
+	conn.RegisterCommitHook(func() int {
+		if changed {
+			changed = false
+			wakeSQLiteWatchers()
+		}
+		return 0
+	})
+	conn.RegisterRollbackHook(func() {
+		changed = false
+	})
+	return nil
+}
+
+func wakeSQLiteWatchers() {
+	sqliteWakers.Lock()
+	defer sqliteWakers.Unlock()
+	for ch := range sqliteWakers.chans {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Watch streams the changes recorded in user_changes by the triggers created by Migrate.
+// Commits made through Open in this process wake the watcher up immediately; other writers,
+// such as another process, are picked up by polling every second. When the changes following
+// the last one read have already been pruned from user_changes, a ChangeGap is emitted.
+func (r *SqlliteRepository) Watch(ctx context.Context) <-chan UserChange {
+	ch := make(chan UserChange, watchBufferSize)
+	wake := make(chan struct{}, 1)
+
+	sqliteWakers.Lock()
+	sqliteWakers.chans[wake] = struct{}{}
+	sqliteWakers.Unlock()
+
+	var last int64
+	err := r.db.QueryRowContext(ctx, selectMaxChangeSeqQuery).Scan(&last)
+
+	go func() {
+		defer func() {
+			sqliteWakers.Lock()
+			delete(sqliteWakers.chans, wake)
+			sqliteWakers.Unlock()
+			close(ch)
+		}()
+
+		missed := err != nil
+		for {
+			if !missed {
+				var ok bool
+				if last, ok = r.forwardChanges(ctx, last, ch); !ok {
+					return
+				}
+			} else if r.db.QueryRowContext(ctx, selectMaxChangeSeqQuery).Scan(&last) == nil {
+				// Restart from the current position; whatever happened before is reported as a gap.
+				missed = false
+				if !sendChange(ctx, ch, UserChange{Op: ChangeGap}) {
+					return
+				}
+			}
+
+			timer := time.NewTimer(sqliteWatchInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-wake:
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+	}()
+	return ch
+}
+
+// forwardChanges sends the changes recorded after last and returns the new position.
+// It returns false once ctx is done.
+func (r *SqlliteRepository) forwardChanges(ctx context.Context, last int64, ch chan<- UserChange) (int64, bool) {
+	for {
+		changes, seqs, err := r.readChanges(ctx, last)
+		if err != nil {
+			// Retried on the next wake up or poll.
+			return last, ctx.Err() == nil
+		}
+		if len(changes) == 0 {
+			return last, true
+		}
+		if seqs[0] != last+1 && !sendChange(ctx, ch, UserChange{Op: ChangeGap}) {
+			return last, false
+		}
+		for i, change := range changes {
+			if !sendChange(ctx, ch, change) {
+				return last, false
+			}
+			last = seqs[i]
+		}
+	}
+}
+
+func (r *SqlliteRepository) readChanges(ctx context.Context, last int64) ([]UserChange, []int64, error) {
+	rows, err := r.db.QueryContext(ctx, selectChangesQuery, last)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query user changes: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		changes []UserChange
+		seqs    []int64
+	)
+	for rows.Next() {
+		var (
+			change UserChange
+			seq    int64
+		)
+		if err := rows.Scan(&seq, &change.Op, &change.TenantID, &change.User.ID, &change.User.Name, &change.User.Email,
+			&change.User.Status); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan user change: %w", err)
+		}
+		var err error
+		if change.User.Email, err = r.emails.decode(change.User.Email); err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, change)
+		seqs = append(seqs, seq)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return changes, seqs, nil
+}
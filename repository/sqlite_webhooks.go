@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+)
+
+const (
+	insertSubscriptionQuery2 = `
+    INSERT INTO webhook_subscriptions(id, tenant_id, url, secret, event_types, created_at)
+    VALUES(?, ?, ?, ?, ?, ?);
+`
+
+	selectSubscriptionQuery2 = `
+    SELECT ` + subscriptionColumns + `
+      FROM webhook_subscriptions
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	selectSubscriptionsQuery2 = `
+    SELECT ` + subscriptionColumns + `
+      FROM webhook_subscriptions
+     WHERE tenant_id = ?
+     ORDER BY created_at, id;
+`
+
+	deleteSubscriptionQuery2 = `
+    DELETE FROM webhook_subscriptions
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	deleteSubscriptionDeliveriesQuery2 = `
+    DELETE FROM webhook_deliveries
+     WHERE tenant_id = ? AND subscription_id = ?;
+`
+
+	insertDeliveryQuery2 = `
+    INSERT INTO webhook_deliveries(id, tenant_id, subscription_id, event_id, event_type, payload, status, attempts,
+                                   last_error, response_code, next_attempt_at, created_at, updated_at)
+    VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    ON CONFLICT(subscription_id, event_id) DO NOTHING;
+`
+
+	selectDueDeliveriesQuery2 = `
+    SELECT ` + deliveryColumns + `
+      FROM webhook_deliveries
+     WHERE status = 'pending' AND next_attempt_at <= ?
+     ORDER BY next_attempt_at
+     LIMIT ?;
+`
+
+	selectDeliveryQuery2 = `
+    SELECT ` + deliveryColumns + `
+      FROM webhook_deliveries
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	selectDeliveriesQuery2 = `
+    SELECT ` + deliveryColumns + `
+      FROM webhook_deliveries
+     WHERE tenant_id = ?1
+       AND (?2 = '00000000-0000-0000-0000-000000000000' OR subscription_id = ?2)
+       AND (?3 = '' OR status = ?3)
+     ORDER BY created_at DESC
+     LIMIT ?4;
+`
+
+	updateDeliveryQuery2 = `
+    UPDATE webhook_deliveries
+       SET status = ?, attempts = ?, last_error = ?, response_code = ?, next_attempt_at = ?, updated_at = ?
+     WHERE id = ?;
+`
+)
+
+// AddSubscription stores a webhook subscription for the tenant of ctx, generating its ID if needed.
+func (r *SqlliteRepository) AddSubscription(ctx context.Context, sub domain.WebhookSubscription) (*domain.WebhookSubscription, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sub.TenantID = tenantID
+	if sub.ID == uuid.Nil {
+		sub.ID = uuid.New()
+	}
+	eventTypes, err := json.Marshal(sub.EventTypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event types: %w", err)
+	}
+	if _, err := r.db.ExecContext(ctx, insertSubscriptionQuery2, sub.ID, sub.TenantID, sub.URL, sub.Secret, string(eventTypes), sub.CreatedAt.UTC()); err != nil {
+		return nil, fmt.Errorf("failed to add subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// GetSubscription returns the webhook subscription of the tenant of ctx with the given ID.
+func (r *SqlliteRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.WebhookSubscription, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := scanSQLiteSubscription(r.db.QueryRowContext(ctx, selectSubscriptionQuery2, tenantID, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ListSubscriptions returns the webhook subscriptions of the tenant of ctx in creation order.
+func (r *SqlliteRepository) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.QueryContext(ctx, selectSubscriptionsQuery2, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := make([]domain.WebhookSubscription, 0)
+	for rows.Next() {
+		sub, err := scanSQLiteSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes a webhook subscription and its deliveries.
+// The deliveries are deleted explicitly since SQLite only enforces foreign keys when the connection enables them.
+func (r *SqlliteRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op once committed
+
+	if _, err := tx.ExecContext(ctx, deleteSubscriptionDeliveriesQuery2, tenantID, id); err != nil {
+		return fmt.Errorf("failed to delete deliveries: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, deleteSubscriptionQuery2, tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	} else if n == 0 {
+		return ErrSubscriptionNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// EnqueueDelivery stores a delivery unless the event was already queued for the subscription.
+func (r *SqlliteRepository) EnqueueDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	payload, err := r.emails.sealPayload(d.Payload)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, insertDeliveryQuery2, d.ID, d.TenantID, d.SubscriptionID, d.EventID, d.EventType, string(payload),
+		d.Status, d.Attempts, d.LastError, d.ResponseCode, d.NextAttemptAt.UTC(), d.CreatedAt.UTC(), d.UpdatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to enqueue delivery: %w", err)
+	}
+	return nil
+}
+
+// DueDeliveries returns the pending deliveries due at now.
+func (r *SqlliteRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	return r.queryDeliveries(ctx, selectDueDeliveriesQuery2, now.UTC(), limit)
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt.
+func (r *SqlliteRepository) UpdateDelivery(ctx context.Context, d domain.WebhookDelivery) error {
+	res, err := r.db.ExecContext(ctx, updateDeliveryQuery2, d.Status, d.Attempts, d.LastError, d.ResponseCode,
+		d.NextAttemptAt.UTC(), d.UpdatedAt.UTC(), d.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	if err := checkRowsAffected(res); err != nil {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// GetDelivery returns the webhook delivery of the tenant of ctx with the given ID.
+func (r *SqlliteRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	d, err := scanDelivery(r.db.QueryRowContext(ctx, selectDeliveryQuery2, tenantID, id), r.emails)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDeliveries returns the deliveries of the tenant of ctx matching filter, most recent first.
+func (r *SqlliteRepository) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]domain.WebhookDelivery, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return r.queryDeliveries(ctx, selectDeliveriesQuery2, tenantID, filter.SubscriptionID, string(filter.Status), filter.limit())
+}
+
+func (r *SqlliteRepository) queryDeliveries(ctx context.Context, query string, args ...any) ([]domain.WebhookDelivery, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows, r.emails)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+	return deliveries, nil
+}
+
+func scanSQLiteSubscription(row rowScanner) (*domain.WebhookSubscription, error) {
+	var (
+		sub        domain.WebhookSubscription
+		eventTypes string
+	)
+	if err := row.Scan(&sub.ID, &sub.TenantID, &sub.URL, &sub.Secret, &eventTypes, &sub.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan subscription row: %w", err)
+	}
+	if err := json.Unmarshal([]byte(eventTypes), &sub.EventTypes); err != nil {
+		return nil, fmt.Errorf("failed to decode event types: %w", err)
+	}
+	sub.CreatedAt = sub.CreatedAt.UTC()
+	return &sub, nil
+}
@@ -0,0 +1,199 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+// testContext returns the test context scoped to a test tenant.
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	return tenant.WithID(t.Context(), "test")
+}
+
+// testTenantIsolation checks that tenants neither see nor modify each other's users,
+// that emails are only unique within a tenant and that calls without a tenant fail.
+func testTenantIsolation(t *testing.T, repo repository.UserRepository) {
+	t.Helper()
+	acme := tenant.WithID(t.Context(), "acme")
+	globex := tenant.WithID(t.Context(), "globex")
+
+	alice, err := repo.AddUser(acme, domain.User{Name: "Alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+	other, err := repo.AddUser(globex, domain.User{Name: "Other Alice", Email: "alice@example.com"})
+	require.NoError(t, err)
+
+	users, err := repo.GetAllUsers(acme)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.User{*alice}, users)
+
+	got, err := repo.GetUserByEmail(globex, "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, other, got)
+
+	_, err = repo.GetUserByID(globex, alice.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = repo.UpdateUser(globex, domain.User{ID: alice.ID, Name: "Taken", Email: "taken@example.com"})
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	require.ErrorIs(t, repo.DeleteUser(globex, alice.ID), repository.ErrUserNotFound)
+	// Neither an insert nor an upsert can take over the ID of another tenant's user.
+	_, err = repo.AddUser(globex, domain.User{ID: alice.ID, Name: "Taken", Email: "taken@example.com"})
+	require.ErrorIs(t, err, repository.ErrUserAlreadyExists)
+	if upserter, ok := repo.(repository.UserUpserter); ok {
+		_, err = upserter.UpsertUser(globex, domain.User{ID: alice.ID, Name: "Taken", Email: "taken@example.com"})
+		require.ErrorIs(t, err, repository.ErrUserNotFound)
+	}
+	// Nor can an insert replace a user of the same tenant, unlike an upsert.
+	_, err = repo.AddUser(acme, domain.User{ID: alice.ID, Name: "Taken", Email: "taken@example.com"})
+	require.ErrorIs(t, err, repository.ErrUserAlreadyExists)
+	if upserter, ok := repo.(repository.UserUpserter); ok {
+		renamed := *alice
+		renamed.Name = "Alice Smith"
+		alice, err = upserter.UpsertUser(acme, renamed)
+		require.NoError(t, err)
+	}
+
+	got, err = repo.GetUserByID(acme, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, alice, got)
+
+	// Updates keep emails unique within the tenant.
+	bob, err := repo.AddUser(acme, domain.User{Name: "Bob", Email: "bob@example.com"})
+	require.NoError(t, err)
+	_, err = repo.UpdateUser(acme, domain.User{ID: bob.ID, Name: "Bob", Email: "alice@example.com", Status: bob.Status})
+	require.ErrorIs(t, err, repository.ErrEmailAlreadyExists)
+	got, err = repo.GetUserByID(acme, bob.ID)
+	require.NoError(t, err)
+	assert.Equal(t, bob, got)
+
+	_, err = repo.GetAllUsers(t.Context())
+	require.ErrorIs(t, err, tenant.ErrNoTenant)
+	_, err = repo.AddUser(t.Context(), domain.User{Name: "Nobody", Email: "nobody@example.com"})
+	require.ErrorIs(t, err, tenant.ErrNoTenant)
+}
+
+func TestMemoryRepository_TenantIsolation(t *testing.T) {
+	testTenantIsolation(t, repository.NewMemoryRepository())
+}
+
+func TestSqlLiteRepository_TenantIsolation(t *testing.T) {
+	testTenantIsolation(t, setupSQLiteOutbox(t))
+}
+
+func TestCachingRepository_TenantIsolation(t *testing.T) {
+	testTenantIsolation(t, repository.NewCachingRepository(repository.NewMemoryRepository()))
+}
+
+func TestPsqlRepository_TenantIsolation(t *testing.T) {
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	repo, repoCleanup := setupRepository(t, container)
+	defer repoCleanup()
+
+	testTenantIsolation(t, &repo)
+}
+
+func TestSqlLiteRepository_MigrateLegacyUsers(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+		CREATE TABLE users (id TEXT PRIMARY KEY, name TEXT NOT NULL, email TEXT NOT NULL UNIQUE);
+		CREATE TABLE outbox (
+		  seq INTEGER PRIMARY KEY AUTOINCREMENT, id TEXT NOT NULL UNIQUE, type TEXT NOT NULL, user_id TEXT NOT NULL,
+		  payload TEXT NOT NULL, occurred_at TIMESTAMP NOT NULL, delivered_at TIMESTAMP
+		);
+		INSERT INTO users(id, name, email) VALUES('6f1c1e4e-8b3b-4c59-9a57-5b8f3b1f7a10', 'Legacy', 'legacy@example.com');`)
+	require.NoError(t, err)
+
+	repo := repository.NewSQLLiteRepository(db)
+	require.NoError(t, repo.Migrate(t.Context()))
+	// Migrating again is a no-op.
+	require.NoError(t, repo.Migrate(t.Context()))
+
+	users, err := repo.GetAllUsers(tenant.WithID(t.Context(), tenant.Default))
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "legacy@example.com", users[0].Email)
+
+	testOutbox(t, repo)
+}
+
+// setupAppPool connects to the container as app_user, the regular role created by init.sql.
+// The container user is a superuser, which row-level security does not apply to.
+func setupAppPool(t *testing.T, container *postgres.PostgresContainer) *pgxpool.Pool {
+	t.Helper()
+	connString, err := container.ConnectionString(t.Context(), "sslmode=disable")
+	require.NoError(t, err)
+	u, err := url.Parse(connString)
+	require.NoError(t, err)
+	u.User = url.UserPassword("app_user", "app_user")
+
+	pool, err := pgxpool.New(t.Context(), u.String())
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// countUsers counts the users visible with app.tenant_id set to tenantID, without filtering on the tenant.
+func countUsers(t *testing.T, pool *pgxpool.Pool, tenantID string) int {
+	t.Helper()
+	var n int
+	err := pgx.BeginFunc(t.Context(), pool, func(tx pgx.Tx) error {
+		if tenantID != "" {
+			if _, err := tx.Exec(t.Context(), `SELECT set_config('app.tenant_id', $1, true)`, tenantID); err != nil {
+				return err
+			}
+		}
+		return tx.QueryRow(t.Context(), `SELECT COUNT(*) FROM users`).Scan(&n)
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestPsqlRepository_RowLevelSecurity(t *testing.T) {
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	pool := setupAppPool(t, container)
+	repo := repository.NewPsqlRepository(pool)
+	testTenantIsolation(t, repo)
+
+	acme := tenant.WithID(t.Context(), "acme")
+	for range 2 {
+		_, err := repo.AddUser(acme, domain.User{Name: "Acme User", Email: uuid.NewString() + "@acme.example.com"})
+		require.NoError(t, err)
+	}
+
+	// A query without any tenant filter only sees the rows of the transaction tenant.
+	assert.Equal(t, 3, countUsers(t, pool, "acme"))
+	assert.Equal(t, 1, countUsers(t, pool, "globex"))
+	assert.Equal(t, 0, countUsers(t, pool, "initech"))
+	assert.Equal(t, 0, countUsers(t, pool, ""))
+
+	// Rows cannot be written into another tenant either.
+	err := pgx.BeginFunc(t.Context(), pool, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(t.Context(), `SELECT set_config('app.tenant_id', 'globex', true)`); err != nil {
+			return err
+		}
+		_, err := tx.Exec(t.Context(), `INSERT INTO users (id, tenant_id, name, email) VALUES ($1, 'acme', 'Intruder', 'intruder@example.com')`, uuid.New())
+		return err
+	})
+	require.Error(t, err)
+	assert.Equal(t, 3, countUsers(t, pool, "acme"))
+}
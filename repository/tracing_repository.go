@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/davidyannick/repository-pattern/repository"
+
+// Attribute keys used on repository spans.
+const (
+	attrDBSystem    = attribute.Key("db.system")
+	attrDBOperation = attribute.Key("db.operation")
+	attrDBStatement = attribute.Key("db.statement")
+	attrDBRows      = attribute.Key("db.rows")
+)
+
+// TracingRepository is a UserRepository decorator that wraps every call in an OpenTelemetry span.
+type TracingRepository struct {
+	next   UserRepository
+	system string
+	tracer trace.Tracer
+}
+
+// TracingOption configures a TracingRepository.
+type TracingOption func(*tracingConfig)
+
+type tracingConfig struct {
+	provider trace.TracerProvider
+}
+
+// WithTracerProvider sets the provider used to create spans instead of the global one.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(c *tracingConfig) {
+		c.provider = provider
+	}
+}
+
+// NewTracingRepository wraps next so that every call creates a span tagged with the given db.system (e.g. "postgresql").
+func NewTracingRepository(next UserRepository, system string, opts ...TracingOption) *TracingRepository {
+	cfg := tracingConfig{provider: otel.GetTracerProvider()}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &TracingRepository{
+		next:   next,
+		system: system,
+		tracer: cfg.provider.Tracer(tracerName),
+	}
+}
+
+// AddUser traces and delegates to the wrapped repository.
+func (r *TracingRepository) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	ctx, span := r.start(ctx, "AddUser", "INSERT")
+	defer span.End()
+
+	u, err := r.next.AddUser(ctx, user)
+	endSpan(span, 1, err)
+	return u, err
+}
+
+// GetAllUsers traces and delegates to the wrapped repository.
+func (r *TracingRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	ctx, span := r.start(ctx, "GetAllUsers", "SELECT")
+	defer span.End()
+
+	users, err := r.next.GetAllUsers(ctx)
+	endSpan(span, len(users), err)
+	return users, err
+}
+
+// GetUserByID traces and delegates to the wrapped repository.
+func (r *TracingRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	ctx, span := r.start(ctx, "GetUserByID", "SELECT")
+	defer span.End()
+
+	u, err := r.next.GetUserByID(ctx, id)
+	endSpan(span, 1, err)
+	return u, err
+}
+
+// GetUserByEmail traces and delegates to the wrapped repository.
+func (r *TracingRepository) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	ctx, span := r.start(ctx, "GetUserByEmail", "SELECT")
+	defer span.End()
+
+	u, err := r.next.GetUserByEmail(ctx, email)
+	endSpan(span, 1, err)
+	return u, err
+}
+
+// UpdateUser traces and delegates to the wrapped repository.
+func (r *TracingRepository) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	ctx, span := r.start(ctx, "UpdateUser", "UPDATE")
+	defer span.End()
+
+	u, err := r.next.UpdateUser(ctx, user)
+	endSpan(span, 1, err)
+	return u, err
+}
+
+// DeleteUser traces and delegates to the wrapped repository.
+func (r *TracingRepository) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	ctx, span := r.start(ctx, "DeleteUser", "DELETE")
+	defer span.End()
+
+	err := r.next.DeleteUser(ctx, id)
+	endSpan(span, 1, err)
+	return err
+}
+
+func (r *TracingRepository) start(ctx context.Context, method, operation string) (context.Context, trace.Span) {
+	return r.tracer.Start(ctx, "UserRepository."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attrDBSystem.String(r.system),
+			attrDBOperation.String(operation),
+		),
+	)
+}
+
+func endSpan(span trace.Span, rows int, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attrDBRows.Int(rows))
+}
+
+var (
+	stringLiteral  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numericLiteral = regexp.MustCompile(`\$?\b\d+(?:\.\d+)?\b`)
+)
+
+// SanitizeStatement collapses whitespace and replaces string and numeric literals with '?'
+// so that statements can be attached to spans without leaking data.
+func SanitizeStatement(statement string) string {
+	statement = strings.Join(strings.Fields(statement), " ")
+	statement = stringLiteral.ReplaceAllString(statement, "?")
+	return numericLiteral.ReplaceAllStringFunc(statement, func(s string) string {
+		// Keep positional placeholders such as $1
+		if strings.HasPrefix(s, "$") {
+			return s
+		}
+		return "?"
+	})
+}
+
+// statementOperation returns the first keyword of a statement, e.g. SELECT or INSERT.
+func statementOperation(statement string) string {
+	fields := strings.Fields(statement)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,98 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracerProvider(t *testing.T) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	return provider, exporter
+}
+
+func spanAttributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(span.Attributes))
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingRepository_AddUser(t *testing.T) {
+	ctx := testContext(t)
+	provider, exporter := newTestTracerProvider(t)
+	repo := repository.NewTracingRepository(repository.NewMemoryRepository(), "memory", repository.WithTracerProvider(provider))
+
+	_, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "UserRepository.AddUser", spans[0].Name)
+
+	attrs := spanAttributes(spans[0])
+	assert.Equal(t, "memory", attrs["db.system"].AsString())
+	assert.Equal(t, "INSERT", attrs["db.operation"].AsString())
+	assert.Equal(t, int64(1), attrs["db.rows"].AsInt64())
+}
+
+func TestTracingRepository_Error(t *testing.T) {
+	provider, exporter := newTestTracerProvider(t)
+	repo := repository.NewTracingRepository(repository.NewMemoryRepository(), "memory", repository.WithTracerProvider(provider))
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	cancel()
+	_, err := repo.GetAllUsers(ctx)
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.NotEmpty(t, spans[0].Events, "the error should be recorded as a span event")
+}
+
+func TestPgxTracer(t *testing.T) {
+	ctx := testContext(t)
+	provider, exporter := newTestTracerProvider(t)
+	tracer := repository.NewPgxTracer(provider)
+
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "SELECT id FROM users WHERE name = 'John' AND age > 42 AND id = $1"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 3")})
+
+	ctx = tracer.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{SQL: "DELETE FROM users"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	attrs := spanAttributes(spans[0])
+	assert.Equal(t, "pgx.SELECT", spans[0].Name)
+	assert.Equal(t, "postgresql", attrs["db.system"].AsString())
+	assert.Equal(t, "SELECT id FROM users WHERE name = ? AND age > ? AND id = $1", attrs["db.statement"].AsString())
+	assert.Equal(t, int64(3), attrs["db.rows"].AsInt64())
+
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+}
+
+func TestSanitizeStatement(t *testing.T) {
+	statement := `
+    INSERT INTO users (id, name, email)
+    VALUES ('it''s', 12.5, $3)`
+
+	assert.Equal(t, "INSERT INTO users (id, name, email) VALUES (?, ?, $3)", repository.SanitizeStatement(statement))
+}
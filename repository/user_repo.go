@@ -1,13 +1,71 @@
 package repository
 
 import (
+	"bytes"
 	"context"
+	"errors"
 
 	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
 )
 
 // UserRepository defines the methods for user data persistence.
+// AddUser only creates users: it generates an ID unless the user has one, and returns ErrUserAlreadyExists
+// when the ID is taken. Users are added as active unless they have a status, and UpdateUser keeps the status
+// of a user given none.
 type UserRepository interface {
 	AddUser(ctx context.Context, user domain.User) (*domain.User, error)
 	GetAllUsers(ctx context.Context) ([]domain.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	UpdateUser(ctx context.Context, user domain.User) (*domain.User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+// UserUpserter is implemented by repositories able to store a user under its ID, replacing the user of the tenant
+// with that ID. It is meant for copying users between repositories, as when moving them between shards or
+// backfilling a new backend, not for creating them. An ID held by another tenant is reported as ErrUserNotFound.
+type UserUpserter interface {
+	UpsertUser(ctx context.Context, user domain.User) (*domain.User, error)
+}
+
+// upsertUser stores user in repo under its ID, with UpsertUser when repo implements it, or else by adding it and
+// updating it when it already exists.
+func upsertUser(ctx context.Context, repo UserRepository, user domain.User) (*domain.User, error) {
+	if upserter, ok := repo.(UserUpserter); ok {
+		return upserter.UpsertUser(ctx, user)
+	}
+	u, err := repo.AddUser(ctx, user)
+	if errors.Is(err, ErrUserAlreadyExists) {
+		return repo.UpdateUser(ctx, user)
+	}
+	return u, err
+}
+
+// UserPager is implemented by repositories able to list users a page at a time, for walking large tables.
+type UserPager interface {
+	// ListUsers returns up to limit users with an ID greater than after, ordered by ID.
+	ListUsers(ctx context.Context, after uuid.UUID, limit int) ([]domain.User, error)
+}
+
+// listUsers returns a page of users of repo with ListUsers when repo implements it, or else by listing them all.
+func listUsers(ctx context.Context, repo UserRepository, after uuid.UUID, limit int) ([]domain.User, error) {
+	if pager, ok := repo.(UserPager); ok {
+		return pager.ListUsers(ctx, after, limit)
+	}
+	users, err := repo.GetAllUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return usersAfter(users, after, limit), nil
+}
+
+// usersAfter returns up to limit users of users with an ID greater than after, ordered by ID.
+func usersAfter(users []domain.User, after uuid.UUID, limit int) []domain.User {
+	sortUsersByID(users)
+	i := 0
+	for i < len(users) && bytes.Compare(users[i].ID[:], after[:]) <= 0 {
+		i++
+	}
+	return users[i:min(i+limit, len(users))]
 }
@@ -0,0 +1,306 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// insertVerificationTokenQuery only stores tokens of existing users of the tenant.
+	insertVerificationTokenQuery = `
+    INSERT INTO verification_tokens (id, tenant_id, user_id, token_hash, expires_at, created_at)
+    SELECT $3, tenant_id, id, $4, $5, $6 FROM users WHERE tenant_id = $1 AND id = $2
+    `
+
+	selectVerificationTokenQuery = `
+    SELECT id, user_id, token_hash, expires_at, created_at, used_at
+      FROM verification_tokens
+     WHERE tenant_id = $1 AND id = $2
+    `
+
+	useVerificationTokenQuery = `
+    UPDATE verification_tokens SET used_at = $3 WHERE tenant_id = $1 AND id = $2 AND used_at IS NULL
+    `
+
+	useUserVerificationTokensQuery = `
+    UPDATE verification_tokens SET used_at = $3 WHERE tenant_id = $1 AND user_id = $2 AND used_at IS NULL
+    `
+
+	insertVerificationTokenQuery2 = `
+    INSERT INTO verification_tokens(id, tenant_id, user_id, token_hash, expires_at, created_at)
+    SELECT ?, tenant_id, id, ?, ?, ? FROM users WHERE tenant_id = ? AND id = ?;
+`
+
+	selectVerificationTokenQuery2 = `
+    SELECT id, user_id, token_hash, expires_at, created_at, used_at
+      FROM verification_tokens
+     WHERE tenant_id = ? AND id = ?;
+`
+
+	useVerificationTokenQuery2 = `
+    UPDATE verification_tokens
+       SET used_at = ?
+     WHERE tenant_id = ? AND id = ? AND used_at IS NULL;
+`
+
+	useUserVerificationTokensQuery2 = `
+    UPDATE verification_tokens
+       SET used_at = ?
+     WHERE tenant_id = ? AND user_id = ? AND used_at IS NULL;
+`
+)
+
+// VerificationTokenStore is implemented by repositories persisting email verification tokens. Tokens are
+// deleted along with their user.
+type VerificationTokenStore interface {
+	// AddVerificationToken stores a new token, or returns ErrUserNotFound.
+	AddVerificationToken(ctx context.Context, token domain.VerificationToken) error
+	// GetVerificationToken returns a token, used or not, or ErrVerificationTokenNotFound.
+	GetVerificationToken(ctx context.Context, id uuid.UUID) (*domain.VerificationToken, error)
+	// UseVerificationToken marks a token as used, or returns ErrVerificationTokenNotFound when it is unknown
+	// or already used, so that a token is only ever used once.
+	UseVerificationToken(ctx context.Context, id uuid.UUID) error
+	// RevokeUserVerificationTokens marks every unused token of a user as used and returns how many it revoked.
+	RevokeUserVerificationTokens(ctx context.Context, userID uuid.UUID) (int, error)
+}
+
+// tenantVerificationToken is a stored verification token along with the tenant owning it.
+type tenantVerificationToken struct {
+	tenant string
+	token  domain.VerificationToken
+}
+
+// AddVerificationToken stores a verification token in memory.
+func (r *MemoryRepository) AddVerificationToken(ctx context.Context, token domain.VerificationToken) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.indexOf(tenantID, func(u *domain.User) bool { return u.ID == token.UserID }) < 0 {
+		return ErrUserNotFound
+	}
+	r.verificationTokens = append(r.verificationTokens, tenantVerificationToken{tenant: tenantID, token: token})
+	return nil
+}
+
+// GetVerificationToken returns a verification token of the tenant.
+func (r *MemoryRepository) GetVerificationToken(ctx context.Context, id uuid.UUID) (*domain.VerificationToken, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, t := range r.verificationTokens {
+		if t.tenant == tenantID && t.token.ID == id {
+			token := t.token
+			return &token, nil
+		}
+	}
+	return nil, ErrVerificationTokenNotFound
+}
+
+// UseVerificationToken marks an unused verification token of the tenant as used.
+func (r *MemoryRepository) UseVerificationToken(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.verificationTokens {
+		t := &r.verificationTokens[i]
+		if t.tenant == tenantID && t.token.ID == id && t.token.UsedAt == nil {
+			now := time.Now()
+			t.token.UsedAt = &now
+			return nil
+		}
+	}
+	return ErrVerificationTokenNotFound
+}
+
+// RevokeUserVerificationTokens marks the unused verification tokens of a user of the tenant as used.
+func (r *MemoryRepository) RevokeUserVerificationTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var n int
+	for i := range r.verificationTokens {
+		t := &r.verificationTokens[i]
+		if t.tenant == tenantID && t.token.UserID == userID && t.token.UsedAt == nil {
+			t.token.UsedAt = &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+// AddVerificationToken stores a verification token.
+func (r *PsqlRepository) AddVerificationToken(ctx context.Context, token domain.VerificationToken) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		tag, err := tx.Exec(ctx, insertVerificationTokenQuery, tenantID, token.UserID, token.ID, token.TokenHash,
+			token.ExpiresAt, token.CreatedAt)
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute insert verification token query: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return struct{}{}, ErrUserNotFound
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// GetVerificationToken returns a verification token, read from the primary so that a use is seen at once.
+func (r *PsqlRepository) GetVerificationToken(ctx context.Context, id uuid.UUID) (*domain.VerificationToken, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) (*domain.VerificationToken, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var t domain.VerificationToken
+		err = tx.QueryRow(ctx, selectVerificationTokenQuery, tenantID, id).
+			Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &t.UsedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrVerificationTokenNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute select verification token query: %w", err)
+		}
+		return &t, nil
+	})
+}
+
+// UseVerificationToken marks an unused verification token as used.
+func (r *PsqlRepository) UseVerificationToken(ctx context.Context, id uuid.UUID) error {
+	_, err := inTenantTx(ctx, r.pool, func(tx pgx.Tx) (struct{}, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return struct{}{}, err
+		}
+		tag, err := tx.Exec(ctx, useVerificationTokenQuery, tenantID, id, time.Now())
+		if err != nil {
+			return struct{}{}, fmt.Errorf("failed to execute use verification token query: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return struct{}{}, ErrVerificationTokenNotFound
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// RevokeUserVerificationTokens marks the unused verification tokens of a user as used.
+func (r *PsqlRepository) RevokeUserVerificationTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	return inTenantTx(ctx, r.pool, func(tx pgx.Tx) (int, error) {
+		tenantID, err := tenant.Require(ctx)
+		if err != nil {
+			return 0, err
+		}
+		tag, err := tx.Exec(ctx, useUserVerificationTokensQuery, tenantID, userID, time.Now())
+		if err != nil {
+			return 0, fmt.Errorf("failed to execute use verification tokens query: %w", err)
+		}
+		return int(tag.RowsAffected()), nil
+	})
+}
+
+// AddVerificationToken stores a verification token.
+func (r *SqlliteRepository) AddVerificationToken(ctx context.Context, token domain.VerificationToken) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, insertVerificationTokenQuery2, token.ID, token.TokenHash, token.ExpiresAt,
+		token.CreatedAt, tenantID, token.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to insert verification token: %w", err)
+	}
+	n, err := rowsAffected(res)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// GetVerificationToken returns a verification token.
+func (r *SqlliteRepository) GetVerificationToken(ctx context.Context, id uuid.UUID) (*domain.VerificationToken, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var t domain.VerificationToken
+	var usedAt sql.NullTime
+	err = r.db.QueryRowContext(ctx, selectVerificationTokenQuery2, tenantID, id).
+		Scan(&t.ID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.CreatedAt, &usedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrVerificationTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query verification token: %w", err)
+	}
+	t.UsedAt = nullTimePtr(usedAt)
+	return &t, nil
+}
+
+// UseVerificationToken marks an unused verification token as used.
+func (r *SqlliteRepository) UseVerificationToken(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return err
+	}
+	res, err := r.db.ExecContext(ctx, useVerificationTokenQuery2, time.Now(), tenantID, id)
+	if err != nil {
+		return fmt.Errorf("failed to use verification token: %w", err)
+	}
+	n, err := rowsAffected(res)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVerificationTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUserVerificationTokens marks the unused verification tokens of a user as used.
+func (r *SqlliteRepository) RevokeUserVerificationTokens(ctx context.Context, userID uuid.UUID) (int, error) {
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.db.ExecContext(ctx, useUserVerificationTokensQuery2, time.Now(), tenantID, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to use verification tokens: %w", err)
+	}
+	return rowsAffected(res)
+}
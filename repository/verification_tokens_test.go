@@ -0,0 +1,97 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationTokenStore(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	sqlite := repository.NewSQLLiteRepository(db)
+	require.NoError(t, sqlite.Migrate(testContext(t)))
+
+	stores := map[string]interface {
+		repository.UserRepository
+		repository.VerificationTokenStore
+	}{
+		"memory": repository.NewMemoryRepository(),
+		"sqlite": sqlite,
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := testContext(t)
+			user, err := store.AddUser(ctx, domain.User{Name: "Alice", Email: "alice@example.com", Status: domain.StatusPending})
+			require.NoError(t, err)
+			assert.Equal(t, domain.StatusPending, user.Status)
+
+			now := time.Now().UTC().Truncate(time.Second)
+			token := domain.VerificationToken{
+				ID:        uuid.New(),
+				UserID:    user.ID,
+				TokenHash: "hash",
+				ExpiresAt: now.Add(time.Hour),
+				CreatedAt: now,
+			}
+			require.NoError(t, store.AddVerificationToken(ctx, token))
+			require.ErrorIs(t, store.AddVerificationToken(ctx, domain.VerificationToken{ID: uuid.New(), UserID: uuid.New(),
+				TokenHash: "other", ExpiresAt: now.Add(time.Hour), CreatedAt: now}), repository.ErrUserNotFound)
+
+			got, err := store.GetVerificationToken(ctx, token.ID)
+			require.NoError(t, err)
+			assert.Equal(t, user.ID, got.UserID)
+			assert.Equal(t, "hash", got.TokenHash)
+			assert.True(t, token.ExpiresAt.Equal(got.ExpiresAt))
+			assert.Nil(t, got.UsedAt)
+			assert.True(t, got.Active(now))
+
+			other := tenant.WithID(ctx, "other")
+			_, err = store.GetVerificationToken(other, token.ID)
+			require.ErrorIs(t, err, repository.ErrVerificationTokenNotFound)
+			require.ErrorIs(t, store.UseVerificationToken(other, token.ID), repository.ErrVerificationTokenNotFound)
+
+			require.NoError(t, store.UseVerificationToken(ctx, token.ID))
+			require.ErrorIs(t, store.UseVerificationToken(ctx, token.ID), repository.ErrVerificationTokenNotFound,
+				"tokens are single use")
+			got, err = store.GetVerificationToken(ctx, token.ID)
+			require.NoError(t, err)
+			assert.NotNil(t, got.UsedAt)
+			assert.False(t, got.Active(now))
+
+			second := domain.VerificationToken{ID: uuid.New(), UserID: user.ID, TokenHash: "second", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+			require.NoError(t, store.AddVerificationToken(ctx, second))
+			n, err := store.RevokeUserVerificationTokens(other, user.ID)
+			require.NoError(t, err)
+			assert.Zero(t, n)
+			n, err = store.RevokeUserVerificationTokens(ctx, user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, 1, n, "used tokens are left alone")
+			require.ErrorIs(t, store.UseVerificationToken(ctx, second.ID), repository.ErrVerificationTokenNotFound)
+
+			require.NoError(t, store.DeleteUser(ctx, user.ID))
+			_, err = store.GetVerificationToken(ctx, token.ID)
+			require.ErrorIs(t, err, repository.ErrVerificationTokenNotFound)
+
+			_, err = store.AddUser(ctx, domain.User{Name: "Bob", Email: "bob@example.com"})
+			require.NoError(t, err)
+			bob, err := store.GetUserByEmail(ctx, "bob@example.com")
+			require.NoError(t, err)
+			assert.Equal(t, domain.StatusActive, bob.Status, "users are active by default")
+			bob.Status = ""
+			bob.Name = "Robert"
+			bob, err = store.UpdateUser(ctx, *bob)
+			require.NoError(t, err)
+			assert.Equal(t, domain.StatusActive, bob.Status, "updates without a status keep it")
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+)
+
+const (
+	watchBufferSize     = 64
+	watchReconnectBase  = 100 * time.Millisecond
+	watchReconnectMax   = 5 * time.Second
+	sqliteWatchInterval = time.Second
+)
+
+// ChangeOp is the kind of change reported by Watch.
+type ChangeOp string
+
+// Change kinds. ChangeGap reports that changes may have been missed before the next one,
+// for instance while reconnecting; watchers that keep state should reload it.
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+	ChangeGap    ChangeOp = "gap"
+)
+
+// UserChange is a change to the users table. User holds the new row, or the deleted one for ChangeDelete,
+// and TenantID the tenant owning it. Both are empty for ChangeGap.
+type UserChange struct {
+	Op       ChangeOp    `json:"op"`
+	TenantID string      `json:"tenant_id"`
+	User     domain.User `json:"user"`
+}
+
+// Watcher is implemented by repositories able to stream the changes made to users.
+type Watcher interface {
+	// Watch returns the changes committed after the call, in commit order. The channel is closed once ctx is done.
+	// A watcher that does not keep up slows down its own feed but not the writers.
+	Watch(ctx context.Context) <-chan UserChange
+}
+
+// sendChange delivers change on ch unless ctx is done first.
+func sendChange(ctx context.Context, ch chan<- UserChange, change UserChange) bool {
+	select {
+	case ch <- change:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// sleepContext waits for d or until ctx is done, and reports whether the full delay elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,104 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextChange(t *testing.T, changes <-chan repository.UserChange) repository.UserChange {
+	t.Helper()
+	select {
+	case change, ok := <-changes:
+		require.True(t, ok, "change feed closed")
+		return change
+	case <-time.After(500 * time.Millisecond):
+		require.FailNow(t, "no change received")
+		return repository.UserChange{}
+	}
+}
+
+// testWatch checks that inserts, updates and deletes are streamed in order.
+func testWatch(t *testing.T, repo interface {
+	repository.UserRepository
+	repository.Watcher
+}) {
+	t.Helper()
+	ctx := testContext(t)
+
+	changes := repo.Watch(ctx)
+	user, err := repo.AddUser(ctx, domain.User{Name: "Test User", Email: "test@example.com"})
+	require.NoError(t, err)
+	user.Name = "Updated"
+	_, err = repo.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	require.NoError(t, repo.DeleteUser(ctx, user.ID))
+
+	assert.Equal(t, repository.UserChange{Op: repository.ChangeInsert, TenantID: "test", User: domain.User{ID: user.ID, Name: "Test User", Email: user.Email, Status: domain.StatusActive}}, nextChange(t, changes))
+	assert.Equal(t, repository.UserChange{Op: repository.ChangeUpdate, TenantID: "test", User: *user}, nextChange(t, changes))
+	assert.Equal(t, repository.UserChange{Op: repository.ChangeDelete, TenantID: "test", User: *user}, nextChange(t, changes))
+}
+
+func TestSqlLiteRepository_Watch(t *testing.T) {
+	repo, closeRepo, err := repository.Open(testContext(t), "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+
+	sqlite, ok := repo.(*repository.SqlliteRepository)
+	require.True(t, ok)
+	testWatch(t, sqlite)
+}
+
+func TestSqlLiteRepository_Watch_RolledBack(t *testing.T) {
+	ctx := testContext(t)
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+	sqlite, ok := repo.(*repository.SqlliteRepository)
+	require.True(t, ok)
+
+	changes := sqlite.Watch(ctx)
+	_, err = sqlite.AddUser(ctx, domain.User{Name: "First", Email: "first@example.com"})
+	require.NoError(t, err)
+	// Duplicate email: the insert fails and records no change
+	_, err = sqlite.AddUser(ctx, domain.User{Name: "Second", Email: "first@example.com"})
+	require.Error(t, err)
+	third, err := sqlite.AddUser(ctx, domain.User{Name: "Third", Email: "third@example.com"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "First", nextChange(t, changes).User.Name)
+	assert.Equal(t, *third, nextChange(t, changes).User)
+}
+
+func TestSqlLiteRepository_Watch_Close(t *testing.T) {
+	repo, closeRepo, err := repository.Open(testContext(t), "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+	sqlite, ok := repo.(*repository.SqlliteRepository)
+	require.True(t, ok)
+
+	ctx, cancel := context.WithCancel(testContext(t))
+	changes := sqlite.Watch(ctx)
+	cancel()
+
+	// The feed is closed once the context is done
+	require.Eventually(t, func() bool {
+		_, open := <-changes
+		return !open
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPsqlRepository_Watch(t *testing.T) {
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	repo, repoCleanup := setupRepository(t, container)
+	defer repoCleanup()
+
+	testWatch(t, &repo)
+}
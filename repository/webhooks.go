@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/google/uuid"
+)
+
+const defaultDeliveryListLimit = 100
+
+// DeliveryFilter selects the deliveries returned by ListDeliveries. Zero fields match everything.
+type DeliveryFilter struct {
+	SubscriptionID uuid.UUID
+	Status         domain.DeliveryStatus
+	// Limit caps the number of deliveries returned, most recent first (100 by default).
+	Limit int
+}
+
+func (f DeliveryFilter) limit() int {
+	if f.Limit <= 0 {
+		return defaultDeliveryListLimit
+	}
+	return f.Limit
+}
+
+func (f DeliveryFilter) matches(d *domain.WebhookDelivery) bool {
+	return (f.SubscriptionID == uuid.Nil || d.SubscriptionID == f.SubscriptionID) &&
+		(f.Status == "" || d.Status == f.Status)
+}
+
+// WebhookStore is implemented by repositories storing webhook subscriptions and the deliveries made to them.
+// Deleting a subscription deletes its deliveries. Subscriptions and deliveries belong to the tenant of the
+// context they are read or added with, except for the deliveries processed by the worker, which spans every tenant.
+type WebhookStore interface {
+	AddSubscription(ctx context.Context, sub domain.WebhookSubscription) (*domain.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id uuid.UUID) (*domain.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+
+	// EnqueueDelivery stores a new delivery for its TenantID. A delivery of the same event to the same subscription
+	// is only stored once.
+	EnqueueDelivery(ctx context.Context, delivery domain.WebhookDelivery) error
+	// DueDeliveries returns at most limit pending deliveries of any tenant whose next attempt is due at now, oldest first.
+	DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error)
+	// UpdateDelivery saves the status, attempts, error and next attempt of a delivery of any tenant.
+	UpdateDelivery(ctx context.Context, delivery domain.WebhookDelivery) error
+	GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]domain.WebhookDelivery, error)
+}
+
+// AddSubscription stores a webhook subscription for the tenant of ctx, generating its ID if needed.
+func (r *MemoryRepository) AddSubscription(ctx context.Context, sub domain.WebhookSubscription) (*domain.WebhookSubscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub.TenantID = tenantID
+	if sub.ID == uuid.Nil {
+		sub.ID = uuid.New()
+	}
+	sub.EventTypes = slices.Clone(sub.EventTypes)
+	r.subscriptions = append(r.subscriptions, sub)
+	return &sub, nil
+}
+
+// GetSubscription returns the webhook subscription of the tenant of ctx with the given ID.
+func (r *MemoryRepository) GetSubscription(ctx context.Context, id uuid.UUID) (*domain.WebhookSubscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := slices.IndexFunc(r.subscriptions, func(s domain.WebhookSubscription) bool { return s.TenantID == tenantID && s.ID == id })
+	if i < 0 {
+		return nil, ErrSubscriptionNotFound
+	}
+	sub := r.subscriptions[i]
+	return &sub, nil
+}
+
+// ListSubscriptions returns the webhook subscriptions of the tenant of ctx in creation order.
+func (r *MemoryRepository) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := make([]domain.WebhookSubscription, 0)
+	for _, sub := range r.subscriptions {
+		if sub.TenantID == tenantID {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes a webhook subscription of the tenant of ctx and its deliveries.
+func (r *MemoryRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.subscriptions, func(s domain.WebhookSubscription) bool { return s.TenantID == tenantID && s.ID == id })
+	if i < 0 {
+		return ErrSubscriptionNotFound
+	}
+	r.subscriptions = slices.Delete(r.subscriptions, i, i+1)
+	r.deliveries = slices.DeleteFunc(r.deliveries, func(d domain.WebhookDelivery) bool { return d.SubscriptionID == id })
+	return nil
+}
+
+// EnqueueDelivery stores a delivery unless the event was already queued for the subscription.
+func (r *MemoryRepository) EnqueueDelivery(ctx context.Context, delivery domain.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.deliveries, func(d domain.WebhookDelivery) bool {
+		return d.SubscriptionID == delivery.SubscriptionID && d.EventID == delivery.EventID
+	}) {
+		return nil
+	}
+	r.deliveries = append(r.deliveries, delivery)
+	return nil
+}
+
+// DueDeliveries returns the pending deliveries due at now.
+func (r *MemoryRepository) DueDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	due := make([]domain.WebhookDelivery, 0)
+	for _, d := range r.deliveries {
+		if d.Status == domain.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	slices.SortStableFunc(due, func(a, b domain.WebhookDelivery) int { return a.NextAttemptAt.Compare(b.NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// UpdateDelivery saves the outcome of a delivery attempt.
+func (r *MemoryRepository) UpdateDelivery(ctx context.Context, delivery domain.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.deliveries, func(d domain.WebhookDelivery) bool { return d.ID == delivery.ID })
+	if i < 0 {
+		return ErrDeliveryNotFound
+	}
+	d := &r.deliveries[i]
+	d.Status = delivery.Status
+	d.Attempts = delivery.Attempts
+	d.LastError = delivery.LastError
+	d.ResponseCode = delivery.ResponseCode
+	d.NextAttemptAt = delivery.NextAttemptAt
+	d.UpdatedAt = delivery.UpdatedAt
+	return nil
+}
+
+// GetDelivery returns the webhook delivery of the tenant of ctx with the given ID.
+func (r *MemoryRepository) GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := slices.IndexFunc(r.deliveries, func(d domain.WebhookDelivery) bool { return d.TenantID == tenantID && d.ID == id })
+	if i < 0 {
+		return nil, ErrDeliveryNotFound
+	}
+	delivery := r.deliveries[i]
+	return &delivery, nil
+}
+
+// ListDeliveries returns the deliveries of the tenant of ctx matching filter, most recent first.
+func (r *MemoryRepository) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]domain.WebhookDelivery, error) {
+	tenantID, err := requireTenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	deliveries := make([]domain.WebhookDelivery, 0)
+	for i := len(r.deliveries) - 1; i >= 0 && len(deliveries) < filter.limit(); i-- {
+		if r.deliveries[i].TenantID == tenantID && filter.matches(&r.deliveries[i]) {
+			deliveries = append(deliveries, r.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,134 @@
+package repository_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDelivery(subID uuid.UUID, status domain.DeliveryStatus, next time.Time) domain.WebhookDelivery {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	return domain.WebhookDelivery{
+		ID:             uuid.New(),
+		TenantID:       "test",
+		SubscriptionID: subID,
+		EventID:        uuid.New(),
+		EventType:      domain.UserCreated,
+		Payload:        json.RawMessage(`{"type":"UserCreated"}`),
+		Status:         status,
+		NextAttemptAt:  next.UTC().Truncate(time.Millisecond),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+}
+
+// testWebhookStore checks subscriptions, delivery deduplication, the due queue, updates, listing and tenant isolation.
+func testWebhookStore(t *testing.T, store repository.WebhookStore) {
+	t.Helper()
+	ctx := testContext(t)
+	other := tenant.WithID(t.Context(), "other")
+
+	sub, err := store.AddSubscription(ctx, domain.WebhookSubscription{
+		URL:        "https://example.com/hook",
+		Secret:     "secret",
+		EventTypes: []domain.EventType{domain.UserCreated, domain.UserDeleted},
+		CreatedAt:  time.Now().UTC().Truncate(time.Millisecond),
+	})
+	require.NoError(t, err)
+	require.NotEqual(t, uuid.Nil, sub.ID)
+	assert.Equal(t, "test", sub.TenantID)
+
+	got, err := store.GetSubscription(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, sub, got)
+
+	subs, err := store.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+
+	_, err = store.GetSubscription(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrSubscriptionNotFound)
+	_, err = store.GetSubscription(other, sub.ID)
+	require.ErrorIs(t, err, repository.ErrSubscriptionNotFound)
+	subs, err = store.ListSubscriptions(other)
+	require.NoError(t, err)
+	assert.Empty(t, subs)
+
+	now := time.Now()
+	due := newDelivery(sub.ID, domain.DeliveryPending, now.Add(-time.Minute))
+	later := newDelivery(sub.ID, domain.DeliveryPending, now.Add(time.Hour))
+	dead := newDelivery(sub.ID, domain.DeliveryDead, now.Add(-time.Hour))
+	for _, d := range []domain.WebhookDelivery{due, later, dead} {
+		require.NoError(t, store.EnqueueDelivery(ctx, d))
+	}
+	// The same event is only queued once per subscription.
+	duplicate := due
+	duplicate.ID = uuid.New()
+	require.NoError(t, store.EnqueueDelivery(ctx, duplicate))
+
+	pending, err := store.DueDeliveries(ctx, now, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, due, pending[0])
+
+	due.Status = domain.DeliverySucceeded
+	due.Attempts = 1
+	due.ResponseCode = 204
+	due.UpdatedAt = due.UpdatedAt.Add(time.Second)
+	require.NoError(t, store.UpdateDelivery(ctx, due))
+	gotDelivery, err := store.GetDelivery(ctx, due.ID)
+	require.NoError(t, err)
+	assert.Equal(t, due, *gotDelivery)
+
+	require.ErrorIs(t, store.UpdateDelivery(ctx, newDelivery(sub.ID, domain.DeliveryPending, now)), repository.ErrDeliveryNotFound)
+	_, err = store.GetDelivery(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrDeliveryNotFound)
+	_, err = store.GetDelivery(other, due.ID)
+	require.ErrorIs(t, err, repository.ErrDeliveryNotFound)
+
+	all, err := store.ListDeliveries(ctx, repository.DeliveryFilter{SubscriptionID: sub.ID})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	deadLetters, err := store.ListDeliveries(ctx, repository.DeliveryFilter{Status: domain.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, dead.ID, deadLetters[0].ID)
+	limited, err := store.ListDeliveries(ctx, repository.DeliveryFilter{Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, limited, 2)
+	none, err := store.ListDeliveries(other, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+	require.ErrorIs(t, store.DeleteSubscription(other, sub.ID), repository.ErrSubscriptionNotFound)
+
+	require.NoError(t, store.DeleteSubscription(ctx, sub.ID))
+	require.ErrorIs(t, store.DeleteSubscription(ctx, sub.ID), repository.ErrSubscriptionNotFound)
+	all, err = store.ListDeliveries(ctx, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, all)
+}
+
+func TestMemoryRepository_Webhooks(t *testing.T) {
+	testWebhookStore(t, repository.NewMemoryRepository())
+}
+
+func TestSqlLiteRepository_Webhooks(t *testing.T) {
+	testWebhookStore(t, setupSQLiteOutbox(t))
+}
+
+func TestPsqlRepository_Webhooks(t *testing.T) {
+	container, containerCleanup := setupPostgresContainer(t)
+	defer containerCleanup()
+
+	repo, repoCleanup := setupRepository(t, container)
+	defer repoCleanup()
+
+	testWebhookStore(t, &repo)
+}
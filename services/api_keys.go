@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+)
+
+// apiKeyTouchInterval is how stale the last use of an API key gets before it is recorded again, so that busy
+// keys do not cost a write per request.
+const apiKeyTouchInterval = time.Minute
+
+var (
+	// ErrInvalidAPIKey is returned by AuthenticateAPIKey for malformed, unknown, revoked and expired keys alike.
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrInvalidAPIKeyRequest is returned by CreateAPIKey for keys without a single owner, scope or future expiry.
+	ErrInvalidAPIKeyRequest = errors.New("invalid api key request")
+	// ErrAPIKeysDisabled is returned by the API key operations when the service stores no API keys.
+	ErrAPIKeysDisabled = errors.New("api keys are not enabled")
+)
+
+// WithAPIKeys lets API keys be created in store and used to authenticate. Users may manage their own keys;
+// managing any other key requires the api_keys:manage permission.
+func WithAPIKeys(store repository.APIKeyStore) Option {
+	return func(s *UserService) {
+		s.apiKeys = store
+	}
+}
+
+// CreateAPIKey creates an API key with the name, owner, permissions and expiry of key, and returns it along with
+// the key itself, which is not stored and cannot be shown again. The actor of ctx must hold every permission of
+// the key, and a key owned by a user never allows more than the roles of the user do.
+func (s *UserService) CreateAPIKey(ctx context.Context, key domain.APIKey) (*domain.APIKey, string, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.CreateAPIKey")
+	defer span.End()
+
+	if s.apiKeys == nil {
+		return nil, "", spanError(span, ErrAPIKeysDisabled)
+	}
+	now := time.Now().UTC()
+	if err := validateAPIKey(key, now); err != nil {
+		return nil, "", spanError(span, err)
+	}
+	if err := s.authorize(ctx, domain.PermAPIKeysManage, apiKeyOwner(key)); err != nil {
+		return nil, "", spanError(span, fmt.Errorf("failed to create api key: %w", err))
+	}
+	if err := s.authorizeGrant(ctx, key); err != nil {
+		return nil, "", spanError(span, fmt.Errorf("failed to create api key: %w", err))
+	}
+
+	secret, prefix, hash, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, "", spanError(span, err)
+	}
+	key.ID = uuid.New()
+	key.Prefix = prefix
+	key.KeyHash = hash
+	key.CreatedAt = now
+	key.LastUsedAt = nil
+	key.RevokedAt = nil
+	if err := s.apiKeys.AddAPIKey(ctx, key); err != nil {
+		return nil, "", spanError(span, fmt.Errorf("failed to create api key: %w", err))
+	}
+	return &key, secret, nil
+}
+
+// ListAPIKeys returns every API key of the tenant, revoked or not.
+func (s *UserService) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ListAPIKeys")
+	defer span.End()
+
+	if s.apiKeys == nil {
+		return nil, spanError(span, ErrAPIKeysDisabled)
+	}
+	if err := s.authorize(ctx, domain.PermAPIKeysManage, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to list api keys: %w", err))
+	}
+	keys, err := s.apiKeys.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to list api keys: %w", err))
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the API key with the given ID.
+func (s *UserService) RevokeAPIKey(ctx context.Context, id uuid.UUID) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.RevokeAPIKey")
+	defer span.End()
+
+	if s.apiKeys == nil {
+		return spanError(span, ErrAPIKeysDisabled)
+	}
+	key, err := s.apiKeys.GetAPIKey(ctx, id)
+	if err != nil {
+		return spanError(span, fmt.Errorf("failed to revoke api key: %w", err))
+	}
+	if err := s.authorize(ctx, domain.PermAPIKeysManage, apiKeyOwner(*key)); err != nil {
+		return spanError(span, fmt.Errorf("failed to revoke api key: %w", err))
+	}
+	if err := s.apiKeys.RevokeAPIKey(ctx, id); err != nil {
+		return spanError(span, fmt.Errorf("failed to revoke api key: %w", err))
+	}
+	return nil
+}
+
+// AuthenticateAPIKey returns the stored API key matching key if it is still active, or ErrInvalidAPIKey,
+// and records its use. The keys of users who are not active are rejected too.
+func (s *UserService) AuthenticateAPIKey(ctx context.Context, key string) (*domain.APIKey, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.AuthenticateAPIKey")
+	defer span.End()
+
+	if s.apiKeys == nil {
+		return nil, spanError(span, ErrAPIKeysDisabled)
+	}
+	prefix, err := auth.ParseAPIKey(key)
+	if err != nil {
+		return nil, spanError(span, ErrInvalidAPIKey)
+	}
+	stored, err := s.apiKeys.GetAPIKeyByPrefix(ctx, prefix)
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, spanError(span, ErrInvalidAPIKey)
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to authenticate api key: %w", err))
+	}
+	now := time.Now().UTC()
+	if subtle.ConstantTimeCompare([]byte(auth.HashAPIKey(key)), []byte(stored.KeyHash)) != 1 || !stored.Active(now) {
+		return nil, spanError(span, ErrInvalidAPIKey)
+	}
+	if stored.UserID != nil {
+		owner, err := s.repo.GetUserByID(ctx, *stored.UserID)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, spanError(span, ErrInvalidAPIKey)
+		}
+		if err != nil {
+			return nil, spanError(span, fmt.Errorf("failed to authenticate api key: %w", err))
+		}
+		if owner.Status != "" && owner.Status != domain.StatusActive {
+			return nil, spanError(span, ErrInvalidAPIKey)
+		}
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= apiKeyTouchInterval {
+		// The key is valid, so failing to record its use must not fail the request.
+		if err := s.apiKeys.TouchAPIKey(ctx, stored.ID, now); err != nil {
+			span.RecordError(fmt.Errorf("failed to record api key use: %w", err))
+		} else {
+			stored.LastUsedAt = &now
+		}
+	}
+	return stored, nil
+}
+
+func validateAPIKey(key domain.APIKey, now time.Time) error {
+	if (key.UserID == nil) == (key.ServiceAccount == "") {
+		return fmt.Errorf("%w: it must belong to either a user or a service account", ErrInvalidAPIKeyRequest)
+	}
+	if len(key.Permissions) == 0 {
+		return fmt.Errorf("%w: it must be scoped to at least one permission", ErrInvalidAPIKeyRequest)
+	}
+	for _, p := range key.Permissions {
+		if !p.Valid() {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidAPIKeyRequest, p)
+		}
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return fmt.Errorf("%w: it must expire in the future", ErrInvalidAPIKeyRequest)
+	}
+	return nil
+}
+
+// apiKeyOwner returns the user owning key, who may manage it without permission, or uuid.Nil.
+// authorizeGrant returns ErrForbidden unless the actor of ctx, within its scope and roles, holds every permission
+// of key, so that keys cannot be used to gain permissions. Users hold the permissions on their own record for
+// their own keys.
+func (s *UserService) authorizeGrant(ctx context.Context, key domain.APIKey) error {
+	for _, perm := range key.Permissions {
+		self := uuid.Nil
+		if perm == domain.PermUsersRead || perm == domain.PermUsersWrite {
+			self = apiKeyOwner(key)
+		}
+		if err := s.authorize(ctx, perm, self); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func apiKeyOwner(key domain.APIKey) uuid.UUID {
+	if key.UserID == nil {
+		return uuid.Nil
+	}
+	return *key.UserID
+}
@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserService_APIKeys(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	userService := service.NewUserService(repo, service.WithAuthorization(repo), service.WithAPIKeys(repo))
+
+	system := actor.With(ctx, actor.Service("bootstrap"))
+	admin, err := userService.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, userService.SetRoles(system, admin.ID, domain.RoleAdmin))
+	member, err := userService.AddUser(system, domain.User{Name: "Member", Email: "member@example.com"})
+	require.NoError(t, err)
+	asAdmin := actor.With(ctx, actor.User(admin.ID.String()))
+	asMember := actor.With(ctx, actor.User(member.ID.String()))
+
+	// Keys need a single owner, a known scope and a future expiry.
+	read := []domain.Permission{domain.PermUsersRead}
+	past := time.Now().Add(-time.Hour)
+	for _, invalid := range []domain.APIKey{
+		{Permissions: read},
+		{UserID: &admin.ID, ServiceAccount: "billing", Permissions: read},
+		{ServiceAccount: "billing"},
+		{ServiceAccount: "billing", Permissions: []domain.Permission{"users:everything"}},
+		{ServiceAccount: "billing", Permissions: read, ExpiresAt: &past},
+	} {
+		_, _, err := userService.CreateAPIKey(asAdmin, invalid)
+		require.ErrorIs(t, err, service.ErrInvalidAPIKeyRequest)
+	}
+
+	// Users manage their own keys only; service account keys need api_keys:manage.
+	_, _, err = userService.CreateAPIKey(asMember, domain.APIKey{ServiceAccount: "billing", Permissions: read})
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, _, err = userService.CreateAPIKey(asMember, domain.APIKey{UserID: &admin.ID, Permissions: read})
+	require.ErrorIs(t, err, service.ErrForbidden)
+	memberKey, memberSecret, err := userService.CreateAPIKey(asMember, domain.APIKey{Name: "script", UserID: &member.ID, Permissions: read})
+	require.NoError(t, err)
+	assert.Contains(t, memberSecret, memberKey.Prefix+"_")
+	assert.NotContains(t, memberKey.KeyHash, memberSecret)
+	_, err = userService.ListAPIKeys(asMember)
+	require.ErrorIs(t, err, service.ErrForbidden)
+
+	// Keys cannot allow more than their creator holds.
+	_, _, err = userService.CreateAPIKey(asMember, domain.APIKey{UserID: &member.ID, Permissions: []domain.Permission{domain.PermUsersDelete}})
+	require.ErrorIs(t, err, service.ErrForbidden)
+	manager, _, err := userService.CreateAPIKey(asAdmin, domain.APIKey{Name: "provisioning", ServiceAccount: "provisioning",
+		Permissions: []domain.Permission{domain.PermAPIKeysManage, domain.PermUsersRead}})
+	require.NoError(t, err)
+	asManager := actor.WithScope(actor.With(ctx, manager.Actor()), manager.Permissions)
+	_, _, err = userService.CreateAPIKey(asManager, domain.APIKey{ServiceAccount: "provisioning",
+		Permissions: []domain.Permission{domain.PermAPIKeysManage, domain.PermUsersDelete}})
+	require.ErrorIs(t, err, service.ErrForbidden, "a scoped key cannot mint a broader one")
+	_, _, err = userService.CreateAPIKey(asManager, domain.APIKey{ServiceAccount: "reporting", Permissions: read})
+	require.NoError(t, err)
+
+	serviceKey, serviceSecret, err := userService.CreateAPIKey(asAdmin, domain.APIKey{Name: "billing", ServiceAccount: "billing",
+		Permissions: []domain.Permission{domain.PermUsersRead, domain.PermUsersWrite}})
+	require.NoError(t, err)
+	keys, err := userService.ListAPIKeys(asAdmin)
+	require.NoError(t, err)
+	assert.Len(t, keys, 4)
+
+	// Keys authenticate their owner, restricted to their scope, and record their use.
+	key, err := userService.AuthenticateAPIKey(ctx, serviceSecret)
+	require.NoError(t, err)
+	assert.Equal(t, actor.Service("billing"), key.Actor())
+	require.NotNil(t, key.LastUsedAt)
+	asBilling := actor.WithScope(actor.With(ctx, key.Actor()), key.Permissions)
+	_, err = userService.AddUser(asBilling, domain.User{Name: "Customer", Email: "customer@example.com"})
+	require.NoError(t, err)
+	require.ErrorIs(t, userService.DeleteUser(asBilling, member.ID), service.ErrForbidden)
+
+	key, err = userService.AuthenticateAPIKey(ctx, memberSecret)
+	require.NoError(t, err)
+	asMemberKey := actor.WithScope(actor.With(ctx, key.Actor()), key.Permissions)
+	_, err = userService.GetUser(asMemberKey, member.ID)
+	require.NoError(t, err)
+	_, err = userService.UpdateUser(asMemberKey, *member)
+	require.ErrorIs(t, err, service.ErrForbidden, "the key is read-only even for its own user")
+	_, err = userService.GetAllUsers(asMemberKey)
+	require.ErrorIs(t, err, service.ErrForbidden, "the key allows no more than the roles of its user")
+
+	// Wrong, unknown, foreign and revoked keys are all rejected alike.
+	for _, invalid := range []string{"rpk_nope", memberSecret + "x", serviceKey.Prefix + "_" + strings.Repeat("A", 43)} {
+		_, err = userService.AuthenticateAPIKey(ctx, invalid)
+		require.ErrorIs(t, err, service.ErrInvalidAPIKey)
+	}
+	_, err = userService.AuthenticateAPIKey(tenant.WithID(ctx, "other"), memberSecret)
+	require.ErrorIs(t, err, service.ErrInvalidAPIKey)
+	require.ErrorIs(t, userService.RevokeAPIKey(asMember, serviceKey.ID), service.ErrForbidden)
+	require.NoError(t, userService.RevokeAPIKey(asMember, memberKey.ID))
+	_, err = userService.AuthenticateAPIKey(ctx, memberSecret)
+	require.ErrorIs(t, err, service.ErrInvalidAPIKey)
+	require.ErrorIs(t, userService.RevokeAPIKey(asAdmin, memberKey.ID), repository.ErrAPIKeyNotFound)
+}
@@ -0,0 +1,90 @@
+package service_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserService_AuditHistory(t *testing.T) {
+	ctx := actor.With(tenant.WithID(t.Context(), "acme"), actor.User("operator-1"))
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+	store, ok := repo.(interface {
+		repository.Transactor
+		repository.PersonalDataStore
+		repository.AuditStore
+	})
+	require.True(t, ok)
+	userService := service.NewUserService(repo, service.WithOutbox(store), service.WithPersonalData(store), service.WithAudit(store))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	user.Email = "johnny@example.com"
+	_, err = userService.UpdateUser(actor.With(ctx, actor.Service("crm-sync")), *user)
+	require.NoError(t, err)
+
+	page, err := userService.AuditHistory(ctx, user.ID, repository.AuditQuery{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	created := page.Entries[0]
+	assert.Equal(t, domain.AuditCreate, created.Action)
+	assert.Equal(t, actor.User("operator-1"), created.Actor)
+	assert.Equal(t, "acme", created.TenantID)
+	assert.Equal(t, []domain.FieldChange{
+		{Field: "name", After: "John Doe"},
+		{Field: "email", After: "john@example.com"},
+		{Field: "status", After: "active"},
+	}, created.Changes)
+
+	page, err = userService.AuditHistory(ctx, user.ID, repository.AuditQuery{After: page.Next})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	updated := page.Entries[0]
+	assert.Equal(t, actor.Service("crm-sync"), updated.Actor)
+	assert.Equal(t, []domain.FieldChange{{Field: "email", Before: "john@example.com", After: "johnny@example.com"}}, updated.Changes)
+
+	// Erasing keeps who changed which fields, but not the values.
+	_, err = userService.EraseUser(ctx, user.ID)
+	require.NoError(t, err)
+	export, err := userService.ExportUser(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, export.Audit, 3)
+	assert.Equal(t, []domain.FieldChange{{Field: "email"}}, export.Audit[1].Changes)
+	assert.Equal(t, domain.AuditErase, export.Audit[2].Action)
+	archive, err := json.Marshal(export)
+	require.NoError(t, err)
+	assert.NotContains(t, string(archive), "john")
+
+	_, err = service.NewUserService(repo).AuditHistory(ctx, user.ID, repository.AuditQuery{})
+	require.ErrorIs(t, err, service.ErrAuditDisabled)
+}
+
+func TestUserService_AuditWithoutOutbox(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	userService := service.NewUserService(repo, service.WithAudit(repo))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, userService.DeleteUser(ctx, user.ID))
+
+	page, err := userService.AuditHistory(ctx, user.ID, repository.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, actor.Unknown, page.Entries[0].Actor)
+	assert.Equal(t, domain.AuditDelete, page.Entries[1].Action)
+	assert.Equal(t, []domain.FieldChange{
+		{Field: "name", Before: "John Doe"},
+		{Field: "email", Before: "john@example.com"},
+		{Field: "status", Before: "active"},
+	}, page.Entries[1].Changes)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrForbidden is returned when the actor of the context lacks the permission an operation requires.
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidRole is returned by SetRoles for unknown roles.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrAuthorizationDisabled is returned by SetRoles and GetRoles when the service stores no roles.
+	ErrAuthorizationDisabled = errors.New("authorization is not enabled")
+)
+
+// WithAuthorization checks before every operation that the actor of the context is allowed to perform it,
+// based on the roles of users kept in store. Users may always read and edit their own record. Service actors
+// are in-process jobs and are trusted; a context without actor is denied everything.
+func WithAuthorization(store repository.RoleStore) Option {
+	return func(s *UserService) {
+		s.roles = store
+	}
+}
+
+// SetRoles replaces the roles of the user with the given ID.
+func (s *UserService) SetRoles(ctx context.Context, id uuid.UUID, roles ...domain.Role) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.SetRoles")
+	defer span.End()
+
+	if s.roles == nil {
+		return spanError(span, ErrAuthorizationDisabled)
+	}
+	if err := s.authorize(ctx, domain.PermRolesWrite, uuid.Nil); err != nil {
+		return spanError(span, fmt.Errorf("failed to set roles: %w", err))
+	}
+	for _, role := range roles {
+		if !role.Valid() {
+			return spanError(span, fmt.Errorf("%w: %q", ErrInvalidRole, role))
+		}
+	}
+	if err := s.roles.SetRoles(ctx, id, roles); err != nil {
+		return spanError(span, fmt.Errorf("failed to set roles: %w", err))
+	}
+	return nil
+}
+
+// GetRoles returns the roles of the user with the given ID.
+func (s *UserService) GetRoles(ctx context.Context, id uuid.UUID) ([]domain.Role, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetRoles")
+	defer span.End()
+
+	if s.roles == nil {
+		return nil, spanError(span, ErrAuthorizationDisabled)
+	}
+	if err := s.authorize(ctx, domain.PermUsersRead, id); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get roles: %w", err))
+	}
+	roles, err := s.roles.GetRoles(ctx, id)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get roles: %w", err))
+	}
+	return roles, nil
+}
+
+// Authorize returns ErrForbidden unless the actor of ctx has perm. It is meant for data served from outside
+// of the service, such as the change stream of the repository.
+func (s *UserService) Authorize(ctx context.Context, perm domain.Permission) error {
+	return s.authorize(ctx, perm, uuid.Nil)
+}
+
+// authorize returns ErrForbidden unless the actor of ctx has perm, or is the user self when not uuid.Nil.
+// An actor restricted to a scope, as by an API key, must also be scoped to perm. Without WithAuthorization,
+// only the scope is checked.
+func (s *UserService) authorize(ctx context.Context, perm domain.Permission, self uuid.UUID) error {
+	return checkPermission(ctx, s.roles, perm, self)
+}
+
+// checkPermission implements authorize with the roles kept in roles, which may be nil.
+func checkPermission(ctx context.Context, roles repository.RoleStore, perm domain.Permission, self uuid.UUID) error {
+	a := actor.Of(ctx)
+	if scope, ok := actor.Scope(ctx); ok && !slices.Contains(scope, perm) {
+		return fmt.Errorf("%w: %s %q is not scoped to %s", ErrForbidden, a.Kind, a.ID, perm)
+	}
+	if roles == nil {
+		return nil
+	}
+	switch a.Kind {
+	case domain.ActorService:
+		return nil
+	case domain.ActorUser:
+		id, err := uuid.Parse(a.ID)
+		if err != nil {
+			break
+		}
+		if self != uuid.Nil && id == self {
+			return nil
+		}
+		granted, err := roles.GetRoles(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to get roles of actor: %w", err)
+		}
+		if slices.ContainsFunc(granted, func(r domain.Role) bool { return r.Grants(perm) }) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %q lacks %s", ErrForbidden, a.Kind, a.ID, perm)
+}
@@ -0,0 +1,81 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserService_Authorization(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	userService := service.NewUserService(repo, service.WithAuthorization(repo))
+
+	// Service actors are trusted, which is how the first admin gets its role.
+	system := actor.With(ctx, actor.Service("bootstrap"))
+	admin, err := userService.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, userService.SetRoles(system, admin.ID, domain.RoleAdmin))
+	viewer, err := userService.AddUser(system, domain.User{Name: "Viewer", Email: "viewer@example.com"})
+	require.NoError(t, err)
+	member, err := userService.AddUser(system, domain.User{Name: "Member", Email: "member@example.com"})
+	require.NoError(t, err)
+
+	asAdmin := actor.With(ctx, actor.User(admin.ID.String()))
+	asViewer := actor.With(ctx, actor.User(viewer.ID.String()))
+	asMember := actor.With(ctx, actor.User(member.ID.String()))
+	require.NoError(t, userService.SetRoles(asAdmin, viewer.ID, domain.RoleViewer))
+
+	// Without roles, users only see and edit themselves.
+	_, err = userService.GetAllUsers(asMember)
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = userService.GetUser(asMember, viewer.ID)
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = userService.GetUser(asMember, member.ID)
+	require.NoError(t, err)
+	_, err = userService.GetUserByEmail(asMember, "member@example.com")
+	require.NoError(t, err)
+	_, err = userService.GetUserByEmail(asMember, "viewer@example.com")
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = userService.GetUserByEmail(asMember, "nobody@example.com")
+	require.ErrorIs(t, err, service.ErrForbidden, "unknown emails are not disclosed either")
+	member.Name = "Member Renamed"
+	_, err = userService.UpdateUser(asMember, *member)
+	require.NoError(t, err)
+	require.ErrorIs(t, userService.DeleteUser(asMember, member.ID), service.ErrForbidden)
+	require.ErrorIs(t, userService.SetRoles(asMember, member.ID, domain.RoleAdmin), service.ErrForbidden)
+
+	// Viewers read everyone but change no one else.
+	users, err := userService.GetAllUsers(asViewer)
+	require.NoError(t, err)
+	assert.Len(t, users, 3)
+	_, err = userService.GetUserByEmail(asViewer, "nobody@example.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = userService.AddUser(asViewer, domain.User{Name: "New", Email: "new@example.com"})
+	require.ErrorIs(t, err, service.ErrForbidden)
+	roles, err := userService.GetRoles(asViewer, admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Role{domain.RoleAdmin}, roles)
+
+	// Admins do everything, and lose their powers along with their role.
+	require.NoError(t, userService.DeleteUser(asAdmin, member.ID))
+	require.ErrorIs(t, userService.SetRoles(asAdmin, admin.ID, "owner"), service.ErrInvalidRole)
+	require.NoError(t, userService.SetRoles(asAdmin, admin.ID))
+	_, err = userService.GetAllUsers(asAdmin)
+	require.ErrorIs(t, err, service.ErrForbidden)
+
+	// Contexts without actor, or with an actor unknown in the tenant, are denied.
+	_, err = userService.GetAllUsers(ctx)
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = userService.GetAllUsers(actor.With(ctx, actor.User(uuid.NewString())))
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = userService.GetAllUsers(actor.With(tenant.WithID(ctx, "other"), actor.User(viewer.ID.String())))
+	require.ErrorIs(t, err, service.ErrForbidden)
+}
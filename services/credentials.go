@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/password"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/utils"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidCredentials is returned by Authenticate, whether the email is unknown or the password wrong.
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrWeakPassword is returned by SetPassword when the password does not follow the password policy.
+	ErrWeakPassword = errors.New("password does not meet the policy")
+	// ErrCredentialsDisabled is returned by SetPassword and Authenticate when the service stores no credentials.
+	ErrCredentialsDisabled = errors.New("credentials are not enabled")
+)
+
+// credentials stores passwords hashed by hasher.
+type credentials struct {
+	store  repository.CredentialStore
+	hasher *password.Hasher
+
+	// decoy is a hash verified when there is no credential to check, so that unknown emails take as long as
+	// wrong passwords.
+	decoyOnce sync.Once
+	decoy     string
+}
+
+// WithCredentials lets users set a password, stored in store as hashed by hasher, and authenticate with it.
+func WithCredentials(store repository.CredentialStore, hasher *password.Hasher) Option {
+	return func(s *UserService) {
+		s.credentials = &credentials{store: store, hasher: hasher}
+	}
+}
+
+// SetPassword sets the password of the user with the given ID, after checking it against the password policy,
+// and revokes the refresh tokens of the user. Only the user and the actors allowed to write credentials may set it.
+func (s *UserService) SetPassword(ctx context.Context, id uuid.UUID, pw string) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.SetPassword")
+	defer span.End()
+
+	if s.credentials == nil {
+		return spanError(span, ErrCredentialsDisabled)
+	}
+	if err := s.authorize(ctx, domain.PermCredentialsWrite, id); err != nil {
+		return spanError(span, fmt.Errorf("failed to set password: %w", err))
+	}
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return spanError(span, fmt.Errorf("failed to set password: %w", err))
+	}
+	if err := utils.ValidatePassword(*user, pw); err != nil {
+		return spanError(span, fmt.Errorf("%w: %w", ErrWeakPassword, err))
+	}
+	if err := s.credentials.set(ctx, id, pw); err != nil {
+		return spanError(span, fmt.Errorf("failed to set password: %w", err))
+	}
+	if err := s.revokeSessions(ctx, id); err != nil {
+		return spanError(span, err)
+	}
+	return nil
+}
+
+// Authenticate returns the user with the given email if pw is their password, or ErrInvalidCredentials.
+// A password hashed with other parameters than the current ones is rehashed on the way. Users who are not active
+// get ErrUserInactive, once their password is checked.
+func (s *UserService) Authenticate(ctx context.Context, email, pw string) (*domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.Authenticate")
+	defer span.End()
+
+	if s.credentials == nil {
+		return nil, spanError(span, ErrCredentialsDisabled)
+	}
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.credentials.verifyDecoy(pw)
+		return nil, spanError(span, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to authenticate: %w", err))
+	}
+	credential, err := s.credentials.store.GetCredential(ctx, user.ID)
+	if errors.Is(err, repository.ErrCredentialNotFound) {
+		s.credentials.verifyDecoy(pw)
+		return nil, spanError(span, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to authenticate: %w", err))
+	}
+
+	rehash, err := s.credentials.hasher.Verify(credential.PasswordHash, pw)
+	if errors.Is(err, password.ErrMismatch) {
+		return nil, spanError(span, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to authenticate: %w", err))
+	}
+	if rehash {
+		// The password is right, so a failure to upgrade its hash must not fail the login; it is retried next time.
+		if err := s.credentials.set(ctx, user.ID, pw); err != nil {
+			span.RecordError(fmt.Errorf("failed to rehash password: %w", err))
+		}
+	}
+	if user.Status != "" && user.Status != domain.StatusActive {
+		return nil, spanError(span, fmt.Errorf("%w: user is %s", ErrUserInactive, user.Status))
+	}
+	return user, nil
+}
+
+func (c *credentials) set(ctx context.Context, id uuid.UUID, pw string) error {
+	hash, err := c.hasher.Hash(pw)
+	if err != nil {
+		return err
+	}
+	return c.store.SetCredential(ctx, domain.Credential{UserID: id, PasswordHash: hash, UpdatedAt: time.Now().UTC()})
+}
+
+func (c *credentials) verifyDecoy(pw string) {
+	c.decoyOnce.Do(func() {
+		c.decoy, _ = c.hasher.Hash(uuid.NewString())
+	})
+	_, _ = c.hasher.Verify(c.decoy, pw)
+}
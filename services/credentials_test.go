@@ -0,0 +1,92 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/password"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var fastArgon2 = password.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestUserService_SetPasswordAndAuthenticate(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	userService := service.NewUserService(repo, service.WithCredentials(repo, password.NewHasher(password.WithArgon2id(fastArgon2))))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+
+	err = userService.SetPassword(ctx, user.ID, "short")
+	require.ErrorIs(t, err, service.ErrWeakPassword)
+	err = userService.SetPassword(ctx, user.ID, "john-is-my-password")
+	require.ErrorIs(t, err, service.ErrWeakPassword)
+	require.NoError(t, userService.SetPassword(ctx, user.ID, "correct horse battery staple"))
+
+	got, err := userService.Authenticate(ctx, "john@example.com", "correct horse battery staple")
+	require.NoError(t, err)
+	assert.Equal(t, user, got)
+
+	_, err = userService.Authenticate(ctx, "john@example.com", "wrong horse battery staple")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = userService.Authenticate(ctx, "jane@example.com", "correct horse battery staple")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = userService.Authenticate(tenant.WithID(ctx, "other"), "john@example.com", "correct horse battery staple")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+
+	_, err = service.NewUserService(repo).Authenticate(ctx, "john@example.com", "correct horse battery staple")
+	require.ErrorIs(t, err, service.ErrCredentialsDisabled)
+}
+
+func TestUserService_AuthenticateRehashes(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	legacy := service.NewUserService(repo, service.WithCredentials(repo, password.NewHasher(password.WithBcrypt(bcrypt.MinCost))))
+	user, err := legacy.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, legacy.SetPassword(ctx, user.ID, "correct horse battery staple"))
+
+	current := service.NewUserService(repo, service.WithCredentials(repo, password.NewHasher(password.WithArgon2id(fastArgon2))))
+	_, err = current.Authenticate(ctx, "john@example.com", "wrong horse battery staple")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials)
+	credential, err := repo.GetCredential(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, credential.PasswordHash, "$2a$", "a failed login must not rehash")
+
+	_, err = current.Authenticate(ctx, "john@example.com", "correct horse battery staple")
+	require.NoError(t, err)
+	credential, err = repo.GetCredential(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Contains(t, credential.PasswordHash, "$argon2id$")
+
+	_, err = current.Authenticate(ctx, "john@example.com", "correct horse battery staple")
+	require.NoError(t, err)
+}
+
+func TestUserService_SetPasswordOfOthers(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	userService := service.NewUserService(repo, service.WithAuthorization(repo),
+		service.WithCredentials(repo, password.NewHasher(password.WithArgon2id(fastArgon2))))
+	system := actor.With(ctx, actor.Service("test"))
+	user, err := userService.AddUser(system, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	editor, err := userService.AddUser(system, domain.User{Name: "Editor", Email: "editor@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, userService.SetRoles(system, editor.ID, domain.RoleEditor))
+	admin, err := userService.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, userService.SetRoles(system, admin.ID, domain.RoleAdmin))
+
+	require.NoError(t, userService.SetPassword(actor.With(ctx, actor.User(user.ID.String())), user.ID, "correct horse battery staple"))
+	err = userService.SetPassword(actor.With(ctx, actor.User(editor.ID.String())), user.ID, "stolen horse battery staple")
+	require.ErrorIs(t, err, service.ErrForbidden, "editors cannot take over accounts")
+	require.NoError(t, userService.SetPassword(actor.With(ctx, actor.User(admin.ID.String())), user.ID, "reset horse battery staple"))
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/auth"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/mail"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultVerificationTTL = 24 * time.Hour
+
+var (
+	// ErrInvalidStatus is returned for unknown user statuses.
+	ErrInvalidStatus = errors.New("invalid status")
+	// ErrStatusTransition is returned when a user cannot change from its current status to the requested one.
+	ErrStatusTransition = errors.New("status transition not allowed")
+	// ErrUserInactive is returned by Authenticate for the right password of a user who is not active.
+	ErrUserInactive = errors.New("user is not active")
+	// ErrInvalidVerificationToken is returned by VerifyEmail for malformed, unknown, used and expired tokens alike.
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+	// ErrVerificationDisabled is returned by SendVerification and VerifyEmail when emails are not verified.
+	ErrVerificationDisabled = errors.New("email verification is not enabled")
+)
+
+// verification mails single-use tokens stored in store to pending users.
+type verification struct {
+	store  repository.VerificationTokenStore
+	sender mail.Sender
+	from   string
+	ttl    time.Duration
+}
+
+// WithEmailVerification makes new users pending until they verify their email with a token kept in store and
+// sent by sender from the given address. Tokens expire after ttl, 24 hours when zero.
+func WithEmailVerification(store repository.VerificationTokenStore, sender mail.Sender, from string, ttl time.Duration) Option {
+	if ttl <= 0 {
+		ttl = defaultVerificationTTL
+	}
+	return func(s *UserService) {
+		s.verification = &verification{store: store, sender: sender, from: from, ttl: ttl}
+	}
+}
+
+// SetStatus changes the status of the user with the given ID, if its lifecycle allows it, and returns the user.
+// Suspended and disabled users are logged out as their refresh tokens are revoked.
+func (s *UserService) SetStatus(ctx context.Context, id uuid.UUID, status domain.UserStatus) (*domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.SetStatus")
+	defer span.End()
+
+	if !status.Valid() {
+		return nil, spanError(span, fmt.Errorf("%w: %q", ErrInvalidStatus, status))
+	}
+	if err := s.authorize(ctx, domain.PermUsersWrite, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to set status: %w", err))
+	}
+	u, err := s.setStatus(ctx, id, status)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to set status: %w", err))
+	}
+	return u, nil
+}
+
+// SendVerification mails a new verification token to the pending user with the given ID.
+func (s *UserService) SendVerification(ctx context.Context, id uuid.UUID) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.SendVerification")
+	defer span.End()
+
+	if s.verification == nil {
+		return spanError(span, ErrVerificationDisabled)
+	}
+	if err := s.authorize(ctx, domain.PermUsersWrite, id); err != nil {
+		return spanError(span, fmt.Errorf("failed to send verification: %w", err))
+	}
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return spanError(span, fmt.Errorf("failed to send verification: %w", err))
+	}
+	if user.Status != domain.StatusPending {
+		return spanError(span, fmt.Errorf("%w: user is already %s", ErrStatusTransition, user.Status))
+	}
+	if err := s.verification.send(ctx, user); err != nil {
+		return spanError(span, fmt.Errorf("failed to send verification: %w", err))
+	}
+	return nil
+}
+
+// VerifyEmail uses a verification token and activates its pending user, whom it returns. The token is the proof
+// of identity, so no permission is required; the change is audited as made by the user.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (*domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.VerifyEmail")
+	defer span.End()
+
+	if s.verification == nil {
+		return nil, spanError(span, ErrVerificationDisabled)
+	}
+	id, hash, err := auth.ParseOpaqueToken(token)
+	if err != nil {
+		return nil, spanError(span, ErrInvalidVerificationToken)
+	}
+	stored, err := s.verification.store.GetVerificationToken(ctx, id)
+	if errors.Is(err, repository.ErrVerificationTokenNotFound) {
+		return nil, spanError(span, ErrInvalidVerificationToken)
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to verify email: %w", err))
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(stored.TokenHash)) != 1 || !stored.Active(time.Now()) {
+		return nil, spanError(span, ErrInvalidVerificationToken)
+	}
+
+	if _, ok := actor.FromContext(ctx); !ok {
+		ctx = actor.With(ctx, actor.User(stored.UserID.String()))
+	}
+	// The token is used up front, so that concurrent verifications with it cannot both succeed.
+	if err := s.verification.store.UseVerificationToken(ctx, stored.ID); errors.Is(err, repository.ErrVerificationTokenNotFound) {
+		return nil, spanError(span, ErrInvalidVerificationToken)
+	} else if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to verify email: %w", err))
+	}
+	u, err := s.setStatus(ctx, stored.UserID, domain.StatusActive)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to verify email: %w", err))
+	}
+	return u, nil
+}
+
+// setStatus changes the status of a user along its lifecycle, without checking permissions.
+func (s *UserService) setStatus(ctx context.Context, id uuid.UUID, status domain.UserStatus) (*domain.User, error) {
+	u, err := s.write(ctx, domain.AuditUpdate, id, func(ctx context.Context, repo repository.UserRepository) (*domain.User, error) {
+		user, err := repo.GetUserByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if !user.Status.CanTransitionTo(status) {
+			return nil, fmt.Errorf("%w: from %s to %s", ErrStatusTransition, user.Status, status)
+		}
+		user.Status = status
+		return repo.UpdateUser(ctx, *user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == domain.StatusSuspended || status == domain.StatusDisabled {
+		if err := s.revokeSessions(ctx, id); err != nil {
+			// The status alone locks the user out: logins and refreshes both check it.
+			trace.SpanFromContext(ctx).RecordError(err)
+		}
+	}
+	return u, nil
+}
+
+// revokeSessions revokes the refresh tokens of a user when they are kept along with its credentials.
+// Its access tokens stay valid until they expire.
+func (s *UserService) revokeSessions(ctx context.Context, id uuid.UUID) error {
+	if s.credentials == nil {
+		return nil
+	}
+	store, ok := s.credentials.store.(repository.RefreshTokenStore)
+	if !ok {
+		return nil
+	}
+	if _, err := store.RevokeUserRefreshTokens(ctx, id); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// send stores a new verification token for user and mails it.
+func (v *verification) send(ctx context.Context, user *domain.User) error {
+	id, token, hash, err := auth.NewOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(v.ttl)
+	err = v.store.AddVerificationToken(ctx, domain.VerificationToken{
+		ID:        id,
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+	return v.sender.Send(ctx, mail.Message{
+		From:    v.from,
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\r\n\r\nPlease verify your email address with the following token, "+
+			"valid until %s:\r\n\r\n%s", user.Name, expiresAt.Format(time.RFC1123), token),
+	})
+}
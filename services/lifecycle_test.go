@@ -0,0 +1,196 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/mail"
+	"github.com/davidyannick/repository-pattern/password"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// outbox records the mails sent, as a mail.Sender.
+type outbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (o *outbox) Send(_ context.Context, msg mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+// lastToken returns the token at the end of the last mail sent.
+func (o *outbox) lastToken(t *testing.T) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	require.NotEmpty(t, o.messages)
+	fields := strings.Fields(o.messages[len(o.messages)-1].Body)
+	return fields[len(fields)-1]
+}
+
+func TestUserService_EmailVerification(t *testing.T) {
+	ctx := actor.With(tenant.WithID(t.Context(), "acme"), actor.Service("signup"))
+	repo := repository.NewMemoryRepository()
+	sent := &outbox{}
+	userService := service.NewUserService(repo, service.WithEmailVerification(repo, sent, "noreply@example.com", time.Hour))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusPending, user.Status)
+	require.Len(t, sent.messages, 1)
+	assert.Equal(t, "john@example.com", sent.messages[0].To)
+	assert.Equal(t, "noreply@example.com", sent.messages[0].From)
+	first := sent.lastToken(t)
+
+	// A new token does not invalidate the previous one.
+	require.NoError(t, userService.SendVerification(ctx, user.ID))
+	second := sent.lastToken(t)
+	assert.NotEqual(t, first, second)
+
+	anonymous := tenant.WithID(t.Context(), "acme")
+	_, err = userService.VerifyEmail(anonymous, "not-a-token")
+	require.ErrorIs(t, err, service.ErrInvalidVerificationToken)
+	_, err = userService.VerifyEmail(anonymous, uuid.NewString()+"."+strings.Repeat("A", 43))
+	require.ErrorIs(t, err, service.ErrInvalidVerificationToken)
+	_, err = userService.VerifyEmail(tenant.WithID(t.Context(), "other"), first)
+	require.ErrorIs(t, err, service.ErrInvalidVerificationToken)
+
+	verified, err := userService.VerifyEmail(anonymous, first)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusActive, verified.Status)
+	_, err = userService.VerifyEmail(anonymous, first)
+	require.ErrorIs(t, err, service.ErrInvalidVerificationToken, "tokens are single use")
+	_, err = userService.VerifyEmail(anonymous, second)
+	require.ErrorIs(t, err, service.ErrStatusTransition)
+	require.ErrorIs(t, userService.SendVerification(ctx, user.ID), service.ErrStatusTransition)
+
+	// Updates keep the status.
+	verified.Name = "John Smith"
+	verified.Status = domain.StatusDisabled
+	updated, err := userService.UpdateUser(ctx, *verified)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusActive, updated.Status)
+
+	// Users with a status are not verified.
+	imported, err := userService.AddUser(ctx, domain.User{Name: "Jane Doe", Email: "jane@example.com", Status: domain.StatusActive})
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusActive, imported.Status)
+	assert.Len(t, sent.messages, 2)
+	_, err = userService.AddUser(ctx, domain.User{Name: "Jim Doe", Email: "jim@example.com", Status: "banned"})
+	require.ErrorIs(t, err, service.ErrInvalidStatus)
+
+	_, err = service.NewUserService(repo).VerifyEmail(anonymous, first)
+	require.ErrorIs(t, err, service.ErrVerificationDisabled)
+}
+
+func TestUserService_UpdateEmail(t *testing.T) {
+	ctx := actor.With(tenant.WithID(t.Context(), "acme"), actor.Service("signup"))
+	repo := repository.NewMemoryRepository()
+	sent := &outbox{}
+	userService := service.NewUserService(repo, service.WithEmailVerification(repo, sent, "noreply@example.com", time.Hour))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	first := sent.lastToken(t)
+	require.NoError(t, userService.SendVerification(ctx, user.ID))
+	outstanding := sent.lastToken(t)
+	user, err = userService.VerifyEmail(ctx, first)
+	require.NoError(t, err)
+	require.Equal(t, domain.StatusActive, user.Status)
+
+	// Other changes keep the user active.
+	user.Name = "John Smith"
+	user, err = userService.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusActive, user.Status)
+	assert.Len(t, sent.messages, 2)
+
+	user.Email = "john@example.org"
+	user, err = userService.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusPending, user.Status, "a new email must be verified")
+	require.Len(t, sent.messages, 3)
+	assert.Equal(t, "john@example.org", sent.messages[2].To)
+
+	_, err = userService.VerifyEmail(ctx, outstanding)
+	require.ErrorIs(t, err, service.ErrInvalidVerificationToken, "the tokens sent to the previous email are revoked")
+	user, err = userService.VerifyEmail(ctx, sent.lastToken(t))
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusActive, user.Status)
+
+	// Suspended users stay suspended, with nothing to verify.
+	_, err = userService.SetStatus(ctx, user.ID, domain.StatusSuspended)
+	require.NoError(t, err)
+	user.Email = "john@example.net"
+	user, err = userService.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusSuspended, user.Status)
+	assert.Len(t, sent.messages, 3)
+}
+
+func TestUserService_SetStatus(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo := repository.NewMemoryRepository()
+	userService := service.NewUserService(repo,
+		service.WithAuthorization(repo),
+		service.WithCredentials(repo, password.NewHasher(password.WithArgon2id(fastArgon2))))
+
+	system := actor.With(ctx, actor.Service("bootstrap"))
+	admin, err := userService.AddUser(system, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, userService.SetRoles(system, admin.ID, domain.RoleAdmin))
+	user, err := userService.AddUser(system, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusActive, user.Status)
+	require.NoError(t, userService.SetPassword(system, user.ID, "correct horse battery staple"))
+	require.NoError(t, repo.AddRefreshToken(ctx, domain.RefreshToken{ID: uuid.New(), UserID: user.ID, TokenHash: "hash",
+		ExpiresAt: time.Now().Add(time.Hour), CreatedAt: time.Now()}))
+
+	asAdmin := actor.With(ctx, actor.User(admin.ID.String()))
+	asUser := actor.With(ctx, actor.User(user.ID.String()))
+	_, err = userService.SetStatus(asUser, user.ID, domain.StatusActive)
+	require.ErrorIs(t, err, service.ErrForbidden, "users do not change their own status")
+	_, err = userService.SetStatus(asAdmin, user.ID, "banned")
+	require.ErrorIs(t, err, service.ErrInvalidStatus)
+	_, err = userService.SetStatus(asAdmin, user.ID, domain.StatusPending)
+	require.ErrorIs(t, err, service.ErrStatusTransition)
+
+	suspended, err := userService.SetStatus(asAdmin, user.ID, domain.StatusSuspended)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusSuspended, suspended.Status)
+	_, err = userService.Authenticate(ctx, "john@example.com", "correct horse battery staple")
+	require.ErrorIs(t, err, service.ErrUserInactive)
+	_, err = userService.Authenticate(ctx, "john@example.com", "wrong horse battery staple")
+	require.ErrorIs(t, err, service.ErrInvalidCredentials, "the status is only told to who knows the password")
+	revoked, err := repo.RevokeUserRefreshTokens(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, revoked, "suspending a user revokes its refresh tokens")
+
+	_, err = userService.SetStatus(asAdmin, user.ID, domain.StatusActive)
+	require.NoError(t, err)
+	_, err = userService.Authenticate(ctx, "john@example.com", "correct horse battery staple")
+	require.NoError(t, err)
+
+	_, err = userService.SetStatus(asAdmin, user.ID, domain.StatusDisabled)
+	require.NoError(t, err)
+	_, err = userService.SetStatus(asAdmin, user.ID, domain.StatusActive)
+	require.ErrorIs(t, err, service.ErrStatusTransition, "disabling a user is final")
+	_, err = userService.AddUser(asAdmin, domain.User{ID: user.ID, Name: "John Doe", Email: "john@example.com", Status: domain.StatusActive})
+	require.ErrorIs(t, err, repository.ErrUserAlreadyExists, "creating a user cannot replace a disabled one")
+	_, err = userService.SetStatus(asAdmin, uuid.New(), domain.StatusActive)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
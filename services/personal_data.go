@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+)
+
+// UserExport is everything held about a user. Its JSON encoding is the archive answering a data access request.
+type UserExport struct {
+	ExportedAt time.Time `json:"exported_at"`
+	TenantID   string    `json:"tenant_id"`
+	// User is nil when the user was deleted but records about them remain.
+	User   *domain.User        `json:"user"`
+	Events []domain.Event      `json:"events"`
+	Audit  []domain.AuditEntry `json:"audit"`
+	repository.UserRecords
+}
+
+// ErasureReceipt is the proof that a user was erased. It holds no personal data, so it can be kept indefinitely.
+type ErasureReceipt struct {
+	ID       uuid.UUID                `json:"id"`
+	TenantID string                   `json:"tenant_id"`
+	UserID   uuid.UUID                `json:"user_id"`
+	ErasedAt time.Time                `json:"erased_at"`
+	Erased   repository.ErasureCounts `json:"erased"`
+	// CachesCleared is the number of caches the user was dropped from.
+	CachesCleared int `json:"caches_cleared"`
+}
+
+// WithPersonalData makes ExportUser include the events, roles, API keys and tokens of the user and EraseUser
+// delete or anonymize the records kept in store besides the user itself.
+func WithPersonalData(store repository.PersonalDataStore) Option {
+	return func(s *UserService) {
+		s.personal = store
+	}
+}
+
+// WithCaches adds caches that writes and EraseUser drop the user from. A cache the repository of the service
+// is or wraps must be given here too, since decorators hide it.
+func WithCaches(caches ...repository.Forgetter) Option {
+	return func(s *UserService) {
+		s.caches = append(s.caches, caches...)
+	}
+}
+
+// ExportUser returns everything held about the user with the given ID.
+func (s *UserService) ExportUser(ctx context.Context, id uuid.UUID) (*UserExport, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.ExportUser")
+	defer span.End()
+
+	if err := s.authorize(ctx, domain.PermUsersRead, id); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to export user: %w", err))
+	}
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to export user: %w", err))
+	}
+	export := &UserExport{
+		ExportedAt: time.Now().UTC(),
+		TenantID:   tenantID,
+		Events:     []domain.Event{},
+		Audit:      []domain.AuditEntry{},
+		UserRecords: repository.UserRecords{
+			Roles:              []domain.Role{},
+			APIKeys:            []domain.APIKey{},
+			RefreshTokens:      []domain.RefreshToken{},
+			VerificationTokens: []domain.VerificationToken{},
+		},
+	}
+	export.User, err = s.repo.GetUserByID(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, spanError(span, fmt.Errorf("failed to export user: %w", err))
+	}
+	if s.personal != nil {
+		if export.Events, err = s.personal.UserEvents(ctx, id); err != nil {
+			return nil, spanError(span, fmt.Errorf("failed to export user events: %w", err))
+		}
+		if export.UserRecords, err = s.personal.UserRecords(ctx, id); err != nil {
+			return nil, spanError(span, fmt.Errorf("failed to export user records: %w", err))
+		}
+	}
+	if s.audit != nil {
+		if export.Audit, err = s.fullAuditHistory(ctx, id); err != nil {
+			return nil, spanError(span, fmt.Errorf("failed to export user audit history: %w", err))
+		}
+	}
+	if export.User == nil && len(export.Events) == 0 && len(export.Audit) == 0 {
+		return nil, spanError(span, fmt.Errorf("failed to export user: %w", repository.ErrUserNotFound))
+	}
+	return export, nil
+}
+
+// EraseUser irreversibly erases the user with the given ID and returns the receipt of the erasure.
+// With WithPersonalData, the roles, API keys, tokens and credentials of the user are deleted with it and its
+// events, webhook deliveries and audit entries are anonymized; otherwise only the user is deleted. Either way
+// a UserErased event asks downstream systems to erase the user too. With WithAudit, the erasure itself is
+// audited, without values, in the same transaction.
+func (s *UserService) EraseUser(ctx context.Context, id uuid.UUID) (*ErasureReceipt, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.EraseUser")
+	defer span.End()
+
+	if err := s.authorize(ctx, domain.PermUsersDelete, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to erase user: %w", err))
+	}
+	tenantID, err := tenant.Require(ctx)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to erase user: %w", err))
+	}
+	var counts repository.ErasureCounts
+	if s.personal != nil {
+		var audit []domain.AuditEntry
+		if s.audit != nil {
+			audit = append(audit, domain.NewAuditEntry(domain.AuditErase, actor.Of(ctx), id, nil, nil))
+		}
+		counts, err = s.personal.ErasePersonalData(ctx, id, audit...)
+	} else {
+		_, err = s.write(ctx, domain.AuditErase, id, func(ctx context.Context, repo repository.UserRepository) (*domain.User, error) {
+			return nil, repo.DeleteUser(ctx, id)
+		})
+		counts.Users = 1
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to erase user: %w", err))
+	}
+
+	receipt := &ErasureReceipt{
+		ID:       uuid.New(),
+		TenantID: tenantID,
+		UserID:   id,
+		ErasedAt: time.Now().UTC(),
+		Erased:   counts,
+	}
+	receipt.CachesCleared = s.forget(ctx, id)
+	return receipt, nil
+}
+
+// forget drops the user from the caches given with WithCaches and returns their number.
+func (s *UserService) forget(ctx context.Context, id uuid.UUID) int {
+	for _, cache := range s.caches {
+		cache.Forget(ctx, id)
+	}
+	return len(s.caches)
+}
+
+func (s *UserService) fullAuditHistory(ctx context.Context, id uuid.UUID) ([]domain.AuditEntry, error) {
+	entries := make([]domain.AuditEntry, 0)
+	query := repository.AuditQuery{}
+	for {
+		page, err := s.audit.AuditHistory(ctx, id, query)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page.Entries...)
+		if page.Next == 0 {
+			return entries, nil
+		}
+		query.After = page.Next
+	}
+}
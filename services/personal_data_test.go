@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	mock_repository "github.com/davidyannick/repository-pattern/mocks"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestUserService_ExportAndEraseUser(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+	store, ok := repo.(interface {
+		repository.Transactor
+		repository.PersonalDataStore
+	})
+	require.True(t, ok)
+
+	// The cache is hidden behind a decorator, as in main, so it has to be given with WithCaches.
+	cache := repository.NewCachingRepository(repo)
+	decorated := repository.NewTracingRepository(cache, "sqlite")
+	userService := service.NewUserService(decorated, service.WithOutbox(store), service.WithPersonalData(store), service.WithCaches(cache))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "john@example.com"})
+	require.NoError(t, err)
+	user.Name = "Johnny Doe"
+	_, err = userService.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+
+	records, ok := repo.(interface {
+		repository.RoleStore
+		repository.APIKeyStore
+		repository.RefreshTokenStore
+		repository.VerificationTokenStore
+		repository.CredentialStore
+	})
+	require.True(t, ok)
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, records.SetRoles(ctx, user.ID, []domain.Role{domain.RoleEditor}))
+	apiKey := domain.APIKey{ID: uuid.New(), Prefix: "abc", KeyHash: "key-secret", Name: "ci", UserID: &user.ID,
+		Permissions: []domain.Permission{domain.PermUsersRead}, CreatedAt: now}
+	require.NoError(t, records.AddAPIKey(ctx, apiKey))
+	refreshToken := domain.RefreshToken{ID: uuid.New(), UserID: user.ID, TokenHash: "refresh-secret", ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	require.NoError(t, records.AddRefreshToken(ctx, refreshToken))
+	verificationToken := domain.VerificationToken{ID: uuid.New(), UserID: user.ID, TokenHash: "verification-secret",
+		ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	require.NoError(t, records.AddVerificationToken(ctx, verificationToken))
+	require.NoError(t, records.SetCredential(ctx, domain.Credential{UserID: user.ID, PasswordHash: "password-secret", UpdatedAt: now}))
+	// Cache the user, so that erasing it has to evict it.
+	_, err = userService.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+
+	export, err := userService.ExportUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "acme", export.TenantID)
+	assert.Equal(t, user, export.User)
+	require.Len(t, export.Events, 2)
+	assert.Equal(t, "Johnny Doe", export.Events[1].User.Name)
+	assert.Equal(t, []domain.Role{domain.RoleEditor}, export.Roles)
+	require.Len(t, export.APIKeys, 1)
+	assert.Equal(t, apiKey.ID, export.APIKeys[0].ID)
+	assert.Equal(t, "ci", export.APIKeys[0].Name)
+	require.Len(t, export.RefreshTokens, 1)
+	assert.Equal(t, refreshToken.ID, export.RefreshTokens[0].ID)
+	require.Len(t, export.VerificationTokens, 1)
+	assert.Equal(t, verificationToken.ID, export.VerificationTokens[0].ID)
+	archive, err := json.Marshal(export)
+	require.NoError(t, err)
+	assert.Contains(t, string(archive), "john@example.com")
+	assert.Contains(t, string(archive), `"roles":["editor"]`)
+	assert.NotContains(t, string(archive), "secret", "keys and tokens are exported without their hashes")
+
+	receipt, err := userService.EraseUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, receipt.UserID)
+	assert.Equal(t, "acme", receipt.TenantID)
+	assert.Equal(t, repository.ErasureCounts{Users: 1, Roles: 1, APIKeys: 1, RefreshTokens: 1, VerificationTokens: 1, Credentials: 1, Events: 2},
+		receipt.Erased)
+	assert.Equal(t, 1, receipt.CachesCleared)
+	encoded, err := json.Marshal(receipt)
+	require.NoError(t, err)
+	assert.NotContains(t, string(encoded), "john")
+
+	_, err = userService.GetUser(ctx, user.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	// The remaining events only carry the user ID.
+	export, err = userService.ExportUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, export.User)
+	assert.Empty(t, export.Roles)
+	assert.Empty(t, export.APIKeys)
+	assert.Empty(t, export.RefreshTokens)
+	assert.Empty(t, export.VerificationTokens)
+	_, err = records.GetCredential(ctx, user.ID)
+	require.ErrorIs(t, err, repository.ErrCredentialNotFound)
+	require.Len(t, export.Events, 3)
+	assert.Equal(t, domain.UserErased, export.Events[2].Type)
+	archive, err = json.Marshal(export)
+	require.NoError(t, err)
+	assert.NotContains(t, string(archive), "john")
+	assert.NotContains(t, string(archive), "John")
+
+	_, err = userService.ExportUser(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+	_, err = userService.EraseUser(ctx, uuid.New())
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestUserService_EraseUserWithoutPersonalData(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx := tenant.WithID(t.Context(), "acme")
+	id := uuid.New()
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+	mockRepo.EXPECT().DeleteUser(gomock.Any(), id).Return(nil)
+
+	receipt, err := service.NewUserService(mockRepo).EraseUser(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, repository.ErasureCounts{Users: 1}, receipt.Erased)
+	assert.Zero(t, receipt.CachesCleared)
+
+	_, err = service.NewUserService(mockRepo).EraseUser(t.Context(), id)
+	require.ErrorIs(t, err, tenant.ErrNoTenant)
+}
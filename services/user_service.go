@@ -2,36 +2,321 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/davidyannick/repository-pattern/actor"
 	"github.com/davidyannick/repository-pattern/domain"
 	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const tracerName = "github.com/davidyannick/repository-pattern/services"
+
+// tracer creates the spans of the services without a tracer of their own; it follows the global tracer provider.
+var tracer = otel.Tracer(tracerName)
+
 // UserService provides user-related business logic and interacts with the UserRepository.
 type UserService struct {
-	repo repository.UserRepository
+	repo     repository.UserRepository
+	outbox   repository.Transactor
+	personal repository.PersonalDataStore
+	caches   []repository.Forgetter
+	audit    repository.AuditStore
+	roles    repository.RoleStore
+	apiKeys  repository.APIKeyStore
+	tracer   trace.Tracer
+	// decorateTx wraps the repository of outbox transactions, when set.
+	decorateTx func(repository.UserRepository) repository.UserRepository
+	// credentials is nil unless WithCredentials is given.
+	credentials *credentials
+	// verification is nil unless WithEmailVerification is given.
+	verification *verification
+}
+
+// Option configures a UserService.
+type Option func(*UserService)
+
+// WithOutbox makes every write record its UserCreated, UserUpdated or UserDeleted event
+// in the outbox, in the same transaction as the change itself. Writes then go to outbox instead of the repository,
+// bypassing its decorators unless WithTxDecorator is given, and the user is dropped from the caches of the service,
+// the repository included, once the transaction is committed.
+func WithOutbox(outbox repository.Transactor) Option {
+	return func(s *UserService) {
+		s.outbox = outbox
+	}
+}
+
+// WithTxDecorator wraps the repository of every outbox transaction with decorate, so that writes made through
+// the outbox are traced, measured or logged like the ones made through the repository. decorate must not retry
+// calls, since a failed statement aborts the transaction.
+func WithTxDecorator(decorate func(repository.UserRepository) repository.UserRepository) Option {
+	return func(s *UserService) {
+		s.decorateTx = decorate
+	}
+}
+
+// WithAudit records every write in the audit trail of store, with the actor of its context and the fields
+// it changed. With an outbox whose transactions accept audit entries, they are recorded in the same transaction.
+func WithAudit(store repository.AuditStore) Option {
+	return func(s *UserService) {
+		s.audit = store
+	}
+}
+
+// WithTracerProvider sets the provider used to create spans instead of the global one.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *UserService) {
+		s.tracer = provider.Tracer(tracerName)
+	}
 }
 
 // NewUserService creates a new UserService with the given UserRepository.
-func NewUserService(repo repository.UserRepository) *UserService {
-	return &UserService{repo: repo}
+func NewUserService(repo repository.UserRepository, opts ...Option) *UserService {
+	s := &UserService{repo: repo, tracer: tracer}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// AddUser adds a new user to the repository.
+// AddUser adds a new user to the repository. Users without a status are active, or pending with
+// WithEmailVerification, in which case they are mailed a verification token.
 func (s *UserService) AddUser(ctx context.Context, user domain.User) (*domain.User, error) {
-	u, err := s.repo.AddUser(ctx, user)
+	ctx, span := s.tracer.Start(ctx, "UserService.AddUser")
+	defer span.End()
+
+	if user.Status != "" && !user.Status.Valid() {
+		return nil, spanError(span, fmt.Errorf("%w: %q", ErrInvalidStatus, user.Status))
+	}
+	if err := s.authorize(ctx, domain.PermUsersWrite, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to add user: %w", err))
+	}
+	if s.verification != nil && user.Status == "" {
+		user.Status = domain.StatusPending
+	}
+	u, err := s.write(ctx, domain.AuditCreate, user.ID, func(ctx context.Context, repo repository.UserRepository) (*domain.User, error) {
+		return repo.AddUser(ctx, user)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to add user: %w", err)
+		return nil, spanError(span, fmt.Errorf("failed to add user: %w", err))
+	}
+	if s.verification != nil && u.Status == domain.StatusPending {
+		// The user exists by now, and can ask for another token with SendVerification.
+		if err := s.verification.send(ctx, u); err != nil {
+			span.RecordError(fmt.Errorf("failed to send verification: %w", err))
+		}
 	}
 	return u, nil
 }
 
 // GetAllUsers retrieves all users from the repository.
 func (s *UserService) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetAllUsers")
+	defer span.End()
+
+	if err := s.authorize(ctx, domain.PermUsersRead, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get all users: %w", err))
+	}
 	users, err := s.repo.GetAllUsers(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all users: %w", err)
+		return nil, spanError(span, fmt.Errorf("failed to get all users: %w", err))
 	}
 	return users, nil
 }
+
+// GetUser retrieves the user with the given ID.
+func (s *UserService) GetUser(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetUser")
+	defer span.End()
+
+	if err := s.authorize(ctx, domain.PermUsersRead, id); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get user: %w", err))
+	}
+	u, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get user: %w", err))
+	}
+	return u, nil
+}
+
+// GetUserByEmail retrieves the user with the given email.
+func (s *UserService) GetUserByEmail(ctx context.Context, email string) (*domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.GetUserByEmail")
+	defer span.End()
+
+	u, err := s.repo.GetUserByEmail(ctx, email)
+	// Users may look themselves up, but whether an email is taken is only told to those allowed to read users.
+	self := uuid.Nil
+	if err == nil {
+		self = u.ID
+	}
+	if err := s.authorize(ctx, domain.PermUsersRead, self); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get user by email: %w", err))
+	}
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get user by email: %w", err))
+	}
+	return u, nil
+}
+
+// UpdateUser updates an existing user. Its status is kept: it changes with SetStatus and VerifyEmail only,
+// except that with email verification, a new email must be verified again. Active users then become pending,
+// the tokens sent to the previous email are revoked and a new one is sent.
+func (s *UserService) UpdateUser(ctx context.Context, user domain.User) (*domain.User, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.UpdateUser")
+	defer span.End()
+
+	user.Status = ""
+	if err := s.authorize(ctx, domain.PermUsersWrite, user.ID); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to update user: %w", err))
+	}
+	var emailChanged bool
+	u, err := s.write(ctx, domain.AuditUpdate, user.ID, func(ctx context.Context, repo repository.UserRepository) (*domain.User, error) {
+		if s.verification != nil {
+			current, err := repo.GetUserByID(ctx, user.ID)
+			if err != nil {
+				return nil, err
+			}
+			emailChanged = current.Email != user.Email
+			if emailChanged && current.Status == domain.StatusActive {
+				user.Status = domain.StatusPending
+			}
+		}
+		return repo.UpdateUser(ctx, user)
+	})
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to update user: %w", err))
+	}
+	if emailChanged {
+		if _, err := s.verification.store.RevokeUserVerificationTokens(ctx, u.ID); err != nil {
+			return nil, spanError(span, fmt.Errorf("failed to revoke verification tokens: %w", err))
+		}
+		if u.Status == domain.StatusPending {
+			if err := s.SendVerification(ctx, u.ID); err != nil {
+				return nil, spanError(span, fmt.Errorf("failed to update user: %w", err))
+			}
+		}
+	}
+	return u, nil
+}
+
+// DeleteUser deletes the user with the given ID.
+func (s *UserService) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	ctx, span := s.tracer.Start(ctx, "UserService.DeleteUser")
+	defer span.End()
+
+	if err := s.authorize(ctx, domain.PermUsersDelete, uuid.Nil); err != nil {
+		return spanError(span, fmt.Errorf("failed to delete user: %w", err))
+	}
+	_, err := s.write(ctx, domain.AuditDelete, id, func(ctx context.Context, repo repository.UserRepository) (*domain.User, error) {
+		return nil, repo.DeleteUser(ctx, id)
+	})
+	if err != nil {
+		return spanError(span, fmt.Errorf("failed to delete user: %w", err))
+	}
+	return nil
+}
+
+// ErrAuditDisabled is returned by AuditHistory when the service records no audit trail.
+var ErrAuditDisabled = errors.New("audit trail is not enabled")
+
+// AuditHistory returns a page of the audit trail of the user with the given ID, oldest change first.
+func (s *UserService) AuditHistory(ctx context.Context, id uuid.UUID, query repository.AuditQuery) (repository.AuditPage, error) {
+	ctx, span := s.tracer.Start(ctx, "UserService.AuditHistory")
+	defer span.End()
+
+	if err := s.authorize(ctx, domain.PermUsersRead, uuid.Nil); err != nil {
+		return repository.AuditPage{}, spanError(span, fmt.Errorf("failed to get audit history: %w", err))
+	}
+	if s.audit == nil {
+		return repository.AuditPage{}, spanError(span, ErrAuditDisabled)
+	}
+	page, err := s.audit.AuditHistory(ctx, id, query)
+	if err != nil {
+		return repository.AuditPage{}, spanError(span, fmt.Errorf("failed to get audit history: %w", err))
+	}
+	return page, nil
+}
+
+// eventTypes maps the action of a write to the event recorded in the outbox.
+var eventTypes = map[domain.AuditAction]domain.EventType{
+	domain.AuditCreate: domain.UserCreated,
+	domain.AuditUpdate: domain.UserUpdated,
+	domain.AuditDelete: domain.UserDeleted,
+	domain.AuditErase:  domain.UserErased,
+}
+
+// write applies op, which changes the user with the given ID (unknown before a creation) and returns it, nil once deleted.
+// With an outbox, op runs in a transaction that also records the event of the action, and the user is then
+// dropped from the caches the transaction bypassed.
+func (s *UserService) write(ctx context.Context, action domain.AuditAction, id uuid.UUID,
+	op func(context.Context, repository.UserRepository) (*domain.User, error)) (*domain.User, error) {
+	if s.outbox == nil {
+		return s.apply(ctx, s.repo, s.audit, action, id, op)
+	}
+	var u *domain.User
+	err := s.outbox.InTx(ctx, func(ctx context.Context, tx repository.Tx) (err error) {
+		var audit repository.AuditAppender = s.audit
+		if appender, ok := tx.(repository.AuditAppender); ok && s.audit != nil {
+			audit = appender
+		}
+		var repo repository.UserRepository = tx
+		if s.decorateTx != nil {
+			repo = s.decorateTx(tx)
+		}
+		if u, err = s.apply(ctx, repo, audit, action, id, op); err != nil {
+			return err
+		}
+		user := domain.User{ID: id}
+		if u != nil && action != domain.AuditErase {
+			user = *u
+		}
+		return tx.AppendEvents(ctx, domain.NewUserEvent(eventTypes[action], user))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if u != nil {
+		id = u.ID
+	}
+	s.forget(ctx, id)
+	return u, nil
+}
+
+// apply runs op on repo and records in audit, unless nil, the change it made. Erasures are recorded without values.
+func (s *UserService) apply(ctx context.Context, repo repository.UserRepository, audit repository.AuditAppender,
+	action domain.AuditAction, id uuid.UUID, op func(context.Context, repository.UserRepository) (*domain.User, error)) (*domain.User, error) {
+	if audit == nil {
+		return op(ctx, repo)
+	}
+	var before *domain.User
+	if id != uuid.Nil && action != domain.AuditErase {
+		u, err := repo.GetUserByID(ctx, id)
+		if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
+			return nil, err
+		}
+		before = u
+	}
+	after, err := op(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	if after != nil {
+		id = after.ID
+	}
+	if err := audit.AppendAudit(ctx, domain.NewAuditEntry(action, actor.Of(ctx), id, before, after)); err != nil {
+		return nil, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return after, nil
+}
+
+// spanError records err on the span and returns it unchanged.
+func spanError(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
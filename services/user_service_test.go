@@ -1,13 +1,21 @@
 package service_test
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/davidyannick/repository-pattern/domain"
 	mock_repository "github.com/davidyannick/repository-pattern/mocks"
+	"github.com/davidyannick/repository-pattern/repository"
 	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 
 	"go.uber.org/mock/gomock"
 )
@@ -46,3 +54,135 @@ func TestAddUser(t *testing.T) {
 	require.Equal(t, userAdded.Email, user.Email)
 	require.Equal(t, userAdded.ID, user.ID)
 }
+
+func TestAddUser_Tracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+	mockRepo.EXPECT().AddUser(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, user domain.User) (*domain.User, error) {
+		// The repository runs inside the service span
+		require.True(t, trace.SpanContextFromContext(ctx).IsValid())
+		return nil, errors.New("boom")
+	})
+
+	userService := service.NewUserService(mockRepo, service.WithTracerProvider(provider))
+
+	_, err := userService.AddUser(t.Context(), domain.User{Name: "John Doe", Email: "user@email.com"})
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	require.Equal(t, "UserService.AddUser", spans[0].Name)
+	require.Equal(t, codes.Error, spans[0].Status.Code)
+}
+
+func TestGetUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+	user := domain.User{ID: uuid.New(), Name: "John Doe", Email: "user@email.com"}
+	mockRepo.EXPECT().GetUserByID(gomock.Any(), user.ID).Return(&user, nil)
+	mockRepo.EXPECT().GetUserByEmail(gomock.Any(), "missing@email.com").Return(nil, repository.ErrUserNotFound)
+
+	userService := service.NewUserService(mockRepo)
+
+	found, err := userService.GetUser(t.Context(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, user, *found)
+
+	_, err = userService.GetUserByEmail(t.Context(), "missing@email.com")
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestUpdateAndDeleteUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockRepo := mock_repository.NewMockUserRepository(mockCtrl)
+	user := domain.User{ID: uuid.New(), Name: "John Doe", Email: "user@email.com"}
+	mockRepo.EXPECT().UpdateUser(gomock.Any(), user).Return(&user, nil)
+	mockRepo.EXPECT().DeleteUser(gomock.Any(), user.ID).Return(repository.ErrUserNotFound)
+
+	userService := service.NewUserService(mockRepo)
+
+	updated, err := userService.UpdateUser(t.Context(), user)
+	require.NoError(t, err)
+	require.Equal(t, user, *updated)
+
+	err = userService.DeleteUser(t.Context(), user.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func TestUserService_WithOutbox(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+	store, ok := repo.(interface {
+		repository.Transactor
+		repository.OutboxStore
+	})
+	require.True(t, ok)
+
+	userService := service.NewUserService(repo, service.WithOutbox(store))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "user@email.com"})
+	require.NoError(t, err)
+	user.Name = "Jane Doe"
+	_, err = userService.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	require.NoError(t, userService.DeleteUser(ctx, user.ID))
+
+	// A failed write records no event
+	err = userService.DeleteUser(ctx, user.ID)
+	require.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	pending, err := store.PendingEvents(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	require.Equal(t, domain.UserCreated, pending[0].Event.Type)
+	require.Equal(t, domain.UserUpdated, pending[1].Event.Type)
+	require.Equal(t, "Jane Doe", pending[1].Event.User.Name)
+	require.Equal(t, domain.UserDeleted, pending[2].Event.Type)
+	for _, record := range pending {
+		require.Equal(t, user.ID, record.Event.UserID)
+		require.Equal(t, "acme", record.Event.TenantID)
+	}
+}
+
+func TestUserService_WithOutboxKeepsDecoratorsAndCaches(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	repo, closeRepo, err := repository.Open(ctx, "sqlite://:memory:?migrate=true")
+	require.NoError(t, err)
+	defer closeRepo()
+	store, ok := repo.(repository.Transactor)
+	require.True(t, ok)
+
+	var decorated []repository.UserRepository
+	decorate := func(repo repository.UserRepository) repository.UserRepository {
+		decorated = append(decorated, repo)
+		return repo
+	}
+	cache := repository.NewCachingRepository(repo)
+	userService := service.NewUserService(cache, service.WithOutbox(store), service.WithTxDecorator(decorate), service.WithCaches(cache))
+
+	user, err := userService.AddUser(ctx, domain.User{Name: "John Doe", Email: "user@email.com"})
+	require.NoError(t, err)
+	_, err = userService.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	user.Name = "Jane Doe"
+	_, err = userService.UpdateUser(ctx, *user)
+	require.NoError(t, err)
+	require.Len(t, decorated, 2)
+
+	// The update went around the cache, which no longer holds the old name
+	found, err := userService.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Jane Doe", found.Name)
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/webhook"
+	"github.com/google/uuid"
+)
+
+// secretSize is the number of random bytes in a generated webhook secret.
+const secretSize = 32
+
+// ErrInvalidWebhook is returned when a subscription has an unusable URL or an unknown event type.
+var ErrInvalidWebhook = errors.New("invalid webhook subscription")
+
+// knownEventTypes lists the event types a subscription can ask for.
+var knownEventTypes = []domain.EventType{domain.UserCreated, domain.UserUpdated, domain.UserDeleted}
+
+// WebhookService manages webhook subscriptions and exposes their delivery logs.
+// Every operation requires the webhooks:manage permission.
+type WebhookService struct {
+	store repository.WebhookStore
+	roles repository.RoleStore
+}
+
+// WebhookOption configures a WebhookService.
+type WebhookOption func(*WebhookService)
+
+// WithWebhookAuthorization checks the permission of the actor of the context against the roles kept in store,
+// as WithAuthorization does for UserService. Without it, only the scope of the actor is checked.
+func WithWebhookAuthorization(store repository.RoleStore) WebhookOption {
+	return func(s *WebhookService) {
+		s.roles = store
+	}
+}
+
+// NewWebhookService creates a new WebhookService with the given WebhookStore.
+func NewWebhookService(store repository.WebhookStore, opts ...WebhookOption) *WebhookService {
+	s := &WebhookService{store: store}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Subscribe registers rawURL for the given event types, or for every event when none is given.
+// URLs pointing at localhost or at internal addresses are refused.
+// The returned subscription holds the generated secret used to sign its deliveries; it is only shown here.
+func (s *WebhookService) Subscribe(ctx context.Context, rawURL string, eventTypes ...domain.EventType) (*domain.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.Subscribe")
+	defer span.End()
+
+	if err := checkPermission(ctx, s.roles, domain.PermWebhooksManage, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to subscribe: %w", err))
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, spanError(span, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook))
+	}
+	if err := webhook.CheckHost(u.Hostname()); err != nil {
+		return nil, spanError(span, fmt.Errorf("%w: %w", ErrInvalidWebhook, err))
+	}
+	for _, t := range eventTypes {
+		if !slices.Contains(knownEventTypes, t) {
+			return nil, spanError(span, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, t))
+		}
+	}
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to generate webhook secret: %w", err))
+	}
+
+	sub, err := s.store.AddSubscription(ctx, domain.WebhookSubscription{
+		ID:         uuid.New(),
+		URL:        u.String(),
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to add subscription: %w", err))
+	}
+	return sub, nil
+}
+
+// Unsubscribe deletes the subscription with the given ID along with its deliveries.
+func (s *WebhookService) Unsubscribe(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "WebhookService.Unsubscribe")
+	defer span.End()
+
+	if err := checkPermission(ctx, s.roles, domain.PermWebhooksManage, uuid.Nil); err != nil {
+		return spanError(span, fmt.Errorf("failed to unsubscribe: %w", err))
+	}
+
+	if err := s.store.DeleteSubscription(ctx, id); err != nil {
+		return spanError(span, fmt.Errorf("failed to delete subscription: %w", err))
+	}
+	return nil
+}
+
+// ListSubscriptions returns every webhook subscription.
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]domain.WebhookSubscription, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ListSubscriptions")
+	defer span.End()
+
+	if err := checkPermission(ctx, s.roles, domain.PermWebhooksManage, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to list subscriptions: %w", err))
+	}
+
+	subs, err := s.store.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to list subscriptions: %w", err))
+	}
+	return subs, nil
+}
+
+// GetDelivery retrieves the delivery with the given ID.
+func (s *WebhookService) GetDelivery(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.GetDelivery")
+	defer span.End()
+
+	if err := checkPermission(ctx, s.roles, domain.PermWebhooksManage, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get delivery: %w", err))
+	}
+
+	d, err := s.store.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get delivery: %w", err))
+	}
+	return d, nil
+}
+
+// ListDeliveries returns the delivery log matching filter, most recent first.
+func (s *WebhookService) ListDeliveries(ctx context.Context, filter repository.DeliveryFilter) ([]domain.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.ListDeliveries")
+	defer span.End()
+
+	if err := checkPermission(ctx, s.roles, domain.PermWebhooksManage, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to list deliveries: %w", err))
+	}
+
+	deliveries, err := s.store.ListDeliveries(ctx, filter)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to list deliveries: %w", err))
+	}
+	return deliveries, nil
+}
+
+// DeadLetters returns the deliveries that ran out of attempts, most recent first.
+func (s *WebhookService) DeadLetters(ctx context.Context, limit int) ([]domain.WebhookDelivery, error) {
+	return s.ListDeliveries(ctx, repository.DeliveryFilter{Status: domain.DeliveryDead, Limit: limit})
+}
+
+// Redeliver queues a dead delivery again, with a fresh set of attempts.
+func (s *WebhookService) Redeliver(ctx context.Context, id uuid.UUID) (*domain.WebhookDelivery, error) {
+	ctx, span := tracer.Start(ctx, "WebhookService.Redeliver")
+	defer span.End()
+
+	if err := checkPermission(ctx, s.roles, domain.PermWebhooksManage, uuid.Nil); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to redeliver: %w", err))
+	}
+
+	d, err := s.store.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to get delivery: %w", err))
+	}
+	if d.Status != domain.DeliveryDead {
+		return nil, spanError(span, fmt.Errorf("%w: delivery %s is %s, not dead", ErrInvalidWebhook, id, d.Status))
+	}
+	now := time.Now().UTC()
+	d.Status = domain.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	d.UpdatedAt = now
+	if err := s.store.UpdateDelivery(ctx, *d); err != nil {
+		return nil, spanError(span, fmt.Errorf("failed to update delivery: %w", err))
+	}
+	return d, nil
+}
@@ -0,0 +1,109 @@
+package service_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/actor"
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	service "github.com/davidyannick/repository-pattern/services"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookService_Subscribe(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	webhooks := service.NewWebhookService(repository.NewMemoryRepository())
+
+	sub, err := webhooks.Subscribe(ctx, "https://example.com/hook", domain.UserCreated)
+	require.NoError(t, err)
+	assert.Len(t, sub.Secret, 64)
+	assert.Equal(t, []domain.EventType{domain.UserCreated}, sub.EventTypes)
+
+	for _, url := range []string{"ftp://example.com", "/hook", "not a url", "http://127.0.0.1:5432", "http://localhost/hook",
+		"http://169.254.169.254/latest/meta-data", "http://10.0.0.1/hook", "http://[::1]:8080/hook"} {
+		_, err := webhooks.Subscribe(ctx, url)
+		require.ErrorIs(t, err, service.ErrInvalidWebhook, url)
+	}
+	_, err = webhooks.Subscribe(ctx, "https://example.com/hook", "UserRenamed")
+	require.ErrorIs(t, err, service.ErrInvalidWebhook)
+
+	subs, err := webhooks.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+
+	require.NoError(t, webhooks.Unsubscribe(ctx, sub.ID))
+	require.ErrorIs(t, webhooks.Unsubscribe(ctx, sub.ID), repository.ErrSubscriptionNotFound)
+}
+
+func TestWebhookService_Redeliver(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	store := repository.NewMemoryRepository()
+	webhooks := service.NewWebhookService(store)
+
+	sub, err := webhooks.Subscribe(ctx, "https://example.com/hook")
+	require.NoError(t, err)
+	dead := domain.WebhookDelivery{
+		ID:             uuid.New(),
+		TenantID:       sub.TenantID,
+		SubscriptionID: sub.ID,
+		EventID:        uuid.New(),
+		EventType:      domain.UserCreated,
+		Status:         domain.DeliveryDead,
+		Attempts:       8,
+		NextAttemptAt:  time.Now(),
+	}
+	require.NoError(t, store.EnqueueDelivery(ctx, dead))
+
+	deadLetters, err := webhooks.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+
+	redelivered, err := webhooks.Redeliver(ctx, dead.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DeliveryPending, redelivered.Status)
+	assert.Zero(t, redelivered.Attempts)
+
+	got, err := webhooks.GetDelivery(ctx, dead.ID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.DeliveryPending, got.Status)
+	deadLetters, err = webhooks.DeadLetters(ctx, 10)
+	require.NoError(t, err)
+	assert.Empty(t, deadLetters)
+
+	_, err = webhooks.Redeliver(ctx, dead.ID)
+	require.ErrorIs(t, err, service.ErrInvalidWebhook)
+}
+
+func TestWebhookService_RequiresWebhooksManage(t *testing.T) {
+	ctx := tenant.WithID(t.Context(), "acme")
+	store := repository.NewMemoryRepository()
+	webhooks := service.NewWebhookService(store, service.WithWebhookAuthorization(store))
+	admin, err := store.AddUser(ctx, domain.User{Name: "Admin", Email: "admin@example.com"})
+	require.NoError(t, err)
+	editor, err := store.AddUser(ctx, domain.User{Name: "Editor", Email: "editor@example.com"})
+	require.NoError(t, err)
+	require.NoError(t, store.SetRoles(ctx, admin.ID, []domain.Role{domain.RoleAdmin}))
+	require.NoError(t, store.SetRoles(ctx, editor.ID, []domain.Role{domain.RoleEditor}))
+	asAdmin := actor.With(ctx, actor.User(admin.ID.String()))
+	asEditor := actor.With(ctx, actor.User(editor.ID.String()))
+
+	_, err = webhooks.Subscribe(asEditor, "https://example.com/hook")
+	require.ErrorIs(t, err, service.ErrForbidden)
+	sub, err := webhooks.Subscribe(asAdmin, "https://example.com/hook")
+	require.NoError(t, err)
+
+	_, err = webhooks.ListSubscriptions(asEditor)
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = webhooks.ListDeliveries(asEditor, repository.DeliveryFilter{})
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = webhooks.GetDelivery(asEditor, uuid.New())
+	require.ErrorIs(t, err, service.ErrForbidden)
+	_, err = webhooks.Redeliver(asEditor, uuid.New())
+	require.ErrorIs(t, err, service.ErrForbidden)
+	require.ErrorIs(t, webhooks.Unsubscribe(asEditor, sub.ID), service.ErrForbidden)
+	require.NoError(t, webhooks.Unsubscribe(asAdmin, sub.ID))
+}
@@ -0,0 +1,35 @@
+// Package tenant carries the tenant, the customer account owning the data, in a context.
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// Default is the tenant owning the users created before tenants were introduced.
+const Default = "default"
+
+// ErrNoTenant is returned when tenant-scoped data is accessed with a context carrying no tenant.
+var ErrNoTenant = errors.New("no tenant in context")
+
+type contextKey struct{}
+
+// WithID returns a copy of ctx scoped to the given tenant.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant of ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Require returns the tenant of ctx, or ErrNoTenant.
+func Require(ctx context.Context) (string, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return "", ErrNoTenant
+	}
+	return id, nil
+}
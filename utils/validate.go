@@ -3,6 +3,8 @@ package utils
 import (
 	"errors"
 	"net/mail"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/davidyannick/repository-pattern/domain"
 )
@@ -28,3 +30,42 @@ func ValidateUser(user domain.User) error {
 	}
 	return nil
 }
+
+const (
+	// MinPasswordLength is the minimum number of characters of a password.
+	MinPasswordLength = 12
+	// MaxPasswordLength is the maximum length of a password in bytes, the most bcrypt takes into account.
+	MaxPasswordLength = 72
+
+	// ErrPasswordTooShort represents a password shorter than MinPasswordLength.
+	ErrPasswordTooShort = "password too short"
+	// ErrPasswordTooLong represents a password longer than MaxPasswordLength.
+	ErrPasswordTooLong = "password too long"
+	// ErrPasswordTooSimple represents a password made of a single repeated character.
+	ErrPasswordTooSimple = "password too simple"
+	// ErrPasswordContainsIdentity represents a password containing the name or email of the user.
+	ErrPasswordContainsIdentity = "password contains user name or email"
+)
+
+// ValidatePassword checks that password is acceptable for user: long enough, not longer than bcrypt supports,
+// not a single repeated character and not containing the name or the local part of the email of the user.
+func ValidatePassword(user domain.User, password string) error {
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		return errors.New(ErrPasswordTooShort)
+	}
+	if len(password) > MaxPasswordLength {
+		return errors.New(ErrPasswordTooLong)
+	}
+	first, _ := utf8.DecodeRuneInString(password)
+	if strings.Trim(password, string(first)) == "" {
+		return errors.New(ErrPasswordTooSimple)
+	}
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(user.Email, "@")
+	for _, identity := range []string{user.Name, local} {
+		if len(identity) >= 3 && strings.Contains(lower, strings.ToLower(identity)) {
+			return errors.New(ErrPasswordContainsIdentity)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a webhook URL points at an address deliveries must not reach.
+var ErrForbiddenAddress = errors.New("address is not allowed for webhooks")
+
+// PublicAddr reports whether deliveries may be posted to addr. Loopback, link-local, private, unspecified and
+// multicast addresses are refused, so that subscribers cannot reach the internal network.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// CheckHost returns ErrForbiddenAddress when host, as found in a subscription URL, is localhost or an address refused
+// by PublicAddr. Other host names are only resolved, and checked, when the worker dials them.
+func CheckHost(host string) error {
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	if name == "localhost" || strings.HasSuffix(name, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil && !PublicAddr(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// dialControl returns a net.Dialer Control function refusing the addresses not allowed by allow. It runs on the
+// resolved address of every connection, so that a host name resolving to an internal address is refused too.
+func dialControl(allow func(netip.Addr) bool) func(network, address string, _ syscall.RawConn) error {
+	return func(_, address string, _ syscall.RawConn) error {
+		addrPort, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+		}
+		if !allow(addrPort.Addr()) {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+		}
+		return nil
+	}
+}
+
+// newClient returns the default delivery client: it times out, does not follow redirects and only dials the
+// addresses allowed by allow. It ignores the proxy of the environment, whose address would be checked instead.
+func newClient(allow func(netip.Addr) bool) *http.Client {
+	dialer := &net.Dialer{Timeout: defaultTimeout, KeepAlive: 30 * time.Second, Control: dialControl(allow)}
+	return &http.Client{
+		Timeout: defaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
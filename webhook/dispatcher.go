@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/google/uuid"
+)
+
+// Dispatcher queues a delivery of each event for every subscription of its tenant interested in it.
+// It implements outbox.Publisher, so that webhooks are fed by the outbox relay.
+type Dispatcher struct {
+	store repository.WebhookStore
+}
+
+// NewDispatcher creates a Dispatcher queuing deliveries in store.
+func NewDispatcher(store repository.WebhookStore) *Dispatcher {
+	return &Dispatcher{store: store}
+}
+
+// Publish queues a pending delivery of event for the matching subscriptions of the event tenant. Publishing the same
+// event again does not queue it twice. Events recorded before tenants carry none and go to the default tenant.
+func (d *Dispatcher) Publish(ctx context.Context, event domain.Event) error {
+	tenantID := event.TenantID
+	if tenantID == "" {
+		tenantID = tenant.Default
+	}
+	subs, err := d.store.ListSubscriptions(tenant.WithID(ctx, tenantID))
+	if err != nil {
+		return fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, sub := range subs {
+		if !sub.Matches(event.Type) {
+			continue
+		}
+		err := d.store.EnqueueDelivery(ctx, domain.WebhookDelivery{
+			ID:             uuid.New(),
+			TenantID:       sub.TenantID,
+			SubscriptionID: sub.ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        payload,
+			Status:         domain.DeliveryPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enqueue delivery to %s: %w", sub.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package webhook delivers user events to the URLs subscribed to them, signed with the subscription secret.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	DeliveryHeader  = "X-Webhook-ID"
+	EventHeader     = "X-Webhook-Event"
+)
+
+// ErrInvalidSignature is returned by Verify when the signature header does not match the body.
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the value of the signature header for body sent at timestamp: "t=<unix seconds>,v1=<hex HMAC-SHA256>".
+// The HMAC covers "<unix seconds>.<body>", so that a captured request cannot be replayed later with another timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify checks a signature header produced by Sign. Signatures older or newer than tolerance are rejected,
+// unless tolerance is zero.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var (
+		ts   string
+		sigs [][]byte
+	)
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if age := now.Sub(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+
+	expected := mac(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
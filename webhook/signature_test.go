@@ -0,0 +1,22 @@
+package webhook_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"UserCreated"}`)
+	now := time.Now()
+	header := webhook.Sign("secret", now, body)
+
+	require.NoError(t, webhook.Verify("secret", header, body, now, time.Minute))
+	require.ErrorIs(t, webhook.Verify("other", header, body, now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", header, []byte(`{}`), now, time.Minute), webhook.ErrInvalidSignature)
+	require.ErrorIs(t, webhook.Verify("secret", header, body, now.Add(time.Hour), time.Minute), webhook.ErrInvalidSignature)
+	require.NoError(t, webhook.Verify("secret", header, body, now.Add(time.Hour), 0))
+	require.ErrorIs(t, webhook.Verify("secret", "v1=abc", body, now, 0), webhook.ErrInvalidSignature)
+}
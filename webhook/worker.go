@@ -0,0 +1,260 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultMaxAttempts  = 8
+	defaultBackoffBase  = 10 * time.Second
+	defaultBackoffMax   = time.Hour
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 50
+	defaultConcurrency  = 4
+	defaultTimeout      = 10 * time.Second
+
+	// maxErrorLength bounds the response excerpt kept in WebhookDelivery.LastError.
+	maxErrorLength = 512
+)
+
+// Worker posts the due deliveries to their subscription URL. A delivery answered with a 2xx status succeeds;
+// any other outcome is retried with exponential backoff until the maximum number of attempts is reached,
+// after which the delivery is dead and only comes back through a manual redelivery.
+// Only one Worker should process a given store.
+type Worker struct {
+	store       repository.WebhookStore
+	client      *http.Client
+	allowAddr   func(netip.Addr) bool
+	logger      *slog.Logger
+	maxAttempts int
+	backoffBase time.Duration
+	backoffMax  time.Duration
+	interval    time.Duration
+	batchSize   int
+	concurrency int
+}
+
+// WorkerOption configures a Worker.
+type WorkerOption func(*Worker)
+
+// WithHTTPClient sets the client used to post deliveries. The default one times out after 10 seconds, only dials
+// the addresses allowed by WithAddressFilter and does not follow redirects, which count as failed attempts, so that
+// a subscriber cannot point deliveries at another host.
+func WithHTTPClient(client *http.Client) WorkerOption {
+	return func(w *Worker) {
+		w.client = client
+	}
+}
+
+// WithAddressFilter sets the addresses the default client may dial, the ones allowed by PublicAddr by default.
+func WithAddressFilter(allow func(netip.Addr) bool) WorkerOption {
+	return func(w *Worker) {
+		w.allowAddr = allow
+	}
+}
+
+// WithMaxAttempts sets how many times a delivery is attempted before it is dead.
+func WithMaxAttempts(n int) WorkerOption {
+	return func(w *Worker) {
+		w.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay after the first failed attempt, doubled after each further failure up to maxDelay.
+func WithBackoff(base, maxDelay time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.backoffBase = base
+		w.backoffMax = maxDelay
+	}
+}
+
+// WithPollInterval sets how long the worker waits before looking for due deliveries again.
+func WithPollInterval(d time.Duration) WorkerOption {
+	return func(w *Worker) {
+		w.interval = d
+	}
+}
+
+// WithBatchSize sets the maximum number of due deliveries read at once.
+func WithBatchSize(n int) WorkerOption {
+	return func(w *Worker) {
+		w.batchSize = n
+	}
+}
+
+// WithConcurrency sets how many deliveries are posted concurrently.
+func WithConcurrency(n int) WorkerOption {
+	return func(w *Worker) {
+		w.concurrency = n
+	}
+}
+
+// WithLogger sets the logger used to report failed attempts.
+func WithLogger(logger *slog.Logger) WorkerOption {
+	return func(w *Worker) {
+		w.logger = logger
+	}
+}
+
+// NewWorker creates a Worker delivering the deliveries queued in store.
+func NewWorker(store repository.WebhookStore, opts ...WorkerOption) *Worker {
+	w := &Worker{
+		store:       store,
+		allowAddr:   PublicAddr,
+		logger:      slog.Default(),
+		maxAttempts: defaultMaxAttempts,
+		backoffBase: defaultBackoffBase,
+		backoffMax:  defaultBackoffMax,
+		interval:    defaultPollInterval,
+		batchSize:   defaultBatchSize,
+		concurrency: defaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.client == nil {
+		w.client = newClient(w.allowAddr)
+	}
+	return w
+}
+
+// Run delivers the due deliveries until ctx is canceled. A full batch is followed immediately by the next one.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		n, err := w.ProcessDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.ErrorContext(ctx, "webhook processing failed", slog.String("error", err.Error()))
+		}
+		if err == nil && n == w.batchSize {
+			continue
+		}
+
+		timer := time.NewTimer(w.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// ProcessDue attempts one batch of due deliveries and returns how many were attempted.
+// Failed attempts are recorded on the deliveries; the error only reports store failures.
+func (w *Worker) ProcessDue(ctx context.Context) (int, error) {
+	due, err := w.store.DueDeliveries(ctx, time.Now().UTC(), w.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read due deliveries: %w", err)
+	}
+
+	var g errgroup.Group
+	g.SetLimit(max(w.concurrency, 1))
+	errs := make([]error, len(due))
+	for i, d := range due {
+		g.Go(func() error {
+			errs[i] = w.attempt(ctx, d)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return len(due), errors.Join(errs...)
+}
+
+// attempt posts d once and saves the outcome.
+func (w *Worker) attempt(ctx context.Context, d domain.WebhookDelivery) error {
+	d.Attempts++
+	sub, err := w.store.GetSubscription(tenant.WithID(ctx, d.TenantID), d.SubscriptionID)
+	switch {
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		d.Status = domain.DeliveryDead
+		d.LastError = "subscription not found"
+	case err != nil:
+		return fmt.Errorf("failed to get subscription %s: %w", d.SubscriptionID, err)
+	default:
+		d.ResponseCode, err = w.post(ctx, sub, d)
+		if err == nil {
+			d.Status = domain.DeliverySucceeded
+			d.LastError = ""
+		} else {
+			d.LastError = truncate(err.Error(), maxErrorLength)
+			if d.Attempts >= w.maxAttempts {
+				d.Status = domain.DeliveryDead
+			} else {
+				d.NextAttemptAt = time.Now().Add(w.backoff(d.Attempts)).UTC()
+			}
+			w.logger.WarnContext(ctx, "webhook delivery failed",
+				slog.String("delivery_id", d.ID.String()),
+				slog.String("subscription_id", d.SubscriptionID.String()),
+				slog.Int("attempts", d.Attempts),
+				slog.String("status", string(d.Status)),
+				slog.String("error", d.LastError),
+			)
+		}
+	}
+
+	d.UpdatedAt = time.Now().UTC()
+	if err := w.store.UpdateDelivery(ctx, d); err != nil {
+		return fmt.Errorf("failed to update delivery %s: %w", d.ID, err)
+	}
+	return nil
+}
+
+// post sends the payload of d to the subscription URL and returns the response status code.
+func (w *Worker) post(ctx context.Context, sub *domain.WebhookSubscription, d domain.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, d.ID.String())
+	req.Header.Set(EventHeader, string(d.EventType))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, time.Now(), d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to post delivery: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorLength))
+		return resp.StatusCode, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+	return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+}
+
+// backoff returns the delay before the attempt following the given number of attempts:
+// the exponential delay with up to half of it randomized, so that failing endpoints are not retried in lockstep.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.backoffBase
+	for i := 1; i < attempts && delay < w.backoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.backoffMax)
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int64N(half+1)) // #nosec G404 -- jitter does not need a secure source
+	}
+	return delay
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
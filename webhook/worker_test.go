@@ -0,0 +1,237 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/davidyannick/repository-pattern/domain"
+	"github.com/davidyannick/repository-pattern/repository"
+	"github.com/davidyannick/repository-pattern/tenant"
+	"github.com/davidyannick/repository-pattern/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	return tenant.WithID(t.Context(), "acme")
+}
+
+// userEvent returns an event of a user of the acme tenant.
+func userEvent(eventType domain.EventType, user domain.User) domain.Event {
+	event := domain.NewUserEvent(eventType, user)
+	event.TenantID = "acme"
+	return event
+}
+
+func subscribe(t *testing.T, ctx context.Context, store repository.WebhookStore, url string, eventTypes ...domain.EventType) *domain.WebhookSubscription {
+	t.Helper()
+	sub, err := store.AddSubscription(ctx, domain.WebhookSubscription{
+		URL:        url,
+		Secret:     "secret",
+		EventTypes: eventTypes,
+		CreatedAt:  time.Now().UTC(),
+	})
+	require.NoError(t, err)
+	return sub
+}
+
+// newWorker returns a worker allowed to post to the loopback test servers.
+func newWorker(store repository.WebhookStore, opts ...webhook.WorkerOption) *webhook.Worker {
+	opts = append([]webhook.WorkerOption{
+		webhook.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		webhook.WithBackoff(0, 0),
+		webhook.WithAddressFilter(netip.Addr.IsLoopback),
+	}, opts...)
+	return webhook.NewWorker(store, opts...)
+}
+
+func TestDispatcher_Publish(t *testing.T) {
+	ctx := testContext(t)
+	store := repository.NewMemoryRepository()
+	all := subscribe(t, ctx, store, "https://example.com/all")
+	deleted := subscribe(t, ctx, store, "https://example.com/deleted", domain.UserDeleted)
+	globex := tenant.WithID(t.Context(), "globex")
+	subscribe(t, globex, store, "https://example.com/globex")
+
+	dispatcher := webhook.NewDispatcher(store)
+	event := userEvent(domain.UserCreated, domain.User{Name: "Test User"})
+	require.NoError(t, dispatcher.Publish(ctx, event))
+	// Published again by the relay after a crash: not queued twice.
+	require.NoError(t, dispatcher.Publish(ctx, event))
+
+	deliveries, err := store.ListDeliveries(ctx, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, all.ID, deliveries[0].SubscriptionID)
+	assert.Equal(t, event.ID, deliveries[0].EventID)
+	assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+
+	none, err := store.ListDeliveries(ctx, repository.DeliveryFilter{SubscriptionID: deleted.ID})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+	none, err = store.ListDeliveries(globex, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, none, "events only go to the subscriptions of their tenant")
+}
+
+func TestWorker_Delivers(t *testing.T) {
+	ctx := testContext(t)
+	store := repository.NewMemoryRepository()
+
+	received := make(chan *http.Request, 1)
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		received <- r
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	subscribe(t, ctx, store, server.URL)
+	event := userEvent(domain.UserCreated, domain.User{Name: "Test User"})
+	require.NoError(t, webhook.NewDispatcher(store).Publish(ctx, event))
+
+	// The worker serves every tenant.
+	n, err := newWorker(store).ProcessDue(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	req := <-received
+	assert.Equal(t, string(domain.UserCreated), req.Header.Get(webhook.EventHeader))
+	require.NoError(t, webhook.Verify("secret", req.Header.Get(webhook.SignatureHeader), body, time.Now(), time.Minute))
+
+	deliveries, err := store.ListDeliveries(ctx, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, req.Header.Get(webhook.DeliveryHeader), deliveries[0].ID.String())
+	assert.Equal(t, domain.DeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseCode)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+}
+
+func TestWorker_RetriesThenDeadLetters(t *testing.T) {
+	ctx := testContext(t)
+	store := repository.NewMemoryRepository()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	subscribe(t, ctx, store, server.URL)
+	require.NoError(t, webhook.NewDispatcher(store).Publish(ctx, userEvent(domain.UserDeleted, domain.User{})))
+
+	worker := newWorker(store, webhook.WithMaxAttempts(3))
+	for range 5 {
+		_, err := worker.ProcessDue(ctx)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+
+	deliveries, err := store.ListDeliveries(ctx, repository.DeliveryFilter{Status: domain.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 3, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[0].ResponseCode)
+	assert.Contains(t, deliveries[0].LastError, "unavailable")
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	ctx := testContext(t)
+	store := repository.NewMemoryRepository()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	subscribe(t, ctx, store, server.URL)
+	require.NoError(t, webhook.NewDispatcher(store).Publish(ctx, userEvent(domain.UserCreated, domain.User{})))
+
+	worker := newWorker(store, webhook.WithBackoff(time.Hour, 2*time.Hour))
+	_, err := worker.ProcessDue(ctx)
+	require.NoError(t, err)
+
+	// The failed delivery is not due again before half of the base delay.
+	n, err := worker.ProcessDue(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	deliveries, err := store.ListDeliveries(ctx, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+	assert.WithinRange(t, deliveries[0].NextAttemptAt, time.Now().Add(29*time.Minute), time.Now().Add(time.Hour))
+}
+
+func TestWorker_DoesNotFollowRedirects(t *testing.T) {
+	ctx := testContext(t)
+	store := repository.NewMemoryRepository()
+
+	var followed atomic.Bool
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		followed.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer target.Close()
+	server := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer server.Close()
+
+	subscribe(t, ctx, store, server.URL)
+	require.NoError(t, webhook.NewDispatcher(store).Publish(ctx, userEvent(domain.UserCreated, domain.User{})))
+	_, err := newWorker(store).ProcessDue(ctx)
+	require.NoError(t, err)
+
+	assert.False(t, followed.Load())
+	deliveries, err := store.ListDeliveries(ctx, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+	assert.Equal(t, http.StatusTemporaryRedirect, deliveries[0].ResponseCode)
+}
+
+func TestWorker_RefusesInternalAddresses(t *testing.T) {
+	ctx := testContext(t)
+	store := repository.NewMemoryRepository()
+
+	var reached atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		reached.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// Stored directly, the subscription stands for a host name that resolved to a public address when subscribing
+	// and resolves to a loopback one now, as with DNS rebinding.
+	subscribe(t, ctx, store, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+	require.NoError(t, webhook.NewDispatcher(store).Publish(ctx, userEvent(domain.UserCreated, domain.User{})))
+	_, err := newWorker(store, webhook.WithAddressFilter(webhook.PublicAddr)).ProcessDue(ctx)
+	require.NoError(t, err)
+
+	assert.False(t, reached.Load())
+	deliveries, err := store.ListDeliveries(ctx, repository.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, domain.DeliveryPending, deliveries[0].Status)
+	assert.Zero(t, deliveries[0].ResponseCode)
+	assert.Contains(t, deliveries[0].LastError, webhook.ErrForbiddenAddress.Error())
+}
+
+func TestCheckHost(t *testing.T) {
+	for _, host := range []string{"127.0.0.1", "localhost", "api.localhost", "10.0.0.1", "192.168.1.10", "169.254.169.254",
+		"0.0.0.0", "[::1]", "[fd00::1]", "[fe80::1]", "[::ffff:127.0.0.1]", "224.0.0.1"} {
+		require.ErrorIs(t, webhook.CheckHost(host), webhook.ErrForbiddenAddress, host)
+	}
+	for _, host := range []string{"example.com", "93.184.216.34", "[2606:2800:220:1:248:1893:25c8:1946]"} {
+		require.NoError(t, webhook.CheckHost(host), host)
+	}
+}